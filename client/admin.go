@@ -0,0 +1,234 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QuotaUsage 一个配额范围（用户或目录）的用量与上限，上限为 0 表示不限
+type QuotaUsage struct {
+	Path      string `json:"path"`
+	UsedBytes int64  `json:"used_bytes"`
+	UsedFiles int64  `json:"used_files"`
+	MaxBytes  int64  `json:"max_bytes"`
+	MaxFiles  int64  `json:"max_files"`
+}
+
+// Quota 当前用户的用户级配额与各目录配额
+type Quota struct {
+	User    QuotaUsage   `json:"user"`
+	Folders []QuotaUsage `json:"folders"`
+}
+
+// Quota 查看当前用户的配额与用量
+func (c *Client) Quota(ctx context.Context) (*Quota, error) {
+	q := &Quota{}
+	if err := c.call(ctx, http.MethodGet, "/quota", nil, nil, q); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// SetQuota 设置配额：path 为空时是用户级配额（仅管理员），userID 为 0 表示当前用户
+func (c *Client) SetQuota(ctx context.Context, userID int64, p string, maxBytes, maxFiles int64) error {
+	query := url.Values{"path": {p}}
+	setInt(query, "user_id", userID)
+	return c.call(ctx, http.MethodPut, "/quota", query, map[string]int64{"max_bytes": maxBytes, "max_files": maxFiles}, nil)
+}
+
+// DeleteQuota 删除配额
+func (c *Client) DeleteQuota(ctx context.Context, userID int64, p string) error {
+	query := url.Values{"path": {p}}
+	setInt(query, "user_id", userID)
+	return c.call(ctx, http.MethodDelete, "/quota", query, nil, nil)
+}
+
+// AuditEntry 一条审计日志
+type AuditEntry struct {
+	ID       int64           `json:"id"`
+	At       time.Time       `json:"at"`
+	UserID   int64           `json:"user_id,omitempty"`
+	Username string          `json:"username"`
+	ClientIP string          `json:"client_ip"`
+	Via      string          `json:"via"`
+	Action   string          `json:"action"`
+	OwnerID  int64           `json:"owner_id,omitempty"`
+	NodeID   int64           `json:"node_id,omitempty"`
+	Path     string          `json:"path,omitempty"`
+	OldPath  string          `json:"old_path,omitempty"`
+	Detail   json.RawMessage `json:"detail,omitempty"`
+}
+
+// AuditQuery 审计日志的筛选条件，零值表示不限
+type AuditQuery struct {
+	User    string // 用户名或用户 ID
+	OwnerID int64  // 命名空间所有者（管理员）
+	Path    string // 子树
+	Actions []string
+	From    time.Time
+	To      time.Time
+	Before  int64 // 上一页的 NextBefore
+	Limit   int
+}
+
+func (q *AuditQuery) values() url.Values {
+	query := url.Values{}
+	if q == nil {
+		return query
+	}
+	if q.User != "" {
+		query.Set("user", q.User)
+	}
+	setInt(query, "owner", q.OwnerID)
+	if q.Path != "" {
+		query.Set("path", q.Path)
+	}
+	if len(q.Actions) > 0 {
+		query.Set("action", strings.Join(q.Actions, ","))
+	}
+	if !q.From.IsZero() {
+		query.Set("from", q.From.Format(time.RFC3339))
+	}
+	if !q.To.IsZero() {
+		query.Set("to", q.To.Format(time.RFC3339))
+	}
+	setInt(query, "before", q.Before)
+	setInt(query, "limit", int64(q.Limit))
+	return query
+}
+
+// Audit 查询审计日志，按 ID 倒序分页
+func (c *Client) Audit(ctx context.Context, q *AuditQuery) (*Page[AuditEntry], error) {
+	resp := &Page[AuditEntry]{}
+	if err := c.call(ctx, http.MethodGet, "/audit", q.values(), nil, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// AuditExport 流式导出符合条件的全部审计日志（不分页），每条调用一次 fn，fn 返回错误时停止
+func (c *Client) AuditExport(ctx context.Context, q *AuditQuery, fn func(AuditEntry) error) error {
+	query := q.values()
+	query.Del("before")
+	query.Del("limit")
+	resp, err := c.stream(ctx, http.MethodGet, "/audit/export", query, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	dec := json.NewDecoder(bufio.NewReader(resp.Body))
+	for {
+		var e AuditEntry
+		if err := dec.Decode(&e); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+}
+
+// Webhook 变更通知的订阅，Events 为空表示全部事件类型
+type Webhook struct {
+	ID         int64     `json:"id"`
+	URL        string    `json:"url"`
+	PathPrefix string    `json:"path_prefix"`
+	Events     []string  `json:"events"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// CreateWebhook 创建 Webhook，secret 为空时由服务器生成；返回 ID 与签名密钥
+func (c *Client) CreateWebhook(ctx context.Context, rawURL, pathPrefix string, events []string, secret string) (int64, string, error) {
+	req := map[string]any{"url": rawURL, "path_prefix": pathPrefix, "events": events}
+	if secret != "" {
+		req["secret"] = secret
+	}
+	var resp struct {
+		ID     int64  `json:"id"`
+		Secret string `json:"secret"`
+	}
+	if err := c.call(ctx, http.MethodPost, "/webhooks", nil, req, &resp); err != nil {
+		return 0, "", err
+	}
+	return resp.ID, resp.Secret, nil
+}
+
+// Webhooks 列出当前命名空间的 Webhook
+func (c *Client) Webhooks(ctx context.Context) ([]Webhook, error) {
+	resp := &Page[Webhook]{}
+	if err := c.call(ctx, http.MethodGet, "/webhooks", nil, nil, resp); err != nil {
+		return nil, err
+	}
+	return resp.Items, nil
+}
+
+// WebhookUpdate 修改 Webhook，nil 字段保持不变
+type WebhookUpdate struct {
+	URL        *string   `json:"url,omitempty"`
+	PathPrefix *string   `json:"path_prefix,omitempty"`
+	Events     *[]string `json:"events,omitempty"`
+	Active     *bool     `json:"active,omitempty"`
+}
+
+// UpdateWebhook 修改 Webhook
+func (c *Client) UpdateWebhook(ctx context.Context, id int64, update WebhookUpdate) error {
+	return c.call(ctx, http.MethodPut, "/webhooks/"+strconv.FormatInt(id, 10), nil, update, nil)
+}
+
+// DeleteWebhook 删除 Webhook
+func (c *Client) DeleteWebhook(ctx context.Context, id int64) error {
+	return c.call(ctx, http.MethodDelete, "/webhooks/"+strconv.FormatInt(id, 10), nil, nil, nil)
+}
+
+// WebhookDelivery 一次投递，Status 为 pending、delivered 或 dead
+type WebhookDelivery struct {
+	ID            int64      `json:"id"`
+	WebhookID     int64      `json:"webhook_id"`
+	ChangeID      int64      `json:"change_id"`
+	EventType     string     `json:"event_type"`
+	Path          string     `json:"path"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	LastStatus    int        `json:"last_status,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+}
+
+// WebhookDeliveries 列出 Webhook 的投递记录，status 为空表示全部
+func (c *Client) WebhookDeliveries(ctx context.Context, id int64, status string) ([]WebhookDelivery, error) {
+	query := url.Values{}
+	if status != "" {
+		query.Set("status", status)
+	}
+	return c.deliveries(ctx, "/webhooks/"+strconv.FormatInt(id, 10)+"/deliveries", query)
+}
+
+// DeadLetters 所有 Webhook 中放弃重试的投递
+func (c *Client) DeadLetters(ctx context.Context) ([]WebhookDelivery, error) {
+	return c.deliveries(ctx, "/webhooks/dead", nil)
+}
+
+func (c *Client) deliveries(ctx context.Context, p string, query url.Values) ([]WebhookDelivery, error) {
+	resp := &Page[WebhookDelivery]{}
+	if err := c.call(ctx, http.MethodGet, p, query, nil, resp); err != nil {
+		return nil, err
+	}
+	return resp.Items, nil
+}
+
+// Redeliver 重新投递一条记录
+func (c *Client) Redeliver(ctx context.Context, deliveryID int64) error {
+	return c.call(ctx, http.MethodPost, "/webhooks/deliveries/"+strconv.FormatInt(deliveryID, 10)+"/retry", nil, nil, nil)
+}
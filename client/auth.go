@@ -0,0 +1,131 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// User 用户
+type User struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	IsAdmin  bool   `json:"is_admin"`
+}
+
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Register 注册用户（第一个注册的用户成为管理员）
+func (c *Client) Register(ctx context.Context, username, password string) (*User, error) {
+	var resp struct {
+		User *User `json:"user"`
+	}
+	if err := c.call(ctx, http.MethodPost, "/auth/register", nil, credentials{username, password}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.User, nil
+}
+
+// Session 登录得到的会话
+type Session struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	User      *User     `json:"user"`
+}
+
+// Login 用户名密码登录，返回会话 JWT；不会修改 c.Token
+func (c *Client) Login(ctx context.Context, username, password string) (*Session, error) {
+	sess := &Session{}
+	if err := c.call(ctx, http.MethodPost, "/auth/login", nil, credentials{username, password}, sess); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// Logout 清除服务器设置的会话 Cookie（JWT 本身在过期前仍然有效）
+func (c *Client) Logout(ctx context.Context) error {
+	return c.call(ctx, http.MethodPost, "/auth/logout", nil, nil, nil)
+}
+
+// Me 当前凭据对应的用户
+func (c *Client) Me(ctx context.Context) (*User, error) {
+	u := &User{}
+	if err := c.call(ctx, http.MethodGet, "/auth/me", nil, nil, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// APIToken 长期有效的 API Token；Token 明文只在创建时返回
+type APIToken struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Token      string     `json:"token,omitempty"`
+	CreatedAt  time.Time  `json:"created_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreateToken 为当前用户签发 API Token，expiresInDays 为 0 表示永不过期
+func (c *Client) CreateToken(ctx context.Context, name string, expiresInDays int) (*APIToken, error) {
+	req := map[string]any{"name": name}
+	if expiresInDays > 0 {
+		req["expires_in_days"] = expiresInDays
+	}
+	t := &APIToken{}
+	if err := c.call(ctx, http.MethodPost, "/auth/tokens", nil, req, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Tokens 列出当前用户的 API Token（不含明文）
+func (c *Client) Tokens(ctx context.Context) ([]APIToken, error) {
+	resp := &Page[APIToken]{}
+	if err := c.call(ctx, http.MethodGet, "/auth/tokens", nil, nil, resp); err != nil {
+		return nil, err
+	}
+	return resp.Items, nil
+}
+
+// DeleteToken 撤销 API Token
+func (c *Client) DeleteToken(ctx context.Context, id int64) error {
+	return c.call(ctx, http.MethodDelete, "/auth/tokens/"+strconv.FormatInt(id, 10), nil, nil, nil)
+}
+
+// S3Key S3 兼容网关的访问密钥；SecretKey 只在创建时返回
+type S3Key struct {
+	AccessKey  string     `json:"access_key"`
+	SecretKey  string     `json:"secret_key,omitempty"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// CreateS3Key 创建 S3 访问密钥
+func (c *Client) CreateS3Key(ctx context.Context, name string) (*S3Key, error) {
+	k := &S3Key{}
+	if err := c.call(ctx, http.MethodPost, "/auth/s3keys", nil, map[string]string{"name": name}, k); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// S3Keys 列出当前用户的 S3 访问密钥
+func (c *Client) S3Keys(ctx context.Context) ([]S3Key, error) {
+	resp := &Page[S3Key]{}
+	if err := c.call(ctx, http.MethodGet, "/auth/s3keys", nil, nil, resp); err != nil {
+		return nil, err
+	}
+	return resp.Items, nil
+}
+
+// DeleteS3Key 撤销 S3 访问密钥
+func (c *Client) DeleteS3Key(ctx context.Context, accessKey string) error {
+	return c.call(ctx, http.MethodDelete, "/auth/s3keys/"+url.PathEscape(accessKey), nil, nil, nil)
+}
@@ -0,0 +1,139 @@
+// Package client 网盘 HTTP API 的 Go 客户端。
+//
+// 所有方法都接收 context.Context，用于取消与超时；服务器返回的错误解析为 *Error，
+// 可用 errors.Is 与 ErrNotFound、ErrConflict、ErrQuotaExceeded 等比较。
+// 上传与下载均为流式，不在内存中缓存文件内容。
+// WebDAV、S3 兼容网关与调试接口是独立的协议，不在本包范围内。
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout 普通请求（不含流式上传下载）的默认超时
+const DefaultTimeout = 30 * time.Second
+
+// Client 网盘 API 客户端，创建后可并发使用（不要再修改字段）
+type Client struct {
+	// BaseURL 服务器地址，如 http://localhost:8000
+	BaseURL string
+	// Token API Token 或会话 JWT，以 Authorization: Bearer 发送
+	Token string
+	// Owner 非 0 时访问该用户共享给自己的命名空间（owner 参数）
+	Owner int64
+	// HTTP 发送请求使用的 http.Client
+	HTTP *http.Client
+	// Timeout 普通请求的超时，0 表示只由 ctx 控制；上传、下载与事件流不受此限制
+	Timeout time.Duration
+}
+
+// New 创建客户端，使用 DefaultHTTPClient 与 DefaultTimeout
+func New(baseURL, token string) *Client {
+	return &Client{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Token:   token,
+		HTTP:    DefaultHTTPClient(),
+		Timeout: DefaultTimeout,
+	}
+}
+
+// DefaultHTTPClient 带连接与 TLS 握手超时的 http.Client；不设整体超时，以免中断大文件传输
+func DefaultHTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = 10 * time.Second
+	return &http.Client{Transport: transport}
+}
+
+// endpoint 拼接请求地址，设置了 Owner 且 query 中没有 owner 时附带 owner 参数
+func (c *Client) endpoint(p string, query url.Values) string {
+	if c.Owner != 0 && query.Get("owner") == "" {
+		if query == nil {
+			query = url.Values{}
+		}
+		query.Set("owner", strconv.FormatInt(c.Owner, 10))
+	}
+	u := c.BaseURL + p
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// stream 发送请求并检查状态码，非 2xx 时把响应体解析为 *Error；成功时调用方负责关闭响应体
+func (c *Client) stream(ctx context.Context, method, p string, query url.Values, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.endpoint(p, query), body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	httpClient := c.HTTP
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	return nil, decodeError(resp)
+}
+
+// call 发送 JSON 请求并把响应解析到 out（可为 nil），受 Timeout 限制
+func (c *Client) call(ctx context.Context, method, p string, query url.Values, in, out any) error {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body, contentType = bytes.NewReader(data), "application/json"
+	}
+	resp, err := c.stream(ctx, method, p, query, contentType, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Page 列表响应；按 ID 倒序分页的接口在还有下一页时返回 NextBefore，作为下一次请求的 before
+type Page[T any] struct {
+	Count      int   `json:"count"`
+	Items      []T   `json:"items"`
+	NextBefore int64 `json:"next_before,omitempty"`
+}
+
+// setInt 非 0 时设置整数查询参数
+func setInt(query url.Values, key string, v int64) {
+	if v != 0 {
+		query.Set(key, strconv.FormatInt(v, 10))
+	}
+}
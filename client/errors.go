@@ -0,0 +1,66 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// 按状态码分类的错误，配合 errors.Is 使用：errors.Is(err, client.ErrNotFound)
+var (
+	ErrBadRequest    = errors.New("bad request")
+	ErrUnauthorized  = errors.New("unauthorized")
+	ErrForbidden     = errors.New("forbidden")
+	ErrNotFound      = errors.New("not found")
+	ErrConflict      = errors.New("conflict")
+	ErrGone          = errors.New("gone")
+	ErrTooLarge      = errors.New("request entity too large")
+	ErrQuotaExceeded = errors.New("quota exceeded")
+)
+
+var statusErrors = map[int]error{
+	http.StatusBadRequest:            ErrBadRequest,
+	http.StatusUnauthorized:          ErrUnauthorized,
+	http.StatusForbidden:             ErrForbidden,
+	http.StatusNotFound:              ErrNotFound,
+	http.StatusConflict:              ErrConflict,
+	http.StatusGone:                  ErrGone,
+	http.StatusRequestEntityTooLarge: ErrTooLarge,
+	http.StatusInsufficientStorage:   ErrQuotaExceeded,
+}
+
+// Error 服务器返回的错误，Message 取自响应体的 error 字段
+type Error struct {
+	StatusCode int      `json:"-"`
+	Message    string   `json:"error"`
+	Conflicts  []string `json:"conflicts,omitempty"` // 归档导入时已存在的目标路径
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s (%d)", e.Message, e.StatusCode)
+	if len(e.Conflicts) > 0 {
+		msg += ": " + strings.Join(e.Conflicts, ", ")
+	}
+	return msg
+}
+
+// Is 让 errors.Is 按状态码匹配分类错误
+func (e *Error) Is(target error) bool {
+	return target != nil && statusErrors[e.StatusCode] == target
+}
+
+// decodeError 解析非 2xx 响应；响应体不是 JSON 时把正文作为错误信息
+func decodeError(resp *http.Response) error {
+	e := &Error{StatusCode: resp.StatusCode}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if json.Unmarshal(data, e) != nil || e.Message == "" {
+		e.Message = strings.TrimSpace(string(data))
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(resp.StatusCode)
+	}
+	return e
+}
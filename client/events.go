@@ -0,0 +1,81 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 变更事件类型
+const (
+	EventCreated = "created"
+	EventUpdated = "updated"
+	EventMoved   = "moved"
+	EventDeleted = "deleted"
+	EventReset   = "reset" // 游标已失效，需要重新拉取列表
+	EventReady   = "ready" // 订阅建立，Cursor 为当前游标
+)
+
+// ChangeEvent 一条变更事件；Cursor 即事件 ID，保存下来可在重连时继续
+type ChangeEvent struct {
+	Cursor  int64     `json:"cursor"`
+	Type    string    `json:"type"`
+	OwnerID int64     `json:"owner_id"`
+	NodeID  int64     `json:"node_id,omitempty"`
+	Path    string    `json:"path,omitempty"`
+	OldPath string    `json:"old_path,omitempty"`
+	Actor   string    `json:"actor,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// Events 订阅变更事件流（SSE），对每个事件调用 fn，直到 ctx 取消、连接断开或 fn 返回错误。
+// cursor 为负数时从最新位置开始；否则从该游标之后继续，游标失效时先收到 EventReset
+func (c *Client) Events(ctx context.Context, cursor int64, fn func(ChangeEvent) error) error {
+	query := url.Values{}
+	if cursor >= 0 {
+		query.Set("cursor", strconv.FormatInt(cursor, 10))
+	}
+	resp, err := c.stream(ctx, http.MethodGet, "/events", query, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			// 空行结束一个事件；只有注释（心跳）的帧没有 data
+			if data.Len() == 0 {
+				continue
+			}
+			var ev ChangeEvent
+			err := json.Unmarshal([]byte(data.String()), &ev)
+			data.Reset()
+			if err != nil {
+				return err
+			}
+			if err := fn(ev); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+		// id、event 与数据中的字段重复，注释行（: ping）忽略
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return ctx.Err()
+}
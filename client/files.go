@@ -0,0 +1,227 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"single_drive/shared"
+)
+
+// ConflictPolicy 目标已存在时的处理方式（onConflict 参数），空串使用服务器默认值
+type ConflictPolicy string
+
+const (
+	ConflictFail      ConflictPolicy = "fail"
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	ConflictRename    ConflictPolicy = "rename"
+	ConflictSkip      ConflictPolicy = "skip"
+	ConflictKeepNewer ConflictPolicy = "keep-newer"
+)
+
+func (p ConflictPolicy) set(query url.Values) {
+	if p != "" {
+		query.Set("onConflict", string(p))
+	}
+}
+
+// Conflict 冲突处理结果，Path 为最终写入（或被跳过）的路径
+type Conflict struct {
+	Policy   ConflictPolicy `json:"policy"`
+	Conflict bool           `json:"conflict"`
+	Action   string         `json:"action"`
+	Path     string         `json:"path"`
+}
+
+// Node 文件树中的一个节点（/list 的树形结构），Name 与 Path 均为完整的相对路径
+type Node struct {
+	ID       int64    `json:"id"`
+	Name     string   `json:"name"`
+	Capacity int64    `json:"capacity"`
+	IsDir    bool     `json:"is_dir"`
+	Path     string   `json:"path"`
+	Hash     string   `json:"hash,omitempty"` // 内容的 SHA-256，早期上传的文件可能为空
+	Tags     []string `json:"tags,omitempty"`
+	Starred  bool     `json:"starred,omitempty"`
+	Children []*Node  `json:"children,omitempty"`
+}
+
+// Tree 命名空间内可见节点的索引，根目录的路径为空串
+type Tree struct {
+	Root  *Node
+	nodes map[string]*Node
+}
+
+// Lookup 按路径查找节点
+func (t *Tree) Lookup(p string) (*Node, bool) {
+	n, ok := t.nodes[p]
+	return n, ok
+}
+
+// Paths 全部节点的路径（不含根目录）
+func (t *Tree) Paths() []string {
+	paths := make([]string, 0, len(t.nodes))
+	for p := range t.nodes {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// List 读取命名空间的文件树；指定 tags 时只保留带有全部标签的节点及其上级目录
+func (c *Client) List(ctx context.Context, tags ...string) (*Tree, error) {
+	query := url.Values{}
+	if len(tags) > 0 {
+		query.Set("tag", strings.Join(tags, ","))
+	}
+	var resp struct {
+		Roots []*Node `json:"roots"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/list", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	root := &Node{IsDir: true, Children: resp.Roots}
+	t := &Tree{Root: root, nodes: map[string]*Node{"": root}}
+	var index func(n *Node)
+	index = func(n *Node) {
+		for _, child := range n.Children {
+			t.nodes[child.Path] = child
+			index(child)
+		}
+	}
+	index(root)
+	return t, nil
+}
+
+// ListFlat 扁平列表（format=simple），Capacity 为 0 的是目录
+func (c *Client) ListFlat(ctx context.Context) ([]shared.MetaData, error) {
+	var items []shared.MetaData
+	if err := c.call(ctx, http.MethodGet, "/list", url.Values{"format": {"simple"}}, nil, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// MediaMetadata 服务端从文件内容提取的元数据
+type MediaMetadata struct {
+	MIME       string     `json:"mime"`
+	Width      int        `json:"width,omitempty"`
+	Height     int        `json:"height,omitempty"`
+	DurationMS int64      `json:"duration_ms,omitempty"`
+	Pages      int        `json:"pages,omitempty"`
+	Camera     string     `json:"camera,omitempty"`
+	TakenAt    *time.Time `json:"taken_at,omitempty"`
+	GPS        *struct {
+		Lat float64 `json:"lat"`
+		Lon float64 `json:"lon"`
+	} `json:"gps,omitempty"`
+}
+
+// FileInfo /info 返回的详情
+type FileInfo struct {
+	Name       string            `json:"name"`
+	Size       int64             `json:"size"`
+	Mode       string            `json:"mode"`
+	ModTime    time.Time         `json:"mod_time"`
+	IsDir      bool              `json:"is_directory"`
+	Metadata   *MediaMetadata    `json:"metadata,omitempty"`
+	Tags       []string          `json:"tags,omitempty"`
+	Starred    bool              `json:"starred,omitempty"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// Info 读取文件或目录的详情
+func (c *Client) Info(ctx context.Context, name string) (*FileInfo, error) {
+	info := &FileInfo{}
+	if err := c.call(ctx, http.MethodGet, "/info", url.Values{"name": {name}}, nil, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Mkdir 创建目录（上级目录不存在时一并创建），返回是否新建
+func (c *Client) Mkdir(ctx context.Context, name string) (bool, error) {
+	var resp struct {
+		Message string `json:"message"`
+	}
+	if err := c.call(ctx, http.MethodPost, "/createdir", url.Values{"path": {name}}, nil, &resp); err != nil {
+		return false, err
+	}
+	return resp.Message != "Directory already exists", nil
+}
+
+// DeleteResult 删除结果，移入回收站时 TrashID 为回收站条目 ID
+type DeleteResult struct {
+	Path    string `json:"path"`
+	TrashID int64  `json:"trash_id,omitempty"`
+}
+
+// Delete 删除文件（默认移入回收站），permanent 为 true 时彻底删除
+func (c *Client) Delete(ctx context.Context, name string, permanent bool) (*DeleteResult, error) {
+	return c.remove(ctx, "/delete", url.Values{"name": {name}}, permanent)
+}
+
+// DeleteDir 删除目录及其内容
+func (c *Client) DeleteDir(ctx context.Context, name string, permanent bool) (*DeleteResult, error) {
+	return c.remove(ctx, "/deletedir", url.Values{"dirname": {name}}, permanent)
+}
+
+func (c *Client) remove(ctx context.Context, p string, query url.Values, permanent bool) (*DeleteResult, error) {
+	if permanent {
+		query.Set("permanent", "true")
+	}
+	res := &DeleteResult{}
+	if err := c.call(ctx, http.MethodDelete, p, query, nil, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Rename 把 oldName 重命名为 newName（均为完整路径）
+func (c *Client) Rename(ctx context.Context, oldName, newName string) error {
+	return c.call(ctx, http.MethodPut, "/rename", url.Values{"oldName": {oldName}, "newName": {newName}}, nil, nil)
+}
+
+// Move 把 src 移动到目录 parent 下，返回的 Conflict.Path 为移动后的路径
+func (c *Client) Move(ctx context.Context, src, parent string, policy ConflictPolicy) (*Conflict, error) {
+	query := url.Values{"oldpath": {src}, "newparent": {parent}}
+	policy.set(query)
+	var resp struct {
+		Conflict *Conflict `json:"conflict"`
+	}
+	if err := c.call(ctx, http.MethodPut, "/move", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Conflict, nil
+}
+
+// Copy 把 src 复制到目录 parent 下，返回的 Conflict.Path 为副本的路径
+func (c *Client) Copy(ctx context.Context, src, parent string, policy ConflictPolicy) (*Conflict, error) {
+	query := url.Values{"src": {src}, "newparent": {parent}}
+	policy.set(query)
+	var resp struct {
+		Conflict *Conflict `json:"conflict"`
+	}
+	if err := c.call(ctx, http.MethodPost, "/copy", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Conflict, nil
+}
+
+// Thumbnail 读取缩略图（JPEG），size 为 0 时使用服务器默认尺寸；调用方负责关闭
+func (c *Client) Thumbnail(ctx context.Context, name string, size int) (io.ReadCloser, error) {
+	query := url.Values{"name": {name}}
+	if size > 0 {
+		query.Set("size", strconv.Itoa(size))
+	}
+	resp, err := c.stream(ctx, http.MethodGet, "/thumbnail", query, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,187 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TagCount 命名空间中的标签及使用次数
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+type tagsResponse struct {
+	Tags []string `json:"tags"`
+}
+
+// Tags 读取节点的标签
+func (c *Client) Tags(ctx context.Context, p string) ([]string, error) {
+	var resp tagsResponse
+	if err := c.call(ctx, http.MethodGet, "/tags", url.Values{"path": {p}}, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Tags, nil
+}
+
+// AllTags 命名空间内（可读范围）所有标签及使用次数
+func (c *Client) AllTags(ctx context.Context) ([]TagCount, error) {
+	var tags []TagCount
+	if err := c.call(ctx, http.MethodGet, "/tags", nil, nil, &tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// AddTags 给节点添加标签，返回节点现有的全部标签
+func (c *Client) AddTags(ctx context.Context, p string, tags ...string) ([]string, error) {
+	var resp tagsResponse
+	if err := c.call(ctx, http.MethodPost, "/tags", url.Values{"path": {p}, "tag": {strings.Join(tags, ",")}}, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Tags, nil
+}
+
+// RemoveTags 移除节点的标签，返回节点剩余的标签
+func (c *Client) RemoveTags(ctx context.Context, p string, tags ...string) ([]string, error) {
+	var resp tagsResponse
+	if err := c.call(ctx, http.MethodDelete, "/tags", url.Values{"path": {p}, "tag": {strings.Join(tags, ",")}}, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Tags, nil
+}
+
+// RenameTag 在整个命名空间内重命名标签（目标已存在时合并），返回涉及的节点数
+func (c *Client) RenameTag(ctx context.Context, from, to string) (int64, error) {
+	var resp struct {
+		Count int64 `json:"count"`
+	}
+	if err := c.call(ctx, http.MethodPut, "/tags", url.Values{"from": {from}, "to": {to}}, nil, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Count, nil
+}
+
+// Favorite 当前用户收藏的一个节点，可能在他人的命名空间中
+type Favorite struct {
+	NodeID    int64     `json:"node_id"`
+	OwnerID   int64     `json:"owner"`
+	Path      string    `json:"path"`
+	Capacity  int64     `json:"capacity"`
+	IsDir     bool      `json:"is_dir"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Favorites 列出当前用户的收藏
+func (c *Client) Favorites(ctx context.Context) ([]Favorite, error) {
+	var favs []Favorite
+	if err := c.call(ctx, http.MethodGet, "/favorites", nil, nil, &favs); err != nil {
+		return nil, err
+	}
+	return favs, nil
+}
+
+// SetFavorite 收藏或取消收藏
+func (c *Client) SetFavorite(ctx context.Context, p string, starred bool) error {
+	method := http.MethodPut
+	if !starred {
+		method = http.MethodDelete
+	}
+	return c.call(ctx, method, "/favorites", url.Values{"path": {p}}, nil, nil)
+}
+
+type propertiesResponse struct {
+	Properties map[string]string `json:"properties"`
+}
+
+// Properties 读取节点的自定义属性
+func (c *Client) Properties(ctx context.Context, p string) (map[string]string, error) {
+	var resp propertiesResponse
+	if err := c.call(ctx, http.MethodGet, "/properties", url.Values{"path": {p}}, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Properties, nil
+}
+
+// SetProperties 合并设置自定义属性，值为 nil 的键被删除，返回更新后的全部属性
+func (c *Client) SetProperties(ctx context.Context, p string, props map[string]*string) (map[string]string, error) {
+	var resp propertiesResponse
+	if err := c.call(ctx, http.MethodPut, "/properties", url.Values{"path": {p}}, props, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Properties, nil
+}
+
+// DeleteProperty 删除一个自定义属性
+func (c *Client) DeleteProperty(ctx context.Context, p, key string) error {
+	return c.call(ctx, http.MethodDelete, "/properties", url.Values{"path": {p}, "key": {key}}, nil, nil)
+}
+
+// FeedQuery 最近使用与目录动态的分页参数
+type FeedQuery struct {
+	Kinds  []string // upload、download、edit、share、delete，空表示默认范围
+	Before int64    // 上一页的 NextBefore
+	Limit  int      // 0 使用服务器默认值（50）
+}
+
+func (q *FeedQuery) values(query url.Values) url.Values {
+	if q == nil {
+		return query
+	}
+	if len(q.Kinds) > 0 {
+		query.Set("kind", strings.Join(q.Kinds, ","))
+	}
+	setInt(query, "before", q.Before)
+	setInt(query, "limit", int64(q.Limit))
+	return query
+}
+
+// RecentItem 最近使用的一项（每个节点只保留最近一次操作）
+type RecentItem struct {
+	EventID  int64     `json:"event_id"`
+	At       time.Time `json:"at"`
+	Kind     string    `json:"kind"`
+	Action   string    `json:"action"`
+	NodeID   int64     `json:"node_id"`
+	OwnerID  int64     `json:"owner"`
+	Name     string    `json:"name"`
+	Path     string    `json:"path"`
+	Capacity int64     `json:"capacity"`
+	IsDir    bool      `json:"is_dir"`
+}
+
+// Recent 当前用户最近操作过的节点，按时间倒序
+func (c *Client) Recent(ctx context.Context, q *FeedQuery) (*Page[RecentItem], error) {
+	resp := &Page[RecentItem]{}
+	if err := c.call(ctx, http.MethodGet, "/recent", q.values(url.Values{}), nil, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// ActivityEntry 目录动态中的一条记录
+type ActivityEntry struct {
+	ID       int64           `json:"id"`
+	At       time.Time       `json:"at"`
+	Kind     string          `json:"kind"`
+	Action   string          `json:"action"`
+	Username string          `json:"username"`
+	Via      string          `json:"via"`
+	NodeID   int64           `json:"node_id,omitempty"`
+	Path     string          `json:"path,omitempty"`
+	OldPath  string          `json:"old_path,omitempty"`
+	Detail   json.RawMessage `json:"detail,omitempty"`
+}
+
+// Activity 目录 p 子树上所有人的操作，按时间倒序
+func (c *Client) Activity(ctx context.Context, p string, q *FeedQuery) (*Page[ActivityEntry], error) {
+	resp := &Page[ActivityEntry]{}
+	if err := c.call(ctx, http.MethodGet, "/activity", q.values(url.Values{"path": {p}}), nil, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
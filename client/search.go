@@ -0,0 +1,93 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// SearchResult 搜索结果，Snippets 为已转义的 HTML，匹配词用 <mark> 标出
+type SearchResult struct {
+	ID        int64          `json:"id"`
+	Name      string         `json:"name"`
+	Path      string         `json:"path"`
+	Capacity  int64          `json:"capacity"`
+	IsDir     bool           `json:"is_dir"`
+	CreatedAt time.Time      `json:"created_at"`
+	NameMatch bool           `json:"name_match"`
+	Rank      float64        `json:"rank"`
+	Snippets  []string       `json:"snippets,omitempty"`
+	Metadata  *MediaMetadata `json:"metadata,omitempty"`
+}
+
+// Search 按文件名与正文搜索；filters 为附加的筛选参数（path、type、tag、starred、camera、has_gps 等），limit 为 0 使用服务器默认值
+func (c *Client) Search(ctx context.Context, q string, limit int, filters url.Values) ([]SearchResult, error) {
+	query := url.Values{}
+	for k, v := range filters {
+		query[k] = v
+	}
+	query.Set("q", q)
+	setInt(query, "limit", int64(limit))
+	var results []SearchResult
+	if err := c.call(ctx, http.MethodGet, "/search", query, nil, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// FilterItem 筛选结果
+type FilterItem struct {
+	ID        int64          `json:"id"`
+	Name      string         `json:"name"`
+	Path      string         `json:"path"`
+	Capacity  int64          `json:"capacity"`
+	IsDir     bool           `json:"is_dir"`
+	CreatedAt time.Time      `json:"created_at"`
+	Metadata  *MediaMetadata `json:"metadata,omitempty"`
+}
+
+// FilterByType 按类型筛选：image、video、audio、text、document、archive 或 image/* 这样的 MIME 类型
+func (c *Client) FilterByType(ctx context.Context, typ string, filters url.Values) ([]FilterItem, error) {
+	return c.filter(ctx, "/filter/type", filters, "type", typ)
+}
+
+// FilterByDate 按日期筛选，field 为 created（上传时间，默认）或 taken（拍摄时间），零值表示不限
+func (c *Client) FilterByDate(ctx context.Context, start, end time.Time, field string, filters url.Values) ([]FilterItem, error) {
+	var kv []string
+	if !start.IsZero() {
+		kv = append(kv, "start_date", start.Format(time.RFC3339))
+	}
+	if !end.IsZero() {
+		kv = append(kv, "end_date", end.Format(time.RFC3339))
+	}
+	if field != "" {
+		kv = append(kv, "date_field", field)
+	}
+	return c.filter(ctx, "/filter/date", filters, kv...)
+}
+
+// FilterBySize 按大小（字节）筛选，max 为 0 表示不限
+func (c *Client) FilterBySize(ctx context.Context, min, max int64, filters url.Values) ([]FilterItem, error) {
+	kv := []string{"min_size", strconv.FormatInt(min, 10)}
+	if max > 0 {
+		kv = append(kv, "max_size", strconv.FormatInt(max, 10))
+	}
+	return c.filter(ctx, "/filter/size", filters, kv...)
+}
+
+func (c *Client) filter(ctx context.Context, p string, filters url.Values, kv ...string) ([]FilterItem, error) {
+	query := url.Values{}
+	for k, v := range filters {
+		query[k] = v
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		query.Set(kv[i], kv[i+1])
+	}
+	var items []FilterItem
+	if err := c.call(ctx, http.MethodGet, p, query, nil, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
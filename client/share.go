@@ -0,0 +1,233 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ShareOptions 创建分享链接的参数
+type ShareOptions struct {
+	Path         string     `json:"path"`
+	Password     string     `json:"password,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	MaxDownloads int        `json:"max_downloads,omitempty"`
+}
+
+// ShareLink 分享链接；Create 返回时 URL 为完整地址，列表中的链接只有 Token
+type ShareLink struct {
+	ID            int64      `json:"id"`
+	Token         string     `json:"token"`
+	URL           string     `json:"url,omitempty"`
+	OwnerID       int64      `json:"owner_id,omitempty"`
+	NodeID        int64      `json:"node_id,omitempty"`
+	Path          string     `json:"path"`
+	IsDir         bool       `json:"is_dir,omitempty"`
+	HasPassword   bool       `json:"has_password,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	MaxDownloads  *int       `json:"max_downloads,omitempty"`
+	DownloadCount int        `json:"download_count,omitempty"`
+	CreatedBy     int64      `json:"created_by,omitempty"`
+	CreatedAt     time.Time  `json:"created_at,omitempty"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Share 创建分享链接
+func (c *Client) Share(ctx context.Context, opts ShareOptions) (*ShareLink, error) {
+	link := &ShareLink{}
+	if err := c.call(ctx, http.MethodPost, "/shares", nil, opts, link); err != nil {
+		return nil, err
+	}
+	link.URL = c.BaseURL + link.URL
+	return link, nil
+}
+
+// Shares 列出当前用户创建的、或指向自己命名空间的分享链接
+func (c *Client) Shares(ctx context.Context) ([]ShareLink, error) {
+	resp := &Page[ShareLink]{}
+	if err := c.call(ctx, http.MethodGet, "/shares", nil, nil, resp); err != nil {
+		return nil, err
+	}
+	return resp.Items, nil
+}
+
+// RevokeShare 撤销分享链接
+func (c *Client) RevokeShare(ctx context.Context, id int64) error {
+	return c.call(ctx, http.MethodDelete, "/shares/"+strconv.FormatInt(id, 10), nil, nil, nil)
+}
+
+// ShareAccess 分享链接的一条访问记录，Action 为 view、download 或 denied
+type ShareAccess struct {
+	Action     string    `json:"action"`
+	Path       string    `json:"path"`
+	ClientIP   string    `json:"client_ip"`
+	UserAgent  string    `json:"user_agent"`
+	AccessedAt time.Time `json:"accessed_at"`
+}
+
+// ShareAccessLog 查看分享链接的访问记录
+func (c *Client) ShareAccessLog(ctx context.Context, id int64) ([]ShareAccess, error) {
+	resp := &Page[ShareAccess]{}
+	if err := c.call(ctx, http.MethodGet, "/shares/"+strconv.FormatInt(id, 10)+"/access", nil, nil, resp); err != nil {
+		return nil, err
+	}
+	return resp.Items, nil
+}
+
+// PublicEntry 通过分享链接看到的文件或目录
+type PublicEntry struct {
+	Name          string        `json:"name"`
+	Path          string        `json:"path"` // 相对于分享根
+	IsDir         bool          `json:"is_dir"`
+	Size          int64         `json:"size"`
+	ModTime       time.Time     `json:"mod_time"`
+	ExpiresAt     *time.Time    `json:"expires_at,omitempty"`
+	DownloadsLeft *int          `json:"downloads_left,omitempty"`
+	Children      []PublicEntry `json:"children,omitempty"`
+}
+
+// anonymous 分享链接的公开访问不附带凭据与 owner 参数
+func (c *Client) anonymous() *Client {
+	return &Client{BaseURL: c.BaseURL, HTTP: c.HTTP, Timeout: c.Timeout}
+}
+
+func shareQuery(sub, password string) url.Values {
+	query := url.Values{}
+	if sub != "" {
+		query.Set("path", sub)
+	}
+	if password != "" {
+		query.Set("password", password)
+	}
+	return query
+}
+
+// OpenShare 匿名查看分享内容，sub 为目录分享中的子路径；token 也可以是分享链接的完整地址
+func (c *Client) OpenShare(ctx context.Context, token, sub, password string) (*PublicEntry, error) {
+	token = shareToken(token)
+	entry := &PublicEntry{}
+	if err := c.anonymous().call(ctx, http.MethodGet, "/s/"+url.PathEscape(token), shareQuery(sub, password), nil, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// DownloadShare 匿名下载分享的文件，目录按 format 打包；计入下载次数，调用方负责关闭
+func (c *Client) DownloadShare(ctx context.Context, token, sub, password, format string) (io.ReadCloser, error) {
+	token = shareToken(token)
+	query := shareQuery(sub, password)
+	if format != "" {
+		query.Set("format", format)
+	}
+	resp, err := c.anonymous().stream(ctx, http.MethodGet, "/s/"+url.PathEscape(token)+"/download", query, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// shareToken 从分享地址（…/s/<token>）中取出 token
+func shareToken(s string) string {
+	if i := strings.LastIndex(s, "/s/"); i >= 0 {
+		s = s[i+len("/s/"):]
+	}
+	return strings.Trim(s, "/")
+}
+
+// ACLEntry 节点上（含从上级继承）的一条授权
+type ACLEntry struct {
+	NodeID    int64     `json:"node_id"`
+	Path      string    `json:"path"`
+	UserID    int64     `json:"user_id"`
+	Username  string    `json:"username"`
+	Perms     []string  `json:"perms"`
+	GrantedBy string    `json:"granted_by"`
+	CreatedAt time.Time `json:"created_at"`
+	Inherited bool      `json:"inherited"`
+}
+
+// ACL 节点的授权列表与用户的有效权限
+type ACL struct {
+	Owner     int64      `json:"owner"`
+	Path      string     `json:"path"`
+	UserID    int64      `json:"user_id"`
+	Effective []string   `json:"effective"`
+	Entries   []ACLEntry `json:"entries"`
+}
+
+// ACL 查看节点的授权；user 非空时计算该用户的有效权限，否则为当前用户
+func (c *Client) ACL(ctx context.Context, p, user string) (*ACL, error) {
+	query := url.Values{"path": {p}}
+	if user != "" {
+		query.Set("user", user)
+	}
+	acl := &ACL{}
+	if err := c.call(ctx, http.MethodGet, "/acl", query, nil, acl); err != nil {
+		return nil, err
+	}
+	return acl, nil
+}
+
+// Grant 把节点的权限（read、write、delete、share、admin）授予用户
+func (c *Client) Grant(ctx context.Context, p, user string, perms ...string) error {
+	return c.call(ctx, http.MethodPost, "/acl", url.Values{"path": {p}, "user": {user}, "perms": {strings.Join(perms, ",")}}, nil, nil)
+}
+
+// Revoke 撤销用户在节点上的权限，perms 为空时删除整条授权
+func (c *Client) Revoke(ctx context.Context, p, user string, perms ...string) error {
+	query := url.Values{"path": {p}, "user": {user}}
+	if len(perms) > 0 {
+		query.Set("perms", strings.Join(perms, ","))
+	}
+	return c.call(ctx, http.MethodDelete, "/acl", query, nil, nil)
+}
+
+// SharedItem 其他用户共享给当前用户的节点，访问时把 Client.Owner 设为 Owner
+type SharedItem struct {
+	Owner     int64     `json:"owner"`
+	OwnerName string    `json:"owner_name"`
+	Path      string    `json:"path"`
+	IsDir     bool      `json:"is_dir"`
+	Perms     []string  `json:"perms"`
+	GrantedBy string    `json:"granted_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SharedWithMe 列出其他用户共享给当前用户的节点
+func (c *Client) SharedWithMe(ctx context.Context) ([]SharedItem, error) {
+	resp := &Page[SharedItem]{}
+	if err := c.call(ctx, http.MethodGet, "/shared", nil, nil, resp); err != nil {
+		return nil, err
+	}
+	return resp.Items, nil
+}
+
+// PresignRequest 预签名 URL 的参数，Action 为 download、downloaddir 或 upload/chunk
+type PresignRequest struct {
+	Action    string `json:"action"`
+	Path      string `json:"path"`
+	MaxSize   int64  `json:"max_size,omitempty"`
+	ExpiresIn int64  `json:"expires_in,omitempty"` // 秒，0 使用服务器默认值
+}
+
+// PresignedURL 预签名 URL；URL 为完整地址，上传时 Form 为必须原样提交的表单字段
+type PresignedURL struct {
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	Form      map[string]string `json:"form,omitempty"`
+}
+
+// Presign 签发预签名 URL，持有者无需凭据即可在有效期内访问
+func (c *Client) Presign(ctx context.Context, req PresignRequest) (*PresignedURL, error) {
+	p := &PresignedURL{}
+	if err := c.call(ctx, http.MethodPost, "/presign", nil, req, p); err != nil {
+		return nil, err
+	}
+	p.URL = c.BaseURL + p.URL
+	return p, nil
+}
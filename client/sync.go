@@ -0,0 +1,706 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 双向同步：本地目录与远程目录各自与上次同步时的状态（状态文件）比较，
+// 只有一侧变化时把变化同步到另一侧；两侧都修改了同一文件时保留远程版本，
+// 本地版本另存为 "name (conflict from host).ext" 并上传，因此不会丢失任何一方的修改。
+// 删除一侧的文件时另一侧也删除（远程进入回收站）；一侧删除而另一侧修改时保留修改。
+
+// SyncStateFile 默认的状态文件名，位于本地目录下
+const SyncStateFile = ".drive-sync.json"
+
+// DefaultSyncExclude 默认排除的文件名：状态文件与 DownloadFile 的临时文件
+var DefaultSyncExclude = []string{".drive-sync*", ".download-*"}
+
+// SyncOp 同步操作类型
+type SyncOp string
+
+const (
+	SyncUpload       SyncOp = "upload"
+	SyncDownload     SyncOp = "download"
+	SyncMkdirLocal   SyncOp = "mkdir-local"
+	SyncMkdirRemote  SyncOp = "mkdir-remote"
+	SyncDeleteLocal  SyncOp = "delete-local"
+	SyncDeleteRemote SyncOp = "delete-remote"
+	SyncMoveRemote   SyncOp = "move-remote" // 监听模式下本地的移动或重命名，From 为原路径
+	SyncConflict     SyncOp = "conflict"    // 远程版本保留原名，本地版本另存为 ConflictPath
+	SyncSkip         SyncOp = "skip"        // 无法同步，Reason 说明原因
+)
+
+// SyncAction 一个同步操作，Path 为相对于同步根目录的 / 分隔路径
+type SyncAction struct {
+	Op           SyncOp `json:"op"`
+	Path         string `json:"path"`
+	IsDir        bool   `json:"is_dir,omitempty"`
+	From         string `json:"from,omitempty"`
+	ConflictPath string `json:"conflict_path,omitempty"`
+	Reason       string `json:"reason,omitempty"`
+	Err          error  `json:"-"`
+	Error        string `json:"error,omitempty"`
+}
+
+// SyncOptions 同步选项
+type SyncOptions struct {
+	// StatePath 状态文件路径，默认为本地目录下的 SyncStateFile
+	StatePath string
+	// Host 冲突副本名中的主机名，默认 os.Hostname()
+	Host string
+	// Exclude 在 DefaultSyncExclude 之外排除的文件或目录名（path.Match 模式，匹配最后一级名称），两侧都生效
+	Exclude []string
+	// DryRun 只计算操作，不修改任何一侧，也不写状态文件
+	DryRun bool
+	// OnAction 每个操作完成（或 DryRun 时计算出）后调用
+	OnAction func(SyncAction)
+}
+
+// SyncResult 同步结果；部分操作失败时 Errors 大于 0，失败的路径下次同步时重试
+type SyncResult struct {
+	Actions []SyncAction `json:"actions"`
+	Errors  int          `json:"errors"`
+}
+
+// syncState 状态文件：上次同步完成时两侧一致的内容
+type syncState struct {
+	Server  string                `json:"server"`
+	Owner   int64                 `json:"owner,omitempty"`
+	Remote  string                `json:"remote"`
+	Entries map[string]*syncEntry `json:"entries"`
+}
+
+// syncEntry 一个路径的状态；Size 与 ModTime 为本地文件的属性，用于跳过未变化文件的哈希计算
+type syncEntry struct {
+	IsDir   bool   `json:"is_dir,omitempty"`
+	Hash    string `json:"hash,omitempty"`
+	Size    int64  `json:"size,omitempty"`
+	ModTime int64  `json:"mtime,omitempty"` // UnixNano
+}
+
+// same 比较两侧（或与基准）的内容是否一致，nil 表示不存在
+func (e *syncEntry) same(o *syncEntry) bool {
+	if e == nil || o == nil {
+		return e == nil && o == nil
+	}
+	if e.IsDir || o.IsDir {
+		return e.IsDir == o.IsDir
+	}
+	return e.Hash != "" && e.Hash == o.Hash
+}
+
+func loadSyncState(p string) (*syncState, error) {
+	st := &syncState{}
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, fmt.Errorf("invalid sync state %s: %v", p, err)
+	}
+	return st, nil
+}
+
+// save 先写临时文件再重命名，中途退出不会留下损坏的状态
+func (st *syncState) save(p string) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+// syncer 同步与监听共用的上下文
+type syncer struct {
+	c         *Client
+	local     string // 本地根目录
+	remote    string // 远程根目录，空串为命名空间根
+	opts      SyncOptions
+	exclude   []string
+	state     *syncState
+	statePath string
+	base      map[string]*syncEntry
+	lstate    map[string]*syncEntry
+	rstate    map[string]*syncEntry
+	skipped   map[string]string // 不参与同步的路径及原因
+	result    *SyncResult       // 为 nil 时不累积操作（监听模式）
+}
+
+// Sync 双向同步本地目录 local 与远程目录 remote（不存在时创建）。
+// 第一次同步时两侧内容相同的文件直接记录，不同的文件按冲突处理；
+// 空文件在服务器上无法与目录区分，不参与同步
+func (c *Client) Sync(ctx context.Context, local, remote string, opts *SyncOptions) (*SyncResult, error) {
+	var o SyncOptions
+	if opts != nil {
+		o = *opts
+	}
+	s, err := c.openSync(local, remote, o)
+	if err != nil {
+		return nil, err
+	}
+	s.result = &SyncResult{}
+	if err := s.scanRemote(ctx); err != nil {
+		return nil, err
+	}
+	if err := s.scanLocal(); err != nil {
+		return nil, err
+	}
+	plan := s.plan()
+	if s.opts.DryRun {
+		for _, a := range plan {
+			s.report(a)
+		}
+		return s.result, nil
+	}
+	s.execute(ctx, plan)
+	if err := s.state.save(s.statePath); err != nil {
+		return s.result, err
+	}
+	return s.result, ctx.Err()
+}
+
+// openSync 检查本地目录并读取状态文件；状态文件属于其他服务器或远程目录时报错
+func (c *Client) openSync(local, remote string, opts SyncOptions) (*syncer, error) {
+	s := &syncer{c: c, local: local, remote: strings.Trim(path.Clean("/"+remote), "/"), opts: opts}
+	s.exclude = append(append([]string(nil), DefaultSyncExclude...), s.opts.Exclude...)
+	if s.opts.Host == "" {
+		s.opts.Host, _ = os.Hostname()
+		if s.opts.Host == "" {
+			s.opts.Host = "local"
+		}
+	}
+	s.statePath = s.opts.StatePath
+	if s.statePath == "" {
+		s.statePath = filepath.Join(local, SyncStateFile)
+	}
+
+	info, err := os.Stat(local)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", local)
+	}
+	st, err := loadSyncState(s.statePath)
+	if err != nil {
+		return nil, err
+	}
+	if st.Entries != nil && (st.Server != c.BaseURL || st.Owner != c.Owner || st.Remote != s.remote) {
+		return nil, fmt.Errorf("%s belongs to another sync (%s %s), remove it to start over", s.statePath, st.Server, displayRemote(st.Remote))
+	}
+	st.Server, st.Owner, st.Remote = c.BaseURL, c.Owner, s.remote
+	if st.Entries == nil {
+		st.Entries = make(map[string]*syncEntry)
+	}
+	s.state, s.base = st, st.Entries
+	return s, nil
+}
+
+func displayRemote(p string) string {
+	return "/" + p
+}
+
+func (s *syncer) excluded(name string) bool {
+	for _, pattern := range s.exclude {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *syncer) remotePath(rel string) string {
+	return path.Join(s.remote, rel)
+}
+
+func (s *syncer) localPath(rel string) string {
+	return filepath.Join(s.local, filepath.FromSlash(rel))
+}
+
+// scanRemote 读取远程目录的文件树；没有内容哈希的早期文件大小未变时沿用基准哈希
+func (s *syncer) scanRemote(ctx context.Context) error {
+	s.rstate = make(map[string]*syncEntry)
+	tree, err := s.c.List(ctx)
+	if err != nil {
+		return err
+	}
+	root, ok := tree.Lookup(s.remote)
+	if !ok {
+		if s.opts.DryRun {
+			return nil
+		}
+		if _, err := s.c.Mkdir(ctx, s.remote); err != nil {
+			return err
+		}
+		return nil
+	}
+	if !root.IsDir {
+		return fmt.Errorf("%s is not a directory", displayRemote(s.remote))
+	}
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		for _, child := range n.Children {
+			if s.excluded(path.Base(child.Path)) {
+				continue
+			}
+			rel := strings.TrimPrefix(strings.TrimPrefix(child.Path, s.remote), "/")
+			e := &syncEntry{IsDir: child.IsDir, Hash: child.Hash, Size: child.Capacity}
+			if !e.IsDir && e.Hash == "" {
+				if b := s.base[rel]; b != nil && !b.IsDir && b.Size == e.Size {
+					e.Hash = b.Hash
+				}
+			}
+			s.rstate[rel] = e
+			if child.IsDir {
+				walk(child)
+			}
+		}
+	}
+	walk(root)
+	return nil
+}
+
+// scanLocal 遍历本地目录；大小与修改时间和基准一致的文件沿用基准哈希
+func (s *syncer) scanLocal() error {
+	s.lstate = make(map[string]*syncEntry)
+	s.skipped = make(map[string]string)
+	return filepath.WalkDir(s.local, func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) {
+			// 扫描期间被删除，按不存在处理
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if p == s.local {
+			return nil
+		}
+		rel, err := filepath.Rel(s.local, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if s.excluded(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			s.lstate[rel] = &syncEntry{IsDir: true}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			s.skipped[rel] = "not a regular file"
+			return nil
+		}
+		e, err := statLocal(p, s.base[rel])
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if e.Size == 0 {
+			s.skipped[rel] = "empty files are not supported by the server"
+			return nil
+		}
+		s.lstate[rel] = e
+		return nil
+	})
+}
+
+// statLocal 读取本地文件的状态，内容可能变化时重新计算哈希
+func statLocal(p string, base *syncEntry) (*syncEntry, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	e := &syncEntry{Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+	if base != nil && !base.IsDir && base.Size == e.Size && base.ModTime == e.ModTime {
+		e.Hash = base.Hash
+		return e, nil
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	e.Hash = hex.EncodeToString(h.Sum(nil))
+	return e, nil
+}
+
+// plan 三方比较得出操作列表
+func (s *syncer) plan() []SyncAction {
+	paths := make(map[string]bool)
+	for _, m := range []map[string]*syncEntry{s.base, s.lstate, s.rstate} {
+		for p := range m {
+			paths[p] = true
+		}
+	}
+	for p := range s.skipped {
+		paths[p] = true
+	}
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+
+	var plan []SyncAction
+	for _, p := range sorted {
+		if reason, ok := s.skipped[p]; ok {
+			plan = append(plan, SyncAction{Op: SyncSkip, Path: p, Reason: reason})
+			continue
+		}
+		b, l, r := s.base[p], s.lstate[p], s.rstate[p]
+		switch {
+		case l.same(r):
+			// 两侧一致（包括都已删除），只更新基准
+			if l == nil {
+				delete(s.base, p)
+			} else {
+				s.record(p, l, r)
+			}
+		case l.same(b):
+			plan = append(plan, s.apply(p, r, l, SyncDeleteLocal, SyncMkdirLocal, SyncDownload))
+		case r.same(b):
+			plan = append(plan, s.apply(p, l, r, SyncDeleteRemote, SyncMkdirRemote, SyncUpload))
+		case l == nil:
+			// 本地删除、远程修改：保留修改
+			plan = append(plan, s.apply(p, r, nil, SyncDeleteLocal, SyncMkdirLocal, SyncDownload))
+		case r == nil:
+			plan = append(plan, s.apply(p, l, nil, SyncDeleteRemote, SyncMkdirRemote, SyncUpload))
+		case !l.IsDir && !r.IsDir:
+			plan = append(plan, SyncAction{Op: SyncConflict, Path: p})
+		default:
+			plan = append(plan, SyncAction{Op: SyncSkip, Path: p, Reason: "changed to a file on one side and a directory on the other"})
+		}
+	}
+	return s.pruneDirDeletes(plan)
+}
+
+// apply 把 src 一侧的状态应用到 dst 一侧
+func (s *syncer) apply(p string, src, dst *syncEntry, del, mkdir, copyOp SyncOp) SyncAction {
+	switch {
+	case src == nil:
+		return SyncAction{Op: del, Path: p, IsDir: dst.IsDir}
+	case dst != nil && src.IsDir != dst.IsDir:
+		return SyncAction{Op: SyncSkip, Path: p, Reason: "changed between file and directory"}
+	case src.IsDir:
+		return SyncAction{Op: mkdir, Path: p, IsDir: true}
+	default:
+		return SyncAction{Op: copyOp, Path: p}
+	}
+}
+
+// pruneDirDeletes 目录下还有需要保留的内容时不删除目录，改为在另一侧创建；
+// 远程目录整体删除，其下的删除操作合并到目录
+func (s *syncer) pruneDirDeletes(plan []SyncAction) []SyncAction {
+	under := func(p, dir string) bool { return strings.HasPrefix(p, dir+"/") }
+	// 由深到浅，子目录先确定是否保留
+	for i := len(plan) - 1; i >= 0; i-- {
+		a := &plan[i]
+		if !a.IsDir || (a.Op != SyncDeleteLocal && a.Op != SyncDeleteRemote) {
+			continue
+		}
+		for _, other := range plan {
+			if under(other.Path, a.Path) && other.Op != a.Op {
+				if a.Op == SyncDeleteLocal {
+					a.Op = SyncMkdirRemote
+				} else {
+					a.Op = SyncMkdirLocal
+				}
+				break
+			}
+		}
+	}
+	var deletedDirs []string
+	pruned := plan[:0]
+	for _, a := range plan {
+		if a.Op == SyncDeleteRemote {
+			covered := false
+			for _, dir := range deletedDirs {
+				if under(a.Path, dir) {
+					covered = true
+					break
+				}
+			}
+			if covered {
+				continue
+			}
+			if a.IsDir {
+				deletedDirs = append(deletedDirs, a.Path)
+			}
+		}
+		pruned = append(pruned, a)
+	}
+	return pruned
+}
+
+// record 两侧一致后更新基准：本地属性取自 l，没有本地属性时取远程
+func (s *syncer) record(p string, l, r *syncEntry) {
+	e := &syncEntry{IsDir: l.IsDir}
+	if !l.IsDir {
+		e.Hash, e.Size, e.ModTime = l.Hash, l.Size, l.ModTime
+		if e.Hash == "" && r != nil {
+			e.Hash = r.Hash
+		}
+	}
+	s.base[p] = e
+}
+
+func (s *syncer) report(a SyncAction) {
+	if a.Err != nil {
+		a.Error = a.Err.Error()
+	}
+	if s.result != nil {
+		if a.Err != nil {
+			s.result.Errors++
+		}
+		s.result.Actions = append(s.result.Actions, a)
+	}
+	if s.opts.OnAction != nil {
+		s.opts.OnAction(a)
+	}
+}
+
+// execute 依次执行：创建目录、传输与冲突、删除（本地由深到浅）；单个操作失败不影响其他操作
+func (s *syncer) execute(ctx context.Context, plan []SyncAction) {
+	phase := func(a SyncAction) int {
+		switch a.Op {
+		case SyncMkdirLocal, SyncMkdirRemote:
+			return 0
+		case SyncDeleteRemote:
+			return 2
+		case SyncDeleteLocal:
+			return 3
+		}
+		return 1
+	}
+	sort.SliceStable(plan, func(i, j int) bool {
+		pi, pj := phase(plan[i]), phase(plan[j])
+		if pi != pj {
+			return pi < pj
+		}
+		if pi == 3 {
+			return plan[i].Path > plan[j].Path
+		}
+		return false
+	})
+	for _, a := range plan {
+		if ctx.Err() != nil {
+			return
+		}
+		a.Err = s.run(ctx, &a)
+		s.report(a)
+	}
+}
+
+func (s *syncer) run(ctx context.Context, a *SyncAction) error {
+	p := a.Path
+	switch a.Op {
+	case SyncMkdirLocal:
+		if err := os.MkdirAll(s.localPath(p), os.ModePerm); err != nil {
+			return err
+		}
+		s.base[p] = &syncEntry{IsDir: true}
+	case SyncMkdirRemote:
+		if _, err := s.c.Mkdir(ctx, s.remotePath(p)); err != nil {
+			return err
+		}
+		s.base[p] = &syncEntry{IsDir: true}
+	case SyncUpload:
+		e, err := s.upload(ctx, p, p)
+		if err != nil {
+			return err
+		}
+		s.base[p] = e
+	case SyncDownload:
+		if err := s.unchangedLocal(p); err != nil {
+			return err
+		}
+		e, err := s.download(ctx, p)
+		if err != nil {
+			return err
+		}
+		s.base[p] = e
+	case SyncConflict:
+		return s.conflict(ctx, a)
+	case SyncDeleteRemote:
+		var err error
+		if a.IsDir {
+			_, err = s.c.DeleteDir(ctx, s.remotePath(p), false)
+		} else {
+			_, err = s.c.Delete(ctx, s.remotePath(p), false)
+		}
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		delete(s.base, p)
+		for q := range s.base {
+			if strings.HasPrefix(q, p+"/") {
+				delete(s.base, q)
+			}
+		}
+	case SyncDeleteLocal:
+		if !a.IsDir {
+			if err := s.unchangedLocal(p); err != nil {
+				return err
+			}
+		}
+		if err := os.Remove(s.localPath(p)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			if a.IsDir {
+				// 目录中还有被排除的文件，保留目录，下次同步时作为新目录创建到远程
+				delete(s.base, p)
+				a.Op, a.Reason = SyncSkip, "directory contains excluded files"
+				return nil
+			}
+			return err
+		}
+		delete(s.base, p)
+	}
+	return nil
+}
+
+// unchangedLocal 覆盖或删除本地文件前确认它在扫描之后没有再被修改
+func (s *syncer) unchangedLocal(p string) error {
+	want := s.lstate[p]
+	info, err := os.Stat(s.localPath(p))
+	if errors.Is(err, os.ErrNotExist) && want == nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if want == nil || info.Size() != want.Size || info.ModTime().UnixNano() != want.ModTime {
+		return fmt.Errorf("%s changed during sync", p)
+	}
+	return nil
+}
+
+// upload 上传本地文件 rel 到远程路径 dst，边上传边计算哈希，记录实际上传的内容
+func (s *syncer) upload(ctx context.Context, rel, dst string) (*syncEntry, error) {
+	f, err := os.Open(s.localPath(rel))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	remote := s.remotePath(dst)
+	opts := &UploadOptions{OnConflict: ConflictOverwrite, ModTime: info.ModTime()}
+	dir, name := path.Split(remote)
+	if _, err := s.c.Upload(ctx, strings.TrimSuffix(dir, "/"), name, io.TeeReader(f, h), info.Size(), opts); err != nil {
+		return nil, err
+	}
+	return &syncEntry{Hash: hex.EncodeToString(h.Sum(nil)), Size: info.Size(), ModTime: info.ModTime().UnixNano()}, nil
+}
+
+// download 下载远程文件覆盖本地路径 rel
+func (s *syncer) download(ctx context.Context, rel string) (*syncEntry, error) {
+	local := s.localPath(rel)
+	if _, err := s.c.DownloadFile(ctx, s.remotePath(rel), local); err != nil {
+		return nil, err
+	}
+	var base *syncEntry
+	if r := s.rstate[rel]; r != nil && r.Hash != "" {
+		// 远程哈希已知时直接沿用，statLocal 只读取大小与修改时间
+		info, err := os.Stat(local)
+		if err != nil {
+			return nil, err
+		}
+		base = &syncEntry{Hash: r.Hash, Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+	}
+	return statLocal(local, base)
+}
+
+// conflict 两侧都修改了文件：先把远程版本下载到临时文件，内容相同（远程没有记录哈希时可能出现）
+// 则只更新基准；否则本地版本改名为冲突副本并上传，原路径换成远程版本
+func (s *syncer) conflict(ctx context.Context, a *SyncAction) error {
+	p := a.Path
+	if err := s.unchangedLocal(p); err != nil {
+		return err
+	}
+	local := s.localPath(p)
+	tmp := filepath.Join(filepath.Dir(local), ".download-conflict-"+filepath.Base(local))
+	defer os.Remove(tmp)
+	if _, err := s.c.DownloadFile(ctx, s.remotePath(p), tmp); err != nil {
+		return err
+	}
+	remote, err := statLocal(tmp, nil)
+	if err != nil {
+		return err
+	}
+	if l := s.lstate[p]; remote.Hash == l.Hash {
+		a.Op, a.Reason = SyncSkip, "identical content"
+		s.base[p] = l
+		return nil
+	}
+	cp := s.conflictName(p)
+	if err := os.Rename(local, s.localPath(cp)); err != nil {
+		return err
+	}
+	a.ConflictPath = cp
+	if err := os.Rename(tmp, local); err != nil {
+		return err
+	}
+	e, err := statLocal(local, nil)
+	if err != nil {
+		return err
+	}
+	s.base[p] = e
+	if e, err = s.upload(ctx, cp, cp); err != nil {
+		// 冲突副本留在本地，下次同步时作为新文件上传
+		return err
+	}
+	s.base[cp] = e
+	return nil
+}
+
+// conflictName 生成两侧都不存在的冲突副本路径，如 "a/report (conflict from host).txt"
+func (s *syncer) conflictName(p string) string {
+	dir, name := path.Split(p)
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		suffix := " (conflict from " + s.opts.Host + ")"
+		if i > 1 {
+			suffix = fmt.Sprintf(" (conflict from %s %d)", s.opts.Host, i)
+		}
+		candidate := dir + stem + suffix + ext
+		if s.lstate[candidate] != nil || s.rstate[candidate] != nil || s.base[candidate] != nil {
+			continue
+		}
+		if _, err := os.Lstat(s.localPath(candidate)); err == nil {
+			continue
+		}
+		return candidate
+	}
+}
@@ -0,0 +1,462 @@
+package client
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"single_drive/shared"
+)
+
+// UploadOptions 上传选项
+type UploadOptions struct {
+	OnConflict ConflictPolicy
+	// ModTime 客户端文件的修改时间，供 keep-newer 策略比较；零值表示不提交
+	ModTime time.Time
+}
+
+func (o *UploadOptions) fields() [][2]string {
+	var fields [][2]string
+	if o == nil {
+		return fields
+	}
+	if o.OnConflict != "" {
+		fields = append(fields, [2]string{"onConflict", string(o.OnConflict)})
+	}
+	if !o.ModTime.IsZero() {
+		fields = append(fields, [2]string{"modTime", o.ModTime.UTC().Format(time.RFC3339)})
+	}
+	return fields
+}
+
+// UploadResult 上传单个文件的结果；冲突策略为 skip 且目标已存在时 Path 为空
+type UploadResult struct {
+	Path     string    `json:"path"`
+	Version  int       `json:"version,omitempty"`
+	Conflict *Conflict `json:"conflict,omitempty"`
+}
+
+// Upload 以 multipart 流式上传 r 的内容到远程目录 dir 下的 name，size 为内容长度（用于配额预检）
+func (c *Client) Upload(ctx context.Context, dir, name string, r io.Reader, size int64, opts *UploadOptions) (*UploadResult, error) {
+	meta, err := json.Marshal(shared.MetaData{Name: path.Join(dir, name), Capacity: size})
+	if err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		fields := append([][2]string{{"meta", string(meta)}, {"path", dir}}, opts.fields()...)
+		for _, kv := range fields {
+			if err := mw.WriteField(kv[0], kv[1]); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		part, err := mw.CreateFormFile("file", name)
+		if err == nil {
+			_, err = io.Copy(part, r)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	resp, err := c.stream(ctx, http.MethodPost, "/upload", nil, mw.FormDataContentType(), pr)
+	// 请求失败时服务器可能没有读完请求体，关闭管道让写入协程退出
+	pr.CloseWithError(io.ErrClosedPipe)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	res := &UploadResult{}
+	if err := json.NewDecoder(resp.Body).Decode(res); err != nil {
+		return nil, err
+	}
+	if res.Path == "" && res.Conflict != nil && res.Conflict.Action != "skip" {
+		res.Path = res.Conflict.Path
+	}
+	return res, nil
+}
+
+// UploadFile 上传本地文件到远程目录 dir，opts 未指定 ModTime 时使用文件的修改时间
+func (c *Client) UploadFile(ctx context.Context, local, dir string, opts *UploadOptions) (*UploadResult, error) {
+	f, err := os.Open(local)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	o := UploadOptions{ModTime: info.ModTime()}
+	if opts != nil {
+		o.OnConflict = opts.OnConflict
+		if !opts.ModTime.IsZero() {
+			o.ModTime = opts.ModTime
+		}
+	}
+	return c.Upload(ctx, dir, filepath.Base(local), f, info.Size(), &o)
+}
+
+// ArchiveResult 归档上传的导入结果
+type ArchiveResult struct {
+	Path        string     `json:"path"`
+	Format      string     `json:"format"`
+	Files       int        `json:"files"`
+	Directories int        `json:"directories"`
+	Bytes       int64      `json:"bytes"`
+	Skipped     int        `json:"skipped"`
+	Conflicts   []Conflict `json:"conflicts,omitempty"`
+	Ignored     []string   `json:"ignored,omitempty"`
+}
+
+// UploadArchive 上传归档（zip、tar、tar.gz、tar.zst）并在服务端解压到远程目录 dir；
+// format 为空时由服务器按内容识别
+func (c *Client) UploadArchive(ctx context.Context, dir string, r io.Reader, format string, policy ConflictPolicy) (*ArchiveResult, error) {
+	query := url.Values{"path": {dir}}
+	if format != "" {
+		query.Set("format", format)
+	}
+	policy.set(query)
+	resp, err := c.stream(ctx, http.MethodPost, "/upload/archive", query, "application/octet-stream", r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	res := &ArchiveResult{}
+	return res, json.NewDecoder(resp.Body).Decode(res)
+}
+
+// UploadDir 把本地目录边打包为 tar.gz 边上传，在远程目录 dir 下生成同名目录
+func (c *Client) UploadDir(ctx context.Context, local, dir string, policy ConflictPolicy) (*ArchiveResult, error) {
+	info, err := os.Stat(local)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", local)
+	}
+	base := filepath.Base(filepath.Clean(local))
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeTarGz(pw, local, base))
+	}()
+	res, err := c.UploadArchive(ctx, dir, pr, "tar.gz", policy)
+	pr.CloseWithError(io.ErrClosedPipe)
+	return res, err
+}
+
+// writeTarGz 把 root 目录写成 tar.gz，归档内的路径以 prefix 开头；只包含目录与普通文件
+func writeTarGz(w io.Writer, root, prefix string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	err := filepath.WalkDir(root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = path.Join(prefix, filepath.ToSlash(rel))
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		header.Uid, header.Gid, header.Uname, header.Gname = 0, 0, "", ""
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, io.LimitReader(f, header.Size))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Download 下载远程文件，返回响应体，调用方负责关闭
+func (c *Client) Download(ctx context.Context, name string) (io.ReadCloser, error) {
+	resp, err := c.stream(ctx, http.MethodGet, "/download", url.Values{"name": {name}}, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// DownloadFile 下载远程文件到本地路径 dest，先写入同目录的临时文件再重命名，返回写入的字节数
+func (c *Client) DownloadFile(ctx context.Context, name, dest string) (int64, error) {
+	body, err := c.Download(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	if err := os.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".download-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	n, err := io.Copy(tmp, body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return n, err
+	}
+	return n, os.Rename(tmp.Name(), dest)
+}
+
+// DownloadDir 把远程目录打包下载，format 为 zip、tar、tar.gz 或 tar.zst（空串为服务器默认的 zip）；
+// 返回响应体与 Content-Type，调用方负责关闭
+func (c *Client) DownloadDir(ctx context.Context, dir, format string) (io.ReadCloser, string, error) {
+	query := url.Values{"dirname": {dir}}
+	if format != "" {
+		query.Set("format", format)
+	}
+	resp, err := c.stream(ctx, http.MethodGet, "/downloaddir", query, "", nil)
+	if err != nil {
+		return nil, "", err
+	}
+	return resp.Body, resp.Header.Get("Content-Type"), nil
+}
+
+// DownloadDirTo 下载远程目录并解压到本地目录 dest：tar 系列边下载边解压，zip 先保存为临时文件
+func (c *Client) DownloadDirTo(ctx context.Context, dir, dest, format string, opts shared.ExtractOptions) error {
+	body, contentType, err := c.DownloadDir(ctx, dir, format)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/x-tar", "application/gzip", "application/zstd":
+		return shared.Untar(body, dest, opts)
+	}
+	tmp, err := os.CreateTemp("", "download_*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, body)
+	if err != nil {
+		return err
+	}
+	return shared.UnzipReader(tmp, size, dest, opts)
+}
+
+// DefaultChunkSize 分块上传的默认分片大小
+const DefaultChunkSize = 4 << 20
+
+// QuickUploadResult 秒传检查结果：NeedUpload 为 false 时文件已存在（或按冲突策略跳过），无需上传
+type QuickUploadResult struct {
+	Message    string    `json:"message"`
+	ExistingID int64     `json:"existing_id,omitempty"`
+	NeedUpload bool      `json:"needUpload"`
+	UploadID   string    `json:"uploadId,omitempty"`
+	Conflict   *Conflict `json:"conflict,omitempty"`
+}
+
+// ChunkFile 分块上传的目标文件
+type ChunkFile struct {
+	Dir     string // 远程目录
+	Name    string
+	Hash    string // 内容的 SHA-256（十六进制）
+	Size    int64
+	ModTime time.Time
+}
+
+func (f *ChunkFile) fields(policy ConflictPolicy) [][2]string {
+	fields := [][2]string{{"fileName", f.Name}, {"fileHash", f.Hash}, {"path", f.Dir}, {"totalSize", strconv.FormatInt(f.Size, 10)}}
+	if policy != "" {
+		fields = append(fields, [2]string{"onConflict", string(policy)})
+	}
+	if !f.ModTime.IsZero() {
+		fields = append(fields, [2]string{"modTime", f.ModTime.UTC().Format(time.RFC3339)})
+	}
+	return fields
+}
+
+// QuickUpload 秒传检查并创建分块上传会话
+func (c *Client) QuickUpload(ctx context.Context, f *ChunkFile, policy ConflictPolicy) (*QuickUploadResult, error) {
+	res := &QuickUploadResult{}
+	if err := c.postForm(ctx, "/upload/quick", f.fields(policy), nil, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ChunkResult 上传一个分片后的会话状态，收齐全部分片后 Status 为 done
+type ChunkResult struct {
+	UploadID      string    `json:"uploadId"`
+	ReceivedCount int       `json:"receivedCount"`
+	TotalChunks   int       `json:"totalChunks"`
+	Status        string    `json:"status"`
+	Conflict      *Conflict `json:"conflict,omitempty"`
+}
+
+// UploadChunk 上传第 index 个分片（从 1 开始）
+func (c *Client) UploadChunk(ctx context.Context, uploadID string, f *ChunkFile, policy ConflictPolicy, index, total int, chunk io.Reader) (*ChunkResult, error) {
+	fields := append(f.fields(policy), [2]string{"uploadId", uploadID}, [2]string{"chunkIndex", strconv.Itoa(index)}, [2]string{"totalChunks", strconv.Itoa(total)})
+	res := &ChunkResult{}
+	if err := c.postForm(ctx, "/upload/chunk", fields, chunk, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// UploadProgress 分块上传会话的进度
+type UploadProgress struct {
+	UploadID       string  `json:"uploadId"`
+	Status         string  `json:"status"`
+	ReceivedChunks int     `json:"receivedChunks"`
+	TotalChunks    int     `json:"totalChunks"`
+	ReceivedBytes  int64   `json:"receivedBytes"`
+	TotalBytes     int64   `json:"totalBytes"`
+	Percent        float64 `json:"percent"`
+	Path           string  `json:"path"`
+	FileName       string  `json:"fileName"`
+}
+
+// Progress 查询分块上传进度；会话完成后即被删除，返回 ErrNotFound
+func (c *Client) Progress(ctx context.Context, uploadID string) (*UploadProgress, error) {
+	res := &UploadProgress{}
+	if err := c.call(ctx, http.MethodGet, "/upload/progress/"+url.PathEscape(uploadID), nil, nil, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ChunkedOptions 分块上传选项
+type ChunkedOptions struct {
+	ChunkSize  int64 // 0 使用 DefaultChunkSize
+	OnConflict ConflictPolicy
+	// OnProgress 每上传完一个分片调用一次
+	OnProgress func(sent, total int64)
+}
+
+// ChunkedUpload 分块上传本地文件到远程目录 dir：先计算哈希尝试秒传，再逐片上传；
+// 文件已存在（秒传）或按冲突策略跳过时返回的 ChunkResult 为 nil
+func (c *Client) ChunkedUpload(ctx context.Context, local, dir string, opts *ChunkedOptions) (*QuickUploadResult, *ChunkResult, error) {
+	var o ChunkedOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.ChunkSize <= 0 {
+		o.ChunkSize = DefaultChunkSize
+	}
+	file, err := os.Open(local)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, nil, err
+	}
+	f := &ChunkFile{Dir: dir, Name: filepath.Base(local), Hash: hex.EncodeToString(hash.Sum(nil)), Size: info.Size(), ModTime: info.ModTime()}
+
+	quick, err := c.QuickUpload(ctx, f, o.OnConflict)
+	if err != nil || !quick.NeedUpload {
+		return quick, nil, err
+	}
+	total := int((f.Size + o.ChunkSize - 1) / o.ChunkSize)
+	if total == 0 {
+		total = 1
+	}
+	var res *ChunkResult
+	for i := 1; i <= total; i++ {
+		offset := int64(i-1) * o.ChunkSize
+		res, err = c.UploadChunk(ctx, quick.UploadID, f, o.OnConflict, i, total, io.NewSectionReader(file, offset, o.ChunkSize))
+		if err != nil {
+			return quick, nil, fmt.Errorf("chunk %d/%d: %w", i, total, err)
+		}
+		if o.OnProgress != nil {
+			o.OnProgress(min(offset+o.ChunkSize, f.Size), f.Size)
+		}
+	}
+	if res.Status == "error" {
+		return quick, res, fmt.Errorf("upload %s failed on the server", quick.UploadID)
+	}
+	return quick, res, nil
+}
+
+// postForm 以 multipart 表单提交 fields，chunk 非 nil 时作为 chunk 文件字段
+func (c *Client) postForm(ctx context.Context, p string, fields [][2]string, chunk io.Reader, out any) error {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		for _, kv := range fields {
+			if err := mw.WriteField(kv[0], kv[1]); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		var err error
+		if chunk != nil {
+			var part io.Writer
+			if part, err = mw.CreateFormFile("chunk", "chunk"); err == nil {
+				_, err = io.Copy(part, chunk)
+			}
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	resp, err := c.stream(ctx, http.MethodPost, p, nil, mw.FormDataContentType(), pr)
+	pr.CloseWithError(io.ErrClosedPipe)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
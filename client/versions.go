@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// FileVersion 文件的一个历史版本
+type FileVersion struct {
+	Version   int       `json:"version"`
+	Hash      string    `json:"hash"`
+	Size      int64     `json:"size"`
+	Author    string    `json:"author"`
+	CreatedAt time.Time `json:"created_at"`
+	Current   bool      `json:"current"`
+}
+
+// Versions 列出文件的历史版本
+func (c *Client) Versions(ctx context.Context, name string) ([]FileVersion, error) {
+	var resp struct {
+		Versions []FileVersion `json:"versions"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/versions", url.Values{"name": {name}}, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Versions, nil
+}
+
+// DownloadVersion 下载文件的某个历史版本，调用方负责关闭
+func (c *Client) DownloadVersion(ctx context.Context, name string, version int) (io.ReadCloser, error) {
+	resp, err := c.stream(ctx, http.MethodGet, "/versions/download", url.Values{"name": {name}, "version": {strconv.Itoa(version)}}, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// RestoreVersion 把文件恢复为某个历史版本（当前内容另存为新版本），返回恢复后的版本号
+func (c *Client) RestoreVersion(ctx context.Context, name string, version int) (int, error) {
+	var resp struct {
+		Version int `json:"version"`
+	}
+	if err := c.call(ctx, http.MethodPost, "/versions/restore", url.Values{"name": {name}, "version": {strconv.Itoa(version)}}, nil, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Version, nil
+}
+
+// TrashItem 回收站中的一个条目（删除的文件或整个目录）
+type TrashItem struct {
+	ID           int64     `json:"id"`
+	OriginalPath string    `json:"original_path"`
+	IsDir        bool      `json:"is_dir"`
+	Capacity     int64     `json:"capacity"`
+	NodeCount    int       `json:"node_count"`
+	DeletedAt    time.Time `json:"deleted_at"`
+	ExpiresAt    time.Time `json:"expires_at,omitempty"`
+}
+
+// Trash 列出当前用户的回收站
+func (c *Client) Trash(ctx context.Context) ([]TrashItem, error) {
+	resp := &Page[TrashItem]{}
+	if err := c.call(ctx, http.MethodGet, "/trash", nil, nil, resp); err != nil {
+		return nil, err
+	}
+	return resp.Items, nil
+}
+
+// RestoreTrash 把回收站条目恢复到原路径，返回的 Conflict.Path 为恢复后的路径
+func (c *Client) RestoreTrash(ctx context.Context, id int64, policy ConflictPolicy) (*Conflict, error) {
+	query := url.Values{"id": {strconv.FormatInt(id, 10)}}
+	policy.set(query)
+	var resp struct {
+		Conflict *Conflict `json:"conflict"`
+	}
+	if err := c.call(ctx, http.MethodPost, "/trash/restore", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Conflict, nil
+}
+
+// PurgeTrash 彻底删除回收站条目，id 为 0 时清空整个回收站，返回删除的条目数
+func (c *Client) PurgeTrash(ctx context.Context, id int64) (int, error) {
+	query := url.Values{}
+	setInt(query, "id", id)
+	var resp struct {
+		Purged int `json:"purged"`
+	}
+	if err := c.call(ctx, http.MethodDelete, "/trash", query, nil, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Purged, nil
+}
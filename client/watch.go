@@ -0,0 +1,443 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// 监听模式：把本地目录单向镜像到远程目录。启动时先与服务器的文件列表对账，
+// 之后监听文件系统事件，路径在 Debounce 内没有新事件才处理（等待文件写完），
+// 新增与修改的文件分块上传（内容已存在时秒传），删除、移动与重命名在远程照做。
+// 状态文件与 Sync 共用，同一目录可以交替使用两种模式。
+
+// DefaultWatchDebounce 默认的去抖间隔
+const DefaultWatchDebounce = 2 * time.Second
+
+// watchRetryDelay 操作失败或对账失败后的重试间隔
+const watchRetryDelay = 30 * time.Second
+
+// WatchOptions 监听选项
+type WatchOptions struct {
+	// StatePath 状态文件路径，默认为本地目录下的 SyncStateFile
+	StatePath string
+	// Exclude 在 DefaultSyncExclude 之外排除的文件或目录名（path.Match 模式）
+	Exclude []string
+	// Debounce 路径最后一次变化后等待多久再上传，0 使用 DefaultWatchDebounce
+	Debounce time.Duration
+	// ChunkSize 分块上传的分片大小，0 使用 DefaultChunkSize
+	ChunkSize int64
+	// OnAction 每个远程操作完成后调用，失败时 Err 非空（稍后重试）
+	OnAction func(SyncAction)
+	// OnError 监听或对账出错时调用（如事件队列溢出），之后会重新对账
+	OnError func(error)
+}
+
+// watcher 一次监听的状态
+type watcher struct {
+	*syncer
+	opts     WatchOptions
+	fsw      *fsnotify.Watcher
+	pending  map[string]time.Time // 待处理的路径及最早处理时间
+	rescanAt time.Time            // 非零时在该时间之后重新对账
+}
+
+// Watch 监听本地目录 local 并把变化镜像到远程目录 remote，直到 ctx 取消（返回 ctx.Err()）。
+// 启动时的对账：本地有而远程没有或内容不同的上传；上次镜像过、本地已删除且远程未被他人修改的删除；
+// 远程独有的内容保留
+func (c *Client) Watch(ctx context.Context, local, remote string, opts *WatchOptions) error {
+	var o WatchOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Debounce <= 0 {
+		o.Debounce = DefaultWatchDebounce
+	}
+	s, err := c.openSync(local, remote, SyncOptions{StatePath: o.StatePath, Exclude: o.Exclude, OnAction: o.OnAction})
+	if err != nil {
+		return err
+	}
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer fsw.Close()
+	w := &watcher{syncer: s, opts: o, fsw: fsw, pending: make(map[string]time.Time)}
+
+	// 先建立监听再对账，对账期间发生的变化不会丢失
+	if err := w.watchTree(s.local, false); err != nil {
+		return err
+	}
+	if err := w.reconcile(ctx); err != nil {
+		return err
+	}
+	tick := time.NewTicker(max(o.Debounce/4, 100*time.Millisecond))
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev, ok := <-fsw.Events:
+			if !ok {
+				return nil
+			}
+			w.event(ev)
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return nil
+			}
+			// 事件可能已经丢失（如 inotify 队列溢出），全量对账一次
+			w.fail(err)
+			w.rescanAt = time.Now()
+		case now := <-tick.C:
+			if !w.rescanAt.IsZero() && !now.Before(w.rescanAt) {
+				w.rescanAt = time.Time{}
+				if err := w.reconcile(ctx); err != nil {
+					w.fail(err)
+					w.rescanAt = now.Add(watchRetryDelay)
+				}
+				continue
+			}
+			w.flush(ctx, now)
+		}
+	}
+}
+
+func (w *watcher) fail(err error) {
+	if w.opts.OnError != nil {
+		w.opts.OnError(err)
+	}
+}
+
+// relPath 本地路径相对于根目录的 / 分隔路径，根目录以外或被排除的路径返回 false
+func (w *watcher) relPath(p string) (string, bool) {
+	rel, err := filepath.Rel(w.local, p)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, name := range strings.Split(rel, "/") {
+		if w.excluded(name) {
+			return "", false
+		}
+	}
+	return rel, true
+}
+
+// watchTree 监听目录及其全部子目录；mark 为 true 时把其中的路径加入待处理（新建的目录在建立监听前可能已写入文件）
+func (w *watcher) watchTree(root string, mark bool) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if p != root && w.excluded(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if mark {
+			if rel, ok := w.relPath(p); ok {
+				w.pending[rel] = time.Now().Add(w.opts.Debounce)
+			}
+		}
+		if d.IsDir() {
+			return w.fsw.Add(p)
+		}
+		return nil
+	})
+}
+
+// event 记录变化的路径，推迟到 Debounce 之后处理
+func (w *watcher) event(ev fsnotify.Event) {
+	if ev.Op == fsnotify.Chmod {
+		return
+	}
+	rel, ok := w.relPath(ev.Name)
+	if !ok {
+		return
+	}
+	if ev.Has(fsnotify.Rename) {
+		// inotify 的监听跟随目录本身，移走的目录不取消监听的话事件仍按旧路径上报；
+		// 移动到的新位置会收到 Create 并重新监听
+		for _, p := range w.fsw.WatchList() {
+			if p == ev.Name || strings.HasPrefix(p, ev.Name+string(filepath.Separator)) {
+				w.fsw.Remove(p)
+			}
+		}
+	}
+	if ev.Has(fsnotify.Create) {
+		if info, err := os.Lstat(ev.Name); err == nil && info.IsDir() {
+			if err := w.watchTree(ev.Name, true); err != nil {
+				w.fail(err)
+			}
+		}
+	}
+	w.pending[rel] = time.Now().Add(w.opts.Debounce)
+}
+
+// reconcile 与服务器的文件列表对账
+func (w *watcher) reconcile(ctx context.Context) error {
+	if err := w.scanRemote(ctx); err != nil {
+		return err
+	}
+	if err := w.scanLocal(); err != nil {
+		return err
+	}
+	paths := make(map[string]bool)
+	for _, m := range []map[string]*syncEntry{w.base, w.lstate, w.rstate} {
+		for p := range m {
+			paths[p] = true
+		}
+	}
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+
+	var dirs []string
+	changed := make(map[string]*syncEntry)
+	gone := make(map[string]bool)
+	for _, p := range sorted {
+		if reason, ok := w.skipped[p]; ok {
+			w.report(SyncAction{Op: SyncSkip, Path: p, Reason: reason})
+			continue
+		}
+		b, l, r := w.base[p], w.lstate[p], w.rstate[p]
+		switch {
+		case l != nil && l.same(r):
+			w.record(p, l, r)
+		case l != nil && r != nil && l.IsDir != r.IsDir:
+			w.report(SyncAction{Op: SyncSkip, Path: p, Reason: "a file on one side and a directory on the other"})
+		case l != nil && l.IsDir:
+			dirs = append(dirs, p)
+		case l != nil:
+			changed[p] = l
+		case b != nil && r != nil && b.same(r):
+			// 停止监听期间在本地删除
+			gone[p] = true
+		default:
+			// 远程独有或已被他人修改的内容不属于镜像，不再跟踪
+			delete(w.base, p)
+		}
+	}
+	w.apply(ctx, dirs, changed, gone)
+	return nil
+}
+
+// flush 处理已过去抖时间的路径
+func (w *watcher) flush(ctx context.Context, now time.Time) {
+	var ready []string
+	for p, at := range w.pending {
+		if !at.After(now) {
+			ready = append(ready, p)
+		}
+	}
+	if len(ready) == 0 {
+		return
+	}
+	sort.Strings(ready)
+
+	var dirs []string
+	changed := make(map[string]*syncEntry)
+	gone := make(map[string]bool)
+	for _, p := range ready {
+		delete(w.pending, p)
+		local := w.localPath(p)
+		info, err := os.Lstat(local)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			// 删除或移走；目录下镜像过的路径一并处理
+			for q := range w.base {
+				if q == p || strings.HasPrefix(q, p+"/") {
+					if _, err := os.Lstat(w.localPath(q)); errors.Is(err, os.ErrNotExist) {
+						gone[q] = true
+					}
+				}
+			}
+		case err != nil:
+			w.retry(SyncAction{Op: SyncUpload, Path: p, Err: err})
+		case info.IsDir():
+			if b := w.base[p]; b == nil || !b.IsDir {
+				dirs = append(dirs, p)
+			}
+		case !info.Mode().IsRegular():
+		default:
+			e, err := statLocal(local, w.base[p])
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				w.retry(SyncAction{Op: SyncUpload, Path: p, Err: err})
+				continue
+			}
+			if e.Size == 0 {
+				w.report(SyncAction{Op: SyncSkip, Path: p, Reason: "empty files are not supported by the server"})
+				continue
+			}
+			if w.base[p].same(e) {
+				// 内容未变（如只改了修改时间），更新本地属性
+				w.base[p] = e
+				continue
+			}
+			changed[p] = e
+		}
+	}
+	w.apply(ctx, dirs, changed, gone)
+}
+
+// retry 报告失败的操作，稍后重新处理该路径
+func (w *watcher) retry(a SyncAction) {
+	w.report(a)
+	w.pending[a.Path] = time.Now().Add(watchRetryDelay)
+}
+
+// apply 依次创建目录、把移走的文件在远程移动到新位置（内容哈希相同）、上传其余变化、删除远程，最后保存状态
+func (w *watcher) apply(ctx context.Context, dirs []string, changed map[string]*syncEntry, gone map[string]bool) {
+	defer func() {
+		if err := w.state.save(w.statePath); err != nil {
+			w.fail(err)
+		}
+	}()
+	sort.Strings(dirs)
+	for _, p := range dirs {
+		if ctx.Err() != nil {
+			return
+		}
+		if _, err := w.c.Mkdir(ctx, w.remotePath(p)); err != nil {
+			w.retry(SyncAction{Op: SyncMkdirRemote, Path: p, IsDir: true, Err: err})
+			continue
+		}
+		w.base[p] = &syncEntry{IsDir: true}
+		w.report(SyncAction{Op: SyncMkdirRemote, Path: p, IsDir: true})
+	}
+
+	movable := make(map[string][]string) // 内容哈希 -> 已移走的文件
+	for p := range gone {
+		if b := w.base[p]; b != nil && !b.IsDir && b.Hash != "" {
+			movable[b.Hash] = append(movable[b.Hash], p)
+		}
+	}
+	for _, candidates := range movable {
+		sort.Strings(candidates)
+	}
+	paths := make([]string, 0, len(changed))
+	for p := range changed {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		if ctx.Err() != nil {
+			return
+		}
+		e := changed[p]
+		if candidates := movable[e.Hash]; w.base[p] == nil && len(candidates) > 0 {
+			from := candidates[0]
+			if err := w.move(ctx, from, p); err == nil {
+				movable[e.Hash] = candidates[1:]
+				delete(gone, from)
+				delete(w.base, from)
+				w.base[p] = e
+				w.report(SyncAction{Op: SyncMoveRemote, Path: p, From: from})
+				continue
+			}
+			// 目标已存在等情况下退回上传，原文件按删除处理
+		}
+		if err := w.upload(ctx, p); err != nil {
+			w.retry(SyncAction{Op: SyncUpload, Path: p, Err: err})
+			continue
+		}
+		w.base[p] = e
+		w.report(SyncAction{Op: SyncUpload, Path: p})
+	}
+
+	removed := make([]string, 0, len(gone))
+	for p := range gone {
+		removed = append(removed, p)
+	}
+	sort.Strings(removed)
+	var deletedDirs []string
+	for _, p := range removed {
+		if ctx.Err() != nil {
+			return
+		}
+		covered := false
+		for _, dir := range deletedDirs {
+			if strings.HasPrefix(p, dir+"/") {
+				covered = true
+				break
+			}
+		}
+		if covered {
+			delete(w.base, p)
+			continue
+		}
+		isDir := w.base[p] != nil && w.base[p].IsDir
+		var err error
+		if isDir {
+			_, err = w.c.DeleteDir(ctx, w.remotePath(p), false)
+			deletedDirs = append(deletedDirs, p)
+		} else {
+			_, err = w.c.Delete(ctx, w.remotePath(p), false)
+		}
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			w.retry(SyncAction{Op: SyncDeleteRemote, Path: p, IsDir: isDir, Err: err})
+			continue
+		}
+		delete(w.base, p)
+		w.report(SyncAction{Op: SyncDeleteRemote, Path: p, IsDir: isDir})
+	}
+}
+
+// remoteParent 远程路径的上级目录，根目录为空串
+func remoteParent(p string) string {
+	if dir := path.Dir(p); dir != "." {
+		return dir
+	}
+	return ""
+}
+
+// move 在远程把 from 移动（并重命名）为 to，均为相对路径
+func (w *watcher) move(ctx context.Context, from, to string) error {
+	orig, dst := w.remotePath(from), w.remotePath(to)
+	src := orig
+	if remoteParent(src) != remoteParent(dst) {
+		if _, err := w.c.Move(ctx, src, remoteParent(dst), ConflictFail); err != nil {
+			return err
+		}
+		src = path.Join(remoteParent(dst), path.Base(src))
+	}
+	if src == dst {
+		return nil
+	}
+	err := w.c.Rename(ctx, src, dst)
+	if err != nil && src != orig {
+		// 重命名失败时把文件移回原处，调用方随后会上传新文件并删除原文件；
+		// 移不回去就删除中间位置的副本，避免在远程留下多余的文件
+		if _, merr := w.c.Move(ctx, src, remoteParent(orig), ConflictFail); merr != nil {
+			w.c.Delete(ctx, src, false)
+		}
+	}
+	return err
+}
+
+// upload 分块上传本地文件，覆盖远程同名文件
+func (w *watcher) upload(ctx context.Context, p string) error {
+	_, _, err := w.c.ChunkedUpload(ctx, w.localPath(p), remoteParent(w.remotePath(p)), &ChunkedOptions{
+		ChunkSize:  w.opts.ChunkSize,
+		OnConflict: ConflictOverwrite,
+	})
+	return err
+}
@@ -0,0 +1,71 @@
+// 分块上传示例：go run ./cmd/chunkupload <文件路径> [目标目录]
+//
+// 服务器地址取自 UPLOAD_URL（默认 http://localhost:8000），设置了 DRIVE_TOKEN 时附带认证头
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"single_drive/client"
+)
+
+const chunkSize = 1024 * 1024 // 1MB per chunk
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println("用法: go run ./cmd/chunkupload <文件路径> [目标目录]")
+		fmt.Println("示例: go run ./cmd/chunkupload test.txt")
+		fmt.Println("示例: go run ./cmd/chunkupload test.txt test/data")
+		os.Exit(1)
+	}
+
+	filePath := os.Args[1]
+	targetPath := ""
+	if len(os.Args) > 2 {
+		targetPath = os.Args[2]
+	}
+	serverURL := os.Getenv("UPLOAD_URL")
+	if serverURL == "" {
+		serverURL = "http://localhost:8000"
+	}
+
+	fmt.Printf("========== 分块上传测试 ==========\n")
+	fmt.Printf("文件路径: %s\n", filePath)
+	fmt.Printf("目标路径: %s\n", targetPath)
+	fmt.Printf("服务器地址: %s\n", serverURL)
+	fmt.Printf("==================================\n\n")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	c := client.New(serverURL, os.Getenv("DRIVE_TOKEN"))
+	quick, res, err := c.ChunkedUpload(ctx, filePath, targetPath, &client.ChunkedOptions{
+		ChunkSize: chunkSize,
+		OnProgress: func(sent, total int64) {
+			percent := 100.0
+			if total > 0 {
+				percent = float64(sent) * 100 / float64(total)
+			}
+			fmt.Printf("  进度: %.2f%% (%d/%d bytes)\n", percent, sent, total)
+		},
+	})
+	if err != nil {
+		fmt.Printf("✗ 上传失败: %v\n", err)
+		os.Exit(1)
+	}
+	switch {
+	case res == nil && quick.ExistingID != 0:
+		fmt.Printf("✓ 秒传成功！文件已存在 (ID: %d)\n", quick.ExistingID)
+	case res == nil:
+		fmt.Printf("✓ %s\n", quick.Message)
+	default:
+		fmt.Printf("✓ 上传完成！uploadId: %s, 状态: %s\n", res.UploadID, res.Status)
+		if res.Conflict != nil && res.Conflict.Conflict {
+			fmt.Printf("  同名冲突，按 %s 处理: %s\n", res.Conflict.Policy, res.Conflict.Path)
+		}
+	}
+
+	fmt.Printf("\n✓ 测试完成！\n")
+}
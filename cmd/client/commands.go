@@ -0,0 +1,793 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"single_drive/client"
+	"single_drive/shared"
+)
+
+// cleanRemote 规范化远程路径：去掉首尾的 /，根目录为空串
+func cleanRemote(p string) string {
+	return strings.Trim(path.Clean("/"+p), "/")
+}
+
+// displayPath 输出时根目录显示为 /
+func displayPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	return p
+}
+
+func hasGlob(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
+
+// expand 展开远程路径中的通配符，按参数顺序返回匹配的节点；没有匹配或路径不存在时报错
+func expand(tree *client.Tree, patterns []string) ([]*client.Node, error) {
+	var nodes []*client.Node
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		pattern = cleanRemote(pattern)
+		if !hasGlob(pattern) {
+			n, ok := tree.Lookup(pattern)
+			if !ok {
+				return nil, fmt.Errorf("%s: no such file or directory", pattern)
+			}
+			if !seen[pattern] {
+				seen[pattern] = true
+				nodes = append(nodes, n)
+			}
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%s: %v", pattern, err)
+		}
+		var matched []string
+		for _, p := range tree.Paths() {
+			// 与 shell 一致，* 不跨越目录层级
+			if ok, _ := path.Match(pattern, p); ok {
+				matched = append(matched, p)
+			}
+		}
+		if len(matched) == 0 {
+			return nil, fmt.Errorf("%s: no match", pattern)
+		}
+		sort.Strings(matched)
+		for _, p := range matched {
+			if !seen[p] {
+				seen[p] = true
+				n, _ := tree.Lookup(p)
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	return nodes, nil
+}
+
+// expandLocal 展开本地路径中的通配符
+func expandLocal(patterns []string) ([]string, error) {
+	var paths []string
+	for _, pattern := range patterns {
+		if !hasGlob(pattern) {
+			if _, err := os.Stat(pattern); err != nil {
+				return nil, err
+			}
+			paths = append(paths, pattern)
+			continue
+		}
+		matched, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", pattern, err)
+		}
+		if len(matched) == 0 {
+			return nil, fmt.Errorf("%s: no match", pattern)
+		}
+		paths = append(paths, matched...)
+	}
+	return paths, nil
+}
+
+// remoteDir 查找作为目标的远程目录
+func remoteDir(tree *client.Tree, p string) (string, error) {
+	p = cleanRemote(p)
+	n, ok := tree.Lookup(p)
+	if !ok {
+		return "", fmt.Errorf("%s: no such directory", p)
+	}
+	if !n.IsDir {
+		return "", fmt.Errorf("%s: not a directory", p)
+	}
+	return p, nil
+}
+
+// entry ls 的输出项
+type entry struct {
+	Path    string   `json:"path"`
+	Name    string   `json:"name"`
+	Size    int64    `json:"size"`
+	IsDir   bool     `json:"is_dir"`
+	Tags    []string `json:"tags,omitempty"`
+	Starred bool     `json:"starred,omitempty"`
+}
+
+func newEntry(n *client.Node) entry {
+	return entry{Path: n.Path, Name: path.Base(n.Path), Size: n.Capacity, IsDir: n.IsDir, Tags: n.Tags, Starred: n.Starred}
+}
+
+// kvFlags 可重复的 key=value 选项
+type kvFlags url.Values
+
+func (f kvFlags) String() string { return url.Values(f).Encode() }
+
+func (f kvFlags) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("expected key=value, got %q", s)
+	}
+	url.Values(f).Add(k, v)
+	return nil
+}
+
+// parseExpires 解析有效期，在 time.ParseDuration 的基础上支持 d（天）
+func parseExpires(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
+
+// highlight 把搜索摘要中的 <mark> 换成终端高亮并还原 HTML 转义
+func highlight(snippet string) string {
+	snippet = strings.NewReplacer("<mark>", "\x1b[1;33m", "</mark>", "\x1b[0m").Replace(snippet)
+	return html.UnescapeString(strings.Join(strings.Fields(snippet), " "))
+}
+
+// printInfo 逐行输出文件信息，没有的字段不输出
+func printInfo(w io.Writer, p string, info *client.FileInfo) {
+	field := func(k string, v any) { fmt.Fprintf(w, "%-12s %v\n", k+":", v) }
+	field("path", displayPath(p))
+	if info.IsDir {
+		field("type", "directory")
+	} else {
+		field("type", "file")
+		field("size", fmt.Sprintf("%s (%d)", formatSize(info.Size), info.Size))
+	}
+	field("mode", info.Mode)
+	field("modified", info.ModTime.Local().Format(time.DateTime))
+	if len(info.Tags) > 0 {
+		field("tags", strings.Join(info.Tags, ", "))
+	}
+	if info.Starred {
+		field("starred", true)
+	}
+	if m := info.Metadata; m != nil {
+		field("mime", m.MIME)
+		if m.Width > 0 {
+			field("dimensions", fmt.Sprintf("%dx%d", m.Width, m.Height))
+		}
+		if m.DurationMS > 0 {
+			field("duration", time.Duration(m.DurationMS)*time.Millisecond)
+		}
+		if m.Pages > 0 {
+			field("pages", m.Pages)
+		}
+		if m.Camera != "" {
+			field("camera", m.Camera)
+		}
+		if m.TakenAt != nil {
+			field("taken", m.TakenAt.Local().Format(time.DateTime))
+		}
+	}
+	for _, k := range sortedKeys(info.Properties) {
+		field("prop."+k, info.Properties[k])
+	}
+}
+
+func init() {
+	commands = append(commands,
+		&command{
+			name:    "ls",
+			args:    "[路径...]",
+			summary: "列出目录内容（默认根目录）",
+			setup: func(fs *flag.FlagSet) func(a *app, args []string) error {
+				long := fs.Bool("l", false, "显示大小、标签等详细信息")
+				return func(a *app, args []string) error {
+					tree, err := a.api.List(a.ctx)
+					if err != nil {
+						return err
+					}
+					if len(args) == 0 {
+						args = []string{""}
+					}
+					nodes, err := expand(tree, args)
+					if err != nil {
+						return err
+					}
+					groups := make([][]entry, len(nodes))
+					var all []entry
+					for i, n := range nodes {
+						if !n.IsDir {
+							groups[i] = []entry{newEntry(n)}
+						} else {
+							for _, child := range n.Children {
+								groups[i] = append(groups[i], newEntry(child))
+							}
+							sort.Slice(groups[i], func(x, y int) bool { return groups[i][x].Name < groups[i][y].Name })
+						}
+						all = append(all, groups[i]...)
+					}
+					if all == nil {
+						all = []entry{}
+					}
+					return a.emit(all, func(w io.Writer) {
+						for i, n := range nodes {
+							if len(nodes) > 1 && n.IsDir {
+								if i > 0 {
+									fmt.Fprintln(w)
+								}
+								fmt.Fprintf(w, "%s:\n", displayPath(n.Path))
+							}
+							for _, e := range groups[i] {
+								name := e.Name
+								if !n.IsDir {
+									name = e.Path
+								}
+								if e.IsDir {
+									name += "/"
+								}
+								if !*long {
+									fmt.Fprintln(w, name)
+									continue
+								}
+								size, star := "-", " "
+								if !e.IsDir {
+									size = formatSize(e.Size)
+								}
+								if e.Starred {
+									star = "*"
+								}
+								fmt.Fprintf(w, "%s %8s  %s", star, size, name)
+								if len(e.Tags) > 0 {
+									fmt.Fprintf(w, "  [%s]", strings.Join(e.Tags, ", "))
+								}
+								fmt.Fprintln(w)
+							}
+						}
+					})
+				}
+			},
+		},
+		&command{
+			name:    "tree",
+			args:    "[路径]",
+			summary: "以树形显示目录结构",
+			setup: func(fs *flag.FlagSet) func(a *app, args []string) error {
+				depth := fs.Int("L", 0, "最大显示层数（0 表示不限）")
+				return func(a *app, args []string) error {
+					tree, err := a.api.List(a.ctx)
+					if err != nil {
+						return err
+					}
+					if len(args) == 0 {
+						args = []string{""}
+					}
+					nodes, err := expand(tree, args[:1])
+					if err != nil {
+						return err
+					}
+					root := nodes[0]
+					return a.emit(root, func(w io.Writer) {
+						fmt.Fprintln(w, displayPath(root.Path))
+						dirs, files := 0, 0
+						var walk func(n *client.Node, prefix string, level int)
+						walk = func(n *client.Node, prefix string, level int) {
+							children := append([]*client.Node(nil), n.Children...)
+							sort.Slice(children, func(i, j int) bool { return children[i].Path < children[j].Path })
+							for i, child := range children {
+								branch, next := "├── ", "│   "
+								if i == len(children)-1 {
+									branch, next = "└── ", "    "
+								}
+								name := path.Base(child.Path)
+								if child.IsDir {
+									dirs++
+									name += "/"
+								} else {
+									files++
+								}
+								fmt.Fprintln(w, prefix+branch+name)
+								if child.IsDir && (*depth == 0 || level < *depth) {
+									walk(child, prefix+next, level+1)
+								}
+							}
+						}
+						walk(root, "", 1)
+						fmt.Fprintf(w, "\n%d directories, %d files\n", dirs, files)
+					})
+				}
+			},
+		},
+		&command{
+			name:    "put",
+			args:    "<本地路径...> <远程目录>",
+			summary: "上传文件；目录需加 -r，打包为 tar.gz 流式上传",
+			minArgs: 2,
+			setup: func(fs *flag.FlagSet) func(a *app, args []string) error {
+				recursive := fs.Bool("r", false, "递归上传目录")
+				policy := fs.String("on-conflict", "", "同名冲突策略：rename、overwrite、skip 或 fail（默认由服务器决定）")
+				return func(a *app, args []string) error {
+					locals, err := expandLocal(args[:len(args)-1])
+					if err != nil {
+						return err
+					}
+					tree, err := a.api.List(a.ctx)
+					if err != nil {
+						return err
+					}
+					dir, err := remoteDir(tree, args[len(args)-1])
+					if err != nil {
+						return err
+					}
+					for _, local := range locals {
+						info, err := os.Stat(local)
+						if err != nil {
+							return err
+						}
+						if info.IsDir() && !*recursive {
+							return fmt.Errorf("%s is a directory (use -r)", local)
+						}
+					}
+					var results []any
+					for _, local := range locals {
+						info, _ := os.Stat(local)
+						if info.IsDir() {
+							res, err := a.api.UploadDir(a.ctx, local, dir, client.ConflictPolicy(*policy))
+							if err != nil {
+								return fmt.Errorf("%s: %v", local, err)
+							}
+							results = append(results, res)
+							if !a.json {
+								fmt.Fprintf(a.stdout, "%s -> %s（%d 个文件，%d 个目录，%s）\n", local, displayPath(res.Path), res.Files, res.Directories, formatSize(res.Bytes))
+							}
+							continue
+						}
+						res, err := a.api.UploadFile(a.ctx, local, dir, &client.UploadOptions{OnConflict: client.ConflictPolicy(*policy)})
+						if err != nil {
+							return fmt.Errorf("%s: %v", local, err)
+						}
+						results = append(results, res)
+						if !a.json {
+							note := ""
+							if res.Conflict != nil && res.Conflict.Conflict {
+								note = "（" + res.Conflict.Action + "）"
+							}
+							fmt.Fprintf(a.stdout, "%s -> %s%s\n", local, res.Path, note)
+						}
+					}
+					if a.json {
+						return a.emit(results, nil)
+					}
+					return nil
+				}
+			},
+		},
+		&command{
+			name:    "get",
+			args:    "<远程路径...> [本地路径]",
+			summary: "下载文件到本地目录（默认当前目录）；目录需加 -r",
+			minArgs: 1,
+			setup: func(fs *flag.FlagSet) func(a *app, args []string) error {
+				recursive := fs.Bool("r", false, "递归下载目录")
+				format := fs.String("format", "", "目录下载使用的归档格式：zip、tar、tar.gz 或 tar.zst")
+				return func(a *app, args []string) error {
+					archive := *format
+					if archive == "" {
+						if archive = a.cfg.Archive; archive == "" {
+							archive = defaultArchive
+						}
+					}
+					dest := "."
+					if len(args) > 1 {
+						dest, args = args[len(args)-1], args[:len(args)-1]
+					}
+					tree, err := a.api.List(a.ctx)
+					if err != nil {
+						return err
+					}
+					nodes, err := expand(tree, args)
+					if err != nil {
+						return err
+					}
+					for _, n := range nodes {
+						if n.Path == "" {
+							return fmt.Errorf("cannot download the root directory, download its entries instead")
+						}
+						if n.IsDir && !*recursive {
+							return fmt.Errorf("%s is a directory (use -r)", n.Path)
+						}
+					}
+					info, statErr := os.Stat(dest)
+					destIsDir := statErr == nil && info.IsDir()
+					if !destIsDir && len(nodes) > 1 {
+						return fmt.Errorf("%s: not a directory", dest)
+					}
+					type result struct {
+						Path  string `json:"path"`
+						Local string `json:"local"`
+						Size  int64  `json:"size,omitempty"`
+					}
+					var results []result
+					for _, n := range nodes {
+						local := dest
+						if destIsDir {
+							local = filepath.Join(dest, path.Base(n.Path))
+						}
+						var size int64
+						if n.IsDir {
+							err = a.api.DownloadDirTo(a.ctx, n.Path, local, archive, shared.DefaultExtractOptions)
+						} else {
+							size, err = a.api.DownloadFile(a.ctx, n.Path, local)
+						}
+						if err != nil {
+							return fmt.Errorf("%s: %v", n.Path, err)
+						}
+						results = append(results, result{Path: n.Path, Local: local, Size: size})
+						if !a.json {
+							fmt.Fprintf(a.stdout, "%s -> %s\n", n.Path, local)
+						}
+					}
+					if a.json {
+						return a.emit(results, nil)
+					}
+					return nil
+				}
+			},
+		},
+		&command{
+			name:    "rm",
+			args:    "<远程路径...>",
+			summary: "删除文件或目录（默认移入回收站）",
+			minArgs: 1,
+			setup: func(fs *flag.FlagSet) func(a *app, args []string) error {
+				recursive := fs.Bool("r", false, "删除目录")
+				permanent := fs.Bool("permanent", false, "彻底删除，不进入回收站")
+				force := fs.Bool("f", false, "忽略不存在的路径")
+				return func(a *app, args []string) error {
+					tree, err := a.api.List(a.ctx)
+					if err != nil {
+						return err
+					}
+					var nodes []*client.Node
+					for _, arg := range args {
+						matched, err := expand(tree, []string{arg})
+						if err != nil {
+							if *force {
+								continue
+							}
+							return err
+						}
+						nodes = append(nodes, matched...)
+					}
+					for _, n := range nodes {
+						if n.Path == "" {
+							return fmt.Errorf("refusing to remove the root directory")
+						}
+						if n.IsDir && !*recursive {
+							return fmt.Errorf("%s is a directory (use -r)", n.Path)
+						}
+					}
+					removed := []string{}
+					for _, n := range nodes {
+						remove := a.api.Delete
+						if n.IsDir {
+							remove = a.api.DeleteDir
+						}
+						if _, err := remove(a.ctx, n.Path, *permanent); err != nil {
+							// 上级目录已在本次命令中删除
+							if *force && errors.Is(err, client.ErrNotFound) {
+								continue
+							}
+							return fmt.Errorf("%s: %v", n.Path, err)
+						}
+						removed = append(removed, n.Path)
+					}
+					return a.emit(map[string]any{"removed": removed, "permanent": *permanent}, func(w io.Writer) {
+						for _, p := range removed {
+							fmt.Fprintf(w, "已删除 %s\n", p)
+						}
+					})
+				}
+			},
+		},
+		&command{
+			name:    "mv",
+			args:    "<远程路径...> <目标>",
+			summary: "移动或重命名；目标为已有目录时移动到其下",
+			minArgs: 2,
+			setup: func(fs *flag.FlagSet) func(a *app, args []string) error {
+				policy := fs.String("on-conflict", "", "移动到目录下时的同名冲突策略")
+				return func(a *app, args []string) error {
+					tree, err := a.api.List(a.ctx)
+					if err != nil {
+						return err
+					}
+					nodes, err := expand(tree, args[:len(args)-1])
+					if err != nil {
+						return err
+					}
+					dst := cleanRemote(args[len(args)-1])
+					target, exists := tree.Lookup(dst)
+					type result struct {
+						From     string           `json:"from"`
+						To       string           `json:"to"`
+						Conflict *client.Conflict `json:"conflict,omitempty"`
+					}
+					var results []result
+					if exists && target.IsDir {
+						for _, n := range nodes {
+							conflict, err := a.api.Move(a.ctx, n.Path, dst, client.ConflictPolicy(*policy))
+							if err != nil {
+								return fmt.Errorf("%s: %v", n.Path, err)
+							}
+							to := path.Join(dst, path.Base(n.Path))
+							if conflict != nil && conflict.Path != "" {
+								to = conflict.Path
+							}
+							results = append(results, result{From: n.Path, To: to, Conflict: conflict})
+						}
+					} else {
+						if len(nodes) > 1 {
+							return fmt.Errorf("%s: not a directory", displayPath(dst))
+						}
+						if exists {
+							return fmt.Errorf("%s already exists", dst)
+						}
+						src := nodes[0]
+						parent := cleanRemote(path.Dir(dst))
+						if _, err := remoteDir(tree, parent); err != nil {
+							return err
+						}
+						// 先移动到目标的上级目录，再重命名
+						from := src.Path
+						if parent != cleanRemote(path.Dir(src.Path)) {
+							if _, err := a.api.Move(a.ctx, src.Path, parent, client.ConflictFail); err != nil {
+								return err
+							}
+							from = path.Join(parent, path.Base(src.Path))
+						}
+						if from != dst {
+							if err := a.api.Rename(a.ctx, from, dst); err != nil {
+								return err
+							}
+						}
+						results = append(results, result{From: src.Path, To: dst})
+					}
+					return a.emit(results, func(w io.Writer) {
+						for _, r := range results {
+							fmt.Fprintf(w, "%s -> %s\n", r.From, r.To)
+						}
+					})
+				}
+			},
+		},
+		&command{
+			name:    "cp",
+			args:    "<远程路径...> <目标目录>",
+			summary: "复制到已有目录下；目录需加 -r",
+			minArgs: 2,
+			setup: func(fs *flag.FlagSet) func(a *app, args []string) error {
+				recursive := fs.Bool("r", false, "递归复制目录")
+				policy := fs.String("on-conflict", "", "同名冲突策略")
+				return func(a *app, args []string) error {
+					tree, err := a.api.List(a.ctx)
+					if err != nil {
+						return err
+					}
+					nodes, err := expand(tree, args[:len(args)-1])
+					if err != nil {
+						return err
+					}
+					dst, err := remoteDir(tree, args[len(args)-1])
+					if err != nil {
+						return err
+					}
+					for _, n := range nodes {
+						if n.IsDir && !*recursive {
+							return fmt.Errorf("%s is a directory (use -r)", displayPath(n.Path))
+						}
+					}
+					type result struct {
+						From     string           `json:"from"`
+						To       string           `json:"to"`
+						Conflict *client.Conflict `json:"conflict,omitempty"`
+					}
+					var results []result
+					for _, n := range nodes {
+						conflict, err := a.api.Copy(a.ctx, n.Path, dst, client.ConflictPolicy(*policy))
+						if err != nil {
+							return fmt.Errorf("%s: %v", n.Path, err)
+						}
+						to := path.Join(dst, path.Base(n.Path))
+						if conflict != nil && conflict.Path != "" {
+							to = conflict.Path
+						}
+						results = append(results, result{From: n.Path, To: to, Conflict: conflict})
+					}
+					return a.emit(results, func(w io.Writer) {
+						for _, r := range results {
+							fmt.Fprintf(w, "%s -> %s\n", r.From, r.To)
+						}
+					})
+				}
+			},
+		},
+		&command{
+			name:    "mkdir",
+			args:    "<远程目录...>",
+			summary: "创建目录",
+			minArgs: 1,
+			setup: func(fs *flag.FlagSet) func(a *app, args []string) error {
+				parents := fs.Bool("p", false, "一并创建上级目录，目录已存在时不报错")
+				return func(a *app, args []string) error {
+					var tree *client.Tree
+					if !*parents {
+						var err error
+						if tree, err = a.api.List(a.ctx); err != nil {
+							return err
+						}
+					}
+					created := []string{}
+					for _, arg := range args {
+						dir := cleanRemote(arg)
+						if dir == "" {
+							continue
+						}
+						if tree != nil {
+							if _, ok := tree.Lookup(dir); ok {
+								return fmt.Errorf("%s already exists", dir)
+							}
+							if _, err := remoteDir(tree, path.Dir(dir)); err != nil {
+								return fmt.Errorf("cannot create %s: %v (use -p)", dir, err)
+							}
+						}
+						ok, err := a.api.Mkdir(a.ctx, dir)
+						if err != nil {
+							return fmt.Errorf("%s: %v", dir, err)
+						}
+						if ok {
+							created = append(created, dir)
+						}
+					}
+					return a.emit(map[string]any{"created": created}, func(w io.Writer) {
+						for _, dir := range created {
+							fmt.Fprintf(w, "已创建 %s\n", dir)
+						}
+					})
+				}
+			},
+		},
+		&command{
+			name:    "info",
+			args:    "<远程路径...>",
+			summary: "显示文件或目录的详细信息",
+			minArgs: 1,
+			setup: func(fs *flag.FlagSet) func(a *app, args []string) error {
+				return func(a *app, args []string) error {
+					tree, err := a.api.List(a.ctx)
+					if err != nil {
+						return err
+					}
+					nodes, err := expand(tree, args)
+					if err != nil {
+						return err
+					}
+					var infos []*client.FileInfo
+					for _, n := range nodes {
+						info, err := a.api.Info(a.ctx, n.Path)
+						if err != nil {
+							return fmt.Errorf("%s: %v", n.Path, err)
+						}
+						infos = append(infos, info)
+					}
+					var v any = infos
+					if len(infos) == 1 {
+						v = infos[0]
+					}
+					return a.emit(v, func(w io.Writer) {
+						for i, info := range infos {
+							if i > 0 {
+								fmt.Fprintln(w)
+							}
+							printInfo(w, nodes[i].Path, info)
+						}
+					})
+				}
+			},
+		},
+		&command{
+			name:    "search",
+			args:    "<关键词...>",
+			summary: "按文件名与内容搜索",
+			minArgs: 1,
+			setup: func(fs *flag.FlagSet) func(a *app, args []string) error {
+				limit := fs.Int("limit", 0, "最多返回的结果数（0 使用服务器默认值）")
+				filters := kvFlags{}
+				fs.Var(filters, "f", "筛选条件 key=value，可重复（path、type、tag、starred、camera、has_gps 等）")
+				return func(a *app, args []string) error {
+					results, err := a.api.Search(a.ctx, strings.Join(args, " "), *limit, url.Values(filters))
+					if err != nil {
+						return err
+					}
+					if results == nil {
+						results = []client.SearchResult{}
+					}
+					return a.emit(results, func(w io.Writer) {
+						for _, r := range results {
+							name := r.Path
+							if r.IsDir {
+								name += "/"
+							} else {
+								name += "  " + formatSize(r.Capacity)
+							}
+							fmt.Fprintln(w, name)
+							for _, s := range r.Snippets {
+								fmt.Fprintf(w, "    %s\n", highlight(s))
+							}
+						}
+					})
+				}
+			},
+		},
+		&command{
+			name:    "share",
+			args:    "<远程路径>",
+			summary: "创建分享链接",
+			minArgs: 1,
+			setup: func(fs *flag.FlagSet) func(a *app, args []string) error {
+				password := fs.String("password", "", "访问密码")
+				expires := fs.String("expires", "", "有效期，如 24h、7d（默认不过期）")
+				maxDownloads := fs.Int("max-downloads", 0, "最多下载次数（0 表示不限）")
+				return func(a *app, args []string) error {
+					opts := client.ShareOptions{Path: cleanRemote(args[0]), Password: *password, MaxDownloads: *maxDownloads}
+					if *expires != "" {
+						d, err := parseExpires(*expires)
+						if err != nil {
+							return err
+						}
+						at := time.Now().Add(d).UTC()
+						opts.ExpiresAt = &at
+					}
+					link, err := a.api.Share(a.ctx, opts)
+					if err != nil {
+						return err
+					}
+					return a.emit(link, func(w io.Writer) {
+						fmt.Fprintln(w, link.URL)
+					})
+				}
+			},
+		},
+	)
+}
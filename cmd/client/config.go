@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"single_drive/client"
+
+	"golang.org/x/term"
+)
+
+// defaultServer 未配置服务器地址时使用
+const defaultServer = "http://localhost:8000"
+
+// defaultArchive 未配置归档格式时下载目录使用
+const defaultArchive = "tar.gz"
+
+// Config 配置文件内容；Token 优先，没有 Token 时用用户名密码登录换取会话
+type Config struct {
+	Server   string `json:"server,omitempty"`
+	Token    string `json:"token,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Archive  string `json:"archive,omitempty"` // 下载目录时的归档格式，默认 tar.gz
+}
+
+// defaultConfigPath 默认配置文件路径
+func defaultConfigPath() string {
+	if p := os.Getenv("DRIVE_CONFIG"); p != "" {
+		return p
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ".drive.json"
+	}
+	return filepath.Join(dir, "single_drive", "config.json")
+}
+
+// loadConfig 读取配置文件，文件不存在时返回空配置
+func loadConfig(p string) (*Config, error) {
+	cfg := &Config{}
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", p, err)
+	}
+	return cfg, nil
+}
+
+// save 写入配置文件，其中含有凭据，只允许当前用户读写
+func (cfg *Config) save(p string) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, append(data, '\n'), 0600)
+}
+
+// client 按 选项 > 环境变量 > 配置文件 的顺序确定服务器与凭据并创建客户端；
+// 只配置了用户名密码时先登录换取会话 JWT
+func (cfg *Config) client(ctx context.Context, server, token string) (*client.Client, error) {
+	pick := func(values ...string) string {
+		for _, v := range values {
+			if v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	c := client.New(pick(server, os.Getenv("UPLOAD_URL"), cfg.Server, defaultServer), pick(token, os.Getenv("DRIVE_TOKEN"), cfg.Token))
+	if c.Token == "" && cfg.Username != "" && cfg.Password != "" {
+		sess, err := c.Login(ctx, cfg.Username, cfg.Password)
+		if err != nil {
+			return nil, fmt.Errorf("login as %s failed: %v", cfg.Username, err)
+		}
+		c.Token = sess.Token
+	}
+	return c, nil
+}
+
+// readPassword 从终端读取密码（不回显）；标准输入不是终端时读取一行
+func readPassword(prompt string, stderr io.Writer) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		fmt.Fprint(stderr, prompt)
+		pw, err := term.ReadPassword(fd)
+		fmt.Fprintln(stderr)
+		return string(pw), err
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func init() {
+	commands = append(commands, &command{
+		name:    "login",
+		args:    "<用户名>",
+		summary: "登录并签发 API Token，连同服务器地址保存到配置文件",
+		minArgs: 1,
+		offline: true,
+		setup: func(fs *flag.FlagSet) func(a *app, args []string) error {
+			tokenName := fs.String("name", "drive-cli", "API Token 的名称")
+			savePassword := fs.Bool("save-password", false, "同时保存密码（每次运行重新登录），默认只保存 Token")
+			return func(a *app, args []string) error {
+				if a.api == nil {
+					c, err := a.cfg.client(a.ctx, "", "")
+					if err != nil {
+						return err
+					}
+					a.api = c
+				}
+				password, err := readPassword("密码: ", a.stderr)
+				if err != nil {
+					return err
+				}
+				sess, err := a.api.Login(a.ctx, args[0], password)
+				if err != nil {
+					return err
+				}
+				a.api.Token = sess.Token
+				token, err := a.api.CreateToken(a.ctx, *tokenName, 0)
+				if err != nil {
+					return err
+				}
+				a.cfg.Server, a.cfg.Token, a.cfg.Username = a.api.BaseURL, token.Token, args[0]
+				a.cfg.Password = ""
+				if *savePassword {
+					a.cfg.Password = password
+				}
+				if err := a.cfg.save(a.configPath); err != nil {
+					return err
+				}
+				return a.emit(map[string]string{"server": a.cfg.Server, "username": args[0], "config": a.configPath}, func(w io.Writer) {
+					fmt.Fprintf(w, "已登录 %s（%s），配置已保存到 %s\n", a.cfg.Server, args[0], a.configPath)
+				})
+			}
+		},
+	})
+}
@@ -1,383 +1,203 @@
+// 网盘命令行客户端：drive [全局选项] <命令> [选项] [参数]
+//
+// 服务器地址与凭据按 命令行选项 > 环境变量（UPLOAD_URL、DRIVE_TOKEN）> 配置文件 的顺序取值，
+// 配置文件默认位于 <用户配置目录>/single_drive/config.json，可用 -config 或 DRIVE_CONFIG 指定，
+// drive login 登录后会签发 API Token 并写入配置文件。远程路径以 / 分隔，支持 * ? [ ] 通配符。
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
-	"log"
-	"mime/multipart"
-	"net/http"
-	"net/url"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"sort"
 
-	"single_drive/shared"
+	"single_drive/client"
 )
 
-// Client 客户端结构体，管理文件和元数据
-type Client struct {
-	Files   []shared.FileObject // 本地文件对象缓存
-	Metas   []shared.MetaData   // 服务器端元数据缓存
-	BaseURL string              // 服务器地址
+// app 一次命令执行的上下文
+type app struct {
+	ctx        context.Context
+	cfg        *Config
+	configPath string
+	api        *client.Client
+	json       bool
+	stdout     io.Writer
+	stderr     io.Writer
 }
 
-// NewClient 创建新的客户端实例
-func NewClient(baseURL string) *Client {
-	if baseURL == "" {
-		baseURL = os.Getenv("UPLOAD_URL")
-	}
-	if baseURL == "" {
-		baseURL = "http://139.196.15.66:8000"
-	}
-	return &Client{
-		BaseURL: baseURL,
-		Files:   make([]shared.FileObject, 0),
-		Metas:   make([]shared.MetaData, 0),
-	}
+// command 子命令：setup 注册选项并返回执行函数
+type command struct {
+	name    string
+	args    string // 用法中的参数部分
+	summary string
+	minArgs int  // 最少参数个数
+	offline bool // 不需要连接服务器
+	setup   func(fs *flag.FlagSet) func(a *app, args []string) error
 }
 
-// StoreFileObject 将文件对象存储到本地目录
-func (c *Client) StoreFileObject(fo *shared.FileObject) error {
-	storageDir := `D:\drivetest`
-	absDir, err := filepath.Abs(storageDir)
-	if err != nil {
-		return err
-	}
-	if err := os.MkdirAll(absDir, os.ModePerm); err != nil {
-		return err
-	}
-	destPath := filepath.Join(absDir, fo.Name)
+var commands []*command
 
-	// write the file content to destination
-	if err := os.WriteFile(destPath, fo.Content, 0644); err != nil {
-		return err
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
 	}
-
-	// 添加到本地缓存
-	c.Files = append(c.Files, *fo)
 	return nil
 }
 
-// UploadFileObject 上传文件对象到服务器
-// relativePath 参数指定文件在服务器上的相对路径（相对于 uploads 目录）
-func (c *Client) UploadFileObject(fo *shared.FileObject, meta *shared.MetaData, relativePath string) error {
-	uploadURL := c.BaseURL + "/upload"
-
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-
-	part, err := writer.CreateFormFile("file", fo.Name)
-	if err != nil {
-		return err
-	}
-
-	if _, err = part.Write(fo.Content); err != nil {
-		writer.Close()
-		return err
-	}
-
-	// 序列化 meta 为 JSON 并作为字段上传
-	metaJSON, err := json.Marshal(meta)
-	if err != nil {
-		writer.Close()
-		return err
-	}
-	_ = writer.WriteField("meta", string(metaJSON))
-
-	// 使用传入的相对路径
-	if relativePath != "" {
-		_ = writer.WriteField("path", relativePath)
-	}
-
-	if err = writer.Close(); err != nil {
-		return err
-	}
-
-	req, err := http.NewRequest("POST", uploadURL, body)
-	if err != nil {
-		return err
-	}
-
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("上传失败，状态码: %d", resp.StatusCode)
+func usage(w io.Writer, global *flag.FlagSet) {
+	fmt.Fprintln(w, "用法: drive [全局选项] <命令> [选项] [参数]")
+	fmt.Fprintln(w, "\n命令:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-7s %s\n", cmd.name, cmd.summary)
 	}
-
-	fmt.Printf("文件 %s 已上传到服务器\n", fo.Name)
-
-	// 上传成功后自动刷新服务器端元数据缓存
-	if err := c.RefreshMetaList(); err != nil {
-		fmt.Printf("warning: 刷新元数据列表失败: %v\n", err)
-	}
-
-	return nil
+	fmt.Fprintln(w, "\n全局选项:")
+	global.SetOutput(w)
+	global.PrintDefaults()
+	fmt.Fprintln(w, "\n使用 drive <命令> -h 查看命令的选项")
 }
 
-func (c *Client) UploadFileTree(ft *shared.FileTree, basePath string) error {
-	// 构造当前节点的完整路径（使用正斜杠以保证跨平台兼容性）
-	currentPath := ft.Name
-	if basePath != "" {
-		currentPath = basePath + "/" + ft.Name
-	}
-
-	if ft.IsDir {
-		// 目录：先创建目录节点
-		createDirURL := fmt.Sprintf("%s/createdir?path=%s", c.BaseURL, url.QueryEscape(currentPath))
-		resp, err := http.Post(createDirURL, "application/json", nil)
-		if err != nil {
-			return fmt.Errorf("创建目录 %s 失败: %v", currentPath, err)
-		}
-		defer resp.Body.Close()
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
 
-		if resp.StatusCode != http.StatusOK {
-			bodyBytes, _ := io.ReadAll(resp.Body)
-			return fmt.Errorf("创建目录 %s 失败，状态码: %d, 响应: %s", currentPath, resp.StatusCode, string(bodyBytes))
+// run 解析参数并执行命令，返回进程退出码
+func run(argv []string, stdout, stderr io.Writer) int {
+	global := flag.NewFlagSet("drive", flag.ContinueOnError)
+	configPath := global.String("config", "", "配置文件路径（默认 $DRIVE_CONFIG 或用户配置目录下的 single_drive/config.json）")
+	server := global.String("server", "", "服务器地址（覆盖 UPLOAD_URL 与配置文件）")
+	token := global.String("token", "", "API Token（覆盖 DRIVE_TOKEN 与配置文件）")
+	owner := global.Int64("owner", 0, "访问其他用户共享给自己的命名空间（用户 ID）")
+	jsonOut := global.Bool("json", false, "以 JSON 输出结果")
+	global.SetOutput(stderr)
+	global.Usage = func() { usage(stderr, global) }
+	if err := global.Parse(argv); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
 		}
-
-		fmt.Printf("✓ 创建目录: %s\n", currentPath)
-
-		// 递归上传子节点
-		for _, child := range ft.Children {
-			if err := c.UploadFileTree(&child, currentPath); err != nil {
-				return err
+		return 2
+	}
+	if global.NArg() == 0 {
+		usage(stderr, global)
+		return 2
+	}
+	name, args := global.Arg(0), global.Args()[1:]
+	if name == "help" {
+		if len(args) > 0 {
+			if cmd := findCommand(args[0]); cmd != nil {
+				fs, _ := commandFlags(cmd, stdout)
+				fs.Usage()
+				return 0
 			}
 		}
-	} else {
-		// 文件：使用 FileObject 上传
-		if ft.Fileobj == nil {
-			return fmt.Errorf("文件 %s 的 Fileobj 为空", currentPath)
-		}
-
-		meta := &shared.MetaData{
-			Name:     ft.Fileobj.Name,
-			Capacity: ft.Fileobj.Capacity,
-		}
-
-		// 传递文件所在的目录路径（不包括文件名本身）
-		if err := c.UploadFileObject(ft.Fileobj, meta, basePath); err != nil {
-			return fmt.Errorf("上传文件 %s 失败: %v", currentPath, err)
+		usage(stdout, global)
+		return 0
+	}
+	cmd := findCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(stderr, "drive: 未知命令 %q\n\n", name)
+		usage(stderr, global)
+		return 2
+	}
+	fs, runCmd := commandFlags(cmd, stderr)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
 		}
-		fmt.Printf("✓ 上传文件: %s (%d 字节)\n", currentPath, ft.Capacity)
-	}
-
-	return nil
-}
-
-// RefreshMetaList 从服务器获取最新的元数据列表并更新缓存
-func (c *Client) RefreshMetaList() error {
-	resp, err := http.Get(c.BaseURL + "/list?format=simple")
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned status %d", resp.StatusCode)
+		return 2
 	}
-
-	var metas []shared.MetaData
-	if err := json.NewDecoder(resp.Body).Decode(&metas); err != nil {
-		return err
+	if fs.NArg() < cmd.minArgs {
+		fmt.Fprintf(stderr, "drive %s: 缺少参数\n\n", cmd.name)
+		fs.Usage()
+		return 2
 	}
 
-	c.Metas = metas
-	fmt.Printf("已刷新元数据列表，共 %d 项\n", len(c.Metas))
-	return nil
-}
-
-// DeleteFile 删除服务器上的文件
-func (c *Client) DeleteFile(filename string) error {
-	delURL := fmt.Sprintf("%s/delete?name=%s", c.BaseURL, url.QueryEscape(filename))
-	req, err := http.NewRequest(http.MethodDelete, delURL, nil)
-	if err != nil {
-		return err
+	// Ctrl+C 取消进行中的请求，未完成的下载不会留下半截文件
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	a := &app{ctx: ctx, json: *jsonOut, stdout: stdout, stderr: stderr}
+	if a.configPath = *configPath; a.configPath == "" {
+		a.configPath = defaultConfigPath()
 	}
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	cfg, err := loadConfig(a.configPath)
 	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("delete failed: server returned %d", resp.StatusCode)
+		fmt.Fprintf(stderr, "drive: %v\n", err)
+		return 1
 	}
-
-	// 从本地文件缓存中移除
-	var newFiles []shared.FileObject
-	for _, f := range c.Files {
-		if f.Name != filename {
-			newFiles = append(newFiles, f)
+	a.cfg = cfg
+	if !cmd.offline || *server != "" {
+		if a.api, err = cfg.client(ctx, *server, *token); err != nil {
+			fmt.Fprintf(stderr, "drive: %v\n", err)
+			return 1
 		}
+		a.api.Owner = *owner
+	}
+	if err := runCmd(a, fs.Args()); err != nil {
+		if a.json {
+			data, _ := json.Marshal(map[string]string{"error": err.Error()})
+			fmt.Fprintln(stderr, string(data))
+		} else {
+			fmt.Fprintf(stderr, "drive %s: %v\n", cmd.name, err)
+		}
+		return 1
 	}
-	c.Files = newFiles
-
-	fmt.Printf("文件 %s 已从服务器删除\n", filename)
-
-	// 删除成功后自动刷新服务器端元数据缓存
-	if err := c.RefreshMetaList(); err != nil {
-		fmt.Printf("warning: 刷新元数据列表失败: %v\n", err)
-	}
-
-	return nil
+	return 0
 }
 
-func (c *Client) downloadFileObject(name string) error {
-	downloadURL := fmt.Sprintf("%s/download?name=%s", c.BaseURL, url.QueryEscape(name))
-	resp, err := http.Get(downloadURL)
-	if err != nil {
-		return err
-	}
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("download failed: server returned %d", resp.StatusCode)
-	}
-	defer resp.Body.Close()
-
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-	fmt.Printf("文件 %s 下载成功，大小 %d 字节\n", name, len(data))
-	// 保存到本地download文件夹
-	storageDir := "./download"
-	absDir, err := filepath.Abs(storageDir)
-	if err != nil {
-		return err
-	}
-	if err := os.MkdirAll(absDir, os.ModePerm); err != nil {
-		return err
-	}
-
-	destPath := filepath.Join(absDir, name)
-	if err := os.WriteFile(destPath, data, 0644); err != nil {
-		return err
+// commandFlags 创建子命令的选项集合，返回执行函数
+func commandFlags(cmd *command, w io.Writer) (*flag.FlagSet, func(a *app, args []string) error) {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(w)
+	runCmd := cmd.setup(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(w, "用法: drive %s [选项] %s\n\n%s\n", cmd.name, cmd.args, cmd.summary)
+		hasFlags := false
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintln(w, "\n选项:")
+			fs.PrintDefaults()
+		}
 	}
-	fmt.Printf("文件 %s 已保存到本地路径 %s\n", name, destPath)
-	return nil
+	return fs, runCmd
 }
 
-func (c *Client) DownloadFileTree(dirName string) error {
-	downloadURL := fmt.Sprintf("%s/downloaddir?dirname=%s", c.BaseURL, url.QueryEscape(dirName))
-	resp, err := http.Get(downloadURL)
-	if err != nil {
-		return err
-	}
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("download failed: server returned %d", resp.StatusCode)
-	}
-	defer resp.Body.Close()
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-	// 下载下来的文件是zip，所以需要解压
-	zipPath := "./download/" + dirName + ".zip"
-	if err := os.WriteFile(zipPath, data, 0644); err != nil {
-		return err
-	}
-	fmt.Printf("目录 %s 下载成功，已保存为 %s\n", dirName, zipPath)
-	// 解压zip文件
-	if err := shared.Unzip(zipPath, "./download/"+dirName); err != nil {
-		return err
+// emit 输出结果：JSON 模式下输出 v，否则调用 human
+func (a *app) emit(v any, human func(w io.Writer)) error {
+	if a.json {
+		enc := json.NewEncoder(a.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
 	}
-	defer os.Remove(zipPath) // 删除zip文件
-	fmt.Printf("目录 %s 已解压到 ./download/%s\n", dirName, dirName)
-
+	human(a.stdout)
 	return nil
 }
 
-func (c *Client) DeleteFileTree(dirName string) error {
-	delURL := fmt.Sprintf("%s/deletedir?dirname=%s", c.BaseURL, url.QueryEscape(dirName))
-	req, err := http.NewRequest(http.MethodDelete, delURL, nil)
-	if err != nil {
-		return err
-	}
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
+// sortedKeys 按字母顺序返回 map 的键
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("delete failed: server returned %d", resp.StatusCode)
-	}
-	fmt.Printf("目录 %s 已从服务器删除\n", dirName)
-	return nil
+	sort.Strings(keys)
+	return keys
 }
 
-func main() {
-	// 创建客户端实例
-	client := NewClient("")
-	// 读取测试文件
-	p, _ := filepath.Abs("test/app.js")
-	fo, meta, err := shared.NewFileObject(p)
-	if err != nil {
-		fmt.Print(err)
-		return
-	}
-
-	fmt.Printf("文件对象创建成功: %+v\n", meta)
-
-	// 存储文件到本地
-	if err := client.StoreFileObject(fo); err != nil {
-		fmt.Print(err)
-		return
-	}
-	fmt.Println("文件存储成功")
-
-	// 上传文件到服务器（会自动刷新元数据列表）
-	// 使用空字符串表示上传到根目录
-	if err := client.UploadFileObject(fo, meta, ""); err != nil {
-		fmt.Print(err)
-		return
-	}
-	fmt.Println("文件上传成功")
-
-	// 显示服务器上的所有文件
-	fmt.Printf("\n服务器文件列表: %+v\n", client.Metas)
-
-	// 下载文件示例
-	if err := client.downloadFileObject("app.js"); err != nil {
-		fmt.Print(err)
-		return
-	}
-
-	// 删除文件示例
-	if err := client.DeleteFile("app.js"); err != nil {
-		fmt.Print(err)
-		return
-	}
-	fmt.Println("文件删除成功")
-
-	fmt.Printf("\n服务器文件列表: %+v\n", client.Metas)
-
-	// 递归上传目录示例
-	ft, err := shared.ReadFileTree("test")
-	if err != nil {
-		log.Fatal(err)
+// formatSize 以 1024 为单位格式化字节数
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
 	}
-	err = client.UploadFileTree(ft, "") // 递归上传 test/ 目录
-	if err != nil {
-		log.Fatal(err)
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
 	}
-	fmt.Println("目录树上传成功")
-
-	//下载文件夹示例
-	err = client.DownloadFileTree("test")
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	fmt.Printf("\n服务器文件列表: %+v\n", client.Metas)
-
+	return fmt.Sprintf("%.1f%c", float64(n)/float64(div), "KMGTPE"[exp])
 }
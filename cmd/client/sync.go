@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"single_drive/client"
+)
+
+// syncSymbols 同步操作在终端输出中的标记
+var syncSymbols = map[client.SyncOp]string{
+	client.SyncUpload:       "↑",
+	client.SyncDownload:     "↓",
+	client.SyncMkdirLocal:   "↓+",
+	client.SyncMkdirRemote:  "↑+",
+	client.SyncDeleteLocal:  "↓-",
+	client.SyncDeleteRemote: "↑-",
+	client.SyncMoveRemote:   "↑>",
+	client.SyncConflict:     "!",
+	client.SyncSkip:         "?",
+}
+
+// printSyncAction 输出一个同步操作
+func printSyncAction(w io.Writer, a client.SyncAction) {
+	name := a.Path
+	if a.IsDir {
+		name += "/"
+	}
+	switch {
+	case a.Err != nil:
+		fmt.Fprintf(w, "%-2s %s: %v\n", "x", name, a.Err)
+	case a.Op == client.SyncMoveRemote:
+		fmt.Fprintf(w, "%-2s %s -> %s\n", syncSymbols[a.Op], a.From, name)
+	case a.Op == client.SyncConflict:
+		fmt.Fprintf(w, "%-2s %s（本地版本另存为 %s）\n", syncSymbols[a.Op], name, a.ConflictPath)
+	case a.Reason != "":
+		fmt.Fprintf(w, "%-2s %s（%s）\n", syncSymbols[a.Op], name, a.Reason)
+	default:
+		fmt.Fprintf(w, "%-2s %s\n", syncSymbols[a.Op], name)
+	}
+}
+
+// splitPatterns 解析逗号分隔的排除模式
+func splitPatterns(s string) []string {
+	var patterns []string
+	for _, pattern := range strings.Split(s, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+func init() {
+	commands = append(commands, &command{
+		name:    "sync",
+		args:    "<本地目录> <远程目录>",
+		summary: "双向同步本地目录与远程目录，两侧都修改的文件保留为冲突副本",
+		minArgs: 2,
+		setup: func(fs *flag.FlagSet) func(a *app, args []string) error {
+			dryRun := fs.Bool("n", false, "只显示将要执行的操作")
+			exclude := fs.String("exclude", "", "额外排除的文件名模式，逗号分隔（如 *.tmp,node_modules）")
+			state := fs.String("state", "", "状态文件路径（默认为本地目录下的 "+client.SyncStateFile+"）")
+			return func(a *app, args []string) error {
+				opts := &client.SyncOptions{StatePath: *state, DryRun: *dryRun, Exclude: splitPatterns(*exclude)}
+				if !a.json {
+					opts.OnAction = func(act client.SyncAction) { printSyncAction(a.stdout, act) }
+				}
+				res, err := a.api.Sync(a.ctx, args[0], cleanRemote(args[1]), opts)
+				if err != nil {
+					return err
+				}
+				if a.json {
+					if err := a.emit(res, nil); err != nil {
+						return err
+					}
+				} else if len(res.Actions) == 0 {
+					fmt.Fprintln(a.stdout, "已是最新")
+				}
+				if res.Errors > 0 {
+					return fmt.Errorf("%d operation(s) failed, they will be retried on the next sync", res.Errors)
+				}
+				return nil
+			}
+		},
+	}, &command{
+		name:    "watch",
+		args:    "<本地目录> <远程目录>",
+		summary: "监听本地目录，把新增、修改、移动与删除实时镜像到远程目录（Ctrl+C 退出）",
+		minArgs: 2,
+		setup: func(fs *flag.FlagSet) func(a *app, args []string) error {
+			debounce := fs.Duration("debounce", client.DefaultWatchDebounce, "文件最后一次变化后等待多久再上传")
+			exclude := fs.String("exclude", "", "额外排除的文件名模式，逗号分隔（如 *.tmp,node_modules）")
+			state := fs.String("state", "", "状态文件路径（默认为本地目录下的 "+client.SyncStateFile+"）")
+			chunkSize := fs.Int64("chunk-size", 0, "分块上传的分片大小（字节，0 使用默认值）")
+			return func(a *app, args []string) error {
+				enc := json.NewEncoder(a.stdout)
+				opts := &client.WatchOptions{
+					StatePath: *state,
+					Exclude:   splitPatterns(*exclude),
+					Debounce:  *debounce,
+					ChunkSize: *chunkSize,
+					OnAction: func(act client.SyncAction) {
+						if a.json {
+							// 持续运行的命令按行输出，便于管道逐条处理
+							enc.Encode(act)
+							return
+						}
+						fmt.Fprintf(a.stdout, "%s ", time.Now().Format(time.TimeOnly))
+						printSyncAction(a.stdout, act)
+					},
+					OnError: func(err error) {
+						fmt.Fprintf(a.stderr, "drive watch: %v\n", err)
+					},
+				}
+				if !a.json {
+					fmt.Fprintf(a.stdout, "正在监听 %s -> %s\n", args[0], displayPath(cleanRemote(args[1])))
+				}
+				err := a.api.Watch(a.ctx, args[0], cleanRemote(args[1]), opts)
+				if errors.Is(err, context.Canceled) {
+					return nil
+				}
+				return err
+			}
+		},
+	})
+}
@@ -24,5 +24,5 @@ func main() {
 	info, _ := os.Stat(filename)
 	fmt.Printf("✓ 创建测试文件: %s (%d bytes)\n", filename, info.Size())
 	fmt.Printf("\n现在可以使用以下命令测试上传:\n")
-	fmt.Printf("  go run chunk_upload_test.go ../test_upload_file.txt\n")
+	fmt.Printf("  go run ./cmd/chunkupload test_upload_file.txt\n")
 }
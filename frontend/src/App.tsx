@@ -2,6 +2,7 @@ import React from 'react';
 import { BrowserRouter as Router, Routes, Route } from 'react-router-dom';
 import MainLayout from './components/Layout/MainLayout';
 import HomePage from './pages/HomePage';
+import RecentPage from './pages/RecentPage';
 import './App.css';
 
 const App: React.FC = () => {
@@ -11,6 +12,7 @@ const App: React.FC = () => {
         <Route path="/" element={<MainLayout />}>
           <Route index element={<HomePage />} />
           <Route path="files/*" element={<HomePage />} />
+          <Route path="recent" element={<RecentPage />} />
         </Route>
       </Routes>
     </Router>
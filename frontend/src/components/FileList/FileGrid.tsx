@@ -18,6 +18,7 @@ import {
   VideoCameraOutlined,
 } from '@ant-design/icons';
 import { formatFileSize, getFileExtension } from '../../utils/helpers';
+import apiService from '../../services/api';
 import type { FileItem } from '../../types';
 import './FileGrid.css';
 
@@ -31,6 +32,9 @@ interface FileGridProps {
   onSelectChange: (keys: string[]) => void;
 }
 
+// 服务端可生成缩略图的图片格式
+const THUMBNAIL_EXTS = ['jpg', 'jpeg', 'png', 'gif', 'webp'];
+
 const FileGrid: React.FC<FileGridProps> = ({
   files,
   onDelete,
@@ -43,6 +47,7 @@ const FileGrid: React.FC<FileGridProps> = ({
   const [renameModalVisible, setRenameModalVisible] = useState(false);
   const [currentFile, setCurrentFile] = useState<FileItem | null>(null);
   const [newName, setNewName] = useState('');
+  const [brokenThumbs, setBrokenThumbs] = useState<Set<string>>(new Set());
 
   // 获取文件图标
   const getFileIcon = (file: FileItem) => {
@@ -53,6 +58,19 @@ const FileGrid: React.FC<FileGridProps> = ({
     const ext = getFileExtension(file.name);
     const iconProps = { className: 'file-icon' };
 
+    // 图片优先显示缩略图，加载失败时退回图标
+    if (THUMBNAIL_EXTS.includes(ext) && !brokenThumbs.has(file.path)) {
+      return (
+        <img
+          className="file-thumbnail"
+          src={apiService.getThumbnailUrl(file.path)}
+          alt={file.name}
+          loading="lazy"
+          onError={() => setBrokenThumbs((prev) => new Set(prev).add(file.path))}
+        />
+      );
+    }
+
     const iconMap: Record<string, JSX.Element> = {
       pdf: <FilePdfOutlined {...iconProps} style={{ color: '#f5222d' }} />,
       jpg: <FileImageOutlined {...iconProps} style={{ color: '#52c41a' }} />,
@@ -93,6 +93,19 @@ const HomePage: React.FC = () => {
     loadFiles();
   }, [loadFiles]);
 
+  // 订阅变更事件：本人在其他设备或其他用户的修改到达后刷新列表（合并短时间内的多个事件）
+  useEffect(() => {
+    let timer: ReturnType<typeof setTimeout> | undefined;
+    const unsubscribe = apiService.subscribeChanges(() => {
+      clearTimeout(timer);
+      timer = setTimeout(loadFiles, 300);
+    });
+    return () => {
+      clearTimeout(timer);
+      unsubscribe();
+    };
+  }, [loadFiles]);
+
   // 刷新列表
   const handleRefresh = () => {
     loadFiles();
@@ -0,0 +1,100 @@
+import React, { useState, useEffect, useCallback } from 'react';
+import { List, Button, Segmented, Tag, Empty, Spin, message } from 'antd';
+import { FileOutlined, FolderOutlined } from '@ant-design/icons';
+import apiService from '../services/api';
+import { formatDate, formatFileSize } from '../utils/helpers';
+import type { ActivityKind, RecentItem } from '../types';
+import './HomePage.css';
+
+// 各类操作的显示名称与颜色
+const kindLabels: Record<ActivityKind, { label: string; color: string }> = {
+  upload: { label: '上传', color: 'blue' },
+  download: { label: '下载', color: 'green' },
+  edit: { label: '编辑', color: 'orange' },
+  share: { label: '共享', color: 'purple' },
+  delete: { label: '删除', color: 'red' },
+};
+
+const RecentPage: React.FC = () => {
+  const [items, setItems] = useState<RecentItem[]>([]);
+  const [kind, setKind] = useState<ActivityKind | 'all'>('all');
+  const [nextBefore, setNextBefore] = useState<number | undefined>();
+  const [loading, setLoading] = useState(false);
+
+  // 加载一页；before 为空时重新加载第一页
+  const loadPage = useCallback(async (before?: number) => {
+    setLoading(true);
+    try {
+      const page = await apiService.getRecent(kind === 'all' ? undefined : [kind], before);
+      setItems((prev) => (before ? [...prev, ...page.items] : page.items));
+      setNextBefore(page.next_before);
+    } catch (error) {
+      message.error('加载最近使用失败');
+      console.error('Load recent error:', error);
+    } finally {
+      setLoading(false);
+    }
+  }, [kind]);
+
+  useEffect(() => {
+    loadPage();
+  }, [loadPage]);
+
+  return (
+    <div className="home-page">
+      <div className="page-header">
+        <span className="breadcrumb">最近使用</span>
+        <Segmented
+          value={kind}
+          onChange={(value) => setKind(value as ActivityKind | 'all')}
+          options={[
+            { label: '全部', value: 'all' },
+            { label: '上传', value: 'upload' },
+            { label: '下载', value: 'download' },
+            { label: '编辑', value: 'edit' },
+            { label: '共享', value: 'share' },
+          ]}
+        />
+      </div>
+      <div className="file-content">
+        <Spin spinning={loading && items.length === 0}>
+          {items.length === 0 && !loading ? (
+            <Empty description="最近没有操作过的文件" />
+          ) : (
+            <List
+              dataSource={items}
+              rowKey="event_id"
+              renderItem={(item) => (
+                <List.Item
+                  actions={[
+                    <Tag color={kindLabels[item.kind].color} key="kind">
+                      {kindLabels[item.kind].label}
+                    </Tag>,
+                    <span key="at">{formatDate(item.at)}</span>,
+                  ]}
+                >
+                  <List.Item.Meta
+                    avatar={item.is_dir ? <FolderOutlined /> : <FileOutlined />}
+                    title={item.name}
+                    description={item.is_dir ? item.path : `${item.path} · ${formatFileSize(item.capacity)}`}
+                  />
+                </List.Item>
+              )}
+              loadMore={
+                nextBefore ? (
+                  <div style={{ textAlign: 'center', margin: '12px 0' }}>
+                    <Button loading={loading} onClick={() => loadPage(nextBefore)}>
+                      加载更多
+                    </Button>
+                  </div>
+                ) : null
+              }
+            />
+          )}
+        </Spin>
+      </div>
+    </div>
+  );
+};
+
+export default RecentPage;
@@ -5,6 +5,16 @@ import type {
   FileInfo,
   ApiResponse,
   UploadRequest,
+  ChangeEvent,
+  SearchResult,
+  TagCount,
+  Favorite,
+  ActivityKind,
+  RecentItem,
+  ActivityEntry,
+  FeedPage,
+  ArchiveImportResult,
+  ArchiveFormat,
 } from '@/types';
 
 // 创建 axios 实例
@@ -33,6 +43,18 @@ class ApiService {
     return response.data;
   }
 
+  // 订阅变更事件（SSE），浏览器断线重连时会携带 Last-Event-ID 从上次的游标继续
+  subscribeChanges(onEvent: (event: ChangeEvent) => void): () => void {
+    const source = new EventSource('/api/events');
+    const types: ChangeEvent['type'][] = ['created', 'updated', 'moved', 'deleted', 'reset'];
+    types.forEach((type) => {
+      source.addEventListener(type, (e) => {
+        onEvent(JSON.parse((e as MessageEvent).data) as ChangeEvent);
+      });
+    });
+    return () => source.close();
+  }
+
   // 获取简单文件列表
   async getSimpleFileList(): Promise<FileMetadata[]> {
     const response = await api.get<FileMetadata[]>('/list?format=simple');
@@ -68,6 +90,29 @@ class ApiService {
     return response.data;
   }
 
+  // 上传归档（zip、tar、tar.gz、tar.zst）并在服务端解压到 path
+  async uploadArchive(
+    file: File,
+    path = '',
+    onConflict?: 'fail' | 'overwrite' | 'rename' | 'skip' | 'keep-newer',
+    onProgress?: (percent: number) => void
+  ): Promise<ArchiveImportResult> {
+    const formData = new FormData();
+    formData.append('file', file);
+    const response = await api.post<ArchiveImportResult>('/upload/archive', formData, {
+      params: { path, onConflict },
+      headers: {
+        'Content-Type': 'multipart/form-data',
+      },
+      onUploadProgress: (progressEvent: AxiosProgressEvent) => {
+        if (progressEvent.total && onProgress) {
+          onProgress(Math.round((progressEvent.loaded * 100) / progressEvent.total));
+        }
+      },
+    });
+    return response.data;
+  }
+
   // 下载文件
   async downloadFile(name: string): Promise<void> {
     const response = await api.get('/download', {
@@ -86,17 +131,22 @@ class ApiService {
     window.URL.revokeObjectURL(url);
   }
 
-  // 下载文件夹（zip）
-  async downloadFolder(dirname: string): Promise<void> {
+  // 缩略图地址（浏览器通过会话 Cookie 认证，可直接用于 <img>）
+  getThumbnailUrl(name: string, size = 256): string {
+    return `/api/thumbnail?name=${encodeURIComponent(name)}&size=${size}`;
+  }
+
+  // 下载文件夹，默认打包为 zip
+  async downloadFolder(dirname: string, format: ArchiveFormat = 'zip'): Promise<void> {
     const response = await api.get('/downloaddir', {
-      params: { dirname },
+      params: { dirname, format },
       responseType: 'blob',
     });
     
     const url = window.URL.createObjectURL(new Blob([response.data]));
     const link = document.createElement('a');
     link.href = url;
-    link.setAttribute('download', `${dirname.split('/').pop()}.zip`);
+    link.setAttribute('download', `${dirname.split('/').pop()}.${format}`);
     document.body.appendChild(link);
     link.click();
     link.remove();
@@ -143,6 +193,74 @@ class ApiService {
     return response.data;
   }
 
+  // 标签
+  async getTags(path: string): Promise<{ path: string; tags: string[] }> {
+    const response = await api.get('/tags', { params: { path } });
+    return response.data;
+  }
+
+  // 命名空间内所有标签及使用次数
+  async listAllTags(): Promise<TagCount[]> {
+    const response = await api.get<TagCount[]>('/tags');
+    return response.data;
+  }
+
+  async addTags(path: string, tags: string[]): Promise<ApiResponse> {
+    const response = await api.post<ApiResponse>('/tags', null, {
+      params: { path, tag: tags.join(',') },
+    });
+    return response.data;
+  }
+
+  async removeTags(path: string, tags: string[]): Promise<ApiResponse> {
+    const response = await api.delete<ApiResponse>('/tags', {
+      params: { path, tag: tags.join(',') },
+    });
+    return response.data;
+  }
+
+  // 收藏
+  async listFavorites(): Promise<Favorite[]> {
+    const response = await api.get<Favorite[]>('/favorites');
+    return response.data;
+  }
+
+  async setFavorite(path: string, starred: boolean): Promise<ApiResponse> {
+    const response = starred
+      ? await api.put<ApiResponse>('/favorites', null, { params: { path } })
+      : await api.delete<ApiResponse>('/favorites', { params: { path } });
+    return response.data;
+  }
+
+  // 自定义属性，值为 null 表示删除
+  async getProperties(path: string): Promise<Record<string, string>> {
+    const response = await api.get('/properties', { params: { path } });
+    return response.data.properties;
+  }
+
+  async setProperties(path: string, properties: Record<string, string | null>): Promise<ApiResponse> {
+    const response = await api.put<ApiResponse>('/properties', properties, {
+      params: { path },
+    });
+    return response.data;
+  }
+
+  // 最近使用，before 为上一页的 next_before
+  async getRecent(kind?: ActivityKind[], before?: number, limit = 50): Promise<FeedPage<RecentItem>> {
+    const response = await api.get<FeedPage<RecentItem>>('/recent', {
+      params: { kind: kind?.join(','), before, limit },
+    });
+    return response.data;
+  }
+
+  // 目录动态
+  async getActivity(path: string, before?: number, limit = 50): Promise<FeedPage<ActivityEntry>> {
+    const response = await api.get<FeedPage<ActivityEntry>>('/activity', {
+      params: { path, before, limit },
+    });
+    return response.data;
+  }
+
   // 批量删除
   async batchDelete(names: string[]): Promise<ApiResponse> {
     const response = await api.delete<ApiResponse>('/batch-delete', {
@@ -168,10 +286,10 @@ class ApiService {
     window.URL.revokeObjectURL(url);
   }
 
-  // 搜索文件
-  async searchFiles(keyword: string): Promise<FileMetadata[]> {
-    const response = await api.get<FileMetadata[]>('/search', {
-      params: { keyword },
+  // 搜索文件（文件名与正文）
+  async searchFiles(keyword: string): Promise<SearchResult[]> {
+    const response = await api.get<SearchResult[]>('/search', {
+      params: { q: keyword },
     });
     return response.data;
   }
@@ -7,6 +7,26 @@ export interface FileMetadata {
   path?: string;
   created_at?: string;
   mod_time?: string;
+  metadata?: MediaMetadata;
+}
+
+// 搜索结果，snippets 为已转义的 HTML，匹配词用 <mark> 标出
+export interface SearchResult extends FileMetadata {
+  name_match: boolean;
+  rank: number;
+  snippets?: string[];
+}
+
+// 服务端从文件内容提取的元数据
+export interface MediaMetadata {
+  mime: string;
+  width?: number;
+  height?: number;
+  duration_ms?: number;
+  pages?: number;
+  camera?: string;
+  taken_at?: string;
+  gps?: { lat: number; lon: number };
 }
 
 // 树节点类型
@@ -16,6 +36,9 @@ export interface TreeNode {
   capacity: number;
   is_dir: boolean;
   path: string;
+  hash?: string; // 文件内容的 SHA-256
+  tags?: string[];
+  starred?: boolean;
   children?: TreeNode[];
 }
 
@@ -32,6 +55,26 @@ export interface FileInfo {
   mode: string;
   mod_time: string;
   is_directory: boolean;
+  metadata?: MediaMetadata;
+  tags?: string[];
+  starred?: boolean;
+  properties?: Record<string, string>;
+}
+
+// 命名空间中的标签及使用次数
+export interface TagCount {
+  tag: string;
+  count: number;
+}
+
+// 当前用户收藏的节点
+export interface Favorite {
+  node_id: number;
+  owner: number;
+  path: string;
+  capacity: number;
+  is_dir: boolean;
+  created_at: string;
 }
 
 // 上传进度
@@ -69,3 +112,75 @@ export interface UploadRequest {
   path?: string;
   onProgress?: (percent: number) => void;
 }
+
+// 冲突处理结果
+export interface ConflictOutcome {
+  policy: 'fail' | 'overwrite' | 'rename' | 'skip' | 'keep-newer';
+  conflict: boolean;
+  action: string;
+  path: string;
+}
+
+// 归档格式（/upload/archive 与 /downloaddir 的 format 参数）
+export type ArchiveFormat = 'zip' | 'tar' | 'tar.gz' | 'tar.zst';
+
+// 归档上传（/upload/archive）的导入结果
+export interface ArchiveImportResult {
+  path: string;
+  format: ArchiveFormat;
+  files: number;
+  directories: number;
+  bytes: number;
+  skipped: number;
+  conflicts?: ConflictOutcome[];
+  ignored?: string[];
+}
+
+// 变更事件（/events 推送）
+export interface ChangeEvent {
+  cursor: number;
+  type: 'created' | 'updated' | 'moved' | 'deleted' | 'reset' | 'ready';
+  owner_id: number;
+  node_id?: number;
+  path?: string;
+  old_path?: string;
+  actor?: string;
+  time: string;
+}
+
+// 最近使用的一项（每个节点只保留最近一次操作）
+export type ActivityKind = 'upload' | 'download' | 'edit' | 'share' | 'delete';
+
+export interface RecentItem {
+  event_id: number;
+  at: string;
+  kind: ActivityKind;
+  action: string;
+  node_id: number;
+  owner: number;
+  name: string;
+  path: string;
+  capacity: number;
+  is_dir: boolean;
+}
+
+// 目录动态中的一条记录
+export interface ActivityEntry {
+  id: number;
+  at: string;
+  kind: ActivityKind;
+  action: string;
+  username: string;
+  via: string;
+  node_id?: number;
+  path?: string;
+  old_path?: string;
+  detail?: Record<string, unknown>;
+}
+
+// 按事件 ID 倒序分页的列表，next_before 存在时还有下一页
+export interface FeedPage<T> {
+  count: number;
+  items: T[];
+  next_before?: number;
+}
@@ -185,8 +185,7 @@ Write-Host "   cd cmd/server" -ForegroundColor Gray
 Write-Host "   go run main.go" -ForegroundColor Gray
 Write-Host ""
 Write-Host "2. Test upload:" -ForegroundColor White
-Write-Host "   cd client" -ForegroundColor Gray
-Write-Host "   go run chunk_upload_test.go ../test_file.txt" -ForegroundColor Gray
+Write-Host "   go run ./cmd/chunkupload test_file.txt" -ForegroundColor Gray
 Write-Host ""
 Write-Host "3. View data:" -ForegroundColor White
 Write-Host "   Browser: http://localhost:8000/debug/drivelist" -ForegroundColor Gray
@@ -0,0 +1,475 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 访问控制：ACL 条目挂在 drivelist 节点上，通过 drivelist_closure 被所有后代继承。
+// 命名空间所有者拥有全部权限；其他用户通过 owner 参数访问共享给自己的目录
+
+// 权限位
+const (
+	PermRead   = 1 << iota // 列表、下载、查看信息与历史版本
+	PermWrite              // 上传、创建目录、复制到此处、恢复版本
+	PermDelete             // 删除、移出（移动/重命名的源）
+	PermShare              // 把自己拥有的权限授予他人
+	PermAdmin              // 全部权限，并可授予/撤销任意权限
+
+	permAll = PermRead | PermWrite | PermDelete | PermShare | PermAdmin
+)
+
+const ctxDriveKey = "drive_namespace" // gin.Context 中保存目标命名空间的键
+
+var permNames = []struct {
+	bit  int
+	name string
+}{
+	{PermRead, "read"},
+	{PermWrite, "write"},
+	{PermDelete, "delete"},
+	{PermShare, "share"},
+	{PermAdmin, "admin"},
+}
+
+// parsePerms 解析逗号分隔的权限名
+func parsePerms(raw string) (int, error) {
+	perms := 0
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+		found := false
+		for _, p := range permNames {
+			if p.name == part {
+				perms |= p.bit
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, newAPIError(http.StatusBadRequest, "Invalid permission: %s (expect read|write|delete|share|admin)", part)
+		}
+	}
+	if perms == 0 {
+		return 0, newAPIError(http.StatusBadRequest, "No permission specified")
+	}
+	return perms, nil
+}
+
+// permList 把权限位转换为名称列表
+func permList(perms int) []string {
+	names := []string{}
+	for _, p := range permNames {
+		if perms&p.bit != 0 {
+			names = append(names, p.name)
+		}
+	}
+	return names
+}
+
+func permName(perm int) string {
+	if names := permList(perm); len(names) > 0 {
+		return strings.Join(names, ",")
+	}
+	return "none"
+}
+
+// ACLEntry 节点上的一条授权
+type ACLEntry struct {
+	NodeID    int64     `json:"node_id"`
+	Path      string    `json:"path"`
+	UserID    int64     `json:"user_id"`
+	Username  string    `json:"username"`
+	Perms     []string  `json:"perms"`
+	GrantedBy string    `json:"granted_by"`
+	CreatedAt time.Time `json:"created_at"`
+	Inherited bool      `json:"inherited"`
+}
+
+func (s *Server) ensureACLTables() error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS drive_acl (
+			node_id INTEGER NOT NULL REFERENCES drivelist(id) ON DELETE CASCADE,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			perms INT NOT NULL,
+			granted_by TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ DEFAULT now(),
+			PRIMARY KEY (node_id, user_id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_acl_user ON drive_acl(user_id)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := s.DB.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveDrive 中间件：根据 owner 参数确定本次请求操作的命名空间，缺省为当前用户自己
+func (s *Server) resolveDrive() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		owner := currentUser(c).ID
+		if scope := presignedScope(c); scope != nil {
+			// 预签名请求只能操作签名中的命名空间，不读取未签名的表单字段
+			if raw := c.Query("owner"); raw != "" && raw != strconv.FormatInt(scope.Owner, 10) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "owner does not match the presigned url"})
+				return
+			}
+			c.Set(ctxDriveKey, s.driveOf(scope.Owner))
+			c.Next()
+			return
+		}
+		raw := c.Query("owner")
+		if raw == "" {
+			raw = c.PostForm("owner")
+		}
+		if raw != "" {
+			id, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid 'owner' parameter"})
+				return
+			}
+			owner = id
+		}
+		c.Set(ctxDriveKey, s.driveOf(owner))
+		c.Next()
+	}
+}
+
+// ownDrive 返回当前用户自己的命名空间（回收站、配额等不支持共享的功能使用）
+func (s *Server) ownDrive(c *gin.Context) *drive {
+	return s.driveOf(currentUser(c).ID)
+}
+
+// nearestNode 返回 rel 自身或最近的已存在祖先节点，均不存在时返回 0
+func (d *drive) nearestNode(q dbQuerier, rel string) (int64, error) {
+	for ; rel != ""; rel = parentRel(rel) {
+		id, err := d.lookupNode(q, rel)
+		if err == nil {
+			return id, nil
+		}
+		if err != sql.ErrNoRows {
+			return 0, err
+		}
+	}
+	return 0, nil
+}
+
+// effectivePerms 计算用户在 rel 上的有效权限：自身及所有祖先节点上的授权取并集
+func (d *drive) effectivePerms(q dbQuerier, userID int64, rel string) (int, error) {
+	if userID == d.OwnerID {
+		return permAll, nil
+	}
+	nodeID, err := d.nearestNode(q, rel)
+	if err != nil || nodeID == 0 {
+		return 0, err
+	}
+	var perms int
+	err = q.QueryRow(`
+		SELECT COALESCE(bit_or(a.perms), 0)
+		FROM drive_acl a
+		JOIN drivelist_closure c ON a.node_id = c.ancestor
+		WHERE c.descendant = $1 AND a.user_id = $2
+	`, nodeID, userID).Scan(&perms)
+	if perms&PermAdmin != 0 {
+		perms = permAll
+	}
+	return perms, err
+}
+
+// authorize 检查当前用户是否拥有 rel 上的 perm 权限
+func (s *Server) authorize(c *gin.Context, d *drive, rel string, perm int) error {
+	return s.authorizeUser(currentUser(c).ID, d, rel, perm)
+}
+
+// authorizeUser 检查指定用户是否拥有 rel 上的 perm 权限，无权限时返回 403
+func (s *Server) authorizeUser(userID int64, d *drive, rel string, perm int) error {
+	perms, err := d.effectivePerms(s.DB, userID, rel)
+	if err != nil {
+		return fmt.Errorf("check permission failed: %v", err)
+	}
+	if perms&perm != perm {
+		label := rel
+		if label == "" {
+			label = "/"
+		}
+		return newAPIError(http.StatusForbidden, "Permission denied: %s on %s", permName(perm), label)
+	}
+	return nil
+}
+
+// readableNodes 返回非所有者可读的节点集合；所有者返回 nil 表示全部可见
+func (d *drive) readableNodes(q dbQuerier, userID int64) (map[int64]bool, error) {
+	if userID == d.OwnerID {
+		return nil, nil
+	}
+	rows, err := q.Query(`
+		SELECT DISTINCT c.descendant
+		FROM drive_acl a
+		JOIN drivelist_closure c ON c.ancestor = a.node_id
+		JOIN drivelist d ON d.id = a.node_id
+		WHERE a.user_id = $1 AND d.owner_id = $2 AND a.perms & $3 <> 0
+	`, userID, d.OwnerID, PermRead|PermAdmin)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	visible := map[int64]bool{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		visible[id] = true
+	}
+	return visible, rows.Err()
+}
+
+// aclTarget 解析 ACL 接口的 path 参数，目标必须是已存在的节点
+func (s *Server) aclTarget(c *gin.Context) (*drive, string, int64, error) {
+	rel, err := cleanRelPath(c.Query("path"))
+	if err != nil {
+		return nil, "", 0, err
+	}
+	if rel == "" {
+		return nil, "", 0, newAPIError(http.StatusBadRequest, "ACL entries must be attached to a file or folder")
+	}
+	d := s.driveFor(c)
+	nodeID, err := d.lookupNode(s.DB, rel)
+	if err == sql.ErrNoRows {
+		return nil, "", 0, newAPIError(http.StatusNotFound, "File not found")
+	}
+	return d, rel, nodeID, err
+}
+
+func (s *Server) userIDByName(username string) (int64, error) {
+	var id int64
+	err := s.DB.QueryRow("SELECT id FROM users WHERE username=$1", username).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, newAPIError(http.StatusNotFound, "User not found: %s", username)
+	}
+	return id, err
+}
+
+// handleGrantACL 授权：POST /acl?path=&user=&perms=read,write
+// 需要目标上的 share 权限，且只能授予自己拥有的权限（admin 可授予任意权限）
+func (s *Server) handleGrantACL(c *gin.Context) {
+	d, rel, nodeID, err := s.aclTarget(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	perms, err := parsePerms(c.Query("perms"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	granteeID, err := s.userIDByName(c.Query("user"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if granteeID == d.OwnerID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The owner already has full access"})
+		return
+	}
+
+	mine, err := d.effectivePerms(s.DB, currentUser(c).ID, rel)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if mine&PermShare == 0 || (mine&PermAdmin == 0 && perms&^mine != 0) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied: cannot grant " + permName(perms) + " on " + rel})
+		return
+	}
+
+	detail := gin.H{"user": c.Query("user"), "perms": permList(perms)}
+	err = s.withAudit(actorOf(c), d.OwnerID, "acl_grant", rel, detail, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			INSERT INTO drive_acl (node_id, user_id, perms, granted_by)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (node_id, user_id) DO UPDATE SET perms = drive_acl.perms | EXCLUDED.perms, granted_by = EXCLUDED.granted_by
+		`, nodeID, granteeID, perms, actorName(c))
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to grant permission: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Permission granted",
+		"owner":   d.OwnerID,
+		"path":    rel,
+		"user":    c.Query("user"),
+		"perms":   permList(perms),
+	})
+}
+
+// handleRevokeACL 撤销：DELETE /acl?path=&user=[&perms=]，不带 perms 时删除整条授权
+func (s *Server) handleRevokeACL(c *gin.Context) {
+	d, rel, nodeID, err := s.aclTarget(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	granteeID, err := s.userIDByName(c.Query("user"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	perms := permAll
+	if raw := c.Query("perms"); raw != "" {
+		if perms, err = parsePerms(raw); err != nil {
+			respondError(c, err)
+			return
+		}
+	}
+
+	// 用户可以放弃别人授予自己的权限；撤销他人的权限需要 admin
+	if granteeID != currentUser(c).ID {
+		if err := s.authorize(c, d, rel, PermAdmin); err != nil {
+			respondError(c, err)
+			return
+		}
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("UPDATE drive_acl SET perms = perms & ~$3::int WHERE node_id=$1 AND user_id=$2", nodeID, granteeID, perms)
+	if err == nil {
+		// 没有授权记录时回滚，不写审计日志
+		if n, _ := res.RowsAffected(); n == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No permission entry on this path for the user"})
+			return
+		}
+		_, err = tx.Exec("DELETE FROM drive_acl WHERE node_id=$1 AND user_id=$2 AND perms = 0", nodeID, granteeID)
+	}
+	if err == nil {
+		err = recordAudit(tx, actorOf(c), d.OwnerID, "acl_revoke", nodeID, rel, "", gin.H{"user": c.Query("user"), "perms": permList(perms)})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke permission: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Permission revoked", "path": rel, "user": c.Query("user"), "perms": permList(perms)})
+}
+
+// handleGetACL 查看节点上（含继承）的授权与指定用户的有效权限：GET /acl?path=[&user=]
+func (s *Server) handleGetACL(c *gin.Context) {
+	d, rel, nodeID, err := s.aclTarget(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := s.authorize(c, d, rel, PermRead); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	userID := currentUser(c).ID
+	if name := c.Query("user"); name != "" {
+		if userID, err = s.userIDByName(name); err != nil {
+			respondError(c, err)
+			return
+		}
+	}
+	effective, err := d.effectivePerms(s.DB, userID, rel)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	rows, err := s.DB.Query(`
+		SELECT a.node_id, n.name, a.user_id, u.username, a.perms, a.granted_by, a.created_at
+		FROM drive_acl a
+		JOIN drivelist_closure c ON a.node_id = c.ancestor
+		JOIN drivelist n ON n.id = a.node_id
+		JOIN users u ON u.id = a.user_id
+		WHERE c.descendant = $1
+		ORDER BY c.depth DESC, u.username
+	`, nodeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	entries := []ACLEntry{}
+	for rows.Next() {
+		var e ACLEntry
+		var perms int
+		if err := rows.Scan(&e.NodeID, &e.Path, &e.UserID, &e.Username, &perms, &e.GrantedBy, &e.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		e.Perms = permList(perms)
+		e.Inherited = e.NodeID != nodeID
+		entries = append(entries, e)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"owner":     d.OwnerID,
+		"path":      rel,
+		"user_id":   userID,
+		"effective": permList(effective),
+		"entries":   entries,
+	})
+}
+
+// handleSharedWithMe 列出其他用户共享给当前用户的节点
+func (s *Server) handleSharedWithMe(c *gin.Context) {
+	rows, err := s.DB.Query(`
+		SELECT n.owner_id, u.username, n.name, n.capacity = 0, a.perms, a.granted_by, a.created_at
+		FROM drive_acl a
+		JOIN drivelist n ON n.id = a.node_id
+		JOIN users u ON u.id = n.owner_id
+		WHERE a.user_id = $1
+		ORDER BY u.username, n.name
+	`, currentUser(c).ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	items := []gin.H{}
+	for rows.Next() {
+		var ownerID int64
+		var ownerName, path, grantedBy string
+		var isDir bool
+		var perms int
+		var createdAt time.Time
+		if err := rows.Scan(&ownerID, &ownerName, &path, &isDir, &perms, &grantedBy, &createdAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		items = append(items, gin.H{
+			"owner":      ownerID,
+			"owner_name": ownerName,
+			"path":       path,
+			"is_dir":     isDir,
+			"perms":      permList(perms),
+			"granted_by": grantedBy,
+			"created_at": createdAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"count": len(items), "items": items})
+}
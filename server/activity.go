@@ -0,0 +1,302 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 最近使用与动态：直接基于审计日志，不另外记录事件。
+// 审计动作归为几类：上传、下载、编辑、共享、删除；覆盖已有文件的上传算作编辑
+
+const (
+	kindUpload   = "upload"
+	kindDownload = "download"
+	kindEdit     = "edit"
+	kindShare    = "share"
+	kindDelete   = "delete"
+)
+
+// activityKinds 每类包含的审计动作，顺序即 activityKindSQL 中的判断顺序
+var activityKinds = []struct {
+	kind    string
+	actions []string
+}{
+	{kindUpload, []string{"upload", "zip_import", "archive_import", "copy", "mkdir"}},
+	{kindDownload, []string{"download"}},
+	{kindEdit, []string{"version_restore", "rename", "move", "trash_restore", "tag_add", "tag_remove", "property_set", "property_delete"}},
+	{kindShare, []string{"share_create", "share_revoke", "acl_grant", "acl_revoke"}},
+	{kindDelete, []string{"delete", "delete_permanent"}},
+}
+
+// activityKindSQL 由审计动作推导分类的 SQL 表达式（表别名 a 为 audit_log）；
+// recordChange 在覆盖已有节点时写入 {"overwritten":true}
+func activityKindSQL() string {
+	var b strings.Builder
+	b.WriteString(`CASE WHEN a.action IN ('upload', 'zip_import', 'archive_import', 'copy') AND strpos(a.detail, '"overwritten":true') > 0 THEN '` + kindEdit + `'`)
+	for _, k := range activityKinds {
+		b.WriteString(" WHEN a.action IN ('" + strings.Join(k.actions, "', '") + "') THEN '" + k.kind + "'")
+	}
+	b.WriteString(" END")
+	return b.String()
+}
+
+// parseKinds 解析逗号分隔的 kind 参数，allowed 为可选的分类
+func parseKinds(raw string, allowed ...string) ([]string, error) {
+	if raw == "" {
+		return allowed, nil
+	}
+	var kinds []string
+	for _, k := range strings.Split(raw, ",") {
+		k = strings.TrimSpace(k)
+		ok := false
+		for _, a := range allowed {
+			ok = ok || a == k
+		}
+		if !ok {
+			return nil, newAPIError(http.StatusBadRequest, "Invalid 'kind' parameter, expected %s", strings.Join(allowed, ", "))
+		}
+		kinds = append(kinds, k)
+	}
+	return kinds, nil
+}
+
+// feedPage 解析分页参数：before 为上一页最后一条的事件 ID，limit 默认 50，最大 200
+func feedPage(c *gin.Context) (before int64, limit int, err error) {
+	limit = 50
+	if raw := c.Query("limit"); raw != "" {
+		n, convErr := strconv.Atoi(raw)
+		if convErr != nil || n <= 0 || n > 200 {
+			return 0, 0, newAPIError(http.StatusBadRequest, "Invalid 'limit' parameter")
+		}
+		limit = n
+	}
+	if raw := c.Query("before"); raw != "" {
+		if before, err = strconv.ParseInt(raw, 10, 64); err != nil || before <= 0 {
+			return 0, 0, newAPIError(http.StatusBadRequest, "Invalid 'before' parameter")
+		}
+	}
+	return before, limit, nil
+}
+
+// RecentItem 当前用户最近操作过的一个节点，只保留最近的一次操作
+type RecentItem struct {
+	EventID  int64     `json:"event_id"`
+	At       time.Time `json:"at"`
+	Kind     string    `json:"kind"`
+	Action   string    `json:"action"`
+	NodeID   int64     `json:"node_id"`
+	OwnerID  int64     `json:"owner"`
+	Name     string    `json:"name"`
+	Path     string    `json:"path"`
+	Capacity int64     `json:"capacity"`
+	IsDir    bool      `json:"is_dir"`
+}
+
+// handleRecent 最近使用：GET /recent?kind=upload,download,edit,share&before=&limit=
+// 返回当前用户操作过、仍然存在且仍可读的节点，每个节点取最近一次操作，按时间倒序，响应中的 next_before 用于翻页
+func (s *Server) handleRecent(c *gin.Context) {
+	kinds, err := parseKinds(c.Query("kind"), kindUpload, kindDownload, kindEdit, kindShare)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	before, limit, err := feedPage(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	user := arg(currentUser(c).ID)
+	kindExpr := activityKindSQL()
+	var kindArgs []string
+	for _, k := range kinds {
+		kindArgs = append(kindArgs, arg(k))
+	}
+	outer := []string{`(d.owner_id = ` + user + ` OR d.id IN (
+			SELECT cl.descendant FROM drive_acl acl JOIN drivelist_closure cl ON cl.ancestor = acl.node_id
+			WHERE acl.user_id = ` + user + ` AND acl.perms & ` + arg(PermRead|PermAdmin) + ` <> 0))`}
+	if before > 0 {
+		outer = append(outer, "r.id < "+arg(before))
+	}
+	// 节点 ID 在移动、重命名后不变，路径取当前值；进入回收站或被删除的节点不再出现
+	rows, err := s.DB.Query(`
+		SELECT r.id, r.at, r.kind, r.action, d.id, d.owner_id, d.name, d.capacity
+		FROM (
+			SELECT DISTINCT ON (a.node_id) a.id, a.at, a.action, a.node_id, `+kindExpr+` AS kind
+			FROM audit_log a
+			WHERE a.user_id = `+user+` AND a.node_id IS NOT NULL AND (`+kindExpr+`) IN (`+strings.Join(kindArgs, ", ")+`)
+			ORDER BY a.node_id, a.id DESC
+		) r
+		JOIN drivelist d ON d.id = r.node_id
+		WHERE `+strings.Join(outer, " AND ")+`
+		ORDER BY r.id DESC
+		LIMIT `+arg(limit), args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	items := []RecentItem{}
+	for rows.Next() {
+		var it RecentItem
+		if err := rows.Scan(&it.EventID, &it.At, &it.Kind, &it.Action, &it.NodeID, &it.OwnerID, &it.Path, &it.Capacity); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		it.Name = it.Path[strings.LastIndex(it.Path, "/")+1:]
+		it.IsDir = it.Capacity == 0 // 容量为0表示目录
+		items = append(items, it)
+	}
+	resp := gin.H{"count": len(items), "items": items}
+	if len(items) == limit {
+		resp["next_before"] = items[len(items)-1].EventID
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// ActivityEntry 目录动态中的一条记录
+type ActivityEntry struct {
+	ID       int64           `json:"id"`
+	At       time.Time       `json:"at"`
+	Kind     string          `json:"kind"`
+	Action   string          `json:"action"`
+	Username string          `json:"username"`
+	Via      string          `json:"via"`
+	NodeID   int64           `json:"node_id,omitempty"`
+	Path     string          `json:"path,omitempty"`
+	OldPath  string          `json:"old_path,omitempty"`
+	Detail   json.RawMessage `json:"detail,omitempty"`
+}
+
+// handleActivity 目录动态：GET /activity?path=&kind=&before=&limit=
+// 返回命名空间内 path 子树（含移入、移出）上所有人的操作，需要 path 上的读权限，按时间倒序分页
+func (s *Server) handleActivity(c *gin.Context) {
+	rel, err := cleanRelPath(c.Query("path"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	d := s.driveFor(c)
+	if err := s.authorize(c, d, rel, PermRead); err != nil {
+		respondError(c, err)
+		return
+	}
+	kinds, err := parseKinds(c.Query("kind"), kindUpload, kindDownload, kindEdit, kindShare, kindDelete)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	before, limit, err := feedPage(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	kindExpr := activityKindSQL()
+	var kindArgs []string
+	for _, k := range kinds {
+		kindArgs = append(kindArgs, arg(k))
+	}
+	conds := []string{
+		"a.owner_id = " + arg(d.OwnerID),
+		"(" + kindExpr + ") IN (" + strings.Join(kindArgs, ", ") + ")",
+	}
+	if rel != "" {
+		p := arg(rel)
+		under := func(col string) string {
+			return "(" + col + " = " + p + " OR left(" + col + ", length(" + p + "::text) + 1) = " + p + " || '/')"
+		}
+		conds = append(conds, "("+under("a.path")+" OR "+under("a.old_path")+")")
+	}
+	if before > 0 {
+		conds = append(conds, "a.id < "+arg(before))
+	}
+	rows, err := s.DB.Query(`
+		SELECT a.id, a.at, `+kindExpr+`, a.action, a.username, a.via, COALESCE(a.node_id, 0), a.path, a.old_path, a.detail
+		FROM audit_log a
+		WHERE `+strings.Join(conds, " AND ")+`
+		ORDER BY a.id DESC
+		LIMIT `+arg(limit), args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	// 与 canSeeChange 相同：移入、移出的另一侧调用者可能无权读取，此时隐藏该路径
+	userID := currentUser(c).ID
+	readable := map[string]bool{}
+	canRead := func(p string) bool {
+		if p == "" || userID == d.OwnerID {
+			return true
+		}
+		ok, seen := readable[p]
+		if !seen {
+			ok = s.authorizeUser(userID, d, p, PermRead) == nil
+			readable[p] = ok
+		}
+		return ok
+	}
+	items := []ActivityEntry{}
+	var scanned int
+	var lastID int64
+	for rows.Next() {
+		var e ActivityEntry
+		var detail string
+		if err := rows.Scan(&e.ID, &e.At, &e.Kind, &e.Action, &e.Username, &e.Via, &e.NodeID, &e.Path, &e.OldPath, &detail); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		scanned++
+		lastID = e.ID
+		pathOK, oldOK := canRead(e.Path), canRead(e.OldPath)
+		if !pathOK && !oldOK {
+			continue
+		}
+		if !pathOK {
+			e.Path = ""
+		}
+		if !oldOK {
+			e.OldPath = ""
+		}
+		// 附加信息中可能带有被隐藏的路径
+		if detail != "" && pathOK && oldOK {
+			e.Detail = json.RawMessage(detail)
+		}
+		items = append(items, e)
+	}
+	resp := gin.H{"path": rel, "count": len(items), "items": items}
+	// 按读取的行数判断是否还有下一页，隐藏的记录也要跳过
+	if scanned == limit {
+		resp["next_before"] = lastID
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// recordDownload 下载也写入审计日志，供“最近使用”与目录动态展示；失败不影响下载
+func (s *Server) recordDownload(c *gin.Context, d *drive, rel string) {
+	nodeID, err := d.lookupNode(s.DB, rel)
+	if err != nil && err != sql.ErrNoRows {
+		return
+	}
+	if err := recordAudit(s.DB, actorOf(c), d.OwnerID, "download", nodeID, rel, "", nil); err != nil {
+		c.Error(err)
+	}
+}
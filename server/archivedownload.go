@@ -0,0 +1,223 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+)
+
+// 目录下载：按 format 参数选择 zip、tar、tar.gz 或 tar.zst，边遍历边写入响应，不再生成临时文件。
+// tar 系列保留 Unix 权限位与修改时间，属主信息不写入
+
+// archiveContentTypes 各格式的 Content-Type 与文件扩展名
+var archiveContentTypes = map[string][2]string{
+	archiveZip:    {"application/zip", ".zip"},
+	archiveTar:    {"application/x-tar", ".tar"},
+	archiveTarGz:  {"application/gzip", ".tar.gz"},
+	archiveTarZst: {"application/zstd", ".tar.zst"},
+}
+
+// downloadFormat 解析目录下载的 format 参数，默认 zip
+func downloadFormat(c *gin.Context) (string, error) {
+	format, err := parseArchiveFormat(c.Query("format"))
+	if err != nil || format != "" {
+		return format, err
+	}
+	return archiveZip, nil
+}
+
+// archiveWriter 统一 zip 与 tar 的写入接口，name 为归档内的相对路径
+type archiveWriter interface {
+	addDir(name string, info fs.FileInfo) error
+	addFile(name string, info fs.FileInfo, r io.Reader) error
+	Close() error
+}
+
+type zipArchiveWriter struct{ zw *zip.Writer }
+
+func (w *zipArchiveWriter) addDir(name string, info fs.FileInfo) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name + "/"
+	_, err = w.zw.CreateHeader(header)
+	return err
+}
+
+func (w *zipArchiveWriter) addFile(name string, info fs.FileInfo, r io.Reader) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+	fw, err := w.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, r)
+	return err
+}
+
+func (w *zipArchiveWriter) Close() error { return w.zw.Close() }
+
+// tarArchiveWriter 写 tar，compressor 为外层的 gzip / zstd 压缩器（可为 nil）
+type tarArchiveWriter struct {
+	tw         *tar.Writer
+	compressor io.WriteCloser
+}
+
+func (w *tarArchiveWriter) header(name string, info fs.FileInfo) (*tar.Header, error) {
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return nil, err
+	}
+	header.Name = name
+	header.Uid, header.Gid, header.Uname, header.Gname = 0, 0, "", ""
+	return header, nil
+}
+
+func (w *tarArchiveWriter) addDir(name string, info fs.FileInfo) error {
+	header, err := w.header(name+"/", info)
+	if err != nil {
+		return err
+	}
+	return w.tw.WriteHeader(header)
+}
+
+func (w *tarArchiveWriter) addFile(name string, info fs.FileInfo, r io.Reader) error {
+	header, err := w.header(name, info)
+	if err != nil {
+		return err
+	}
+	if err := w.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	// tar 头中已经写出大小：文件在打包期间变长时只写入头中的长度，变短时报错
+	n, err := io.Copy(w.tw, io.LimitReader(r, header.Size))
+	if err == nil && n < header.Size {
+		err = fmt.Errorf("file %s shrank while archiving", name)
+	}
+	return err
+}
+
+func (w *tarArchiveWriter) Close() error {
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	if w.compressor != nil {
+		return w.compressor.Close()
+	}
+	return nil
+}
+
+// newArchiveWriter 按格式创建写入 out 的归档
+func newArchiveWriter(out io.Writer, format string) (archiveWriter, error) {
+	switch format {
+	case archiveZip:
+		return &zipArchiveWriter{zw: zip.NewWriter(out)}, nil
+	case archiveTarGz:
+		gz := gzip.NewWriter(out)
+		return &tarArchiveWriter{tw: tar.NewWriter(gz), compressor: gz}, nil
+	case archiveTarZst:
+		zw, err := zstd.NewWriter(out, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return &tarArchiveWriter{tw: tar.NewWriter(zw), compressor: zw}, nil
+	default:
+		return &tarArchiveWriter{tw: tar.NewWriter(out)}, nil
+	}
+}
+
+// writeArchive 递归写入 dirPath 下的目录与普通文件（符号链接等特殊文件跳过），路径相对于 dirPath
+func writeArchive(aw archiveWriter, dirPath string) error {
+	return filepath.WalkDir(dirPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dirPath {
+			return nil
+		}
+		rel, err := filepath.Rel(dirPath, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return aw.addDir(name, info)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return aw.addFile(name, info, f)
+	})
+}
+
+// DownloadArchive 把目录打包为指定格式直接写入响应。
+// 开始写入响应后出错时无法再返回 JSON：记录到 gin 错误并放弃收尾，客户端收到的是不完整的归档
+func (s *Server) DownloadArchive(c *gin.Context, dirPath, name, format string) error {
+	kind, ok := archiveContentTypes[format]
+	if !ok {
+		return fmt.Errorf("unsupported archive format: %s", format)
+	}
+	if _, err := os.Stat(dirPath); err != nil {
+		return err
+	}
+	filename := name + kind[1]
+	c.Header("Content-Type", kind[0])
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`, asciiFilename(filename), url.PathEscape(filename)))
+	c.Status(http.StatusOK)
+
+	aw, err := newArchiveWriter(c.Writer, format)
+	if err != nil {
+		return err
+	}
+	if err := writeArchive(aw, dirPath); err != nil {
+		return err
+	}
+	return aw.Close()
+}
+
+// respondArchiveError 目录打包失败：响应尚未开始时返回 JSON，否则只记录错误
+func respondArchiveError(c *gin.Context, err error) {
+	if c.Writer.Written() {
+		c.Error(err)
+		c.Abort()
+		return
+	}
+	c.Header("Content-Disposition", "")
+	c.Header("Content-Type", "")
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create archive: " + err.Error()})
+}
+
+// asciiFilename 供不支持 filename* 的客户端使用，非 ASCII 与引号替换为下划线
+func asciiFilename(name string) string {
+	b := []byte(name)
+	for i, ch := range b {
+		if ch < 0x20 || ch >= 0x7f || ch == '"' || ch == '\\' {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
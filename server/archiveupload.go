@@ -0,0 +1,657 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"single_drive/shared"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+	"github.com/lib/pq"
+)
+
+// 归档上传：POST /upload/archive 接收 zip、tar、tar.gz、tar.zst，在服务端解压到目标目录。
+// 先把所有条目解压到暂存目录，同时检查条目数、展开后总大小和压缩比；
+// 再在一个事务中批量写入节点、闭包关系、版本与变更事件，并把暂存文件移动到位
+
+// 支持的归档格式
+const (
+	archiveZip    = "zip"
+	archiveTar    = "tar"
+	archiveTarGz  = "tar.gz"
+	archiveTarZst = "tar.zst"
+)
+
+// parseArchiveFormat 解析 format 参数，空串表示按文件头识别
+func parseArchiveFormat(raw string) (string, error) {
+	switch strings.ToLower(raw) {
+	case "":
+		return "", nil
+	case "zip":
+		return archiveZip, nil
+	case "tar":
+		return archiveTar, nil
+	case "tar.gz", "tgz":
+		return archiveTarGz, nil
+	case "tar.zst", "tzst":
+		return archiveTarZst, nil
+	}
+	return "", newAPIError(http.StatusBadRequest, "Invalid 'format' parameter, expected zip, tar, tar.gz or tar.zst")
+}
+
+// detectArchiveFormat 按文件头识别归档格式，无法识别时按 tar 处理
+func detectArchiveFormat(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return archiveZip
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return archiveTarGz
+	case bytes.HasPrefix(head, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return archiveTarZst
+	}
+	return archiveTar
+}
+
+// countingReader 统计读取的字节数（解压前的输入）
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// invalidArchive 解压失败时，超出限制返回 413，其余视为归档损坏
+func invalidArchive(err error) error {
+	var ae *apiError
+	if errors.As(err, &ae) {
+		return ae
+	}
+	if errors.Is(err, shared.ErrArchiveLimit) {
+		return newAPIError(http.StatusRequestEntityTooLarge, "%v", err)
+	}
+	return newAPIError(http.StatusBadRequest, "Invalid archive: %v", err)
+}
+
+// stagedEntry 暂存目录中的一个条目，Path 相对于目标目录
+type stagedEntry struct {
+	Path    string
+	IsDir   bool
+	Size    int64
+	Hash    string
+	ModTime time.Time
+	file    string // 暂存文件
+}
+
+// archiveStage 解压到暂存目录的全部条目；归档内同一路径出现多次时以最后一次为准
+type archiveStage struct {
+	dir     string
+	guard   *shared.ExtractGuard
+	entries []*stagedEntry
+	index   map[string]*stagedEntry
+	ignored []string // 符号链接、硬链接、设备文件等不导入的条目
+}
+
+func newArchiveStage(dir string) *archiveStage {
+	return &archiveStage{dir: dir, index: map[string]*stagedEntry{}}
+}
+
+// entryPath 清理条目路径：防止 zip slip（路径穿越、绝对路径），归档根目录返回空串
+func (st *archiveStage) entryPath(raw string) (string, error) {
+	name := strings.TrimSuffix(strings.TrimPrefix(strings.ReplaceAll(raw, `\`, "/"), "./"), "/")
+	if name == "" || name == "." {
+		return "", nil
+	}
+	rel, err := cleanRelPath(name)
+	if err != nil || rel == "" {
+		return "", newAPIError(http.StatusBadRequest, "Illegal path in archive: %s", raw)
+	}
+	return rel, nil
+}
+
+func (st *archiveStage) addDir(rel string, mod time.Time) error {
+	if err := st.guard.Entry(); err != nil {
+		return invalidArchive(err)
+	}
+	if e := st.index[rel]; e != nil {
+		if !e.IsDir {
+			return newAPIError(http.StatusBadRequest, "Archive contains both a file and a folder at %s", rel)
+		}
+		return nil
+	}
+	e := &stagedEntry{Path: rel, IsDir: true, ModTime: mod}
+	st.index[rel] = e
+	st.entries = append(st.entries, e)
+	return nil
+}
+
+func (st *archiveStage) addFile(rel string, mod time.Time, r io.Reader) error {
+	if err := st.guard.Entry(); err != nil {
+		return invalidArchive(err)
+	}
+	e := st.index[rel]
+	if e != nil && e.IsDir {
+		return newAPIError(http.StatusBadRequest, "Archive contains both a file and a folder at %s", rel)
+	}
+	if e == nil {
+		e = &stagedEntry{Path: rel, file: filepath.Join(st.dir, strconv.Itoa(len(st.entries)))}
+		st.index[rel] = e
+		st.entries = append(st.entries, e)
+	}
+	out, err := os.Create(e.file)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(out, h, st.guard), r)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return invalidArchive(err)
+	}
+	e.Size, e.Hash, e.ModTime = n, hex.EncodeToString(h.Sum(nil)), mod
+	return nil
+}
+
+// stageZip 解压 zip（需要随机访问）
+func (st *archiveStage) stageZip(ra io.ReaderAt, size int64, limits shared.ExtractLimits) error {
+	st.guard = shared.NewExtractGuard(limits, func() int64 { return size })
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return newAPIError(http.StatusBadRequest, "Invalid zip archive: %v", err)
+	}
+	for _, f := range zr.File {
+		rel, err := st.entryPath(f.Name)
+		if err != nil {
+			return err
+		}
+		if rel == "" {
+			continue
+		}
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			err = st.addDir(rel, f.Modified)
+		case mode.IsRegular():
+			if err := st.guard.Reserve(f.UncompressedSize64); err != nil {
+				return invalidArchive(err)
+			}
+			var rc io.ReadCloser
+			if rc, err = f.Open(); err != nil {
+				return invalidArchive(err)
+			}
+			err = st.addFile(rel, f.Modified, rc)
+			rc.Close()
+		default:
+			st.ignored = append(st.ignored, rel)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stageTar 流式解压 tar
+func (st *archiveStage) stageTar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return invalidArchive(err)
+		}
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		rel, err := st.entryPath(hdr.Name)
+		if err != nil {
+			return err
+		}
+		if rel == "" {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = st.addDir(rel, hdr.ModTime)
+		case tar.TypeReg:
+			err = st.addFile(rel, hdr.ModTime, tr)
+		default:
+			st.ignored = append(st.ignored, rel)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// stage 按格式解压输入；ra 不为 nil 时 zip 直接随机读取，否则先把数据流落盘
+func (st *archiveStage) stage(src io.Reader, ra io.ReaderAt, size int64, format string, limits shared.ExtractLimits) (string, error) {
+	counter := &countingReader{r: src}
+	br := bufio.NewReaderSize(counter, 64<<10)
+	if format == "" {
+		head, _ := br.Peek(4)
+		format = detectArchiveFormat(head)
+	}
+	st.guard = shared.NewExtractGuard(limits, func() int64 { return counter.n })
+
+	switch format {
+	case archiveZip:
+		if ra != nil && size >= 0 {
+			return format, st.stageZip(ra, size, limits)
+		}
+		spool, err := os.Create(filepath.Join(st.dir, "archive.zip"))
+		if err != nil {
+			return format, err
+		}
+		defer spool.Close()
+		// 归档本身不会比展开后的上限更大
+		var limited io.Reader = br
+		if max := limits.MaxBytes; max > 0 {
+			limited = io.LimitReader(br, max+1)
+		}
+		n, err := io.Copy(spool, limited)
+		if err != nil {
+			return format, err
+		}
+		if max := limits.MaxBytes; max > 0 && n > max {
+			return format, newAPIError(http.StatusRequestEntityTooLarge, "Archive is larger than %d bytes", max)
+		}
+		return format, st.stageZip(spool, n, limits)
+	case archiveTarGz:
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return format, invalidArchive(err)
+		}
+		defer gz.Close()
+		return format, st.stageTar(gz)
+	case archiveTarZst:
+		zr, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return format, invalidArchive(err)
+		}
+		defer zr.Close()
+		return format, st.stageTar(zr)
+	default:
+		return format, st.stageTar(br)
+	}
+}
+
+// archivePlanItem 一个待导入的文件及其冲突处理结果
+type archivePlanItem struct {
+	entry   *stagedEntry
+	outcome conflictOutcome
+}
+
+// planArchive 在事务内确定每个条目的落地路径：目录与已有目录合并，文件按冲突策略处理；
+// fail 策略下先收集全部冲突，保证要么全部导入要么不落盘
+func (d *drive) planArchive(tx *sql.Tx, target string, policy ConflictPolicy, st *archiveStage) (dirs []string, files []archivePlanItem, conflicts []string, err error) {
+	// 目录：显式条目加上文件的各级上级目录，按路径排序保证父目录在前
+	dirSet := map[string]bool{}
+	for _, e := range st.entries {
+		p := e.Path
+		if !e.IsDir {
+			p = parentRel(p)
+		}
+		for ; p != "" && !dirSet[p]; p = parentRel(p) {
+			if fe := st.index[p]; fe != nil && !fe.IsDir {
+				return nil, nil, nil, newAPIError(http.StatusBadRequest, "Archive contains both a file and a folder at %s", p)
+			}
+			dirSet[p] = true
+		}
+	}
+	for p := range dirSet {
+		dirs = append(dirs, joinRel(target, p))
+	}
+	sort.Strings(dirs)
+
+	// 一次查出与归档内路径同名的已有节点
+	var names []string
+	names = append(names, dirs...)
+	for _, e := range st.entries {
+		if !e.IsDir {
+			names = append(names, joinRel(target, e.Path))
+		}
+	}
+	existing := map[string]int64{} // 路径 -> 容量
+	rows, err := tx.Query("SELECT name, capacity FROM drivelist WHERE owner_id=$1 AND name = ANY($2)", d.OwnerID, pq.Array(names))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("query existing nodes failed: %v", err)
+	}
+	for rows.Next() {
+		var name string
+		var capacity int64
+		if err := rows.Scan(&name, &capacity); err != nil {
+			rows.Close()
+			return nil, nil, nil, err
+		}
+		existing[name] = capacity
+	}
+	rows.Close()
+
+	var newDirs []string
+	for _, dir := range dirs {
+		capacity, ok := existing[dir]
+		if !ok {
+			newDirs = append(newDirs, dir)
+		} else if capacity > 0 { // 容量为0表示目录
+			return nil, nil, nil, newAPIError(http.StatusConflict, "A file already exists where the archive has a folder: %s", dir)
+		}
+	}
+
+	for _, e := range st.entries {
+		if e.IsDir {
+			continue
+		}
+		rel := joinRel(target, e.Path)
+		_, taken := existing[rel]
+		if !taken {
+			_, statErr := os.Lstat(d.abs(rel))
+			taken = statErr == nil
+		}
+		if !taken {
+			files = append(files, archivePlanItem{e, conflictOutcome{Policy: policy, Action: actionCreated, Path: rel}})
+			continue
+		}
+		if policy == ConflictFail {
+			conflicts = append(conflicts, rel)
+			continue
+		}
+		outcome, err := d.resolveConflict(tx, rel, policy, e.ModTime)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		files = append(files, archivePlanItem{e, outcome})
+	}
+	return newDirs, files, conflicts, nil
+}
+
+// ArchiveImportResult 归档导入结果；Conflicts 只列出与已有内容冲突的文件
+type ArchiveImportResult struct {
+	Path        string            `json:"path"`
+	Format      string            `json:"format"`
+	Files       int               `json:"files"`
+	Directories int               `json:"directories"`
+	Bytes       int64             `json:"bytes"`
+	Skipped     int               `json:"skipped"`
+	Conflicts   []conflictOutcome `json:"conflicts,omitempty"`
+	Ignored     []string          `json:"ignored,omitempty"`
+}
+
+// handleArchiveUpload 上传归档并在服务端解压：POST /upload/archive?path=&onConflict=&format=
+// 请求体为 multipart 表单（字段 file）或直接是归档数据流；format 省略时按文件头识别，onConflict 默认 fail
+func (s *Server) handleArchiveUpload(c *gin.Context) {
+	s.uploadArchive(c, "")
+}
+
+// handleZipUpload POST /upload/zip：等同于 /upload/archive?format=zip
+func (s *Server) handleZipUpload(c *gin.Context) {
+	s.uploadArchive(c, "zip")
+}
+
+// uploadArchive 暂存并导入归档；format 非空时不再读取请求中的 format 参数
+func (s *Server) uploadArchive(c *gin.Context, format string) {
+	isMultipart := strings.HasPrefix(c.ContentType(), "multipart/")
+	param := func(key string) string {
+		if v := c.Query(key); v != "" || !isMultipart {
+			return v
+		}
+		return c.PostForm(key)
+	}
+	target, err := cleanRelPath(param("path"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	policy, err := parseConflictPolicy(param("onConflict"), ConflictFail)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if format == "" {
+		format = param("format")
+	}
+	format, err = parseArchiveFormat(format)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	d := s.driveFor(c)
+	if err := s.authorize(c, d, target, PermWrite); err != nil {
+		respondError(c, err)
+		return
+	}
+	if info, err := os.Stat(d.abs(target)); err == nil && !info.IsDir() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Target path is not a directory"})
+		return
+	}
+
+	var src io.Reader = c.Request.Body
+	var ra io.ReaderAt
+	size := int64(-1)
+	if isMultipart {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "File not provided: " + err.Error()})
+			return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open upload: " + err.Error()})
+			return
+		}
+		defer f.Close()
+		src, ra, size = f, f, fh.Size
+	}
+
+	// 暂存目录与命名空间在同一文件系统下，导入时直接重命名
+	stageDir := filepath.Join(s.uploadDir, "_tmp", fmt.Sprintf("archive_%d", time.Now().UnixNano()))
+	if err := os.MkdirAll(stageDir, os.ModePerm); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create tmp dir: " + err.Error()})
+		return
+	}
+	defer os.RemoveAll(stageDir)
+	st := newArchiveStage(stageDir)
+	if format, err = st.stage(src, ra, size, format, s.archiveLimits); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := d.ensureDirNode(tx, target); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create target directory record: " + err.Error()})
+		return
+	}
+	newDirs, files, conflicts, err := d.planArchive(tx, target, policy, st)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if len(conflicts) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Target paths already exist", "conflicts": conflicts})
+		return
+	}
+
+	// 配额：覆盖已有节点时扣除被替换的用量
+	delta := quotaDelta{}
+	for _, it := range files {
+		if !it.outcome.Proceed() {
+			continue
+		}
+		delta.Bytes += it.entry.Size
+		delta.Files++
+		if it.outcome.ExistingID != 0 {
+			usedBytes, usedFiles, err := subtreeUsage(tx, it.outcome.ExistingID)
+			if err != nil {
+				respondError(c, err)
+				return
+			}
+			delta.Bytes -= usedBytes
+			delta.Files -= usedFiles
+		}
+	}
+	if err := s.checkQuota(tx, d, target, delta); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	// 文件系统改动在提交失败时按相反顺序撤销
+	var undo []func()
+	committed := false
+	defer func() {
+		if !committed {
+			for i := len(undo) - 1; i >= 0; i-- {
+				undo[i]()
+			}
+		}
+	}()
+	for _, dir := range newDirs {
+		full := d.abs(dir)
+		if _, err := os.Stat(full); err == nil {
+			continue
+		}
+		if err := os.MkdirAll(full, os.ModePerm); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create directory: " + err.Error()})
+			return
+		}
+		undo = append(undo, func() { os.Remove(full) })
+	}
+	place := func(e *stagedEntry, rel string) error {
+		dst := d.abs(rel)
+		if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+			return err
+		}
+		if err := os.Rename(e.file, dst); err != nil {
+			return err
+		}
+		if !e.ModTime.IsZero() {
+			_ = os.Chtimes(dst, e.ModTime, e.ModTime)
+		}
+		return nil
+	}
+
+	act := actorOf(c)
+	result := ArchiveImportResult{Path: target, Format: format, Directories: len(newDirs), Ignored: st.ignored}
+	names := append([]string{}, newDirs...)
+	capacities := make([]int64, len(newDirs))
+	var newFiles []*stagedEntry
+	var placed []string
+	for _, it := range files {
+		e, outcome := it.entry, it.outcome
+		if outcome.Conflict {
+			result.Conflicts = append(result.Conflicts, outcome)
+		}
+		if !outcome.Proceed() {
+			result.Skipped++
+			continue
+		}
+		reinsert, restore, err := d.clearForOverwrite(tx, &outcome, false)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		undo = append(undo, restore)
+		if outcome.ExistingID != 0 && !reinsert {
+			// 同类文件原地覆盖，保留节点 ID 并把旧内容归档为历史版本
+			restore, err := d.archiveCurrent(tx, outcome.ExistingID, outcome.Path)
+			if err != nil {
+				respondError(c, err)
+				return
+			}
+			undo = append(undo, restore)
+			if err := place(e, outcome.Path); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to extract file %s: %v", e.Path, err)})
+				return
+			}
+			if _, err := tx.Exec("UPDATE drivelist SET capacity=$1 WHERE id=$2", e.Size, outcome.ExistingID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update metadata: " + err.Error()})
+				return
+			}
+			if _, err := d.recordVersion(tx, outcome.ExistingID, outcome.Path, actorName(c), e.Hash); err != nil {
+				respondError(c, err)
+				return
+			}
+			if err := d.recordChange(tx, changeUpdated, "archive_import", outcome.ExistingID, outcome.Path, "", act); err != nil {
+				respondError(c, err)
+				return
+			}
+		} else {
+			dst := d.abs(outcome.Path)
+			if err := place(e, outcome.Path); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to extract file %s: %v", e.Path, err)})
+				return
+			}
+			undo = append(undo, func() { os.Remove(dst) })
+			names = append(names, outcome.Path)
+			capacities = append(capacities, e.Size)
+			newFiles = append(newFiles, e)
+		}
+		placed = append(placed, outcome.Path)
+		result.Files++
+		result.Bytes += e.Size
+	}
+
+	// 新节点、闭包关系、首个版本与变更事件各用一条语句批量写入
+	ids, err := d.insertNodes(tx, names, capacities)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert metadata: " + err.Error()})
+		return
+	}
+	nodeIDs := make([]int64, len(names))
+	for i, name := range names {
+		nodeIDs[i] = ids[name]
+	}
+	fileIDs := nodeIDs[len(newDirs):]
+	hashes := make([]string, len(newFiles))
+	sizes := make([]int64, len(newFiles))
+	for i, e := range newFiles {
+		hashes[i], sizes[i] = e.Hash, e.Size
+	}
+	if err := d.recordInitialVersions(tx, fileIDs, hashes, sizes, actorName(c)); err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := d.recordChanges(tx, changeCreated, "archive_import", nodeIDs, names, act); err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
+	committed = true
+
+	s.notifyChange(d)
+	for _, rel := range placed {
+		s.enqueueFileJobs(d, rel)
+	}
+	c.JSON(http.StatusOK, result)
+}
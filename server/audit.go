@@ -0,0 +1,317 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// 审计日志：每个修改操作在写入元数据的同一事务中追加一条记录，
+// 表上的触发器拒绝 UPDATE / DELETE，保证只追加
+
+// actor 执行操作的主体，写入变更事件与审计日志
+type actor struct {
+	UserID int64
+	Name   string
+	IP     string
+	Via    string // api、webdav、s3
+}
+
+// systemActor 后台任务（自动清理等）使用的操作主体
+var systemActor = actor{Name: "system", Via: "system"}
+
+// actorOf 从请求中提取操作主体
+func actorOf(c *gin.Context) actor {
+	act := actor{Name: actorName(c), IP: c.ClientIP(), Via: "api"}
+	if u := currentUser(c); u != nil {
+		act.UserID = u.ID
+	}
+	switch {
+	case strings.HasPrefix(c.Request.URL.Path, davPrefix):
+		act.Via = "webdav"
+	case strings.HasPrefix(c.Request.URL.Path, "/s3/"):
+		act.Via = "s3"
+	}
+	return act
+}
+
+// AuditEntry 一条审计记录
+type AuditEntry struct {
+	ID       int64           `json:"id"`
+	At       time.Time       `json:"at"`
+	UserID   int64           `json:"user_id,omitempty"`
+	Username string          `json:"username"`
+	ClientIP string          `json:"client_ip"`
+	Via      string          `json:"via"`
+	Action   string          `json:"action"`
+	OwnerID  int64           `json:"owner_id,omitempty"`
+	NodeID   int64           `json:"node_id,omitempty"`
+	Path     string          `json:"path,omitempty"`
+	OldPath  string          `json:"old_path,omitempty"`
+	Detail   json.RawMessage `json:"detail,omitempty"`
+}
+
+func (s *Server) ensureAuditTables() error {
+	stmts := []string{
+		// 不设外键：用户或节点被删除后审计记录依然保留
+		`CREATE TABLE IF NOT EXISTS audit_log (
+			id BIGSERIAL PRIMARY KEY,
+			at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			user_id INTEGER,
+			username TEXT NOT NULL DEFAULT '',
+			client_ip TEXT NOT NULL DEFAULT '',
+			via TEXT NOT NULL DEFAULT '',
+			action TEXT NOT NULL,
+			owner_id INTEGER,
+			node_id INTEGER,
+			path TEXT NOT NULL DEFAULT '',
+			old_path TEXT NOT NULL DEFAULT '',
+			detail TEXT NOT NULL DEFAULT ''
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_at ON audit_log(at)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_user ON audit_log(user_id, id)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_owner ON audit_log(owner_id, id)`,
+		`CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'audit_log is append-only';
+		END;
+		$$ LANGUAGE plpgsql`,
+		`DROP TRIGGER IF EXISTS trg_audit_log_append_only ON audit_log`,
+		`CREATE TRIGGER trg_audit_log_append_only BEFORE UPDATE OR DELETE ON audit_log
+			FOR EACH ROW EXECUTE FUNCTION audit_log_append_only()`,
+	}
+	for _, stmt := range stmts {
+		if _, err := s.DB.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordAudit 在调用方的事务中追加一条审计记录；ownerID 为 0 表示与命名空间无关的操作
+func recordAudit(q dbQuerier, act actor, ownerID int64, action string, nodeID int64, path, oldPath string, detail gin.H) error {
+	nullID := func(id int64) sql.NullInt64 { return sql.NullInt64{Int64: id, Valid: id != 0} }
+	var raw string
+	if len(detail) > 0 {
+		b, err := json.Marshal(detail)
+		if err != nil {
+			return err
+		}
+		raw = string(b)
+	}
+	if _, err := q.Exec(`
+		INSERT INTO audit_log (user_id, username, client_ip, via, action, owner_id, node_id, path, old_path, detail)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`, nullID(act.UserID), act.Name, act.IP, act.Via, action, nullID(ownerID), nullID(nodeID), path, oldPath, raw); err != nil {
+		return fmt.Errorf("record audit log failed: %v", err)
+	}
+	return nil
+}
+
+// recordAuditBatch 批量追加同一动作的审计记录，每个节点一条
+func recordAuditBatch(q dbQuerier, act actor, ownerID int64, action string, nodeIDs []int64, paths []string) error {
+	nullID := func(id int64) sql.NullInt64 { return sql.NullInt64{Int64: id, Valid: id != 0} }
+	if _, err := q.Exec(`
+		INSERT INTO audit_log (user_id, username, client_ip, via, action, owner_id, node_id, path)
+		SELECT $1, $2, $3, $4, $5, $6, n, p FROM unnest($7::int[], $8::text[]) AS t(n, p)
+	`, nullID(act.UserID), act.Name, act.IP, act.Via, action, nullID(ownerID), pq.Array(nodeIDs), pq.Array(paths)); err != nil {
+		return fmt.Errorf("record audit log failed: %v", err)
+	}
+	return nil
+}
+
+// withAudit 在一个事务中执行 fn 并追加审计记录，用于没有现成事务的单语句修改
+func (s *Server) withAudit(act actor, ownerID int64, action, path string, detail gin.H, fn func(tx *sql.Tx) error) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	// 目标是已存在的节点时一并记录节点 ID，移动、重命名后依然能关联
+	var nodeID int64
+	if ownerID != 0 && path != "" {
+		if err := tx.QueryRow("SELECT id FROM drivelist WHERE owner_id=$1 AND name=$2", ownerID, path).Scan(&nodeID); err != nil && err != sql.ErrNoRows {
+			return err
+		}
+	}
+	if err := recordAudit(tx, act, ownerID, action, nodeID, path, "", detail); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// auditQuery 解析查询条件：普通用户只能看到自己执行的、或发生在自己命名空间内的记录
+func auditQuery(c *gin.Context) (string, []any, error) {
+	var conds []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	u := currentUser(c)
+	if !u.IsAdmin {
+		p := arg(u.ID)
+		conds = append(conds, "(user_id = "+p+" OR owner_id = "+p+")")
+	}
+	if raw := c.Query("user"); raw != "" {
+		if id, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			conds = append(conds, "user_id = "+arg(id))
+		} else {
+			conds = append(conds, "username = "+arg(raw))
+		}
+	}
+	if raw := c.Query("owner"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return "", nil, newAPIError(http.StatusBadRequest, "Invalid 'owner' parameter")
+		}
+		conds = append(conds, "owner_id = "+arg(id))
+	}
+	if raw := c.Query("path"); raw != "" {
+		rel, err := cleanRelPath(raw)
+		if err != nil {
+			return "", nil, err
+		}
+		if rel != "" {
+			// 子树匹配：路径本身或其下的任意路径，移动操作的新旧路径都参与匹配
+			p := arg(rel)
+			under := func(col string) string {
+				return "(" + col + " = " + p + " OR left(" + col + ", length(" + p + "::text) + 1) = " + p + " || '/')"
+			}
+			conds = append(conds, "("+under("path")+" OR "+under("old_path")+")")
+		}
+	}
+	if raw := c.Query("action"); raw != "" {
+		var actions []string
+		for _, a := range strings.Split(raw, ",") {
+			if a = strings.TrimSpace(a); a != "" {
+				actions = append(actions, arg(a))
+			}
+		}
+		if len(actions) > 0 {
+			conds = append(conds, "action IN ("+strings.Join(actions, ", ")+")")
+		}
+	}
+	for _, bound := range []struct{ param, op string }{{"from", ">="}, {"to", "<"}} {
+		raw := c.Query(bound.param)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return "", nil, newAPIError(http.StatusBadRequest, "Invalid '%s' parameter, expected RFC3339", bound.param)
+		}
+		conds = append(conds, "at "+bound.op+" "+arg(t))
+	}
+	if raw := c.Query("before"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return "", nil, newAPIError(http.StatusBadRequest, "Invalid 'before' parameter")
+		}
+		conds = append(conds, "id < "+arg(id))
+	}
+
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+	return `SELECT id, at, COALESCE(user_id, 0), username, client_ip, via, action,
+		COALESCE(owner_id, 0), COALESCE(node_id, 0), path, old_path, detail
+		FROM audit_log` + where + " ORDER BY id DESC", args, nil
+}
+
+func scanAuditEntry(rows *sql.Rows) (*AuditEntry, error) {
+	var e AuditEntry
+	var detail string
+	if err := rows.Scan(&e.ID, &e.At, &e.UserID, &e.Username, &e.ClientIP, &e.Via, &e.Action,
+		&e.OwnerID, &e.NodeID, &e.Path, &e.OldPath, &detail); err != nil {
+		return nil, err
+	}
+	if detail != "" {
+		e.Detail = json.RawMessage(detail)
+	}
+	return &e, nil
+}
+
+// handleAuditLog 查询审计日志：GET /audit?user=&owner=&path=&action=&from=&to=&before=&limit=
+// 按 ID 倒序分页，下一页把 before 设为上一页最后一条的 id
+func (s *Server) handleAuditLog(c *gin.Context) {
+	query, args, err := auditQuery(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	limit := 100
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > 1000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'limit' parameter"})
+			return
+		}
+		limit = n
+	}
+	args = append(args, limit)
+	rows, err := s.DB.Query(query+" LIMIT $"+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	items := []*AuditEntry{}
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		items = append(items, e)
+	}
+	resp := gin.H{"count": len(items), "items": items}
+	if len(items) == limit {
+		resp["next_before"] = items[len(items)-1].ID
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// handleAuditExport 以 JSON Lines 导出审计日志（条件同 /audit，不分页），流式写出
+func (s *Server) handleAuditExport(c *gin.Context) {
+	query, args, err := auditQuery(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	rows, err := s.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="audit-%s.jsonl"`, time.Now().Format("20060102-150405")))
+	c.Status(http.StatusOK)
+	enc := json.NewEncoder(c.Writer)
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			// 响应头已经发出，只能中断输出
+			c.Error(err)
+			return
+		}
+		if err := enc.Encode(e); err != nil {
+			return
+		}
+	}
+}
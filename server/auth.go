@@ -0,0 +1,446 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	ctxUserKey        = "drive_user"    // gin.Context 中保存当前用户的键
+	sessionCookieName = "drive_session" // 浏览器登录使用的 Cookie
+	apiTokenPrefix    = "sdt_"          // API Token 前缀，用于和 JWT 区分
+)
+
+// User 已认证的用户
+type User struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	IsAdmin  bool   `json:"is_admin"`
+}
+
+// sessionClaims 登录会话 JWT 的载荷
+type sessionClaims struct {
+	Username string `json:"usr"`
+	IsAdmin  bool   `json:"adm,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func (s *Server) ensureUserTables() error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS users (
+			id SERIAL PRIMARY KEY,
+			username TEXT NOT NULL UNIQUE,
+			password_hash TEXT NOT NULL,
+			is_admin BOOLEAN NOT NULL DEFAULT false,
+			created_at TIMESTAMPTZ DEFAULT now()
+		)`,
+		// 只保存 Token 的 SHA256，明文仅在创建时返回一次
+		`CREATE TABLE IF NOT EXISTS api_tokens (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name TEXT NOT NULL DEFAULT '',
+			token_hash TEXT NOT NULL UNIQUE,
+			created_at TIMESTAMPTZ DEFAULT now(),
+			last_used_at TIMESTAMPTZ,
+			expires_at TIMESTAMPTZ
+		)`,
+		// 每个节点归属于一个用户的命名空间
+		`ALTER TABLE drivelist ADD COLUMN IF NOT EXISTS owner_id INTEGER REFERENCES users(id) ON DELETE CASCADE`,
+		`CREATE INDEX IF NOT EXISTS idx_drivelist_owner_name ON drivelist(owner_id, name)`,
+		`ALTER TABLE drive_trash ADD COLUMN IF NOT EXISTS owner_id INTEGER REFERENCES users(id) ON DELETE CASCADE`,
+		`ALTER TABLE drivelist_versions ADD COLUMN IF NOT EXISTS owner_id INTEGER`,
+	}
+	for _, stmt := range stmts {
+		if _, err := s.DB.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadJWTSecret 读取 JWT_SECRET；未配置时生成随机密钥（重启后会话失效）
+func loadJWTSecret() []byte {
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	log.Println("warning: JWT_SECRET 未设置，使用随机密钥，重启后需要重新登录")
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		log.Fatalf("failed to generate jwt secret: %v", err)
+	}
+	return buf
+}
+
+// currentUser 返回经认证中间件写入的当前用户
+func currentUser(c *gin.Context) *User {
+	if v, ok := c.Get(ctxUserKey); ok {
+		if u, ok := v.(*User); ok {
+			return u
+		}
+	}
+	return nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueSession 为用户签发会话 JWT
+func (s *Server) issueSession(u *User) (string, time.Time, error) {
+	expires := time.Now().Add(s.sessionTTL)
+	claims := sessionClaims{
+		Username: u.Username,
+		IsAdmin:  u.IsAdmin,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatInt(u.ID, 10),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.jwtSecret)
+	return signed, expires, err
+}
+
+// authenticate 依次尝试预签名 URL、Bearer API Token、Bearer JWT、Basic 认证、会话 Cookie
+func (s *Server) authenticate(c *gin.Context) (*User, error) {
+	if c.Query(presignSigParam) != "" {
+		return s.authenticatePresigned(c)
+	}
+	token := ""
+	if h := c.GetHeader("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		token = strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
+	} else if username, password, ok := c.Request.BasicAuth(); ok {
+		// WebDAV 客户端使用 Basic 认证：密码可以是账号密码或 API Token
+		if strings.HasPrefix(password, apiTokenPrefix) {
+			return s.userByAPIToken(password)
+		}
+		u, err := s.verifyPassword(username, password)
+		if err != nil {
+			return nil, errors.New("invalid username or password")
+		}
+		return u, nil
+	} else if cookie, err := c.Cookie(sessionCookieName); err == nil {
+		token = cookie
+	}
+	if token == "" {
+		return nil, errors.New("missing credentials")
+	}
+	if strings.HasPrefix(token, apiTokenPrefix) {
+		return s.userByAPIToken(token)
+	}
+	return s.userBySession(token)
+}
+
+func (s *Server) userBySession(token string) (*User, error) {
+	claims := &sessionClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		return s.jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+	id, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid session subject")
+	}
+	// 以数据库中的当前状态为准：删除或取消管理员后，未过期的会话立即失效或降权
+	u := &User{ID: id}
+	if err := s.DB.QueryRow("SELECT username, is_admin FROM users WHERE id=$1", id).Scan(&u.Username, &u.IsAdmin); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("user no longer exists")
+		}
+		return nil, err
+	}
+	return u, nil
+}
+
+func (s *Server) userByAPIToken(token string) (*User, error) {
+	var u User
+	var tokenID int64
+	err := s.DB.QueryRow(`
+		SELECT u.id, u.username, u.is_admin, t.id
+		FROM api_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = $1 AND (t.expires_at IS NULL OR t.expires_at > now())
+	`, hashToken(token)).Scan(&u.ID, &u.Username, &u.IsAdmin, &tokenID)
+	if err != nil {
+		return nil, errors.New("invalid api token")
+	}
+	if _, err := s.DB.Exec("UPDATE api_tokens SET last_used_at=now() WHERE id=$1", tokenID); err != nil {
+		log.Printf("warning: update token last_used_at failed: %v", err)
+	}
+	return &u, nil
+}
+
+// requireAuth 认证中间件：未登录返回 401
+func (s *Server) requireAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if currentUser(c) != nil {
+			c.Next()
+			return
+		}
+		u, err := s.authenticate(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: " + err.Error()})
+			return
+		}
+		c.Set(ctxUserKey, u)
+		c.Next()
+	}
+}
+
+// requireAdmin 仅管理员可访问
+func (s *Server) requireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if u := currentUser(c); u == nil || !u.IsAdmin {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin privilege required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (s *Server) handleRegister(c *gin.Context) {
+	var req credentials
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	req.Username = strings.TrimSpace(req.Username)
+	if req.Username == "" || strings.ContainsAny(req.Username, "/\\") || len(req.Password) < 8 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username required and password must be at least 8 characters"})
+		return
+	}
+
+	// 第一个注册的用户成为管理员；之后是否开放注册由 ALLOW_REGISTRATION 控制
+	allowed := s.allowRegistration
+	if !allowed {
+		if u, err := s.authenticate(c); err == nil && u.IsAdmin {
+			allowed = true
+		}
+	}
+	// 已有用户且不开放注册时直接拒绝，不必计算密码哈希（最终以事务内的判断为准）
+	var exists bool
+	if err := s.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users)").Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if exists && !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Registration is disabled"})
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password: " + err.Error()})
+		return
+	}
+	u := &User{Username: req.Username}
+	act := actorOf(c)
+	if act.UserID == 0 {
+		act.Name = u.Username
+	}
+	detail := gin.H{"username": u.Username}
+	err = s.withAudit(act, 0, "user_create", "", detail, func(tx *sql.Tx) error {
+		// 锁表后再判断是否为第一个用户，避免并发注册同时成为管理员
+		if _, err := tx.Exec("LOCK TABLE users IN EXCLUSIVE MODE"); err != nil {
+			return err
+		}
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM users)").Scan(&exists); err != nil {
+			return err
+		}
+		if exists && !allowed {
+			return newAPIError(http.StatusForbidden, "Registration is disabled")
+		}
+		u.IsAdmin = !exists
+		detail["is_admin"] = u.IsAdmin
+		return tx.QueryRow("INSERT INTO users (username, password_hash, is_admin) VALUES ($1, $2, $3) RETURNING id",
+			u.Username, string(hash), u.IsAdmin).Scan(&u.ID)
+	})
+	if err != nil {
+		var apiErr *apiError
+		if errors.As(err, &apiErr) {
+			respondError(c, err)
+			return
+		}
+		if strings.Contains(err.Error(), "duplicate key") {
+			c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user: " + err.Error()})
+		return
+	}
+
+	if err := os.MkdirAll(s.driveOf(u.ID).Root, os.ModePerm); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user drive: " + err.Error()})
+		return
+	}
+	if u.IsAdmin {
+		if err := s.adoptLegacyData(u.ID); err != nil {
+			log.Printf("warning: failed to adopt legacy data: %v", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User registered successfully", "user": u})
+}
+
+func (s *Server) handleLogin(c *gin.Context) {
+	var req credentials
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	u, err := s.verifyPassword(req.Username, req.Password)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+		return
+	}
+
+	token, expires, err := s.issueSession(u)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue session: " + err.Error()})
+		return
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(sessionCookieName, token, int(time.Until(expires).Seconds()), "/", "", false, true)
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"expires_at": expires,
+		"user":       u,
+	})
+}
+
+// verifyPassword 校验用户名密码，WebDAV/S3 等非 JSON 入口也会复用
+func (s *Server) verifyPassword(username, password string) (*User, error) {
+	var u User
+	var hash string
+	err := s.DB.QueryRow("SELECT id, username, is_admin, password_hash FROM users WHERE username=$1", username).
+		Scan(&u.ID, &u.Username, &u.IsAdmin, &hash)
+	if err != nil {
+		return nil, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (s *Server) handleLogout(c *gin.Context) {
+	c.SetCookie(sessionCookieName, "", -1, "/", "", false, true)
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+func (s *Server) handleMe(c *gin.Context) {
+	c.JSON(http.StatusOK, currentUser(c))
+}
+
+func (s *Server) handleCreateToken(c *gin.Context) {
+	var req struct {
+		Name      string `json:"name"`
+		ExpiresIn int    `json:"expires_in_days"` // 0 表示永不过期
+	}
+	// 请求体可省略
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	token := apiTokenPrefix + hex.EncodeToString(buf)
+
+	var expires sql.NullTime
+	if req.ExpiresIn > 0 {
+		expires = sql.NullTime{Time: time.Now().AddDate(0, 0, req.ExpiresIn), Valid: true}
+	}
+	var id int64
+	err := s.withAudit(actorOf(c), 0, "token_create", "", gin.H{"name": req.Name}, func(tx *sql.Tx) error {
+		return tx.QueryRow("INSERT INTO api_tokens (user_id, name, token_hash, expires_at) VALUES ($1, $2, $3, $4) RETURNING id",
+			currentUser(c).ID, req.Name, hashToken(token), expires).Scan(&id)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token: " + err.Error()})
+		return
+	}
+	resp := gin.H{"id": id, "name": req.Name, "token": token}
+	if expires.Valid {
+		resp["expires_at"] = expires.Time
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (s *Server) handleListTokens(c *gin.Context) {
+	rows, err := s.DB.Query(`
+		SELECT id, name, created_at, last_used_at, expires_at
+		FROM api_tokens WHERE user_id=$1 ORDER BY id
+	`, currentUser(c).ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	items := []gin.H{}
+	for rows.Next() {
+		var id int64
+		var name string
+		var createdAt time.Time
+		var lastUsed, expires sql.NullTime
+		if err := rows.Scan(&id, &name, &createdAt, &lastUsed, &expires); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		item := gin.H{"id": id, "name": name, "created_at": createdAt}
+		if lastUsed.Valid {
+			item["last_used_at"] = lastUsed.Time
+		}
+		if expires.Valid {
+			item["expires_at"] = expires.Time
+		}
+		items = append(items, item)
+	}
+	c.JSON(http.StatusOK, gin.H{"count": len(items), "items": items})
+}
+
+func (s *Server) handleDeleteToken(c *gin.Context) {
+	err := s.withAudit(actorOf(c), 0, "token_delete", "", gin.H{"id": c.Param("id")}, func(tx *sql.Tx) error {
+		res, err := tx.Exec("DELETE FROM api_tokens WHERE id=$1 AND user_id=$2", c.Param("id"), currentUser(c).ID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return newAPIError(http.StatusNotFound, "Token not found")
+		}
+		return nil
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
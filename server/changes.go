@@ -0,0 +1,419 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"golang.org/x/net/websocket"
+)
+
+// 变更事件流：所有修改命名空间的操作在同一事务内写入 drive_changes，
+// 提交后唤醒该命名空间的订阅者，订阅者按游标（事件 ID）从数据库增量读取，
+// 因此断线重连后可以从上次的游标继续。
+// 写入事件前先持有命名空间写锁直到提交，同一命名空间的事件 ID 按提交顺序递增，
+// 读取方推进游标时不会越过尚未提交的较小 ID
+
+// 事件类型
+const (
+	changeCreated = "created"
+	changeUpdated = "updated"
+	changeMoved   = "moved"
+	changeDeleted = "deleted"
+	changeReset   = "reset" // 游标已失效（事件被清理），客户端需要重新拉取列表
+	changeReady   = "ready" // 订阅建立，携带当前游标
+)
+
+const (
+	changeBatchSize   = 500
+	changeHeartbeat   = 25 * time.Second
+	changeWSReadLimit = 4096
+)
+
+// ChangeEvent 一条变更事件；Cursor 即事件 ID，全局递增
+type ChangeEvent struct {
+	Cursor  int64     `json:"cursor"`
+	Type    string    `json:"type"`
+	OwnerID int64     `json:"owner_id"`
+	NodeID  int64     `json:"node_id,omitempty"`
+	Path    string    `json:"path,omitempty"`
+	OldPath string    `json:"old_path,omitempty"`
+	Actor   string    `json:"actor,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+func (s *Server) ensureChangeTables() error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS drive_changes (
+			id BIGSERIAL PRIMARY KEY,
+			owner_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			type TEXT NOT NULL,
+			node_id INTEGER,
+			path TEXT NOT NULL DEFAULT '',
+			old_path TEXT NOT NULL DEFAULT '',
+			actor TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ DEFAULT now()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_changes_owner ON drive_changes(owner_id, id)`,
+		`CREATE INDEX IF NOT EXISTS idx_changes_created ON drive_changes(created_at)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := s.DB.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordChange 在调用方的事务中写入一条变更事件及对应的审计记录；提交后需调用 notifyChange 唤醒订阅者
+func (d *drive) recordChange(q dbQuerier, typ, action string, nodeID int64, path, oldPath string, act actor) error {
+	var node sql.NullInt64
+	if nodeID != 0 {
+		node = sql.NullInt64{Int64: nodeID, Valid: true}
+	}
+	if err := d.lockNamespace(q); err != nil {
+		return err
+	}
+	if _, err := q.Exec(`
+		INSERT INTO drive_changes (owner_id, type, node_id, path, old_path, actor)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, d.OwnerID, typ, node, path, oldPath, act.Name); err != nil {
+		return fmt.Errorf("record change event failed: %v", err)
+	}
+	// 覆盖已有节点时在审计记录中注明，“最近使用”据此把上传归为编辑
+	var detail gin.H
+	if typ == changeUpdated {
+		detail = gin.H{"overwritten": true}
+	}
+	return recordAudit(q, act, d.OwnerID, action, nodeID, path, oldPath, detail)
+}
+
+// recordChanges 批量写入同一类型的变更事件及对应的审计记录，用于一次导入大量节点
+func (d *drive) recordChanges(q dbQuerier, typ, action string, nodeIDs []int64, paths []string, act actor) error {
+	if len(nodeIDs) == 0 {
+		return nil
+	}
+	if err := d.lockNamespace(q); err != nil {
+		return err
+	}
+	if _, err := q.Exec(`
+		INSERT INTO drive_changes (owner_id, type, node_id, path, actor)
+		SELECT $1, $2, n, p, $5 FROM unnest($3::int[], $4::text[]) AS t(n, p)
+	`, d.OwnerID, typ, pq.Array(nodeIDs), pq.Array(paths), act.Name); err != nil {
+		return fmt.Errorf("record change events failed: %v", err)
+	}
+	return recordAuditBatch(q, act, d.OwnerID, action, nodeIDs, paths)
+}
+
+// outcomeChange 按冲突处理结果确定写入事件的类型：覆盖已有节点为 updated，其余为 created
+func outcomeChange(out conflictOutcome) string {
+	if out.Action == actionOverwritten {
+		return changeUpdated
+	}
+	return changeCreated
+}
+
+// changeHub 按命名空间管理订阅者；通知只是唤醒信号，事件内容总是从数据库读取
+type changeHub struct {
+	mu   sync.Mutex
+	subs map[int64]map[chan struct{}]bool
+}
+
+func newChangeHub() *changeHub {
+	return &changeHub{subs: map[int64]map[chan struct{}]bool{}}
+}
+
+func (h *changeHub) subscribe(ownerID int64) chan struct{} {
+	ch := make(chan struct{}, 1)
+	h.mu.Lock()
+	if h.subs[ownerID] == nil {
+		h.subs[ownerID] = map[chan struct{}]bool{}
+	}
+	h.subs[ownerID][ch] = true
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *changeHub) unsubscribe(ownerID int64, ch chan struct{}) {
+	h.mu.Lock()
+	delete(h.subs[ownerID], ch)
+	if len(h.subs[ownerID]) == 0 {
+		delete(h.subs, ownerID)
+	}
+	h.mu.Unlock()
+}
+
+// notify 唤醒命名空间的所有订阅者；已有未处理的信号时不重复发送
+func (h *changeHub) notify(ownerID int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs[ownerID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// notifyChange 在写入变更事件的事务提交后调用
+func (s *Server) notifyChange(d *drive) {
+	if s.changes != nil {
+		s.changes.notify(d.OwnerID)
+	}
+	s.wakeWebhooks()
+}
+
+// changesSince 读取游标之后的事件
+func (d *drive) changesSince(q dbQuerier, cursor int64, limit int) ([]ChangeEvent, error) {
+	rows, err := q.Query(`
+		SELECT id, type, COALESCE(node_id, 0), path, old_path, actor, created_at
+		FROM drive_changes
+		WHERE owner_id = $1 AND id > $2
+		ORDER BY id
+		LIMIT $3
+	`, d.OwnerID, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []ChangeEvent
+	for rows.Next() {
+		ev := ChangeEvent{OwnerID: d.OwnerID}
+		if err := rows.Scan(&ev.Cursor, &ev.Type, &ev.NodeID, &ev.Path, &ev.OldPath, &ev.Actor, &ev.Time); err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+	return events, rows.Err()
+}
+
+// latestChange 返回命名空间内已提交的最新事件 ID，没有事件时为 0
+func (d *drive) latestChange(q dbQuerier) (int64, error) {
+	var id int64
+	err := q.QueryRow("SELECT COALESCE(MAX(id), 0) FROM drive_changes WHERE owner_id = $1", d.OwnerID).Scan(&id)
+	return id, err
+}
+
+// changeSubscription 解析订阅参数：命名空间、当前用户与起始游标（-1 表示从最新位置开始）
+func (s *Server) changeSubscription(c *gin.Context) (*drive, int64, int64, error) {
+	d := s.driveFor(c)
+	userID := currentUser(c).ID
+	if userID != d.OwnerID {
+		// 订阅他人的命名空间至少需要一个可读节点，事件再逐条按权限过滤
+		visible, err := d.readableNodes(s.DB, userID)
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("check permission failed: %v", err)
+		}
+		if len(visible) == 0 {
+			return nil, 0, 0, newAPIError(http.StatusForbidden, "Permission denied: read on /")
+		}
+	}
+	cursor := int64(-1)
+	raw := c.Query("cursor")
+	if raw == "" {
+		// EventSource 重连时自动携带 Last-Event-ID
+		raw = c.GetHeader("Last-Event-ID")
+	}
+	if raw != "" {
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || v < 0 {
+			return nil, 0, 0, newAPIError(http.StatusBadRequest, "Invalid 'cursor' parameter")
+		}
+		cursor = v
+	}
+	return d, userID, cursor, nil
+}
+
+// canSeeChange 判断订阅者是否能看到该事件：移动事件只要新旧路径之一可读即可
+func (s *Server) canSeeChange(d *drive, userID int64, ev ChangeEvent) bool {
+	if userID == d.OwnerID {
+		return true
+	}
+	if s.authorizeUser(userID, d, ev.Path, PermRead) == nil {
+		return true
+	}
+	return ev.OldPath != "" && s.authorizeUser(userID, d, ev.OldPath, PermRead) == nil
+}
+
+// streamChanges 向一个订阅者推送事件，直到 ctx 结束或发送失败。
+// 先补发游标之后的历史事件，之后每次被唤醒都从数据库读取新事件
+func (s *Server) streamChanges(ctx context.Context, d *drive, userID, cursor int64, send func(ChangeEvent) error, ping func() error) error {
+	wake := s.changes.subscribe(d.OwnerID)
+	defer s.changes.unsubscribe(d.OwnerID, wake)
+
+	var oldest, latest int64
+	if err := s.DB.QueryRow("SELECT COALESCE(MIN(id), 0), COALESCE(MAX(id), 0) FROM drive_changes").Scan(&oldest, &latest); err != nil {
+		return err
+	}
+	switch {
+	case cursor < 0:
+		// 从本命名空间已提交的最新事件开始；全局最大 ID 可能越过本命名空间尚未提交的事件
+		own, err := d.latestChange(s.DB)
+		if err != nil {
+			return err
+		}
+		cursor = own
+	case cursor > latest || (oldest > 0 && cursor < oldest-1) || (oldest == 0 && cursor > 0):
+		// 游标之后的事件已被清理，或游标不属于当前数据库
+		if err := send(ChangeEvent{Cursor: latest, Type: changeReset, OwnerID: d.OwnerID, Time: time.Now()}); err != nil {
+			return err
+		}
+		cursor = latest
+	}
+	if err := send(ChangeEvent{Cursor: cursor, Type: changeReady, OwnerID: d.OwnerID, Time: time.Now()}); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(changeHeartbeat)
+	defer ticker.Stop()
+	for {
+		events, err := d.changesSince(s.DB, cursor, changeBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, ev := range events {
+			cursor = ev.Cursor
+			if !s.canSeeChange(d, userID, ev) {
+				continue
+			}
+			if err := send(ev); err != nil {
+				return err
+			}
+		}
+		if len(events) == changeBatchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-wake:
+		case <-ticker.C:
+			if err := ping(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// handleChangesSSE 通过 Server-Sent Events 推送变更，事件 ID 即游标
+func (s *Server) handleChangesSSE(c *gin.Context) {
+	d, userID, cursor, err := s.changeSubscription(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	w := c.Writer
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	w.Flush()
+
+	send := func(ev ChangeEvent) error {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Cursor, ev.Type, data); err != nil {
+			return err
+		}
+		w.Flush()
+		return nil
+	}
+	ping := func() error {
+		if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+			return err
+		}
+		w.Flush()
+		return nil
+	}
+	if err := s.streamChanges(c.Request.Context(), d, userID, cursor, send, ping); err != nil {
+		log.Printf("change stream closed: %v", err)
+	}
+}
+
+// handleChangesWS 通过 WebSocket 推送变更，每条消息是一个 JSON 事件
+func (s *Server) handleChangesWS(c *gin.Context) {
+	d, userID, cursor, err := s.changeSubscription(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	ws := websocket.Server{
+		Handshake: checkWSOrigin,
+		Handler: func(conn *websocket.Conn) {
+			conn.MaxPayloadBytes = changeWSReadLimit
+			ctx, cancel := context.WithCancel(c.Request.Context())
+			defer cancel()
+			// 客户端不需要发送消息；持续读取以便及时发现连接断开
+			go func() {
+				var msg string
+				for websocket.Message.Receive(conn, &msg) == nil {
+				}
+				cancel()
+			}()
+			send := func(ev ChangeEvent) error {
+				return websocket.JSON.Send(conn, ev)
+			}
+			ping := func() error {
+				return websocket.JSON.Send(conn, gin.H{"type": "ping"})
+			}
+			if err := s.streamChanges(ctx, d, userID, cursor, send, ping); err != nil {
+				log.Printf("change stream closed: %v", err)
+			}
+		},
+	}
+	ws.ServeHTTP(c.Writer, c.Request)
+}
+
+// checkWSOrigin 浏览器发起的 WebSocket 连接会带上 Cookie，只接受同源页面，防止跨站劫持
+func checkWSOrigin(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host != r.Host {
+		return fmt.Errorf("cross-origin websocket rejected: %s", origin)
+	}
+	config.Origin = u
+	return nil
+}
+
+// startChangePruner 后台定期清理超过保留期的变更事件
+func (s *Server) startChangePruner(interval time.Duration) {
+	if s.changeRetention <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			s.pruneChanges()
+			<-ticker.C
+		}
+	}()
+}
+
+func (s *Server) pruneChanges() {
+	res, err := s.DB.Exec("DELETE FROM drive_changes WHERE created_at < $1", time.Now().Add(-s.changeRetention))
+	if err != nil {
+		log.Printf("warning: prune change events failed: %v", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("变更事件自动清理 %d 条", n)
+	}
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConflictPolicy 目标路径已被占用时的处理策略
+type ConflictPolicy string
+
+const (
+	ConflictFail      ConflictPolicy = "fail"       // 返回 409
+	ConflictOverwrite ConflictPolicy = "overwrite"  // 覆盖已有文件/目录
+	ConflictRename    ConflictPolicy = "rename"     // 改名为 "name (1).ext"
+	ConflictSkip      ConflictPolicy = "skip"       // 保留已有内容，跳过本次写入
+	ConflictKeepNewer ConflictPolicy = "keep-newer" // 修改时间较新者胜出
+)
+
+// 冲突处理后的实际动作
+const (
+	actionCreated     = "created"
+	actionOverwritten = "overwritten"
+	actionRenamed     = "renamed"
+	actionSkipped     = "skipped"
+)
+
+// parseConflictPolicy 解析 onConflict 参数，空值时使用各接口自己的默认策略
+func parseConflictPolicy(raw string, def ConflictPolicy) (ConflictPolicy, error) {
+	if raw == "" {
+		return def, nil
+	}
+	switch p := ConflictPolicy(strings.ToLower(raw)); p {
+	case ConflictFail, ConflictOverwrite, ConflictRename, ConflictSkip, ConflictKeepNewer:
+		return p, nil
+	}
+	return "", newAPIError(http.StatusBadRequest, "Invalid onConflict: %s (expect fail|overwrite|rename|skip|keep-newer)", raw)
+}
+
+// parseModTime 解析客户端提供的修改时间，支持 Unix 秒与 RFC3339，空值返回零值
+func parseModTime(raw string) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if sec, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, newAPIError(http.StatusBadRequest, "Invalid modTime: %s", raw)
+	}
+	return t, nil
+}
+
+// conflictOutcome 描述一次冲突处理的结果，会原样返回给客户端
+type conflictOutcome struct {
+	Policy     ConflictPolicy `json:"policy"`
+	Conflict   bool           `json:"conflict"`
+	Action     string         `json:"action"`
+	Path       string         `json:"path"`
+	ExistingID int64          `json:"-"` // 被覆盖节点的 ID（仅 overwritten 时有效）
+}
+
+// Proceed 表示调用方是否需要继续写入
+func (o conflictOutcome) Proceed() bool { return o.Action != actionSkipped }
+
+// pathTaken 判断相对路径是否已被数据库或文件系统占用
+func (d *drive) pathTaken(q dbQuerier, rel string) (int64, bool, error) {
+	id, err := d.lookupNode(q, rel)
+	if err == nil {
+		return id, true, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, false, err
+	}
+	if _, err := os.Lstat(d.abs(rel)); err == nil {
+		return 0, true, nil
+	}
+	return 0, false, nil
+}
+
+// resolveConflict 根据策略决定 target 的最终落地路径
+// incomingMod 为新内容的修改时间，仅 keep-newer 使用；零值视为“更新”
+func (d *drive) resolveConflict(q dbQuerier, target string, policy ConflictPolicy, incomingMod time.Time) (conflictOutcome, error) {
+	out := conflictOutcome{Policy: policy, Action: actionCreated, Path: target}
+	id, taken, err := d.pathTaken(q, target)
+	if err != nil {
+		return out, fmt.Errorf("check target path failed: %v", err)
+	}
+	if !taken {
+		return out, nil
+	}
+	out.Conflict = true
+
+	switch policy {
+	case ConflictFail:
+		return out, newAPIError(http.StatusConflict, "Target path already exists: %s", target)
+	case ConflictSkip:
+		out.Action = actionSkipped
+	case ConflictRename:
+		name, err := d.nextFreeName(q, target)
+		if err != nil {
+			return out, err
+		}
+		out.Action = actionRenamed
+		out.Path = name
+	case ConflictKeepNewer:
+		info, err := os.Stat(d.abs(target))
+		if err == nil && !incomingMod.IsZero() && !incomingMod.After(info.ModTime()) {
+			out.Action = actionSkipped
+			return out, nil
+		}
+		out.Action = actionOverwritten
+		out.ExistingID = id
+	default:
+		out.Action = actionOverwritten
+		out.ExistingID = id
+	}
+	return out, nil
+}
+
+// nextFreeName 生成 "name (1).ext" 形式的第一个未占用路径
+func (d *drive) nextFreeName(q dbQuerier, target string) (string, error) {
+	dir := parentRel(target)
+	base := path.Base(target)
+	ext := path.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	if stem == "" {
+		// 形如 ".env" 的隐藏文件，整体视为主名
+		stem, ext = base, ""
+	}
+	for i := 1; i < 10000; i++ {
+		candidate := joinRel(dir, fmt.Sprintf("%s (%d)%s", stem, i, ext))
+		_, taken, err := d.pathTaken(q, candidate)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no free name for %s", target)
+}
+
+// clearForOverwrite 覆盖前的清理：目录（或类型不一致）需整体替换，同类文件原地覆盖以保留节点 ID
+// （旧内容由调用方归档为历史版本）。整体替换时旧节点移入回收站，覆盖之后仍可恢复。
+// 返回 true 表示旧节点已移走，调用方需要重新插入；undo 在事务提交失败时把旧节点移回原处，
+// 调用前需先移走已写到该路径的新内容
+func (d *drive) clearForOverwrite(q dbQuerier, out *conflictOutcome, incomingIsDir bool) (bool, func(), error) {
+	noop := func() {}
+	if out.Action != actionOverwritten {
+		return false, noop, nil
+	}
+	info, err := os.Lstat(d.abs(out.Path))
+	existingIsDir := err == nil && info.IsDir()
+	if !incomingIsDir && !existingIsDir && out.ExistingID != 0 {
+		return false, noop, nil
+	}
+	if err != nil && out.ExistingID == 0 {
+		return true, noop, nil
+	}
+	_, undo, err := d.moveToTrash(q, out.ExistingID, out.Path)
+	if err != nil {
+		return false, nil, fmt.Errorf("move replaced node to trash failed: %v", err)
+	}
+	out.ExistingID = 0
+	return true, undo, nil
+}
+
+// copyPath 递归复制文件或目录，保留修改时间
+func copyPath(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		if err := os.MkdirAll(dst, os.ModePerm); err != nil {
+			return err
+		}
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := copyPath(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
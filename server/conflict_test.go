@@ -0,0 +1,142 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testDrive 返回以临时目录为根的命名空间，并在磁盘上创建 files 中的文件
+func testDrive(t *testing.T, files ...string) *drive {
+	t.Helper()
+	d := &drive{OwnerID: 1, Root: t.TempDir()}
+	for _, name := range files {
+		full := d.abs(name)
+		if err := os.MkdirAll(filepath.Dir(full), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return d
+}
+
+func TestNextFreeName(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		db     []string // 库中已有的路径
+		disk   []string // 只存在于磁盘上的路径
+		want   string
+	}{
+		{"first free", "a.txt", []string{"a.txt"}, nil, "a (1).txt"},
+		{"skips taken", "a.txt", []string{"a.txt", "a (1).txt", "a (2).txt"}, nil, "a (3).txt"},
+		{"taken on disk only", "a.txt", []string{"a.txt"}, []string{"a (1).txt"}, "a (2).txt"},
+		{"in a directory", "dir/report.tar.gz", []string{"dir/report.tar.gz"}, nil, "dir/report.tar (1).gz"},
+		{"no extension", "notes", []string{"notes"}, nil, "notes (1)"},
+		{"hidden file", ".env", []string{".env"}, nil, ".env (1)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes := map[string]int64{}
+			for _, name := range tt.db {
+				nodes[name] = 1
+			}
+			d := testDrive(t, tt.disk...)
+			db := openFakeDB(t, newFakeNamespace(d.OwnerID, nodes))
+			got, err := d.nextFreeName(db, tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("nextFreeName(%q) = %q, want %q", tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveConflict(t *testing.T) {
+	// 磁盘上已有文件的修改时间
+	existingMod := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	older, newer := existingMod.Add(-time.Hour), existingMod.Add(time.Hour)
+
+	tests := []struct {
+		name       string
+		target     string
+		policy     ConflictPolicy
+		incoming   time.Time
+		wantStatus int // 非 0 表示期望返回该状态码的错误
+		want       conflictOutcome
+	}{
+		{"free path", "new.txt", ConflictFail, time.Time{}, 0,
+			conflictOutcome{Policy: ConflictFail, Action: actionCreated, Path: "new.txt"}},
+		{"fail", "a.txt", ConflictFail, time.Time{}, http.StatusConflict, conflictOutcome{}},
+		{"skip", "a.txt", ConflictSkip, time.Time{}, 0,
+			conflictOutcome{Policy: ConflictSkip, Conflict: true, Action: actionSkipped, Path: "a.txt"}},
+		{"rename", "a.txt", ConflictRename, time.Time{}, 0,
+			conflictOutcome{Policy: ConflictRename, Conflict: true, Action: actionRenamed, Path: "a (1).txt"}},
+		{"overwrite", "a.txt", ConflictOverwrite, time.Time{}, 0,
+			conflictOutcome{Policy: ConflictOverwrite, Conflict: true, Action: actionOverwritten, Path: "a.txt", ExistingID: 1}},
+		{"keep-newer with newer content", "a.txt", ConflictKeepNewer, newer, 0,
+			conflictOutcome{Policy: ConflictKeepNewer, Conflict: true, Action: actionOverwritten, Path: "a.txt", ExistingID: 1}},
+		{"keep-newer with older content", "a.txt", ConflictKeepNewer, older, 0,
+			conflictOutcome{Policy: ConflictKeepNewer, Conflict: true, Action: actionSkipped, Path: "a.txt"}},
+		{"keep-newer with equal time", "a.txt", ConflictKeepNewer, existingMod, 0,
+			conflictOutcome{Policy: ConflictKeepNewer, Conflict: true, Action: actionSkipped, Path: "a.txt"}},
+		{"keep-newer without time", "a.txt", ConflictKeepNewer, time.Time{}, 0,
+			conflictOutcome{Policy: ConflictKeepNewer, Conflict: true, Action: actionOverwritten, Path: "a.txt", ExistingID: 1}},
+		{"untracked file on disk", "stray.txt", ConflictOverwrite, time.Time{}, 0,
+			conflictOutcome{Policy: ConflictOverwrite, Conflict: true, Action: actionOverwritten, Path: "stray.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := testDrive(t, "a.txt", "stray.txt")
+			if err := os.Chtimes(d.abs("a.txt"), existingMod, existingMod); err != nil {
+				t.Fatal(err)
+			}
+			db := openFakeDB(t, newFakeNamespace(d.OwnerID, map[string]int64{"a.txt": 1}))
+			got, err := d.resolveConflict(db, tt.target, tt.policy, tt.incoming)
+			if tt.wantStatus != 0 {
+				var ae *apiError
+				if !errors.As(err, &ae) || ae.status != tt.wantStatus {
+					t.Fatalf("err = %v, want status %d", err, tt.wantStatus)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("outcome = %+v, want %+v", got, tt.want)
+			}
+			if got.Proceed() != (tt.want.Action != actionSkipped) {
+				t.Errorf("Proceed() = %v for action %s", got.Proceed(), got.Action)
+			}
+		})
+	}
+}
+
+func TestParseConflictPolicy(t *testing.T) {
+	tests := []struct {
+		raw     string
+		def     ConflictPolicy
+		want    ConflictPolicy
+		wantErr bool
+	}{
+		{"", ConflictFail, ConflictFail, false},
+		{"", ConflictRename, ConflictRename, false},
+		{"overwrite", ConflictFail, ConflictOverwrite, false},
+		{"Keep-Newer", ConflictFail, ConflictKeepNewer, false},
+		{"replace", ConflictFail, "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseConflictPolicy(tt.raw, tt.def)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseConflictPolicy(%q, %q) = %q, %v; want %q", tt.raw, tt.def, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// drive 一个用户的存储命名空间：元数据按 owner_id 隔离，文件存放在 uploads/users/<id>/ 下
+type drive struct {
+	OwnerID     int64
+	Root        string // 文件存储根目录
+	TrashDir    string // 回收站存储目录
+	VersionsDir string // 历史版本存储目录
+}
+
+// driveOf 返回指定用户的命名空间
+func (s *Server) driveOf(ownerID int64) *drive {
+	base := filepath.Join(s.uploadDir, "users", strconv.FormatInt(ownerID, 10))
+	return &drive{
+		OwnerID:     ownerID,
+		Root:        filepath.Join(base, "files"),
+		TrashDir:    filepath.Join(base, "trash"),
+		VersionsDir: filepath.Join(base, "versions"),
+	}
+}
+
+// driveFor 返回本次请求操作的命名空间（由 resolveDrive 根据 owner 参数确定）
+func (s *Server) driveFor(c *gin.Context) *drive {
+	if v, ok := c.Get(ctxDriveKey); ok {
+		if d, ok := v.(*drive); ok {
+			return d
+		}
+	}
+	return s.ownDrive(c)
+}
+
+// abs 把命名空间内的相对路径转换为磁盘路径
+func (d *drive) abs(rel string) string {
+	return filepath.Join(d.Root, rel)
+}
+
+// adoptLegacyData 把引入多用户之前的数据（owner_id 为空、文件直接位于 uploads/ 下）归入第一个管理员
+func (s *Server) adoptLegacyData(userID int64) error {
+	for _, stmt := range []string{
+		"UPDATE drivelist SET owner_id=$1 WHERE owner_id IS NULL",
+		"UPDATE drive_trash SET owner_id=$1 WHERE owner_id IS NULL",
+		"UPDATE drivelist_versions SET owner_id=$1 WHERE owner_id IS NULL",
+	} {
+		if _, err := s.DB.Exec(stmt, userID); err != nil {
+			return err
+		}
+	}
+
+	d := s.driveOf(userID)
+	moves := map[string]string{
+		trashDirName:    d.TrashDir,
+		versionsDirName: d.VersionsDir,
+	}
+	entries, err := os.ReadDir(s.uploadDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == "_tmp" || name == "users" || name == ".gitkeep" {
+			continue
+		}
+		if dst, ok := moves[name]; ok {
+			// 回收站与版本存储按条目移动到新目录
+			sub, err := os.ReadDir(filepath.Join(s.uploadDir, name))
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(dst, os.ModePerm); err != nil {
+				return err
+			}
+			for _, item := range sub {
+				if err := os.Rename(filepath.Join(s.uploadDir, name, item.Name()), filepath.Join(dst, item.Name())); err != nil {
+					return err
+				}
+			}
+			os.Remove(filepath.Join(s.uploadDir, name))
+			continue
+		}
+		if err := os.Rename(filepath.Join(s.uploadDir, name), d.abs(name)); err != nil {
+			return err
+		}
+	}
+	log.Printf("已将旧数据迁移到用户 %d 的命名空间", userID)
+	return nil
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 测试用的 database/sql 驱动：不连接数据库，按 SQL 片段匹配返回一个内存命名空间的数据，
+// 让依赖 dbQuerier 的冲突处理与配额检查可以在没有 PostgreSQL 的环境下测试
+
+// fakeNamespace 内存中的命名空间：路径到容量（0 表示目录），以及配额规则
+type fakeNamespace struct {
+	ownerID int64
+	nodes   map[string]int64
+	ids     map[string]int64
+	quotas  []QuotaUsage
+	queries []string // 按执行顺序记录的语句
+}
+
+func newFakeNamespace(ownerID int64, nodes map[string]int64) *fakeNamespace {
+	ns := &fakeNamespace{ownerID: ownerID, nodes: nodes, ids: map[string]int64{}}
+	var id int64
+	for name := range nodes {
+		id++
+		ns.ids[name] = id
+	}
+	return ns
+}
+
+func (ns *fakeNamespace) nameOf(id int64) string {
+	for name, v := range ns.ids {
+		if v == id {
+			return name
+		}
+	}
+	return ""
+}
+
+// subtree 统计 root 及其后代的字节数与文件数，root 为空表示整个命名空间
+func (ns *fakeNamespace) subtree(root string) (int64, int64) {
+	var bytes, files int64
+	for name, capacity := range ns.nodes {
+		if !inScope(root, name) {
+			continue
+		}
+		bytes += capacity
+		if capacity > 0 {
+			files++
+		}
+	}
+	return bytes, files
+}
+
+func (ns *fakeNamespace) query(q string, args []driver.Value) ([][]driver.Value, error) {
+	ns.queries = append(ns.queries, q)
+	switch {
+	case strings.Contains(q, "pg_advisory_xact_lock"):
+		return nil, nil
+	case strings.Contains(q, "SELECT id FROM drivelist WHERE owner_id=$1 AND name=$2"):
+		if id, ok := ns.ids[args[1].(string)]; ok {
+			return [][]driver.Value{{id}}, nil
+		}
+		return nil, nil
+	case strings.Contains(q, "FROM drive_quotas WHERE owner_id = $1"):
+		var rows [][]driver.Value
+		for _, u := range ns.quotas {
+			rows = append(rows, []driver.Value{u.Path, u.MaxBytes, u.MaxFiles})
+		}
+		return rows, nil
+	case strings.Contains(q, "WHERE c.ancestor = $1"):
+		bytes, files := ns.subtree(ns.nameOf(args[0].(int64)))
+		return [][]driver.Value{{bytes, files}}, nil
+	case strings.Contains(q, "FROM drivelist WHERE owner_id = $1"):
+		bytes, files := ns.subtree("")
+		return [][]driver.Value{{bytes, files}}, nil
+	}
+	return nil, fmt.Errorf("fakedb: unexpected query: %s", q)
+}
+
+var (
+	fakeDBMu sync.Mutex
+	fakeDBs  = map[string]*fakeNamespace{}
+)
+
+func init() {
+	sql.Register("fakedb", fakeDriver{})
+}
+
+// openFakeDB 打开一个连接到 ns 的 *sql.DB，测试结束时关闭
+func openFakeDB(t *testing.T, ns *fakeNamespace) *sql.DB {
+	t.Helper()
+	fakeDBMu.Lock()
+	fakeDBs[t.Name()] = ns
+	fakeDBMu.Unlock()
+	db, err := sql.Open("fakedb", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		db.Close()
+		fakeDBMu.Lock()
+		delete(fakeDBs, t.Name())
+		fakeDBMu.Unlock()
+	})
+	return db
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeDBMu.Lock()
+	defer fakeDBMu.Unlock()
+	ns, ok := fakeDBs[name]
+	if !ok {
+		return nil, fmt.Errorf("fakedb: unknown database %s", name)
+	}
+	return &fakeConn{ns: ns}, nil
+}
+
+type fakeConn struct{ ns *fakeNamespace }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{c.ns, query}, nil }
+func (c *fakeConn) Close() error                              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)                 { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	ns    *fakeNamespace
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	rows, err := s.ns.query(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(len(rows)), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	rows, err := s.ns.query(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{rows: rows}, nil
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+	next int
+}
+
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	cols := make([]string, len(r.rows[0]))
+	for i := range cols {
+		cols[i] = fmt.Sprintf("c%d", i)
+	}
+	return cols
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
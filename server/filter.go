@@ -0,0 +1,251 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 筛选：/filter/type、/filter/date、/filter/size 共用同一套条件，
+// 每个端点要求提供自己的主要参数，其余条件（包括提取出的元数据）可以任意叠加
+
+// typeCategories 类型分类对应的 MIME 匹配模式（SQL LIKE）
+var typeCategories = map[string][]string{
+	"image": {"image/%"},
+	"video": {"video/%"},
+	"audio": {"audio/%"},
+	"text":  {"text/%", "application/json", "application/xml", "application/javascript"},
+	"document": {
+		"application/pdf", "application/msword", "application/rtf", "text/rtf",
+		"application/vnd.openxmlformats-officedocument.%", "application/vnd.oasis.opendocument.%",
+		"application/vnd.ms-excel", "application/vnd.ms-powerpoint",
+	},
+	"archive": {
+		"application/zip", "application/x-tar", "application/gzip", "application/x-7z-compressed",
+		"application/x-rar-compressed", "application/zstd", "application/x-xz", "application/x-bzip2",
+	},
+}
+
+// FilterItem 筛选结果中的一个文件
+type FilterItem struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	Capacity  int64     `json:"capacity"`
+	IsDir     bool      `json:"is_dir"`
+	CreatedAt time.Time `json:"created_at"`
+	Metadata  *FileMeta `json:"metadata,omitempty"`
+}
+
+// filterConds 根据查询参数生成筛选条件（表别名 d 为 drivelist，m 为 drive_metadata），搜索接口也复用这些条件；
+// arg 登记一个参数并返回其占位符
+func filterConds(c *gin.Context, ownerID, userID int64, arg func(any) string) ([]string, error) {
+	var conds []string
+	conds = append(conds, "d.owner_id = "+arg(ownerID))
+	if userID != ownerID {
+		// 他人的命名空间只能看到共享给自己的子树
+		conds = append(conds, `d.id IN (
+			SELECT cl.descendant FROM drive_acl a JOIN drivelist_closure cl ON cl.ancestor = a.node_id
+			WHERE a.user_id = `+arg(userID)+` AND a.perms & `+arg(PermRead|PermAdmin)+` <> 0)`)
+	}
+
+	if raw := c.Query("path"); raw != "" {
+		rel, err := cleanRelPath(raw)
+		if err != nil {
+			return nil, err
+		}
+		if rel != "" {
+			conds = append(conds, "left(d.name, length("+arg(rel)+"::text) + 1) = "+arg(rel+"/"))
+		}
+	}
+
+	if raw := strings.ToLower(c.Query("type")); raw != "" {
+		patterns, ok := typeCategories[raw]
+		if !ok {
+			if !strings.Contains(raw, "/") {
+				return nil, newAPIError(http.StatusBadRequest, "Unknown type %q, expected a category or a MIME type like image/*", raw)
+			}
+			patterns = []string{strings.Replace(raw, "*", "%", 1)}
+		}
+		var ors []string
+		for _, p := range patterns {
+			ors = append(ors, "m.mime LIKE "+arg(p))
+		}
+		conds = append(conds, "("+strings.Join(ors, " OR ")+")")
+	}
+
+	// 日期：date_field=created（上传时间，默认）或 taken（拍摄时间）；只给日期时 end_date 当天包含在内
+	column := "d.created_at"
+	switch c.DefaultQuery("date_field", "created") {
+	case "created":
+	case "taken":
+		column = "m.taken_at"
+	default:
+		return nil, newAPIError(http.StatusBadRequest, "Invalid 'date_field' parameter, expected created or taken")
+	}
+	for _, bound := range []struct{ param, op string }{{"start_date", ">="}, {"end_date", "<"}} {
+		raw := c.Query(bound.param)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			if t, err = time.ParseInLocation("2006-01-02", raw, time.Local); err != nil {
+				return nil, newAPIError(http.StatusBadRequest, "Invalid '%s' parameter, expected YYYY-MM-DD or RFC3339", bound.param)
+			}
+			if bound.param == "end_date" {
+				t = t.AddDate(0, 0, 1)
+			}
+		}
+		conds = append(conds, column+" "+bound.op+" "+arg(t))
+	}
+
+	// 数值范围：大小（字节）、宽高（像素）、时长（秒）、页数
+	ranges := []struct {
+		param, column, op string
+		scale             float64
+	}{
+		{"min_size", "d.capacity", ">=", 1},
+		{"max_size", "d.capacity", "<=", 1},
+		{"min_width", "m.width", ">=", 1},
+		{"min_height", "m.height", ">=", 1},
+		{"min_duration", "m.duration_ms", ">=", 1000},
+		{"max_duration", "m.duration_ms", "<=", 1000},
+		{"min_pages", "m.pages", ">=", 1},
+		{"max_pages", "m.pages", "<=", 1},
+	}
+	for _, r := range ranges {
+		raw := c.Query(r.param)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil || v < 0 {
+			return nil, newAPIError(http.StatusBadRequest, "Invalid '%s' parameter", r.param)
+		}
+		conds = append(conds, r.column+" "+r.op+" "+arg(int64(v*r.scale)))
+	}
+
+	if raw := c.Query("camera"); raw != "" {
+		conds = append(conds, "m.camera ILIKE "+arg("%"+likeEscape(raw)+"%"))
+	}
+	if raw := c.Query("has_gps"); raw != "" {
+		hasGPS, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, newAPIError(http.StatusBadRequest, "Invalid 'has_gps' parameter")
+		}
+		if hasGPS {
+			conds = append(conds, "m.gps_lat IS NOT NULL")
+		} else {
+			conds = append(conds, "m.gps_lat IS NULL")
+		}
+	}
+
+	// 标签：逗号分隔，需同时带有全部标签；starred=true 只看当前用户收藏的节点
+	if raw := c.Query("tag"); raw != "" {
+		tags, err := parseTags(raw)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tags {
+			conds = append(conds, "d.id IN (SELECT node_id FROM drive_tags WHERE tag = "+arg(t)+")")
+		}
+	}
+	if raw := c.Query("starred"); raw != "" {
+		starred, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, newAPIError(http.StatusBadRequest, "Invalid 'starred' parameter")
+		}
+		op := "IN"
+		if !starred {
+			op = "NOT IN"
+		}
+		conds = append(conds, "d.id "+op+" (SELECT node_id FROM drive_favorites WHERE user_id = "+arg(userID)+")")
+	}
+
+	return conds, nil
+}
+
+// handleFilter 执行筛选并返回文件数组（容量为 0 的是目录，不参与筛选；limit 默认 500，最大 5000）
+func (s *Server) handleFilter(c *gin.Context) {
+	d := s.driveFor(c)
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	conds, err := filterConds(c, d.OwnerID, currentUser(c).ID, arg)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	query := `SELECT d.id, d.name, d.capacity, d.created_at, ` + metaColumns + `
+		FROM drivelist d LEFT JOIN drive_metadata m ON m.node_id = d.id
+		WHERE d.capacity > 0 AND ` + strings.Join(conds, " AND ") + `
+		ORDER BY d.created_at DESC, d.id DESC`
+	limit := 500
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > 5000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'limit' parameter"})
+			return
+		}
+		limit = n
+	}
+	args = append(args, limit)
+	rows, err := s.DB.Query(query+" LIMIT $"+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	items := []FilterItem{}
+	for rows.Next() {
+		var it FilterItem
+		var m metaScan
+		if err := rows.Scan(append([]any{&it.ID, &it.Name, &it.Capacity, &it.CreatedAt}, m.dest()...)...); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		it.Path = it.Name
+		it.Metadata = m.meta()
+		items = append(items, it)
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// requireFilterParam 各筛选端点要求至少提供一个自己的主要参数
+func (s *Server) requireFilterParam(c *gin.Context, params ...string) bool {
+	for _, p := range params {
+		if c.Query(p) != "" {
+			return true
+		}
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "Missing '" + strings.Join(params, "' or '") + "' query parameter"})
+	return false
+}
+
+// handleFilterByType 按类型筛选：GET /filter/type?type=image|video|audio|text|document|archive|<mime>
+func (s *Server) handleFilterByType(c *gin.Context) {
+	if s.requireFilterParam(c, "type") {
+		s.handleFilter(c)
+	}
+}
+
+// handleFilterByDate 按日期筛选：GET /filter/date?start_date=&end_date=&date_field=created|taken
+func (s *Server) handleFilterByDate(c *gin.Context) {
+	if s.requireFilterParam(c, "start_date", "end_date") {
+		s.handleFilter(c)
+	}
+}
+
+// handleFilterBySize 按大小筛选：GET /filter/size?min_size=&max_size=（字节）
+func (s *Server) handleFilterBySize(c *gin.Context) {
+	if s.requireFilterParam(c, "min_size", "max_size") {
+		s.handleFilter(c)
+	}
+}
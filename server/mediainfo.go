@@ -0,0 +1,708 @@
+package server
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// 媒体与文档元数据解析：只读取容器头部与必要的索引结构，全部用标准库实现
+
+const (
+	mp4MaxMoovSize = 32 << 20 // moov 盒子超过该大小时不解析
+	pdfMaxScanSize = 64 << 20 // PDF 只扫描前 64MB
+)
+
+// FileMeta 从文件内容提取的结构化元数据，未能提取的字段为空
+type FileMeta struct {
+	MIME       string     `json:"mime"`
+	Width      int        `json:"width,omitempty"`
+	Height     int        `json:"height,omitempty"`
+	DurationMS int64      `json:"duration_ms,omitempty"`
+	Pages      int        `json:"pages,omitempty"`
+	Camera     string     `json:"camera,omitempty"`
+	TakenAt    *time.Time `json:"taken_at,omitempty"`
+	GPS        *GeoPoint  `json:"gps,omitempty"`
+}
+
+// GeoPoint 拍摄地点（WGS84 十进制度）
+type GeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// extractFileMeta 嗅探文件类型并按类型解析元数据；解析失败的字段留空，只有文件无法读取时返回错误
+func extractFileMeta(path string) (*FileMeta, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	mt, err := mimetype.DetectReader(f)
+	if err != nil {
+		return nil, err
+	}
+	meta := &FileMeta{MIME: strings.TrimSpace(strings.SplitN(mt.String(), ";", 2)[0])}
+	size := info.Size()
+
+	switch {
+	case mimeIn(mt, "image/jpeg", "image/png", "image/gif", "image/webp"):
+		if _, err := f.Seek(0, io.SeekStart); err == nil {
+			if cfg, _, err := image.DecodeConfig(f); err == nil {
+				meta.Width, meta.Height = cfg.Width, cfg.Height
+			}
+		}
+		if tiff := findExif(f, size, meta.MIME); tiff != nil {
+			parseExif(tiff, meta)
+		}
+	case mimeIn(mt, "video/mp4", "video/quicktime"):
+		parseMP4(f, size, meta)
+	case mimeIn(mt, "audio/wav"):
+		parseWAV(f, size, meta)
+	case mimeIn(mt, "video/x-msvideo"):
+		parseAVI(f, meta)
+	case mimeIn(mt, "audio/flac"):
+		parseFLAC(f, meta)
+	case mimeIn(mt, "audio/mpeg"):
+		parseMP3(f, size, meta)
+	case mimeIn(mt, "audio/ogg", "video/ogg"):
+		parseOgg(f, size, meta)
+	case mimeIn(mt, "application/pdf"):
+		meta.Pages = pdfPageCount(f)
+	}
+	return meta, nil
+}
+
+// mimeIn 判断类型或其任一父类型是否在列表中（例如 m4a 的父类型是 video/mp4）
+func mimeIn(mt *mimetype.MIME, types ...string) bool {
+	for m := mt; m != nil; m = m.Parent() {
+		for _, t := range types {
+			if m.Is(t) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readAt 读取 [off, off+n)，不足时返回 nil
+func readAt(r io.ReaderAt, off int64, n int) []byte {
+	if off < 0 || n <= 0 {
+		return nil
+	}
+	buf := make([]byte, n)
+	if read, _ := r.ReadAt(buf, off); read < n {
+		return nil
+	}
+	return buf
+}
+
+// ---------- EXIF ----------
+
+// findExif 从 JPEG APP1、PNG eXIf 或 WebP EXIF 块中找到 TIFF 结构的 EXIF 数据
+func findExif(r io.ReaderAt, size int64, mime string) []byte {
+	switch mime {
+	case "image/jpeg":
+		off := int64(2)
+		for off+4 <= size {
+			hdr := readAt(r, off, 4)
+			if hdr == nil || hdr[0] != 0xFF {
+				return nil
+			}
+			marker := hdr[1]
+			if marker == 0xDA || marker == 0xD9 { // 图像数据开始，后面不会再有 EXIF
+				return nil
+			}
+			n := int(binary.BigEndian.Uint16(hdr[2:]))
+			if marker == 0xE1 && n > 8 {
+				if data := readAt(r, off+4, n-2); data != nil && bytes.HasPrefix(data, []byte("Exif\x00\x00")) {
+					return data[6:]
+				}
+			}
+			off += 2 + int64(n)
+		}
+	case "image/png":
+		off := int64(8)
+		for off+8 <= size {
+			hdr := readAt(r, off, 8)
+			if hdr == nil {
+				return nil
+			}
+			n := int64(binary.BigEndian.Uint32(hdr))
+			switch string(hdr[4:8]) {
+			case "eXIf":
+				if n > 1<<20 {
+					return nil
+				}
+				return readAt(r, off+8, int(n))
+			case "IDAT", "IEND":
+				return nil
+			}
+			off += 12 + n
+		}
+	case "image/webp":
+		off := int64(12)
+		for off+8 <= size {
+			hdr := readAt(r, off, 8)
+			if hdr == nil {
+				return nil
+			}
+			n := int64(binary.LittleEndian.Uint32(hdr[4:]))
+			if string(hdr[:4]) == "EXIF" {
+				if n > 1<<20 {
+					return nil
+				}
+				data := readAt(r, off+8, int(n))
+				return bytes.TrimPrefix(data, []byte("Exif\x00\x00"))
+			}
+			off += 8 + n + n%2
+		}
+	}
+	return nil
+}
+
+// tiffTypeSize TIFF 字段类型对应的单个值字节数
+var tiffTypeSize = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 7: 1, 9: 4, 10: 8}
+
+type tiffEntry struct {
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+// tiffIFD 解析一个 IFD，返回 tag 到条目的映射
+func tiffIFD(b []byte, bo binary.ByteOrder, off uint32) map[uint16]tiffEntry {
+	if int64(off)+2 > int64(len(b)) {
+		return nil
+	}
+	n := int(bo.Uint16(b[off:]))
+	entries := map[uint16]tiffEntry{}
+	for i := 0; i < n; i++ {
+		p := int(off) + 2 + i*12
+		if p+12 > len(b) {
+			break
+		}
+		e := tiffEntry{typ: bo.Uint16(b[p+2:]), count: bo.Uint32(b[p+4:])}
+		sz, ok := tiffTypeSize[e.typ]
+		if !ok || e.count > 1<<16 {
+			continue
+		}
+		total := sz * int(e.count)
+		if total <= 4 {
+			e.data = b[p+8 : p+8+total]
+		} else {
+			start := int64(bo.Uint32(b[p+8:]))
+			if start+int64(total) > int64(len(b)) {
+				continue
+			}
+			e.data = b[start : start+int64(total)]
+		}
+		entries[bo.Uint16(b[p:])] = e
+	}
+	return entries
+}
+
+func (e tiffEntry) str() string {
+	return strings.TrimSpace(strings.TrimRight(string(e.data), "\x00"))
+}
+
+func (e tiffEntry) uint(bo binary.ByteOrder) (uint32, bool) {
+	switch {
+	case e.typ == 3 && len(e.data) >= 2:
+		return uint32(bo.Uint16(e.data)), true
+	case e.typ == 4 && len(e.data) >= 4:
+		return bo.Uint32(e.data), true
+	}
+	return 0, false
+}
+
+func (e tiffEntry) rationals(bo binary.ByteOrder) []float64 {
+	if e.typ != 5 {
+		return nil
+	}
+	var out []float64
+	for i := 0; i+8 <= len(e.data); i += 8 {
+		num, den := bo.Uint32(e.data[i:]), bo.Uint32(e.data[i+4:])
+		if den == 0 {
+			return nil
+		}
+		out = append(out, float64(num)/float64(den))
+	}
+	return out
+}
+
+// EXIF 标签
+const (
+	exifTagMake        = 0x010F
+	exifTagModel       = 0x0110
+	exifTagDateTime    = 0x0132
+	exifTagExifIFD     = 0x8769
+	exifTagGPSIFD      = 0x8825
+	exifTagDateTimeOrg = 0x9003
+	exifTagOffsetOrg   = 0x9011
+	exifTagPixelX      = 0xA002
+	exifTagPixelY      = 0xA003
+)
+
+// parseExif 提取相机型号、拍摄时间和 GPS 坐标
+func parseExif(b []byte, meta *FileMeta) {
+	if len(b) < 8 {
+		return
+	}
+	var bo binary.ByteOrder
+	switch string(b[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return
+	}
+	ifd0 := tiffIFD(b, bo, bo.Uint32(b[4:]))
+	if ifd0 == nil {
+		return
+	}
+
+	maker, model := ifd0[exifTagMake].str(), ifd0[exifTagModel].str()
+	switch {
+	case maker == "" || strings.HasPrefix(strings.ToLower(model), strings.ToLower(maker)):
+		meta.Camera = model
+	case model == "":
+		meta.Camera = maker
+	default:
+		meta.Camera = maker + " " + model
+	}
+
+	taken, offset := ifd0[exifTagDateTime].str(), ""
+	if off, ok := ifd0[exifTagExifIFD].uint(bo); ok {
+		exif := tiffIFD(b, bo, off)
+		if v := exif[exifTagDateTimeOrg].str(); v != "" {
+			taken = v
+		}
+		offset = exif[exifTagOffsetOrg].str()
+		if meta.Width == 0 {
+			w, _ := exif[exifTagPixelX].uint(bo)
+			h, _ := exif[exifTagPixelY].uint(bo)
+			meta.Width, meta.Height = int(w), int(h)
+		}
+	}
+	if t, ok := parseExifTime(taken, offset); ok {
+		meta.TakenAt = &t
+	}
+
+	if off, ok := ifd0[exifTagGPSIFD].uint(bo); ok {
+		gps := tiffIFD(b, bo, off)
+		lat := dmsToDegrees(gps[2].rationals(bo), gps[1].str(), "S")
+		lon := dmsToDegrees(gps[4].rationals(bo), gps[3].str(), "W")
+		if !math.IsNaN(lat) && !math.IsNaN(lon) && (lat != 0 || lon != 0) {
+			meta.GPS = &GeoPoint{Lat: lat, Lon: lon}
+		}
+	}
+}
+
+// parseExifTime 解析 "2006:01:02 15:04:05"；没有时区偏移时按 UTC 记录
+func parseExifTime(v, offset string) (time.Time, bool) {
+	if v == "" || strings.HasPrefix(v, "0000") {
+		return time.Time{}, false
+	}
+	if offset != "" {
+		if t, err := time.Parse("2006:01:02 15:04:05-07:00", v+offset); err == nil {
+			return t, true
+		}
+	}
+	t, err := time.Parse("2006:01:02 15:04:05", v)
+	return t, err == nil
+}
+
+func dmsToDegrees(dms []float64, ref, negRef string) float64 {
+	if len(dms) != 3 {
+		return math.NaN()
+	}
+	deg := dms[0] + dms[1]/60 + dms[2]/3600
+	if strings.EqualFold(ref, negRef) {
+		deg = -deg
+	}
+	return deg
+}
+
+// ---------- 音视频容器 ----------
+
+// mp4Epoch ISO BMFF 时间戳的起点
+var mp4Epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// mp4Boxes 遍历 [off, end) 范围内的盒子
+func mp4Boxes(r io.ReaderAt, off, end int64, fn func(typ string, payload, size int64) bool) {
+	for off+8 <= end {
+		hdr := readAt(r, off, 8)
+		if hdr == nil {
+			return
+		}
+		size, headerLen := int64(binary.BigEndian.Uint32(hdr)), int64(8)
+		switch size {
+		case 0:
+			size = end - off
+		case 1:
+			ext := readAt(r, off+8, 8)
+			if ext == nil {
+				return
+			}
+			size, headerLen = int64(binary.BigEndian.Uint64(ext)), 16
+		}
+		if size < headerLen || size > end-off {
+			return
+		}
+		if !fn(string(hdr[4:8]), off+headerLen, size-headerLen) {
+			return
+		}
+		off += size
+	}
+}
+
+// parseMP4 从 moov/mvhd 读取时长和创建时间，从各 trak/tkhd 读取画面尺寸
+func parseMP4(r io.ReaderAt, fileSize int64, meta *FileMeta) {
+	mp4Boxes(r, 0, fileSize, func(typ string, payload, size int64) bool {
+		if typ != "moov" {
+			return true
+		}
+		if size > mp4MaxMoovSize {
+			return false
+		}
+		moov := readAt(r, payload, int(size))
+		if moov == nil {
+			return false
+		}
+		mr := bytes.NewReader(moov)
+		mp4Boxes(mr, 0, size, func(typ string, p, n int64) bool {
+			switch typ {
+			case "mvhd":
+				parseMvhd(moov[p:p+n], meta)
+			case "trak":
+				mp4Boxes(mr, p, p+n, func(typ string, p, n int64) bool {
+					if typ == "tkhd" {
+						w, h := parseTkhd(moov[p : p+n])
+						if w*h > meta.Width*meta.Height {
+							meta.Width, meta.Height = w, h
+						}
+					}
+					return true
+				})
+			}
+			return true
+		})
+		return false
+	})
+}
+
+func parseMvhd(b []byte, meta *FileMeta) {
+	var created, timescale, duration uint64
+	switch {
+	case len(b) >= 32 && b[0] == 1:
+		created = binary.BigEndian.Uint64(b[4:])
+		timescale = uint64(binary.BigEndian.Uint32(b[20:]))
+		duration = binary.BigEndian.Uint64(b[24:])
+	case len(b) >= 20:
+		created = uint64(binary.BigEndian.Uint32(b[4:]))
+		timescale = uint64(binary.BigEndian.Uint32(b[12:]))
+		duration = uint64(binary.BigEndian.Uint32(b[16:]))
+	default:
+		return
+	}
+	if timescale > 0 && duration > 0 && duration != math.MaxUint32 && duration != math.MaxUint64 {
+		meta.DurationMS = int64(duration * 1000 / timescale)
+	}
+	// 不少设备把创建时间写成 0 或乱码，只接受 1970 年之后、当前时间之前的值
+	if t := mp4Epoch.Add(time.Duration(created) * time.Second); created > 0 && t.Year() >= 1970 && t.Before(time.Now()) {
+		meta.TakenAt = &t
+	}
+}
+
+func parseTkhd(b []byte) (int, int) {
+	off := 76
+	if len(b) > 0 && b[0] == 1 {
+		off = 88
+	}
+	if len(b) < off+8 {
+		return 0, 0
+	}
+	return int(binary.BigEndian.Uint32(b[off:]) >> 16), int(binary.BigEndian.Uint32(b[off+4:]) >> 16)
+}
+
+// parseWAV 时长 = data 块大小 / fmt 块中的字节率
+func parseWAV(r io.ReaderAt, fileSize int64, meta *FileMeta) {
+	var byteRate, dataSize int64
+	for off := int64(12); off+8 <= fileSize; {
+		hdr := readAt(r, off, 8)
+		if hdr == nil {
+			break
+		}
+		n := int64(binary.LittleEndian.Uint32(hdr[4:]))
+		switch string(hdr[:4]) {
+		case "fmt ":
+			if fmtChunk := readAt(r, off+8, 12); fmtChunk != nil {
+				byteRate = int64(binary.LittleEndian.Uint32(fmtChunk[8:]))
+			}
+		case "data":
+			dataSize = min(n, fileSize-off-8)
+		}
+		if byteRate > 0 && dataSize > 0 {
+			meta.DurationMS = dataSize * 1000 / byteRate
+			return
+		}
+		off += 8 + n + n%2
+	}
+}
+
+// parseAVI 读取 avih 主头：每帧微秒数 × 总帧数
+func parseAVI(r io.ReaderAt, meta *FileMeta) {
+	head := readAt(r, 0, 4096)
+	if head == nil {
+		return
+	}
+	i := bytes.Index(head, []byte("avih"))
+	if i < 0 || i+8+40 > len(head) {
+		return
+	}
+	h := head[i+8:]
+	usPerFrame := int64(binary.LittleEndian.Uint32(h[0:]))
+	frames := int64(binary.LittleEndian.Uint32(h[16:]))
+	meta.DurationMS = usPerFrame * frames / 1000
+	meta.Width = int(binary.LittleEndian.Uint32(h[32:]))
+	meta.Height = int(binary.LittleEndian.Uint32(h[36:]))
+}
+
+// id3v2Size 返回文件开头 ID3v2 标签的长度（没有标签时为 0）
+func id3v2Size(r io.ReaderAt) int64 {
+	h := readAt(r, 0, 10)
+	if h == nil || string(h[:3]) != "ID3" {
+		return 0
+	}
+	size := int64(h[6]&0x7F)<<21 | int64(h[7]&0x7F)<<14 | int64(h[8]&0x7F)<<7 | int64(h[9]&0x7F)
+	size += 10
+	if h[5]&0x10 != 0 {
+		size += 10 // footer
+	}
+	return size
+}
+
+// parseFLAC 读取 STREAMINFO 中的采样率与总采样数
+func parseFLAC(r io.ReaderAt, meta *FileMeta) {
+	off := id3v2Size(r)
+	b := readAt(r, off, 4+4+34)
+	if b == nil || string(b[:4]) != "fLaC" || b[4]&0x7F != 0 {
+		return
+	}
+	v := binary.BigEndian.Uint64(b[8+10:])
+	rate, samples := v>>44, v&(1<<36-1)
+	if rate > 0 {
+		meta.DurationMS = int64(samples * 1000 / rate)
+	}
+}
+
+var (
+	mp3BitratesV1 = [16]int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}
+	mp3BitratesV2 = [16]int{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0}
+	mp3Rates      = map[byte][3]int{3: {44100, 48000, 32000}, 2: {22050, 24000, 16000}, 0: {11025, 12000, 8000}}
+)
+
+// parseMP3 优先使用 Xing/Info 或 VBRI 头中的帧数，没有时按首帧码率估算（CBR）
+func parseMP3(r io.ReaderAt, fileSize int64, meta *FileMeta) {
+	start := id3v2Size(r)
+	buf := readAt(r, start, int(min(64<<10, fileSize-start)))
+	for i := 0; i+4 <= len(buf); i++ {
+		if buf[i] != 0xFF || buf[i+1]&0xE0 != 0xE0 {
+			continue
+		}
+		version, layer := (buf[i+1]>>3)&3, (buf[i+1]>>1)&3
+		brIdx, srIdx := buf[i+2]>>4, (buf[i+2]>>2)&3
+		if version == 1 || layer != 1 || srIdx == 3 || brIdx == 0 || brIdx == 15 {
+			continue // 只处理 Layer III
+		}
+		rate := mp3Rates[version][srIdx]
+		mono := buf[i+3]>>6 == 3
+		// side 为帧头之后边信息的长度，Xing 头紧随其后
+		bitrate, samplesPerFrame, side := mp3BitratesV2[brIdx], int64(576), 17
+		if mono {
+			side = 9
+		}
+		if version == 3 {
+			bitrate, samplesPerFrame, side = mp3BitratesV1[brIdx], 1152, 32
+			if mono {
+				side = 17
+			}
+		}
+		frame := buf[i:]
+		if x := 4 + side; len(frame) >= x+12 && (string(frame[x:x+4]) == "Xing" || string(frame[x:x+4]) == "Info") {
+			if binary.BigEndian.Uint32(frame[x+4:])&1 != 0 {
+				frames := int64(binary.BigEndian.Uint32(frame[x+8:]))
+				meta.DurationMS = frames * samplesPerFrame * 1000 / int64(rate)
+				return
+			}
+		}
+		if len(frame) >= 36+18 && string(frame[36:40]) == "VBRI" {
+			frames := int64(binary.BigEndian.Uint32(frame[36+14:]))
+			meta.DurationMS = frames * samplesPerFrame * 1000 / int64(rate)
+			return
+		}
+		audio := fileSize - start - int64(i)
+		meta.DurationMS = audio * 8 / int64(bitrate)
+		return
+	}
+}
+
+// parseOgg 用最后一页的 granule position 除以采样率（Vorbis 取自标识头，Opus 固定 48kHz）
+func parseOgg(r io.ReaderAt, fileSize int64, meta *FileMeta) {
+	first := readAt(r, 0, int(min(512, fileSize)))
+	if first == nil || len(first) < 28 || string(first[:4]) != "OggS" || 27+int(first[26]) > len(first) {
+		return
+	}
+	data := first[27+int(first[26]):]
+	var rate, preSkip int64
+	switch {
+	case bytes.HasPrefix(data, []byte("\x01vorbis")) && len(data) >= 16:
+		rate = int64(binary.LittleEndian.Uint32(data[12:]))
+	case bytes.HasPrefix(data, []byte("OpusHead")) && len(data) >= 12:
+		rate, preSkip = 48000, int64(binary.LittleEndian.Uint16(data[10:]))
+	default:
+		return
+	}
+	tailLen := min(64<<10, fileSize)
+	tail := readAt(r, fileSize-tailLen, int(tailLen))
+	i := bytes.LastIndex(tail, []byte("OggS"))
+	if i < 0 || i+14 > len(tail) || rate == 0 {
+		return
+	}
+	granule := int64(binary.LittleEndian.Uint64(tail[i+6:]))
+	if granule > preSkip {
+		meta.DurationMS = (granule - preSkip) * 1000 / rate
+	}
+}
+
+// ---------- PDF ----------
+
+var (
+	pdfPagesRe  = regexp.MustCompile(`/Type\s*/Pages\b`)
+	pdfCountRe  = regexp.MustCompile(`/Count\s+(\d+)`)
+	pdfObjStmRe = regexp.MustCompile(`/Type\s*/ObjStm\b`)
+)
+
+// pdfPageCount 页数取页面树中最大的 /Count（即根节点）；
+// PDF 1.5 起页面树可能位于压缩的对象流中，需要解压 ObjStm 后再找
+func pdfPageCount(r io.ReaderAt) int {
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, io.NewSectionReader(r, 0, pdfMaxScanSize)); err != nil {
+		return 0
+	}
+	data := buf.Bytes()
+	if n := pdfMaxPagesCount(data); n > 0 {
+		return n
+	}
+	best := 0
+	for _, loc := range pdfObjStmRe.FindAllIndex(data, -1) {
+		dictEnd := pdfDictEnd(data, loc[1])
+		if dictEnd < 0 {
+			continue
+		}
+		stream := pdfStreamData(data, dictEnd)
+		if stream == nil {
+			continue
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(stream))
+		if err != nil {
+			continue
+		}
+		inflated, _ := io.ReadAll(io.LimitReader(zr, 16<<20))
+		zr.Close()
+		best = max(best, pdfMaxPagesCount(inflated))
+	}
+	return best
+}
+
+// pdfMaxPagesCount 在所有 /Type /Pages 字典中取最大的 /Count
+func pdfMaxPagesCount(data []byte) int {
+	best := 0
+	for _, loc := range pdfPagesRe.FindAllIndex(data, -1) {
+		start, end := pdfDictStart(data, loc[0]), pdfDictEnd(data, loc[1])
+		if start < 0 || end < 0 {
+			continue
+		}
+		// 只看本层字典，跳过嵌套字典中的 /Count
+		for _, m := range pdfCountRe.FindAllSubmatchIndex(data[start:end], -1) {
+			if pdfDictStart(data[start:end], m[0]) != 0 {
+				continue
+			}
+			if n, err := strconv.Atoi(string(data[start+m[2] : start+m[3]])); err == nil {
+				best = max(best, n)
+			}
+		}
+	}
+	return best
+}
+
+// pdfDictStart 从 pos 向前找到包含它的 "<<" 的位置
+func pdfDictStart(data []byte, pos int) int {
+	depth := 0
+	for i := pos - 1; i > 0; i-- {
+		switch {
+		case data[i] == '>' && data[i-1] == '>':
+			depth++
+			i--
+		case data[i] == '<' && data[i-1] == '<':
+			if depth == 0 {
+				return i - 1
+			}
+			depth--
+			i--
+		}
+	}
+	return -1
+}
+
+// pdfDictEnd 从 pos 向后找到包含它的字典结束 ">>" 之后的位置
+func pdfDictEnd(data []byte, pos int) int {
+	depth := 0
+	for i := pos; i+1 < len(data); i++ {
+		switch {
+		case data[i] == '<' && data[i+1] == '<':
+			depth++
+			i++
+		case data[i] == '>' && data[i+1] == '>':
+			if depth == 0 {
+				return i + 2
+			}
+			depth--
+			i++
+		}
+	}
+	return -1
+}
+
+// pdfStreamData 返回字典之后 stream ... endstream 之间的原始数据
+func pdfStreamData(data []byte, pos int) []byte {
+	rest := data[pos:]
+	i := bytes.Index(rest, []byte("stream"))
+	if i < 0 || i > 32 {
+		return nil
+	}
+	rest = rest[i+len("stream"):]
+	rest = bytes.TrimPrefix(rest, []byte("\r"))
+	rest = bytes.TrimPrefix(rest, []byte("\n"))
+	j := bytes.Index(rest, []byte("endstream"))
+	if j < 0 {
+		return nil
+	}
+	return rest[:j]
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// mp4Box 拼出一个盒子；size 为 0 时按内容长度填写
+func mp4Box(typ string, size uint32, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	if size == 0 {
+		size = uint32(8 + len(body))
+	}
+	b := binary.BigEndian.AppendUint32(nil, size)
+	return append(append(b, typ...), body...)
+}
+
+func FuzzParseMP4(f *testing.F) {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], 1000) // timescale
+	binary.BigEndian.PutUint32(mvhd[16:], 5000) // duration
+	tkhd := make([]byte, 84)
+	binary.BigEndian.PutUint32(tkhd[76:], 1920<<16)
+	binary.BigEndian.PutUint32(tkhd[80:], 1080<<16)
+	f.Add(append(mp4Box("ftyp", 0, []byte("isom")), mp4Box("moov", 0, mp4Box("mvhd", 0, mvhd), mp4Box("trak", 0, mp4Box("tkhd", 0, tkhd)))...))
+	// 扩展长度为 MaxInt64 的盒子：off+size 溢出后曾越界切片
+	huge := binary.BigEndian.AppendUint64(mp4Box("mvhd", 1), math.MaxInt64)
+	f.Add(mp4Box("moov", 48, mp4Box("free", 0), huge, make([]byte, 16)))
+	f.Add(mp4Box("moov", 0, mp4Box("trak", 0, mp4Box("tkhd", 4))))
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		parseMP4(bytes.NewReader(data), int64(len(data)), &FileMeta{})
+	})
+}
+
+// tiff 拼出一个小端 TIFF：IFD0 位于偏移 8，entries 的值已按 4 字节内联
+func tiff(entries ...[12]byte) []byte {
+	b := []byte("II*\x00\x08\x00\x00\x00")
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(entries)))
+	for _, e := range entries {
+		b = append(b, e[:]...)
+	}
+	return binary.LittleEndian.AppendUint32(b, 0)
+}
+
+func ifdEntry(tag, typ uint16, count, value uint32) [12]byte {
+	var e [12]byte
+	binary.LittleEndian.PutUint16(e[0:], tag)
+	binary.LittleEndian.PutUint16(e[2:], typ)
+	binary.LittleEndian.PutUint32(e[4:], count)
+	binary.LittleEndian.PutUint32(e[8:], value)
+	return e
+}
+
+func FuzzParseExif(f *testing.F) {
+	f.Add(tiff(ifdEntry(exifTagMake, 2, 4, binary.LittleEndian.Uint32([]byte("ABC\x00")))))
+	// Exif 子 IFD 指回 IFD0 自身，GPS 子 IFD 指向文件之外
+	f.Add(tiff(ifdEntry(exifTagExifIFD, 4, 1, 8), ifdEntry(exifTagGPSIFD, 4, 1, 0xFFFFFFFF)))
+	// 数据偏移加长度越过文件末尾
+	f.Add(tiff(ifdEntry(exifTagModel, 2, 0xFFFF, 0xFFFFFFF0)))
+	f.Add([]byte("MM\x00*\xff\xff\xff\xff"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		parseExif(data, &FileMeta{})
+	})
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// 文件元数据：上传后在后台提取 MIME 类型、图片尺寸与 EXIF、音视频时长、PDF 页数，
+// 按节点 ID 存储（移动、重命名后依然有效），并记录提取时的内容哈希，内容变化后重新提取
+
+const metaQueueSize = 1024
+
+func (s *Server) ensureMetadataTables() error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS drive_metadata (
+			node_id INTEGER PRIMARY KEY REFERENCES drivelist(id) ON DELETE CASCADE,
+			file_hash TEXT NOT NULL DEFAULT '',
+			mime TEXT NOT NULL DEFAULT '',
+			width INTEGER,
+			height INTEGER,
+			duration_ms BIGINT,
+			pages INTEGER,
+			camera TEXT NOT NULL DEFAULT '',
+			taken_at TIMESTAMPTZ,
+			gps_lat DOUBLE PRECISION,
+			gps_lon DOUBLE PRECISION,
+			extracted_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_metadata_mime ON drive_metadata(mime)`,
+		`CREATE INDEX IF NOT EXISTS idx_metadata_taken ON drive_metadata(taken_at)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := s.DB.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nullPositive 把 0 存为 NULL，便于筛选时区分“未知”与具体数值
+func nullPositive(v int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: v, Valid: v > 0}
+}
+
+// metaColumns 查询元数据时使用的列，顺序与 metaScan.dest 一致
+const metaColumns = `m.mime, m.width, m.height, m.duration_ms, m.pages, m.camera, m.taken_at, m.gps_lat, m.gps_lon`
+
+// metaScan 扫描 metaColumns 的中间变量，LEFT JOIN 时整行可能为 NULL
+type metaScan struct {
+	mime, camera         sql.NullString
+	width, height, pages sql.NullInt64
+	duration             sql.NullInt64
+	takenAt              sql.NullTime
+	lat, lon             sql.NullFloat64
+}
+
+func (m *metaScan) dest() []any {
+	return []any{&m.mime, &m.width, &m.height, &m.duration, &m.pages, &m.camera, &m.takenAt, &m.lat, &m.lon}
+}
+
+// meta 没有元数据记录时返回 nil
+func (m *metaScan) meta() *FileMeta {
+	if !m.mime.Valid {
+		return nil
+	}
+	meta := &FileMeta{
+		MIME:       m.mime.String,
+		Width:      int(m.width.Int64),
+		Height:     int(m.height.Int64),
+		DurationMS: m.duration.Int64,
+		Pages:      int(m.pages.Int64),
+		Camera:     m.camera.String,
+	}
+	if m.takenAt.Valid {
+		meta.TakenAt = &m.takenAt.Time
+	}
+	if m.lat.Valid && m.lon.Valid {
+		meta.GPS = &GeoPoint{Lat: m.lat.Float64, Lon: m.lon.Float64}
+	}
+	return meta
+}
+
+// loadMetadata 读取节点的元数据及提取时的内容哈希，没有记录时返回 sql.ErrNoRows
+func (s *Server) loadMetadata(nodeID int64) (*FileMeta, string, error) {
+	var hash string
+	var m metaScan
+	err := s.DB.QueryRow("SELECT m.file_hash, "+metaColumns+" FROM drive_metadata m WHERE m.node_id=$1", nodeID).
+		Scan(append([]any{&hash}, m.dest()...)...)
+	if err != nil {
+		return nil, "", err
+	}
+	return m.meta(), hash, nil
+}
+
+// refreshMetadata 返回节点的元数据；没有记录或内容已变化时重新提取并保存
+func (s *Server) refreshMetadata(d *drive, nodeID int64, rel string) (*FileMeta, error) {
+	hash, err := s.contentHash(d, nodeID, rel)
+	if err != nil {
+		return nil, err
+	}
+	if meta, stored, err := s.loadMetadata(nodeID); err == nil && stored == hash {
+		return meta, nil
+	}
+	meta, err := extractFileMeta(d.abs(rel))
+	if err != nil {
+		return nil, err
+	}
+	var taken sql.NullTime
+	if meta.TakenAt != nil {
+		taken = sql.NullTime{Time: *meta.TakenAt, Valid: true}
+	}
+	var lat, lon sql.NullFloat64
+	if meta.GPS != nil {
+		lat = sql.NullFloat64{Float64: meta.GPS.Lat, Valid: true}
+		lon = sql.NullFloat64{Float64: meta.GPS.Lon, Valid: true}
+	}
+	_, err = s.DB.Exec(`
+		INSERT INTO drive_metadata (node_id, file_hash, mime, width, height, duration_ms, pages, camera, taken_at, gps_lat, gps_lon, extracted_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, now())
+		ON CONFLICT (node_id) DO UPDATE SET file_hash=EXCLUDED.file_hash, mime=EXCLUDED.mime, width=EXCLUDED.width,
+			height=EXCLUDED.height, duration_ms=EXCLUDED.duration_ms, pages=EXCLUDED.pages, camera=EXCLUDED.camera,
+			taken_at=EXCLUDED.taken_at, gps_lat=EXCLUDED.gps_lat, gps_lon=EXCLUDED.gps_lon, extracted_at=now()
+	`, nodeID, hash, meta.MIME, nullPositive(int64(meta.Width)), nullPositive(int64(meta.Height)),
+		nullPositive(meta.DurationMS), nullPositive(int64(meta.Pages)), meta.Camera, taken, lat, lon)
+	if err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// indexFile 提取元数据并更新全文索引
+// 解析器处理的是用户上传的任意内容，个别文件触发 panic 时只记录日志，不能让后台协程带着整个进程退出
+func (s *Server) indexFile(d *drive, nodeID int64, rel string) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("metadata %s: panic: %v", rel, r)
+		}
+	}()
+	meta, err := s.refreshMetadata(d, nodeID, rel)
+	if err != nil {
+		log.Printf("metadata %s: %v", rel, err)
+		return
+	}
+	if err := s.refreshContentIndex(d, nodeID, rel, meta.MIME); err != nil {
+		log.Printf("content index %s: %v", rel, err)
+	}
+}
+
+// enqueueFileJobs 文件内容写入后提交缩略图与元数据的后台任务
+func (s *Server) enqueueFileJobs(d *drive, rel string) {
+	s.enqueueThumbnail(d, rel)
+	s.enqueueMetadata(d, rel)
+}
+
+// enqueueMetadata 文件写入后提交后台提取任务；队列满时丢弃，由定期补扫处理
+func (s *Server) enqueueMetadata(d *drive, rel string) {
+	if s.metaQueue == nil {
+		return
+	}
+	select {
+	case s.metaQueue <- fileJob{d: d, rel: rel}:
+	default:
+	}
+}
+
+// startMetadataWorker 启动后台提取协程（元数据与全文索引），并定期补扫缺少记录或内容已变化的文件
+// （复制、从回收站恢复、旧数据以及队列满时丢弃的任务都由补扫覆盖）
+func (s *Server) startMetadataWorker(interval time.Duration) {
+	s.metaQueue = make(chan fileJob, metaQueueSize)
+	go func() {
+		for job := range s.metaQueue {
+			nodeID, err := job.d.lookupNode(s.DB, job.rel)
+			if err != nil {
+				continue
+			}
+			s.indexFile(job.d, nodeID, job.rel)
+		}
+	}()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			s.backfillMetadata()
+			<-ticker.C
+		}
+	}()
+}
+
+// backfillMetadata 按 ID 顺序分批处理缺少元数据或全文索引的文件节点（容量为 0 的是目录）
+func (s *Server) backfillMetadata() {
+	var lastID int64
+	for {
+		rows, err := s.DB.Query(`
+			SELECT d.id, d.owner_id, d.name
+			FROM drivelist d
+			LEFT JOIN drive_metadata m ON m.node_id = d.id
+			LEFT JOIN drive_content ci ON ci.node_id = d.id
+			WHERE d.id > $1 AND d.capacity > 0 AND d.owner_id IS NOT NULL
+				AND (m.node_id IS NULL OR m.file_hash <> COALESCE(d.file_hash, m.file_hash)
+					OR ci.node_id IS NULL OR ci.file_hash <> COALESCE(d.file_hash, ci.file_hash))
+			ORDER BY d.id
+			LIMIT 200
+		`, lastID)
+		if err != nil {
+			log.Printf("warning: query nodes without metadata failed: %v", err)
+			return
+		}
+		type pending struct {
+			id, owner int64
+			name      string
+		}
+		var batch []pending
+		for rows.Next() {
+			var p pending
+			if err := rows.Scan(&p.id, &p.owner, &p.name); err == nil {
+				batch = append(batch, p)
+			}
+		}
+		rows.Close()
+		if len(batch) == 0 {
+			return
+		}
+		for _, p := range batch {
+			s.indexFile(s.driveOf(p.owner), p.id, p.name)
+			lastID = p.id
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// dbQuerier 由 *sql.DB 与 *sql.Tx 共同实现，便于在事务内外复用元数据操作
+type dbQuerier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// namespaceLockSpace 命名空间写锁的 advisory lock 键空间（第二个键为命名空间所有者 ID）
+const namespaceLockSpace = 0x71756f74
+
+// lockNamespace 在事务内对命名空间加锁，持有到事务结束。配额检查与变更事件共用这把锁：
+// 同一命名空间的并发写入依次检查配额，变更事件 ID 也按提交顺序分配
+func (d *drive) lockNamespace(q dbQuerier) error {
+	if _, err := q.Exec("SELECT pg_advisory_xact_lock($1::int, $2::int)", namespaceLockSpace, d.OwnerID); err != nil {
+		return fmt.Errorf("lock namespace failed: %v", err)
+	}
+	return nil
+}
+
+// apiError 携带 HTTP 状态码的错误，供多个处理器共享的核心逻辑使用
+type apiError struct {
+	status int
+	msg    string
+}
+
+func (e *apiError) Error() string { return e.msg }
+
+func newAPIError(status int, format string, args ...any) *apiError {
+	return &apiError{status: status, msg: fmt.Sprintf(format, args...)}
+}
+
+// respondError 把错误写回客户端；非 apiError 一律视为 500
+func respondError(c *gin.Context, err error) {
+	var ae *apiError
+	if errors.As(err, &ae) {
+		c.JSON(ae.status, gin.H{"error": ae.msg})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// cleanRelPath 校验并清理客户端提交的相对路径，根目录返回空串
+func cleanRelPath(p string) (string, error) {
+	if strings.Contains(p, "..") || strings.HasPrefix(p, "/") || strings.HasPrefix(p, "\\") {
+		return "", newAPIError(http.StatusBadRequest, "Invalid path")
+	}
+	p = filepath.ToSlash(filepath.Clean(p))
+	if p == "." {
+		p = ""
+	}
+	return p, nil
+}
+
+// cleanFileName 校验客户端提交的文件名：只能是单个路径段
+func cleanFileName(name string) (string, error) {
+	name, err := cleanRelPath(name)
+	if err != nil {
+		return "", err
+	}
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return "", newAPIError(http.StatusBadRequest, "Invalid file name")
+	}
+	return name, nil
+}
+
+// joinRel 拼接两个相对路径（使用正斜杠）
+func joinRel(dir, name string) string {
+	if dir == "" || dir == "." {
+		return name
+	}
+	return dir + "/" + name
+}
+
+// parentRel 返回相对路径的父目录，根目录返回空串
+func parentRel(p string) string {
+	dir := filepath.ToSlash(filepath.Dir(p))
+	if dir == "." || dir == "/" {
+		return ""
+	}
+	return dir
+}
+
+// lookupNode 按路径查询节点 ID，不存在时返回 sql.ErrNoRows
+func (d *drive) lookupNode(q dbQuerier, name string) (int64, error) {
+	var id int64
+	err := q.QueryRow("SELECT id FROM drivelist WHERE owner_id=$1 AND name=$2", d.OwnerID, name).Scan(&id)
+	return id, err
+}
+
+// insertNode 插入节点及其闭包关系；若父目录已在库中，则挂到父目录下
+func (d *drive) insertNode(q dbQuerier, name string, capacity int64) (int64, error) {
+	var newID int64
+	if err := q.QueryRow("INSERT INTO drivelist (name, capacity, owner_id) VALUES ($1, $2, $3) RETURNING id",
+		name, capacity, d.OwnerID).Scan(&newID); err != nil {
+		return 0, fmt.Errorf("insert drivelist failed: %v", err)
+	}
+
+	// 插入闭包表记录：自己到自己 (depth=0)
+	if _, err := q.Exec("INSERT INTO drivelist_closure (ancestor, descendant, depth) VALUES ($1, $1, 0)", newID); err != nil {
+		return 0, fmt.Errorf("insert closure self failed: %v", err)
+	}
+
+	parent := parentRel(name)
+	if parent == "" {
+		return newID, nil
+	}
+	parentID, err := d.lookupNode(q, parent)
+	if err == sql.ErrNoRows {
+		return newID, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("query parent failed: %v", err)
+	}
+
+	// 复制父节点的所有祖先关系
+	if _, err := q.Exec(`
+		INSERT INTO drivelist_closure (ancestor, descendant, depth)
+		SELECT ancestor, $1, depth + 1
+		FROM drivelist_closure
+		WHERE descendant = $2
+	`, newID, parentID); err != nil {
+		return 0, fmt.Errorf("link parent closure failed: %v", err)
+	}
+	return newID, nil
+}
+
+// insertNodes 批量插入节点（一条语句）及其闭包关系（一条语句），返回路径到 ID 的映射；
+// 与 insertNode 一样，父目录不在库中也不在本批次内时不再向上挂接
+func (d *drive) insertNodes(q dbQuerier, names []string, capacities []int64) (map[string]int64, error) {
+	ids := make(map[string]int64, len(names))
+	if len(names) == 0 {
+		return ids, nil
+	}
+	rows, err := q.Query(`
+		INSERT INTO drivelist (name, capacity, owner_id)
+		SELECT n, c, $3 FROM unnest($1::text[], $2::bigint[]) AS t(n, c)
+		RETURNING id, name
+	`, pq.Array(names), pq.Array(capacities), d.OwnerID)
+	if err != nil {
+		return nil, fmt.Errorf("insert drivelist failed: %v", err)
+	}
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids[name] = id
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// 批次之外的祖先目录一次查出
+	var outside []string
+	seen := map[string]bool{}
+	for _, n := range names {
+		for p := parentRel(n); p != ""; p = parentRel(p) {
+			if _, ok := ids[p]; !ok && !seen[p] {
+				seen[p] = true
+				outside = append(outside, p)
+			}
+		}
+	}
+	known := map[string]int64{}
+	if len(outside) > 0 {
+		rows, err := q.Query("SELECT id, name FROM drivelist WHERE owner_id=$1 AND name = ANY($2)", d.OwnerID, pq.Array(outside))
+		if err != nil {
+			return nil, fmt.Errorf("query parents failed: %v", err)
+		}
+		for rows.Next() {
+			var id int64
+			var name string
+			if err := rows.Scan(&id, &name); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			known[name] = id
+		}
+		rows.Close()
+	}
+
+	var ancestors, descendants, depths []int64
+	for _, n := range names {
+		id := ids[n]
+		ancestors, descendants, depths = append(ancestors, id), append(descendants, id), append(depths, 0)
+		depth := int64(1)
+		for p := parentRel(n); p != ""; p = parentRel(p) {
+			pid, ok := ids[p]
+			if !ok {
+				if pid, ok = known[p]; !ok {
+					break
+				}
+			}
+			ancestors, descendants, depths = append(ancestors, pid), append(descendants, id), append(depths, depth)
+			depth++
+		}
+	}
+	if _, err := q.Exec(`
+		INSERT INTO drivelist_closure (ancestor, descendant, depth)
+		SELECT * FROM unnest($1::int[], $2::int[], $3::int[])
+	`, pq.Array(ancestors), pq.Array(descendants), pq.Array(depths)); err != nil {
+		return nil, fmt.Errorf("insert closure failed: %v", err)
+	}
+	return ids, nil
+}
+
+// ensureDirNode 确保目录及其所有祖先目录在数据库中存在，返回目录 ID
+func (d *drive) ensureDirNode(q dbQuerier, dir string) (int64, error) {
+	if dir == "" {
+		return 0, nil
+	}
+	id, err := d.lookupNode(q, dir)
+	if err == nil {
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+	if _, err := d.ensureDirNode(q, parentRel(dir)); err != nil {
+		return 0, err
+	}
+	// 容量为0表示目录
+	return d.insertNode(q, dir, 0)
+}
+
+// deleteSubtree 删除节点及其所有后代（CASCADE 会同步清理闭包表）
+func deleteSubtree(q dbQuerier, id int64) error {
+	_, err := q.Exec(`
+		DELETE FROM drivelist
+		WHERE id IN (
+			SELECT descendant FROM drivelist_closure WHERE ancestor = $1
+		)
+	`, id)
+	return err
+}
@@ -0,0 +1,248 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 预签名 URL：类似 S3 presigned URL，把一次操作（路由、方法、路径、大小上限、过期时间）
+// 用 HMAC-SHA256 签名后放在查询参数中，校验时只重新计算签名，不查询数据库
+
+const (
+	presignUserParam    = "X-Drive-User"
+	presignActorParam   = "X-Drive-Actor"
+	presignExpiresParam = "X-Drive-Expires"
+	presignMaxSizeParam = "X-Drive-MaxSize"
+	presignSigParam     = "X-Drive-Signature"
+
+	ctxPresignKey = "drive_presign" // gin.Context 中保存预签名范围的键
+
+	presignDefaultTTL = 15 * time.Minute
+	presignMaxTTL     = 7 * 24 * time.Hour
+)
+
+// presignRoute 可签名的路由及其携带目标路径的参数
+type presignRoute struct {
+	Method string
+	Route  string
+	Perm   int
+}
+
+var presignRoutes = map[string]presignRoute{
+	"download":     {http.MethodGet, "/download", PermRead},
+	"downloaddir":  {http.MethodGet, "/downloaddir", PermRead},
+	"upload/chunk": {http.MethodPost, "/upload/chunk", PermWrite},
+}
+
+// presignScope 已校验的预签名范围
+type presignScope struct {
+	Route   string
+	Path    string
+	Owner   int64
+	MaxSize int64 // 0 表示不限制
+}
+
+// loadPresignSecret 读取 PRESIGN_SECRET；未配置时从会话密钥派生
+func loadPresignSecret(jwtSecret []byte) []byte {
+	if secret := os.Getenv("PRESIGN_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	mac := hmac.New(sha256.New, jwtSecret)
+	mac.Write([]byte("presign"))
+	return mac.Sum(nil)
+}
+
+// presignSignature 计算规范化请求串的签名
+func (s *Server) presignSignature(method, route string, owner, userID int64, actor, rel string, maxSize, expires int64) string {
+	canonical := strings.Join([]string{
+		method,
+		route,
+		strconv.FormatInt(owner, 10),
+		strconv.FormatInt(userID, 10),
+		actor,
+		rel,
+		strconv.FormatInt(maxSize, 10),
+		strconv.FormatInt(expires, 10),
+	}, "\n")
+	mac := hmac.New(sha256.New, s.presignSecret)
+	mac.Write([]byte(canonical))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// presignTargetPath 从请求中取出签名覆盖的目标路径
+func presignTargetPath(c *gin.Context, route string) (string, error) {
+	switch route {
+	case "/download":
+		return cleanRelPath(c.Query("name"))
+	case "/downloaddir":
+		return cleanRelPath(c.Query("dirname"))
+	case "/upload/chunk":
+		dir, err := cleanRelPath(c.PostForm("path"))
+		if err != nil {
+			return "", err
+		}
+		return joinRel(dir, c.PostForm("fileName")), nil
+	}
+	return "", errors.New("route does not accept presigned URLs")
+}
+
+// authenticatePresigned 校验预签名 URL，成功时返回签发者并把范围写入上下文
+func (s *Server) authenticatePresigned(c *gin.Context) (*User, error) {
+	q := c.Request.URL.Query()
+	expires, err := strconv.ParseInt(q.Get(presignExpiresParam), 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid presigned expiry")
+	}
+	if time.Now().Unix() > expires {
+		return nil, errors.New("presigned url expired")
+	}
+	userID, err := strconv.ParseInt(q.Get(presignUserParam), 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid presigned user")
+	}
+	owner := userID
+	if raw := q.Get("owner"); raw != "" {
+		if owner, err = strconv.ParseInt(raw, 10, 64); err != nil {
+			return nil, errors.New("invalid presigned owner")
+		}
+	}
+	var maxSize int64
+	if raw := q.Get(presignMaxSizeParam); raw != "" {
+		if maxSize, err = strconv.ParseInt(raw, 10, 64); err != nil {
+			return nil, errors.New("invalid presigned size cap")
+		}
+	}
+
+	route := c.FullPath()
+	rel, err := presignTargetPath(c, route)
+	if err != nil {
+		return nil, err
+	}
+	actor := q.Get(presignActorParam)
+	expected := s.presignSignature(c.Request.Method, route, owner, userID, actor, rel, maxSize, expires)
+	if !hmac.Equal([]byte(expected), []byte(q.Get(presignSigParam))) {
+		return nil, errors.New("presigned signature mismatch")
+	}
+
+	c.Set(ctxPresignKey, &presignScope{Route: route, Path: rel, Owner: owner, MaxSize: maxSize})
+	return &User{ID: userID, Username: actor}, nil
+}
+
+// presignedScope 返回当前请求的预签名范围，普通认证请求返回 nil
+func presignedScope(c *gin.Context) *presignScope {
+	if v, ok := c.Get(ctxPresignKey); ok {
+		if scope, ok := v.(*presignScope); ok {
+			return scope
+		}
+	}
+	return nil
+}
+
+// checkSize 检查写入大小是否超过签名中的上限；非预签名请求或未设上限时总是通过
+func (p *presignScope) checkSize(size int64) error {
+	if p == nil || p.MaxSize == 0 || size <= p.MaxSize {
+		return nil
+	}
+	return newAPIError(http.StatusRequestEntityTooLarge, "Upload of %d bytes exceeds the presigned limit of %d bytes", size, p.MaxSize)
+}
+
+// handlePresign 签发预签名 URL：POST /presign
+// 请求体 {"action":"download|downloaddir|upload/chunk","path":..,"max_size":..,"expires_in":秒}
+func (s *Server) handlePresign(c *gin.Context) {
+	if presignedScope(c) != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Presigned URLs cannot mint new URLs"})
+		return
+	}
+	var req struct {
+		Action    string `json:"action"`
+		Path      string `json:"path"`
+		MaxSize   int64  `json:"max_size"`
+		ExpiresIn int64  `json:"expires_in"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	pr, ok := presignRoutes[req.Action]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid action (expect download|downloaddir|upload/chunk)"})
+		return
+	}
+	rel, err := cleanRelPath(req.Path)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if rel == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing 'path'"})
+		return
+	}
+	if req.MaxSize < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_size must not be negative"})
+		return
+	}
+	ttl := presignDefaultTTL
+	if req.ExpiresIn > 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+	}
+	if ttl > presignMaxTTL {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in exceeds the maximum of 7 days"})
+		return
+	}
+
+	// 签发时检查权限；签名 URL 在有效期内按签发者身份访问
+	d := s.driveFor(c)
+	if err := s.authorize(c, d, rel, pr.Perm); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	u := currentUser(c)
+	expires := time.Now().Add(ttl).Unix()
+	params := url.Values{}
+	switch pr.Route {
+	case "/download":
+		params.Set("name", rel)
+	case "/downloaddir":
+		params.Set("dirname", rel)
+	}
+	if d.OwnerID != u.ID {
+		params.Set("owner", strconv.FormatInt(d.OwnerID, 10))
+	}
+	params.Set(presignUserParam, strconv.FormatInt(u.ID, 10))
+	params.Set(presignActorParam, u.Username)
+	params.Set(presignExpiresParam, strconv.FormatInt(expires, 10))
+	if req.MaxSize > 0 {
+		params.Set(presignMaxSizeParam, strconv.FormatInt(req.MaxSize, 10))
+	}
+	params.Set(presignSigParam, s.presignSignature(pr.Method, pr.Route, d.OwnerID, u.ID, u.Username, rel, req.MaxSize, expires))
+
+	resp := gin.H{
+		"method":     pr.Method,
+		"url":        pr.Route + "?" + params.Encode(),
+		"expires_at": time.Unix(expires, 0),
+	}
+	if pr.Route == "/upload/chunk" {
+		// 上传的目标路径通过表单字段提交，必须与签名一致
+		resp["form"] = gin.H{"path": parentRel(rel), "fileName": pathBase(rel)}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// pathBase 返回正斜杠路径的最后一段
+func pathBase(rel string) string {
+	if i := strings.LastIndex(rel, "/"); i >= 0 {
+		return rel[i+1:]
+	}
+	return rel
+}
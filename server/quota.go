@@ -0,0 +1,308 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 配额：按用户（path 为空）或按目录限制字节数与文件数，NULL 表示不限制。
+// 用户级配额未单独配置时使用 USER_QUOTA_MB / USER_QUOTA_FILES 的默认值
+
+// quotaLimit 一条配额规则，0 表示不限制
+type quotaLimit struct {
+	MaxBytes int64 `json:"max_bytes"`
+	MaxFiles int64 `json:"max_files"`
+}
+
+// QuotaUsage 某个配额范围的用量
+type QuotaUsage struct {
+	Path      string `json:"path"`
+	UsedBytes int64  `json:"used_bytes"`
+	UsedFiles int64  `json:"used_files"`
+	quotaLimit
+}
+
+// quotaDelta 一次写入带来的用量变化；From 非空表示内容来自同一命名空间（移动），
+// 同时包含源路径与目标路径的配额范围不受影响
+type quotaDelta struct {
+	Bytes int64
+	Files int64
+	From  string
+}
+
+func (s *Server) ensureQuotaTables() error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS drive_quotas (
+			owner_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			path TEXT NOT NULL DEFAULT '',
+			max_bytes BIGINT,
+			max_files BIGINT,
+			PRIMARY KEY (owner_id, path)
+		)`,
+		// set_by_admin 为 true 的规则由管理员设置，用户本人不能修改或删除
+		`ALTER TABLE drive_quotas ADD COLUMN IF NOT EXISTS set_by_admin BOOLEAN NOT NULL DEFAULT false`,
+	}
+	for _, stmt := range stmts {
+		if _, err := s.DB.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subtreeUsage 统计节点及其后代的字节数与文件数（容量为 0 的节点视为目录）
+func subtreeUsage(q dbQuerier, nodeID int64) (int64, int64, error) {
+	var bytes, files int64
+	err := q.QueryRow(`
+		SELECT COALESCE(SUM(d.capacity), 0), COUNT(*) FILTER (WHERE d.capacity > 0)
+		FROM drivelist d
+		JOIN drivelist_closure c ON d.id = c.descendant
+		WHERE c.ancestor = $1
+	`, nodeID).Scan(&bytes, &files)
+	return bytes, files, err
+}
+
+// usage 统计命名空间内 path 下的用量，path 为空表示整个命名空间
+func (d *drive) usage(q dbQuerier, path string) (int64, int64, error) {
+	if path == "" {
+		var bytes, files int64
+		err := q.QueryRow(`
+			SELECT COALESCE(SUM(capacity), 0), COUNT(*) FILTER (WHERE capacity > 0)
+			FROM drivelist WHERE owner_id = $1
+		`, d.OwnerID).Scan(&bytes, &files)
+		return bytes, files, err
+	}
+	id, err := d.lookupNode(q, path)
+	if err == sql.ErrNoRows {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	return subtreeUsage(q, id)
+}
+
+// quotaScopes 返回命名空间内的所有配额规则（按路径排序），用户级规则总是第一条
+func (s *Server) quotaScopes(q dbQuerier, d *drive) ([]QuotaUsage, error) {
+	rows, err := q.Query(`
+		SELECT path, COALESCE(max_bytes, 0), COALESCE(max_files, 0)
+		FROM drive_quotas WHERE owner_id = $1 ORDER BY path
+	`, d.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scopes := []QuotaUsage{{quotaLimit: s.defaultQuota}}
+	for rows.Next() {
+		var u QuotaUsage
+		if err := rows.Scan(&u.Path, &u.MaxBytes, &u.MaxFiles); err != nil {
+			return nil, err
+		}
+		if u.Path == "" {
+			scopes[0] = u
+			continue
+		}
+		scopes = append(scopes, u)
+	}
+	return scopes, rows.Err()
+}
+
+// inScope 判断相对路径是否位于配额范围内
+func inScope(scope, rel string) bool {
+	return scope == "" || rel == scope || strings.HasPrefix(rel, scope+"/")
+}
+
+// checkQuota 检查在 target 处写入 delta 后是否超出配额：
+// 单次写入本身就超过上限返回 413，累计超出返回 507。
+// 在事务中调用时先对命名空间加锁，同一命名空间的并发写入依次检查，不会一起越过上限
+func (s *Server) checkQuota(q dbQuerier, d *drive, target string, delta quotaDelta) error {
+	if delta.Bytes <= 0 && delta.Files <= 0 {
+		return nil
+	}
+	scopes, err := s.quotaScopes(q, d)
+	if err != nil {
+		return fmt.Errorf("query quotas failed: %v", err)
+	}
+	locked := false
+	for _, scope := range scopes {
+		if scope.MaxBytes == 0 && scope.MaxFiles == 0 {
+			continue
+		}
+		if !inScope(scope.Path, target) || (delta.From != "" && inScope(scope.Path, delta.From)) {
+			continue
+		}
+		if !locked {
+			if err := d.lockNamespace(q); err != nil {
+				return err
+			}
+			locked = true
+		}
+		label := scope.Path
+		if label == "" {
+			label = "/"
+		}
+		if scope.MaxBytes > 0 && delta.Bytes > scope.MaxBytes {
+			return newAPIError(http.StatusRequestEntityTooLarge, "Upload of %d bytes exceeds the quota of %s (%d bytes)", delta.Bytes, label, scope.MaxBytes)
+		}
+		usedBytes, usedFiles, err := d.usage(q, scope.Path)
+		if err != nil {
+			return fmt.Errorf("query usage failed: %v", err)
+		}
+		if scope.MaxBytes > 0 && delta.Bytes > 0 && usedBytes+delta.Bytes > scope.MaxBytes {
+			return newAPIError(http.StatusInsufficientStorage, "Quota exceeded for %s: %d of %d bytes used", label, usedBytes, scope.MaxBytes)
+		}
+		if scope.MaxFiles > 0 && delta.Files > 0 && usedFiles+delta.Files > scope.MaxFiles {
+			return newAPIError(http.StatusInsufficientStorage, "File count quota exceeded for %s: %d of %d files used", label, usedFiles, scope.MaxFiles)
+		}
+	}
+	return nil
+}
+
+// checkWriteQuota 在冲突处理之后检查配额；覆盖已有节点时扣除被替换的用量
+func (s *Server) checkWriteQuota(q dbQuerier, d *drive, out conflictOutcome, delta quotaDelta) error {
+	if out.ExistingID != 0 {
+		bytes, files, err := subtreeUsage(q, out.ExistingID)
+		if err != nil {
+			return fmt.Errorf("query replaced usage failed: %v", err)
+		}
+		delta.Bytes -= bytes
+		delta.Files -= files
+	}
+	return s.checkQuota(q, d, out.Path, delta)
+}
+
+// precheckUploadQuota 根据客户端声明的 totalSize 提前检查配额，避免上传完才失败
+func (s *Server) precheckUploadQuota(d *drive, target string, totalSize int64, policy ConflictPolicy) error {
+	out := conflictOutcome{Path: target}
+	if policy == ConflictOverwrite || policy == ConflictKeepNewer {
+		if id, err := d.lookupNode(s.DB, target); err == nil {
+			out.ExistingID = id
+		}
+	}
+	return s.checkWriteQuota(s.DB, d, out, quotaDelta{Bytes: totalSize, Files: 1})
+}
+
+// handleQuotaUsage 返回当前用户的用量及各配额范围的限制
+func (s *Server) handleQuotaUsage(c *gin.Context) {
+	d := s.ownDrive(c)
+	scopes, err := s.quotaScopes(s.DB, d)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range scopes {
+		if scopes[i].UsedBytes, scopes[i].UsedFiles, err = d.usage(s.DB, scopes[i].Path); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"user": scopes[0], "folders": scopes[1:]})
+}
+
+// quotaOwner 解析配额接口的目标用户：管理员可通过 user_id 指定其他用户，
+// 普通用户只能为自己的目录设置配额，不能修改用户级配额与管理员设置的目录配额
+func quotaOwner(c *gin.Context, path string) (int64, error) {
+	u := currentUser(c)
+	if raw := c.Query("user_id"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return 0, newAPIError(http.StatusBadRequest, "Invalid 'user_id' query parameter")
+		}
+		if id != u.ID && !u.IsAdmin {
+			return 0, newAPIError(http.StatusForbidden, "Admin privilege required")
+		}
+		return id, nil
+	}
+	if path == "" && !u.IsAdmin {
+		return 0, newAPIError(http.StatusForbidden, "Only admins can change user quotas")
+	}
+	return u.ID, nil
+}
+
+// handleSetQuota 设置配额：PUT /quota?path=&user_id=，请求体 {"max_bytes":..,"max_files":..}
+func (s *Server) handleSetQuota(c *gin.Context) {
+	path, err := cleanRelPath(c.Query("path"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	owner, err := quotaOwner(c, path)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	var req quotaLimit
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if req.MaxBytes < 0 || req.MaxFiles < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Quota values must not be negative"})
+		return
+	}
+
+	// 普通用户覆盖不了管理员设置的规则（ON CONFLICT 的 WHERE 不成立时不更新任何行）
+	isAdmin := currentUser(c).IsAdmin
+	err = s.withAudit(actorOf(c), owner, "quota_set", path, gin.H{"max_bytes": req.MaxBytes, "max_files": req.MaxFiles}, func(tx *sql.Tx) error {
+		res, err := tx.Exec(`
+			INSERT INTO drive_quotas (owner_id, path, max_bytes, max_files, set_by_admin)
+			VALUES ($1, $2, NULLIF($3, 0), NULLIF($4, 0), $5)
+			ON CONFLICT (owner_id, path) DO UPDATE
+			SET max_bytes = EXCLUDED.max_bytes, max_files = EXCLUDED.max_files, set_by_admin = EXCLUDED.set_by_admin
+			WHERE EXCLUDED.set_by_admin OR NOT drive_quotas.set_by_admin
+		`, owner, path, req.MaxBytes, req.MaxFiles, isAdmin)
+		if err != nil {
+			return fmt.Errorf("set quota failed: %v", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return newAPIError(http.StatusForbidden, "Quota was set by an admin and cannot be changed")
+		}
+		return nil
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Quota updated", "user_id": owner, "path": path, "quota": req})
+}
+
+// handleDeleteQuota 删除配额规则；删除用户级规则后恢复为默认配额
+func (s *Server) handleDeleteQuota(c *gin.Context) {
+	path, err := cleanRelPath(c.Query("path"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	owner, err := quotaOwner(c, path)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	isAdmin := currentUser(c).IsAdmin
+	err = s.withAudit(actorOf(c), owner, "quota_delete", path, nil, func(tx *sql.Tx) error {
+		var byAdmin bool
+		err := tx.QueryRow("SELECT set_by_admin FROM drive_quotas WHERE owner_id=$1 AND path=$2 FOR UPDATE", owner, path).Scan(&byAdmin)
+		if err == sql.ErrNoRows {
+			return newAPIError(http.StatusNotFound, "Quota not found")
+		}
+		if err != nil {
+			return err
+		}
+		if byAdmin && !isAdmin {
+			return newAPIError(http.StatusForbidden, "Quota was set by an admin and cannot be removed")
+		}
+		_, err = tx.Exec("DELETE FROM drive_quotas WHERE owner_id=$1 AND path=$2", owner, path)
+		return err
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Quota removed", "user_id": owner, "path": path})
+}
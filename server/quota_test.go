@@ -0,0 +1,114 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestInScope(t *testing.T) {
+	tests := []struct {
+		scope, rel string
+		want       bool
+	}{
+		{"", "", true},
+		{"", "a/b.txt", true},
+		{"docs", "docs", true},
+		{"docs", "docs/a.txt", true},
+		{"docs", "docs/sub/a.txt", true},
+		{"docs", "docs2/a.txt", false},
+		{"docs", "doc", false},
+		{"docs", "other/docs/a.txt", false},
+		{"docs", "", false},
+		{"a/b", "a/b/c", true},
+		{"a/b", "a/bc", false},
+	}
+	for _, tt := range tests {
+		if got := inScope(tt.scope, tt.rel); got != tt.want {
+			t.Errorf("inScope(%q, %q) = %v, want %v", tt.scope, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestCheckQuota(t *testing.T) {
+	// docs 下 80 字节 / 2 个文件，其他位置 10 字节 / 1 个文件
+	nodes := map[string]int64{
+		"docs":       0,
+		"docs/a.txt": 50,
+		"docs/b.txt": 30,
+		"other":      0,
+		"other/c.md": 10,
+	}
+	docs100 := QuotaUsage{Path: "docs", quotaLimit: quotaLimit{MaxBytes: 100}}
+	tests := []struct {
+		name       string
+		quotas     []QuotaUsage
+		target     string
+		delta      quotaDelta
+		wantStatus int // 0 表示通过
+	}{
+		{"no quotas", nil, "docs/new.txt", quotaDelta{Bytes: 1 << 40, Files: 1}, 0},
+		{"within folder quota", []QuotaUsage{docs100}, "docs/new.txt", quotaDelta{Bytes: 20, Files: 1}, 0},
+		{"cumulative over folder quota", []QuotaUsage{docs100}, "docs/new.txt", quotaDelta{Bytes: 21, Files: 1}, http.StatusInsufficientStorage},
+		{"single write over folder quota", []QuotaUsage{docs100}, "docs/new.txt", quotaDelta{Bytes: 101, Files: 1}, http.StatusRequestEntityTooLarge},
+		{"outside the folder", []QuotaUsage{docs100}, "other/new.txt", quotaDelta{Bytes: 500, Files: 1}, 0},
+		{"sibling with a shared prefix", []QuotaUsage{docs100}, "docs2/new.txt", quotaDelta{Bytes: 500, Files: 1}, 0},
+		{"move within the folder", []QuotaUsage{docs100}, "docs/sub/a.txt", quotaDelta{Bytes: 50, Files: 1, From: "docs/a.txt"}, 0},
+		{"move into the folder", []QuotaUsage{docs100}, "docs/c.md", quotaDelta{Bytes: 30, Files: 1, From: "other/c.md"}, http.StatusInsufficientStorage},
+		{"shrinking write", []QuotaUsage{docs100}, "docs/a.txt", quotaDelta{Bytes: -20}, 0},
+		{"user byte quota", []QuotaUsage{{quotaLimit: quotaLimit{MaxBytes: 100}}}, "other/new.txt", quotaDelta{Bytes: 11, Files: 1}, http.StatusInsufficientStorage},
+		{"user file quota", []QuotaUsage{{quotaLimit: quotaLimit{MaxFiles: 3}}}, "new.txt", quotaDelta{Bytes: 1, Files: 1}, http.StatusInsufficientStorage},
+		{"user file quota with room", []QuotaUsage{{quotaLimit: quotaLimit{MaxFiles: 4}}}, "new.txt", quotaDelta{Bytes: 1, Files: 1}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ns := newFakeNamespace(1, nodes)
+			ns.quotas = tt.quotas
+			db := openFakeDB(t, ns)
+			s := &Server{}
+			err := s.checkQuota(db, &drive{OwnerID: 1}, tt.target, tt.delta)
+			if tt.wantStatus == 0 {
+				if err != nil {
+					t.Fatalf("err = %v", err)
+				}
+			} else {
+				var ae *apiError
+				if !errors.As(err, &ae) || ae.status != tt.wantStatus {
+					t.Fatalf("err = %v, want status %d", err, tt.wantStatus)
+				}
+			}
+			// 读取用量之前必须先持有命名空间锁，否则并发写入会基于同一份用量一起通过检查
+			locked := false
+			for _, q := range ns.queries {
+				switch {
+				case strings.Contains(q, "pg_advisory_xact_lock"):
+					locked = true
+				case strings.Contains(q, "SUM("):
+					if !locked {
+						t.Fatalf("usage read before the namespace lock: %s", q)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCheckWriteQuotaCreditsReplacedNode(t *testing.T) {
+	ns := newFakeNamespace(1, map[string]int64{"docs": 0, "docs/a.txt": 90})
+	ns.quotas = []QuotaUsage{{Path: "docs", quotaLimit: quotaLimit{MaxBytes: 100, MaxFiles: 1}}}
+	db := openFakeDB(t, ns)
+	s := &Server{}
+	d := &drive{OwnerID: 1}
+
+	// 覆盖 90 字节的文件：扣除被替换的用量后只多出 5 字节，文件数不变
+	replace := conflictOutcome{Action: actionOverwritten, Path: "docs/a.txt", ExistingID: ns.ids["docs/a.txt"]}
+	if err := s.checkWriteQuota(db, d, replace, quotaDelta{Bytes: 95, Files: 1}); err != nil {
+		t.Errorf("overwrite: err = %v", err)
+	}
+	// 同样大小的新文件会超出
+	create := conflictOutcome{Action: actionCreated, Path: "docs/b.txt"}
+	if err := s.checkWriteQuota(db, d, create, quotaDelta{Bytes: 95, Files: 1}); err == nil {
+		t.Error("new file: expected quota error")
+	}
+}
@@ -0,0 +1,856 @@
+package server
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// S3 兼容网关：/s3/<bucket>/<key>（path-style）。
+// bucket 为命名空间所有者的用户名，key 为命名空间内的相对路径，以 / 结尾的 key 表示目录。
+// 写入复用 storeFile，分段上传复用分块上传会话，删除移入回收站，权限按 ACL 检查
+
+const (
+	s3Namespace   = "http://s3.amazonaws.com/doc/2006-03-01/"
+	s3TimeFormat  = "2006-01-02T15:04:05.000Z"
+	s3MaxKeys     = 1000
+	s3MaxParts    = 10000
+	s3MaxPartSize = 5 << 30 // 单个分段的上限，与 AWS 一致
+)
+
+type s3Owner struct {
+	ID          string
+	DisplayName string
+}
+
+type s3Bucket struct {
+	Name         string
+	CreationDate string
+}
+
+type s3ListAllMyBucketsResult struct {
+	XMLName xml.Name   `xml:"ListAllMyBucketsResult"`
+	Xmlns   string     `xml:"xmlns,attr"`
+	Owner   s3Owner    `xml:"Owner"`
+	Buckets []s3Bucket `xml:"Buckets>Bucket"`
+}
+
+type s3Object struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int64
+	StorageClass string
+}
+
+type s3CommonPrefix struct {
+	Prefix string
+}
+
+type s3ListBucketResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	Xmlns                 string   `xml:"xmlns,attr"`
+	Name                  string
+	Prefix                string
+	Delimiter             string `xml:",omitempty"`
+	EncodingType          string `xml:",omitempty"`
+	MaxKeys               int
+	KeyCount              int `xml:",omitempty"`
+	IsTruncated           bool
+	ContinuationToken     string `xml:",omitempty"`
+	NextContinuationToken string `xml:",omitempty"`
+	StartAfter            string `xml:",omitempty"`
+	Marker                string `xml:",omitempty"`
+	NextMarker            string `xml:",omitempty"`
+	Contents              []s3Object
+	CommonPrefixes        []s3CommonPrefix
+}
+
+type s3InitiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string
+	Key      string
+	UploadId string
+}
+
+type s3CompleteMultipartUpload struct {
+	Parts []struct {
+		PartNumber int
+		ETag       string
+	} `xml:"Part"`
+}
+
+type s3CompleteMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string
+	Bucket   string
+	Key      string
+	ETag     string
+}
+
+type s3CopyObjectResult struct {
+	XMLName      xml.Name `xml:"CopyObjectResult"`
+	Xmlns        string   `xml:"xmlns,attr"`
+	LastModified string
+	ETag         string
+}
+
+type s3Delete struct {
+	Quiet   bool
+	Objects []struct {
+		Key string
+	} `xml:"Object"`
+}
+
+type s3DeleteResult struct {
+	XMLName xml.Name `xml:"DeleteResult"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Deleted []struct {
+		Key string
+	} `xml:"Deleted"`
+	Errors []s3ErrorResponse `xml:"Error"`
+}
+
+type s3ErrorResponse struct {
+	XMLName  xml.Name `xml:"Error"`
+	Key      string   `xml:",omitempty"`
+	Code     string
+	Message  string
+	Resource string `xml:",omitempty"`
+}
+
+// s3Code 把错误转换为 S3 的状态码与错误码
+func s3Code(err error) (int, string, string) {
+	var se *s3Error
+	if errors.As(err, &se) {
+		return se.status, se.code, se.msg
+	}
+	var ae *apiError
+	if errors.As(err, &ae) {
+		code := "InvalidRequest"
+		switch ae.status {
+		case http.StatusForbidden:
+			code = "AccessDenied"
+		case http.StatusNotFound:
+			code = "NoSuchKey"
+		case http.StatusConflict:
+			code = "OperationAborted"
+		case http.StatusRequestEntityTooLarge:
+			code = "EntityTooLarge"
+		case http.StatusInsufficientStorage:
+			code = "QuotaExceeded"
+		}
+		return ae.status, code, ae.msg
+	}
+	return http.StatusInternalServerError, "InternalError", err.Error()
+}
+
+// s3Abort 以 S3 XML 格式返回错误
+func s3Abort(c *gin.Context, err error) {
+	status, code, msg := s3Code(err)
+	c.Abort()
+	c.XML(status, s3ErrorResponse{Code: code, Message: msg, Resource: c.Request.URL.Path})
+}
+
+// s3ETag 对象的 ETag：内容的 SHA256（与版本记录一致），缺失时退化为大小与修改时间
+func s3ETag(hash string, info os.FileInfo) string {
+	if hash == "" {
+		hash = fmt.Sprintf("%x-%x", info.Size(), info.ModTime().UnixNano())
+	}
+	return `"` + hash + `"`
+}
+
+// s3Target 解析 bucket 与 key，返回命名空间与相对路径
+func (s *Server) s3Target(bucket, key string) (*drive, string, error) {
+	ownerID, err := s.userIDByName(bucket)
+	if err != nil {
+		var ae *apiError
+		if errors.As(err, &ae) && ae.status == http.StatusNotFound {
+			return nil, "", newS3Error(http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		}
+		return nil, "", err
+	}
+	rel, err := cleanRelPath(strings.TrimSuffix(key, "/"))
+	if err != nil {
+		return nil, "", newS3Error(http.StatusBadRequest, "InvalidArgument", "Invalid object key")
+	}
+	return s.driveOf(ownerID), rel, nil
+}
+
+// s3Tmp 在临时目录中创建一个文件
+func (s *Server) s3Tmp() (*os.File, error) {
+	dir := filepath.Join(s.uploadDir, "_tmp")
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(dir, "s3-*")
+}
+
+// handleS3 S3 请求分发
+func (s *Server) handleS3(c *gin.Context) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(c.Param("path"), "/"), "/")
+	q := c.Request.URL.Query()
+	method := c.Request.Method
+
+	var err error
+	switch {
+	case bucket == "":
+		if method != http.MethodGet {
+			err = newS3Error(http.StatusNotImplemented, "NotImplemented", "Bucket management is not supported")
+			break
+		}
+		err = s.s3ListBuckets(c)
+	case key == "":
+		switch {
+		case method == http.MethodGet && q.Has("location"):
+			c.XML(http.StatusOK, struct {
+				XMLName xml.Name `xml:"LocationConstraint"`
+				Xmlns   string   `xml:"xmlns,attr"`
+			}{Xmlns: s3Namespace})
+		case method == http.MethodGet:
+			err = s.s3ListObjects(c, bucket)
+		case method == http.MethodHead:
+			err = s.s3HeadBucket(c, bucket)
+		case method == http.MethodPost && q.Has("delete"):
+			err = s.s3DeleteObjects(c, bucket)
+		default:
+			err = newS3Error(http.StatusNotImplemented, "NotImplemented", "Bucket management is not supported")
+		}
+	default:
+		switch {
+		case method == http.MethodGet || method == http.MethodHead:
+			err = s.s3GetObject(c, bucket, key)
+		case method == http.MethodPut && q.Has("uploadId"):
+			err = s.s3UploadPart(c, bucket, key)
+		case method == http.MethodPut && c.GetHeader("X-Amz-Copy-Source") != "":
+			err = s.s3CopyObject(c, bucket, key)
+		case method == http.MethodPut:
+			err = s.s3PutObject(c, bucket, key)
+		case method == http.MethodPost && q.Has("uploads"):
+			err = s.s3CreateMultipartUpload(c, bucket, key)
+		case method == http.MethodPost && q.Has("uploadId"):
+			err = s.s3CompleteMultipartUpload(c, bucket, key)
+		case method == http.MethodDelete && q.Has("uploadId"):
+			err = s.s3AbortMultipartUpload(c, bucket, key)
+		case method == http.MethodDelete:
+			if err = s.s3DeleteObject(c, bucket, key); err == nil {
+				c.Status(http.StatusNoContent)
+			}
+		default:
+			err = newS3Error(http.StatusNotImplemented, "NotImplemented", "Operation is not supported")
+		}
+	}
+	if err != nil {
+		s3Abort(c, err)
+	}
+}
+
+// s3ListBuckets 列出自己的 bucket 以及共享给自己的命名空间
+func (s *Server) s3ListBuckets(c *gin.Context) error {
+	u := currentUser(c)
+	rows, err := s.DB.Query(`
+		SELECT username, created_at FROM users WHERE id = $1
+		UNION
+		SELECT u.username, u.created_at
+		FROM drive_acl a
+		JOIN drivelist d ON d.id = a.node_id
+		JOIN users u ON u.id = d.owner_id
+		WHERE a.user_id = $1 AND d.owner_id <> $1
+		ORDER BY username
+	`, u.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	result := s3ListAllMyBucketsResult{
+		Xmlns: s3Namespace,
+		Owner: s3Owner{ID: strconv.FormatInt(u.ID, 10), DisplayName: u.Username},
+	}
+	for rows.Next() {
+		var name string
+		var created time.Time
+		if err := rows.Scan(&name, &created); err != nil {
+			return err
+		}
+		result.Buckets = append(result.Buckets, s3Bucket{Name: name, CreationDate: created.UTC().Format(s3TimeFormat)})
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	c.XML(http.StatusOK, result)
+	return nil
+}
+
+// s3HeadBucket bucket 存在且当前用户能看到其中的内容时返回 200
+func (s *Server) s3HeadBucket(c *gin.Context, bucket string) error {
+	d, _, err := s.s3Target(bucket, "")
+	if err != nil {
+		return err
+	}
+	visible, err := d.readableNodes(s.DB, currentUser(c).ID)
+	if err != nil {
+		return err
+	}
+	if visible != nil && len(visible) == 0 {
+		return newS3Error(http.StatusForbidden, "AccessDenied", "Access denied")
+	}
+	c.Status(http.StatusOK)
+	return nil
+}
+
+// s3ListObjects ListObjectsV2（list-type=2）与 ListObjects（v1）
+func (s *Server) s3ListObjects(c *gin.Context, bucket string) error {
+	d, _, err := s.s3Target(bucket, "")
+	if err != nil {
+		return err
+	}
+	q := c.Request.URL.Query()
+	v2 := q.Get("list-type") == "2"
+	prefix, delimiter := q.Get("prefix"), q.Get("delimiter")
+	maxKeys := s3MaxKeys
+	if raw := q.Get("max-keys"); raw != "" {
+		if maxKeys, err = strconv.Atoi(raw); err != nil || maxKeys < 0 {
+			return newS3Error(http.StatusBadRequest, "InvalidArgument", "Invalid max-keys")
+		}
+		maxKeys = min(maxKeys, s3MaxKeys)
+	}
+	after := q.Get("marker")
+	if v2 {
+		after = q.Get("start-after")
+		if token := q.Get("continuation-token"); token != "" {
+			raw, err := base64.URLEncoding.DecodeString(token)
+			if err != nil {
+				return newS3Error(http.StatusBadRequest, "InvalidArgument", "Invalid continuation token")
+			}
+			after = string(raw)
+		}
+	}
+
+	visible, err := d.readableNodes(s.DB, currentUser(c).ID)
+	if err != nil {
+		return err
+	}
+	rows, err := s.DB.Query(`
+		SELECT id, name, capacity, COALESCE(file_hash, '')
+		FROM drivelist
+		WHERE owner_id = $1 AND left(name, length($2::text)) = $2
+	`, d.OwnerID, strings.TrimSuffix(prefix, "/"))
+	if err != nil {
+		return err
+	}
+	type entry struct {
+		key  string
+		name string
+		hash string
+	}
+	var entries []entry
+	for rows.Next() {
+		var id, capacity int64
+		var name, hash string
+		if err := rows.Scan(&id, &name, &capacity, &hash); err != nil {
+			rows.Close()
+			return err
+		}
+		if visible != nil && !visible[id] {
+			continue
+		}
+		key := name
+		if capacity == 0 {
+			// 目录以 "name/" 的目录标记对象出现
+			if info, err := os.Stat(d.abs(name)); err == nil && info.IsDir() {
+				key += "/"
+			}
+		}
+		if strings.HasPrefix(key, prefix) {
+			entries = append(entries, entry{key: key, name: name, hash: hash})
+		}
+	}
+	rows.Close()
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+
+	encode := func(v string) string { return v }
+	result := s3ListBucketResult{
+		Xmlns:   s3Namespace,
+		Name:    bucket,
+		MaxKeys: maxKeys,
+	}
+	if q.Get("encoding-type") == "url" {
+		result.EncodingType = "url"
+		encode = func(v string) string { return awsURIEncode(v, true) }
+	}
+	result.Prefix, result.Delimiter = encode(prefix), encode(delimiter)
+	if v2 {
+		result.ContinuationToken = q.Get("continuation-token")
+		result.StartAfter = encode(q.Get("start-after"))
+	} else {
+		result.Marker = encode(q.Get("marker"))
+	}
+
+	seen := map[string]bool{}
+	last := ""
+	count := 0
+	for _, e := range entries {
+		item := e.key
+		isPrefix := false
+		if delimiter != "" {
+			if i := strings.Index(e.key[len(prefix):], delimiter); i >= 0 {
+				item = e.key[:len(prefix)+i+len(delimiter)]
+				isPrefix = true
+			}
+		}
+		if item <= after || seen[item] {
+			continue
+		}
+		if count == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		seen[item] = true
+		count++
+		last = item
+		if isPrefix {
+			result.CommonPrefixes = append(result.CommonPrefixes, s3CommonPrefix{Prefix: encode(item)})
+			continue
+		}
+		obj := s3Object{Key: encode(e.key), StorageClass: "STANDARD"}
+		if info, err := os.Stat(d.abs(e.name)); err == nil {
+			obj.LastModified = info.ModTime().UTC().Format(s3TimeFormat)
+			obj.ETag = s3ETag(e.hash, info)
+			if !info.IsDir() {
+				obj.Size = info.Size()
+			}
+		}
+		result.Contents = append(result.Contents, obj)
+	}
+	if v2 {
+		result.KeyCount = count
+		if result.IsTruncated {
+			result.NextContinuationToken = base64.URLEncoding.EncodeToString([]byte(last))
+		}
+	} else if result.IsTruncated && delimiter != "" {
+		result.NextMarker = encode(last)
+	}
+	c.XML(http.StatusOK, result)
+	return nil
+}
+
+// s3GetObject GetObject / HeadObject，Range 与条件请求由 http.ServeContent 处理
+func (s *Server) s3GetObject(c *gin.Context, bucket, key string) error {
+	d, rel, err := s.s3Target(bucket, key)
+	if err != nil {
+		return err
+	}
+	if err := s.authorize(c, d, rel, PermRead); err != nil {
+		return err
+	}
+	var hash string
+	if err := s.DB.QueryRow("SELECT COALESCE(file_hash, '') FROM drivelist WHERE owner_id=$1 AND name=$2",
+		d.OwnerID, rel).Scan(&hash); err == sql.ErrNoRows {
+		return newS3Error(http.StatusNotFound, "NoSuchKey", "The specified key does not exist")
+	} else if err != nil {
+		return err
+	}
+	f, err := os.Open(d.abs(rel))
+	if err != nil {
+		return newS3Error(http.StatusNotFound, "NoSuchKey", "The specified key does not exist")
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	// 目录只能以 "key/" 的目录标记形式读取，内容为空
+	if info.IsDir() != strings.HasSuffix(key, "/") {
+		return newS3Error(http.StatusNotFound, "NoSuchKey", "The specified key does not exist")
+	}
+	c.Header("ETag", s3ETag(hash, info))
+	if info.IsDir() {
+		c.Header("Content-Type", "application/x-directory")
+		c.Header("Content-Length", "0")
+		c.Header("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+		c.Status(http.StatusOK)
+		return nil
+	}
+	http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), f)
+	return nil
+}
+
+// s3ReceiveBody 把请求体写入临时文件，同时计算 SHA256 与 MD5 并校验 Content-MD5
+func (s *Server) s3ReceiveBody(c *gin.Context) (tmp string, sha string, md5sum []byte, err error) {
+	f, err := s.s3Tmp()
+	if err != nil {
+		return "", "", nil, err
+	}
+	defer f.Close()
+	sh, mh := sha256.New(), md5.New()
+	if _, err := io.Copy(io.MultiWriter(f, sh, mh), c.Request.Body); err != nil {
+		os.Remove(f.Name())
+		return "", "", nil, err
+	}
+	md5sum = mh.Sum(nil)
+	if want := c.GetHeader("Content-MD5"); want != "" && want != base64.StdEncoding.EncodeToString(md5sum) {
+		os.Remove(f.Name())
+		return "", "", nil, newS3Error(http.StatusBadRequest, "BadDigest", "The Content-MD5 you specified did not match what we received")
+	}
+	return f.Name(), hex.EncodeToString(sh.Sum(nil)), md5sum, nil
+}
+
+// s3PutObject PutObject；以 / 结尾且内容为空的 key 创建目录
+func (s *Server) s3PutObject(c *gin.Context, bucket, key string) error {
+	d, rel, err := s.s3Target(bucket, key)
+	if err != nil {
+		return err
+	}
+	if rel == "" {
+		return newS3Error(http.StatusBadRequest, "InvalidArgument", "Invalid object key")
+	}
+	if err := s.authorize(c, d, rel, PermWrite); err != nil {
+		return err
+	}
+	if strings.HasSuffix(key, "/") {
+		if c.Request.ContentLength > 0 {
+			return newS3Error(http.StatusBadRequest, "InvalidArgument", "Directory markers must be empty")
+		}
+		if _, _, err := s.makeDir(d, rel, actorOf(c)); err != nil {
+			return err
+		}
+		c.Header("ETag", `"`+sha256Hex(nil)+`"`)
+		c.Status(http.StatusOK)
+		return nil
+	}
+	if c.Request.ContentLength > 0 {
+		if err := s.precheckUploadQuota(d, rel, c.Request.ContentLength, ConflictOverwrite); err != nil {
+			return err
+		}
+	}
+
+	tmp, sha, _, err := s.s3ReceiveBody(c)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	if _, _, err := s.storeFile(d, rel, tmp, ConflictOverwrite, time.Time{}, actorOf(c), sha); err != nil {
+		return err
+	}
+	c.Header("ETag", `"`+sha+`"`)
+	c.Status(http.StatusOK)
+	return nil
+}
+
+// s3CopyObject CopyObject：源为 X-Amz-Copy-Source 指定的 /bucket/key，可跨命名空间
+func (s *Server) s3CopyObject(c *gin.Context, bucket, key string) error {
+	d, rel, err := s.s3Target(bucket, key)
+	if err != nil {
+		return err
+	}
+	source, err := url.PathUnescape(c.GetHeader("X-Amz-Copy-Source"))
+	if err != nil {
+		return newS3Error(http.StatusBadRequest, "InvalidArgument", "Invalid x-amz-copy-source")
+	}
+	source, _, _ = strings.Cut(source, "?") // 不支持 versionId
+	srcBucket, srcKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+	srcDrive, srcRel, err := s.s3Target(srcBucket, srcKey)
+	if err != nil {
+		return err
+	}
+	if err := s.authorize(c, srcDrive, srcRel, PermRead); err != nil {
+		return err
+	}
+	if err := s.authorize(c, d, rel, PermWrite); err != nil {
+		return err
+	}
+	var hash string
+	if err := s.DB.QueryRow("SELECT COALESCE(file_hash, '') FROM drivelist WHERE owner_id=$1 AND name=$2",
+		srcDrive.OwnerID, srcRel).Scan(&hash); err == sql.ErrNoRows {
+		return newS3Error(http.StatusNotFound, "NoSuchKey", "The specified key does not exist")
+	} else if err != nil {
+		return err
+	}
+	if info, err := os.Stat(srcDrive.abs(srcRel)); err != nil || info.IsDir() {
+		return newS3Error(http.StatusNotFound, "NoSuchKey", "The specified key does not exist")
+	}
+
+	f, err := s.s3Tmp()
+	if err != nil {
+		return err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	if err := copyPath(srcDrive.abs(srcRel), f.Name()); err != nil {
+		return err
+	}
+	if _, _, err := s.storeFile(d, rel, f.Name(), ConflictOverwrite, time.Time{}, actorOf(c), hash); err != nil {
+		return err
+	}
+	info, err := os.Stat(d.abs(rel))
+	if err != nil {
+		return err
+	}
+	c.XML(http.StatusOK, s3CopyObjectResult{
+		Xmlns:        s3Namespace,
+		LastModified: info.ModTime().UTC().Format(s3TimeFormat),
+		ETag:         s3ETag(hash, info),
+	})
+	return nil
+}
+
+// s3DeleteObject DeleteObject：对象移入回收站；目录标记只在目录为空时删除，
+// 不存在的 key 按 S3 语义视为成功
+func (s *Server) s3DeleteObject(c *gin.Context, bucket, key string) error {
+	d, rel, err := s.s3Target(bucket, key)
+	if err != nil {
+		return err
+	}
+	if err := s.authorize(c, d, rel, PermDelete); err != nil {
+		return err
+	}
+	id, err := d.lookupNode(s.DB, rel)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(d.abs(rel))
+	if err != nil || info.IsDir() != strings.HasSuffix(key, "/") {
+		return nil
+	}
+	if info.IsDir() {
+		var children int
+		if err := s.DB.QueryRow("SELECT COUNT(*) FROM drivelist_closure WHERE ancestor=$1 AND depth > 0", id).Scan(&children); err != nil {
+			return err
+		}
+		if children > 0 {
+			return nil
+		}
+	}
+	_, err = s.trashPath(d, rel, false, actorOf(c))
+	return err
+}
+
+// s3DeleteObjects DeleteObjects（POST ?delete）
+func (s *Server) s3DeleteObjects(c *gin.Context, bucket string) error {
+	var req s3Delete
+	if err := xml.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		return newS3Error(http.StatusBadRequest, "MalformedXML", "Invalid Delete request body")
+	}
+	if len(req.Objects) > s3MaxKeys {
+		return newS3Error(http.StatusBadRequest, "MalformedXML", "Too many objects in one request")
+	}
+	result := s3DeleteResult{Xmlns: s3Namespace}
+	for _, obj := range req.Objects {
+		if err := s.s3DeleteObject(c, bucket, obj.Key); err != nil {
+			_, code, msg := s3Code(err)
+			result.Errors = append(result.Errors, s3ErrorResponse{Key: obj.Key, Code: code, Message: msg})
+			continue
+		}
+		if !req.Quiet {
+			result.Deleted = append(result.Deleted, struct{ Key string }{obj.Key})
+		}
+	}
+	c.XML(http.StatusOK, result)
+	return nil
+}
+
+// s3Session 取出属于当前用户且指向该 key 的分段上传会话
+func (s *Server) s3Session(c *gin.Context, d *drive, rel string) (*uploadSession, error) {
+	uploadID := c.Query("uploadId")
+	sessionsMu.Lock()
+	sess, ok := uploadSessions[uploadID]
+	sessionsMu.Unlock()
+	if !ok || sess.OwnerID != currentUser(c).ID || sess.DriveOwner != d.OwnerID ||
+		joinRel(sess.TargetPath, sess.FileName) != rel {
+		return nil, newS3Error(http.StatusNotFound, "NoSuchUpload", "The specified multipart upload does not exist")
+	}
+	return sess, nil
+}
+
+// s3CreateMultipartUpload 创建分段上传，对应一个分块上传会话
+func (s *Server) s3CreateMultipartUpload(c *gin.Context, bucket, key string) error {
+	d, rel, err := s.s3Target(bucket, key)
+	if err != nil {
+		return err
+	}
+	if rel == "" || strings.HasSuffix(key, "/") {
+		return newS3Error(http.StatusBadRequest, "InvalidArgument", "Invalid object key")
+	}
+	if err := s.authorize(c, d, rel, PermWrite); err != nil {
+		return err
+	}
+	uploadID, err := newUploadID("s3_")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(s.uploadDir, "_tmp", uploadID), os.ModePerm); err != nil {
+		return err
+	}
+
+	sessionsMu.Lock()
+	uploadSessions[uploadID] = &uploadSession{
+		UploadID:   uploadID,
+		FileName:   filepath.Base(rel),
+		Received:   map[int]bool{},
+		PartETags:  map[int]string{},
+		TargetPath: parentRel(rel),
+		Status:     "uploading",
+		OnConflict: ConflictOverwrite,
+		Actor:      actorOf(c),
+		OwnerID:    currentUser(c).ID,
+		DriveOwner: d.OwnerID,
+		CreatedAt:  time.Now(),
+	}
+	sessionsMu.Unlock()
+
+	c.XML(http.StatusOK, s3InitiateMultipartUploadResult{Xmlns: s3Namespace, Bucket: bucket, Key: key, UploadId: uploadID})
+	return nil
+}
+
+// s3UploadPart 上传一个分段，保存为会话的第 partNumber 个分片
+func (s *Server) s3UploadPart(c *gin.Context, bucket, key string) error {
+	d, rel, err := s.s3Target(bucket, key)
+	if err != nil {
+		return err
+	}
+	sess, err := s.s3Session(c, d, rel)
+	if err != nil {
+		return err
+	}
+	part, err := strconv.Atoi(c.Query("partNumber"))
+	if err != nil || part < 1 || part > s3MaxParts {
+		return newS3Error(http.StatusBadRequest, "InvalidArgument", "Part number must be an integer between 1 and %d", s3MaxParts)
+	}
+
+	// 写盘前按声明的长度检查分段上限与配额（重传的分段替换原来的内容），
+	// 请求体再限制在声明的长度内
+	size := c.Request.ContentLength
+	if size < 0 {
+		return newS3Error(http.StatusLengthRequired, "MissingContentLength", "You must provide the Content-Length HTTP header")
+	}
+	if size > s3MaxPartSize {
+		return newS3Error(http.StatusBadRequest, "EntityTooLarge", "Part size exceeds the maximum of %d bytes", s3MaxPartSize)
+	}
+	dst := filepath.Join(s.uploadDir, "_tmp", sess.UploadID, fmt.Sprintf("%06d.part", part))
+	var oldSize int64
+	if info, err := os.Stat(dst); err == nil {
+		oldSize = info.Size()
+	}
+	sess.mu.Lock()
+	staged := sess.ReceivedSize - oldSize + size
+	sess.mu.Unlock()
+	if err := s.precheckUploadQuota(d, rel, staged, ConflictOverwrite); err != nil {
+		return err
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, size)
+
+	tmp, _, md5sum, err := s.s3ReceiveBody(c)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return newS3Error(http.StatusBadRequest, "IncompleteBody", "The request body is longer than the declared Content-Length")
+		}
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	info, err := os.Stat(dst)
+	if err != nil {
+		return err
+	}
+	etag := `"` + hex.EncodeToString(md5sum) + `"`
+
+	sess.mu.Lock()
+	sess.Received[part] = true
+	sess.ReceivedSize += info.Size() - oldSize
+	sess.PartETags[part] = etag
+	sess.mu.Unlock()
+
+	c.Header("ETag", etag)
+	c.Status(http.StatusOK)
+	return nil
+}
+
+// s3CompleteMultipartUpload 按客户端给出的分段列表合并；分段需从 1 开始连续编号
+func (s *Server) s3CompleteMultipartUpload(c *gin.Context, bucket, key string) error {
+	d, rel, err := s.s3Target(bucket, key)
+	if err != nil {
+		return err
+	}
+	sess, err := s.s3Session(c, d, rel)
+	if err != nil {
+		return err
+	}
+	var req s3CompleteMultipartUpload
+	if err := xml.NewDecoder(c.Request.Body).Decode(&req); err != nil || len(req.Parts) == 0 {
+		return newS3Error(http.StatusBadRequest, "MalformedXML", "Invalid CompleteMultipartUpload request body")
+	}
+
+	sess.mu.Lock()
+	for i, p := range req.Parts {
+		if p.PartNumber != i+1 {
+			sess.mu.Unlock()
+			return newS3Error(http.StatusBadRequest, "InvalidPartOrder", "Parts must be numbered consecutively starting at 1")
+		}
+		if etag, ok := sess.PartETags[p.PartNumber]; !ok || strings.Trim(etag, `"`) != strings.Trim(p.ETag, `"`) {
+			sess.mu.Unlock()
+			return newS3Error(http.StatusBadRequest, "InvalidPart", "Part %d was not uploaded or its ETag does not match", p.PartNumber)
+		}
+	}
+	sess.TotalChunks = len(req.Parts)
+	sess.mu.Unlock()
+
+	if err := s.mergeChunks(sess.UploadID, sess); err != nil {
+		return err
+	}
+	var hash string
+	if err := s.DB.QueryRow("SELECT COALESCE(file_hash, '') FROM drivelist WHERE owner_id=$1 AND name=$2",
+		d.OwnerID, rel).Scan(&hash); err != nil {
+		return err
+	}
+	c.XML(http.StatusOK, s3CompleteMultipartUploadResult{
+		Xmlns:    s3Namespace,
+		Location: c.Request.URL.Path,
+		Bucket:   bucket,
+		Key:      key,
+		ETag:     `"` + hash + `"`,
+	})
+	return nil
+}
+
+// s3AbortMultipartUpload 放弃分段上传并清理已上传的分段
+func (s *Server) s3AbortMultipartUpload(c *gin.Context, bucket, key string) error {
+	d, rel, err := s.s3Target(bucket, key)
+	if err != nil {
+		return err
+	}
+	sess, err := s.s3Session(c, d, rel)
+	if err != nil {
+		return err
+	}
+	sessionsMu.Lock()
+	delete(uploadSessions, sess.UploadID)
+	sessionsMu.Unlock()
+	os.RemoveAll(filepath.Join(s.uploadDir, "_tmp", sess.UploadID))
+	c.Status(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,497 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// S3 访问密钥与 AWS Signature Version 4 校验。
+// SigV4 需要服务端持有密钥原文，因此单独建表保存，不复用只存哈希的 API Token
+
+const (
+	sigV4Algorithm       = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat      = "20060102T150405Z"
+	unsignedPayload      = "UNSIGNED-PAYLOAD"
+	streamingPayload     = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	streamingPayloadTrl  = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER"
+	streamingUnsignedTrl = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+	sigV4MaxSkew         = 15 * time.Minute
+	s3MaxChunkSize       = 16 << 20 // aws-chunked 单个分块上限
+)
+
+func (s *Server) ensureS3Tables() error {
+	_, err := s.DB.Exec(`CREATE TABLE IF NOT EXISTS s3_credentials (
+		access_key TEXT PRIMARY KEY,
+		secret_key TEXT NOT NULL,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ DEFAULT now(),
+		last_used_at TIMESTAMPTZ
+	)`)
+	return err
+}
+
+// s3Error S3 风格的错误（XML 响应中的 Code）
+type s3Error struct {
+	status int
+	code   string
+	msg    string
+}
+
+func (e *s3Error) Error() string { return e.msg }
+
+func newS3Error(status int, code, format string, args ...any) *s3Error {
+	return &s3Error{status: status, code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+// awsURIEncode 按 SigV4 规则编码：除 A-Z a-z 0-9 - _ . ~ 外全部百分号编码
+func awsURIEncode(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case 'A' <= ch && ch <= 'Z', 'a' <= ch && ch <= 'z', '0' <= ch && ch <= '9',
+			ch == '-', ch == '_', ch == '.', ch == '~':
+			b.WriteByte(ch)
+		case ch == '/' && keepSlash:
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// sigV4Key 派生签名密钥
+func sigV4Key(secret, date, region, service string) []byte {
+	k := hmacSHA256([]byte("AWS4"+secret), date)
+	k = hmacSHA256(k, region)
+	k = hmacSHA256(k, service)
+	return hmacSHA256(k, "aws4_request")
+}
+
+// canonicalQuery 规范化查询串；presigned 请求需要排除签名参数本身
+func canonicalQuery(q url.Values, skip string) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		if k != skip {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vals := append([]string(nil), q[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, awsURIEncode(k, false)+"="+awsURIEncode(v, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// canonicalHeaders 按 SignedHeaders 生成规范化请求头
+func canonicalHeaders(r *http.Request, signed []string) string {
+	var b strings.Builder
+	for _, h := range signed {
+		var val string
+		if h == "host" {
+			val = r.Host
+		} else {
+			val = strings.Join(r.Header.Values(h), ",")
+		}
+		b.WriteString(h + ":" + strings.Join(strings.Fields(val), " ") + "\n")
+	}
+	return b.String()
+}
+
+// sigV4Request 从请求中解析出的签名信息
+type sigV4Request struct {
+	AccessKey     string
+	Date          string // yyyymmdd
+	Region        string
+	Service       string
+	SignedHeaders []string
+	Signature     string
+	AmzDate       string
+	PayloadHash   string
+	Presigned     bool
+	Expires       time.Duration
+}
+
+func (v *sigV4Request) scope() string {
+	return v.Date + "/" + v.Region + "/" + v.Service + "/aws4_request"
+}
+
+// parseCredential 解析 AK/yyyymmdd/region/s3/aws4_request
+func (v *sigV4Request) parseCredential(cred string) error {
+	parts := strings.Split(cred, "/")
+	if len(parts) != 5 || parts[4] != "aws4_request" {
+		return newS3Error(http.StatusBadRequest, "AuthorizationHeaderMalformed", "Invalid credential scope")
+	}
+	v.AccessKey, v.Date, v.Region, v.Service = parts[0], parts[1], parts[2], parts[3]
+	if v.Service != "s3" {
+		return newS3Error(http.StatusBadRequest, "AuthorizationHeaderMalformed", "Credential scope must be for service s3")
+	}
+	return nil
+}
+
+// parseSigV4 从 Authorization 头或 X-Amz-* 查询参数（presigned URL）中解析签名
+func parseSigV4(r *http.Request) (*sigV4Request, error) {
+	v := &sigV4Request{}
+	q := r.URL.Query()
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if !strings.HasPrefix(auth, sigV4Algorithm+" ") {
+			return nil, newS3Error(http.StatusBadRequest, "AuthorizationHeaderMalformed", "Only AWS4-HMAC-SHA256 is supported")
+		}
+		for _, field := range strings.Split(strings.TrimPrefix(auth, sigV4Algorithm+" "), ",") {
+			k, val, _ := strings.Cut(strings.TrimSpace(field), "=")
+			switch k {
+			case "Credential":
+				if err := v.parseCredential(val); err != nil {
+					return nil, err
+				}
+			case "SignedHeaders":
+				v.SignedHeaders = strings.Split(val, ";")
+			case "Signature":
+				v.Signature = val
+			}
+		}
+		v.AmzDate = r.Header.Get("X-Amz-Date")
+		v.PayloadHash = r.Header.Get("X-Amz-Content-Sha256")
+		if v.PayloadHash == "" {
+			v.PayloadHash = unsignedPayload
+		}
+	} else if q.Get("X-Amz-Algorithm") == sigV4Algorithm {
+		if err := v.parseCredential(q.Get("X-Amz-Credential")); err != nil {
+			return nil, err
+		}
+		v.SignedHeaders = strings.Split(q.Get("X-Amz-SignedHeaders"), ";")
+		v.Signature = q.Get("X-Amz-Signature")
+		v.AmzDate = q.Get("X-Amz-Date")
+		v.PayloadHash = unsignedPayload
+		v.Presigned = true
+		secs, err := strconv.Atoi(q.Get("X-Amz-Expires"))
+		if err != nil || secs <= 0 || secs > 7*24*3600 {
+			return nil, newS3Error(http.StatusBadRequest, "AuthorizationQueryParametersError", "Invalid X-Amz-Expires")
+		}
+		v.Expires = time.Duration(secs) * time.Second
+	} else {
+		return nil, newS3Error(http.StatusForbidden, "AccessDenied", "Missing AWS Signature Version 4 credentials")
+	}
+	if v.AccessKey == "" || v.Signature == "" || len(v.SignedHeaders) == 0 {
+		return nil, newS3Error(http.StatusBadRequest, "AuthorizationHeaderMalformed", "Incomplete signature")
+	}
+	// 与 AWS 一致：host 必须签名，否则签名可以换一个主机重放；请求头签名时 x-amz-date 也必须签名
+	// （预签名 URL 的 X-Amz-Date 在查询串中，已包含在规范化请求里）
+	if !slices.Contains(v.SignedHeaders, "host") {
+		return nil, newS3Error(http.StatusBadRequest, "AuthorizationHeaderMalformed", "SignedHeaders must include host")
+	}
+	if !v.Presigned && !slices.Contains(v.SignedHeaders, "x-amz-date") {
+		return nil, newS3Error(http.StatusBadRequest, "AuthorizationHeaderMalformed", "SignedHeaders must include x-amz-date")
+	}
+	return v, nil
+}
+
+// canonicalRequest 生成规范化请求
+func (v *sigV4Request) canonicalRequest(r *http.Request) string {
+	skip := ""
+	if v.Presigned {
+		skip = "X-Amz-Signature"
+	}
+	return strings.Join([]string{
+		r.Method,
+		awsURIEncode(r.URL.Path, true),
+		canonicalQuery(r.URL.Query(), skip),
+		canonicalHeaders(r, v.SignedHeaders),
+		strings.Join(v.SignedHeaders, ";"),
+		v.PayloadHash,
+	}, "\n")
+}
+
+// stringToSign 生成待签名串
+func (v *sigV4Request) stringToSign(canonical string) string {
+	return strings.Join([]string{sigV4Algorithm, v.AmzDate, v.scope(), sha256Hex([]byte(canonical))}, "\n")
+}
+
+// verifySigV4 校验请求签名，成功时返回访问密钥所属用户与签名密钥（流式分块校验使用）
+func (s *Server) verifySigV4(r *http.Request, v *sigV4Request) (*User, []byte, error) {
+	signedAt, err := time.Parse(sigV4TimeFormat, v.AmzDate)
+	if err != nil || !strings.HasPrefix(v.AmzDate, v.Date) {
+		return nil, nil, newS3Error(http.StatusForbidden, "AccessDenied", "Invalid X-Amz-Date")
+	}
+	now := time.Now()
+	if v.Presigned {
+		if now.After(signedAt.Add(v.Expires)) {
+			return nil, nil, newS3Error(http.StatusForbidden, "AccessDenied", "Request has expired")
+		}
+	} else if now.Sub(signedAt) > sigV4MaxSkew || signedAt.Sub(now) > sigV4MaxSkew {
+		return nil, nil, newS3Error(http.StatusForbidden, "RequestTimeTooSkewed", "The difference between the request time and the server's time is too large")
+	}
+
+	var u User
+	var secret string
+	err = s.DB.QueryRow(`
+		SELECT u.id, u.username, u.is_admin, k.secret_key
+		FROM s3_credentials k JOIN users u ON u.id = k.user_id
+		WHERE k.access_key = $1
+	`, v.AccessKey).Scan(&u.ID, &u.Username, &u.IsAdmin, &secret)
+	if err == sql.ErrNoRows {
+		return nil, nil, newS3Error(http.StatusForbidden, "InvalidAccessKeyId", "The access key does not exist")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key := sigV4Key(secret, v.Date, v.Region, v.Service)
+	expected := hex.EncodeToString(hmacSHA256(key, v.stringToSign(v.canonicalRequest(r))))
+	if !hmac.Equal([]byte(expected), []byte(v.Signature)) {
+		return nil, nil, newS3Error(http.StatusForbidden, "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided")
+	}
+	if _, err := s.DB.Exec("UPDATE s3_credentials SET last_used_at=now() WHERE access_key=$1", v.AccessKey); err != nil {
+		return nil, nil, err
+	}
+	return &u, key, nil
+}
+
+// hashingReader 读到结尾时校验请求体的 SHA256
+type hashingReader struct {
+	r        io.Reader
+	h        hash.Hash
+	expected string
+}
+
+func (hr *hashingReader) Read(p []byte) (int, error) {
+	n, err := hr.r.Read(p)
+	hr.h.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(hr.h.Sum(nil)) != hr.expected {
+		return n, newS3Error(http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed")
+	}
+	return n, err
+}
+
+// chunkedReader 解码 aws-chunked 请求体：每个分块为 "大小[;chunk-signature=签名]\r\n数据\r\n"，
+// 签名版本按链式签名逐块校验，最后的尾部（trailer）忽略
+type chunkedReader struct {
+	br      *bufio.Reader
+	signed  bool
+	key     []byte
+	amzDate string
+	scope   string
+	prevSig string
+	buf     []byte
+	done    bool
+}
+
+func (cr *chunkedReader) Read(p []byte) (int, error) {
+	for len(cr.buf) == 0 {
+		if cr.done {
+			return 0, io.EOF
+		}
+		if err := cr.nextChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, cr.buf)
+	cr.buf = cr.buf[n:]
+	return n, nil
+}
+
+func (cr *chunkedReader) nextChunk() error {
+	malformed := newS3Error(http.StatusBadRequest, "IncompleteBody", "Malformed aws-chunked body")
+	line, err := cr.br.ReadString('\n')
+	if err != nil {
+		return malformed
+	}
+	sizeHex, ext, _ := strings.Cut(strings.TrimRight(line, "\r\n"), ";")
+	size, err := strconv.ParseInt(sizeHex, 16, 64)
+	if err != nil || size < 0 || size > s3MaxChunkSize {
+		return malformed
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(cr.br, data); err != nil {
+		return malformed
+	}
+	if size > 0 {
+		if crlf, err := cr.br.ReadString('\n'); err != nil || strings.TrimRight(crlf, "\r\n") != "" {
+			return malformed
+		}
+	}
+	if cr.signed {
+		sig := strings.TrimPrefix(ext, "chunk-signature=")
+		stringToSign := strings.Join([]string{
+			sigV4Algorithm + "-PAYLOAD", cr.amzDate, cr.scope, cr.prevSig, sha256Hex(nil), sha256Hex(data),
+		}, "\n")
+		expected := hex.EncodeToString(hmacSHA256(cr.key, stringToSign))
+		if !hmac.Equal([]byte(expected), []byte(sig)) {
+			return newS3Error(http.StatusForbidden, "SignatureDoesNotMatch", "Chunk signature does not match")
+		}
+		cr.prevSig = sig
+	}
+	if size == 0 {
+		cr.done = true // 之后是可选的 trailer，不再读取
+	}
+	cr.buf = data
+	return nil
+}
+
+// wrapS3Body 按 x-amz-content-sha256 替换请求体：校验哈希或解码 aws-chunked
+func wrapS3Body(r *http.Request, v *sigV4Request, key []byte) error {
+	switch v.PayloadHash {
+	case unsignedPayload:
+	case streamingPayload, streamingPayloadTrl, streamingUnsignedTrl:
+		r.Body = io.NopCloser(&chunkedReader{
+			br:      bufio.NewReader(r.Body),
+			signed:  v.PayloadHash != streamingUnsignedTrl,
+			key:     key,
+			amzDate: v.AmzDate,
+			scope:   v.scope(),
+			prevSig: v.Signature,
+		})
+		if n, err := strconv.ParseInt(r.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64); err == nil {
+			r.ContentLength = n
+		} else {
+			r.ContentLength = -1
+		}
+	default:
+		if len(v.PayloadHash) != 64 {
+			return newS3Error(http.StatusBadRequest, "InvalidArgument", "Invalid x-amz-content-sha256")
+		}
+		if v.PayloadHash == sha256Hex(nil) && r.ContentLength <= 0 {
+			r.Body = io.NopCloser(bytes.NewReader(nil))
+			return nil
+		}
+		r.Body = io.NopCloser(&hashingReader{r: r.Body, h: sha256.New(), expected: v.PayloadHash})
+	}
+	return nil
+}
+
+// requireS3Auth S3 网关的认证中间件：校验 SigV4 后把访问密钥所属用户写入上下文
+func (s *Server) requireS3Auth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		v, err := parseSigV4(c.Request)
+		if err == nil {
+			var u *User
+			var key []byte
+			if u, key, err = s.verifySigV4(c.Request, v); err == nil {
+				if err = wrapS3Body(c.Request, v, key); err == nil {
+					c.Set(ctxUserKey, u)
+					c.Next()
+					return
+				}
+			}
+		}
+		s3Abort(c, err)
+	}
+}
+
+// handleCreateS3Key 创建 S3 访问密钥；secret_key 只在创建时返回
+func (s *Server) handleCreateS3Key(c *gin.Context) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+	}
+	akBuf := make([]byte, 10)
+	skBuf := make([]byte, 30)
+	if _, err := rand.Read(akBuf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := rand.Read(skBuf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	accessKey := "SDAK" + strings.ToUpper(hex.EncodeToString(akBuf))
+	secretKey := hex.EncodeToString(skBuf)
+
+	err := s.withAudit(actorOf(c), 0, "s3key_create", "", gin.H{"access_key": accessKey, "name": req.Name}, func(tx *sql.Tx) error {
+		_, err := tx.Exec("INSERT INTO s3_credentials (access_key, secret_key, user_id, name) VALUES ($1, $2, $3, $4)",
+			accessKey, secretKey, currentUser(c).ID, req.Name)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create access key: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"access_key": accessKey, "secret_key": secretKey, "name": req.Name})
+}
+
+func (s *Server) handleListS3Keys(c *gin.Context) {
+	rows, err := s.DB.Query(`
+		SELECT access_key, name, created_at, last_used_at
+		FROM s3_credentials WHERE user_id=$1 ORDER BY created_at
+	`, currentUser(c).ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	items := []gin.H{}
+	for rows.Next() {
+		var accessKey, name string
+		var createdAt time.Time
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&accessKey, &name, &createdAt, &lastUsed); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		item := gin.H{"access_key": accessKey, "name": name, "created_at": createdAt}
+		if lastUsed.Valid {
+			item["last_used_at"] = lastUsed.Time
+		}
+		items = append(items, item)
+	}
+	c.JSON(http.StatusOK, gin.H{"count": len(items), "items": items})
+}
+
+func (s *Server) handleDeleteS3Key(c *gin.Context) {
+	err := s.withAudit(actorOf(c), 0, "s3key_delete", "", gin.H{"access_key": c.Param("key")}, func(tx *sql.Tx) error {
+		res, err := tx.Exec("DELETE FROM s3_credentials WHERE access_key=$1 AND user_id=$2", c.Param("key"), currentUser(c).ID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return newAPIError(http.StatusNotFound, "Access key not found")
+		}
+		return nil
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Access key revoked"})
+}
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"html"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 全文检索：上传后在后台提取正文写入 drive_content，用 PostgreSQL tsvector（simple 配置，不做词干化）建立倒排索引。
+// 索引按节点 ID 存储：移动、重命名无需更新，删除时随节点级联删除，内容变化后按哈希重新提取
+
+const (
+	searchSnippetRunes = 80 // 片段中匹配词前后保留的字符数
+	searchMaxSnippets  = 2
+)
+
+func (s *Server) ensureSearchTables() error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS drive_content (
+			node_id INTEGER PRIMARY KEY REFERENCES drivelist(id) ON DELETE CASCADE,
+			file_hash TEXT NOT NULL DEFAULT '',
+			body TEXT NOT NULL DEFAULT '',
+			tsv TSVECTOR NOT NULL,
+			indexed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_content_tsv ON drive_content USING GIN(tsv)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := s.DB.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshContentIndex 内容变化后重新提取正文并更新索引；没有可提取文本的文件也写入空记录，避免反复补扫
+func (s *Server) refreshContentIndex(d *drive, nodeID int64, rel, mime string) error {
+	hash, err := s.contentHash(d, nodeID, rel)
+	if err != nil {
+		return err
+	}
+	var stored string
+	if err := s.DB.QueryRow("SELECT file_hash FROM drive_content WHERE node_id=$1", nodeID).Scan(&stored); err == nil && stored == hash {
+		return nil
+	}
+	body, err := extractText(d.abs(rel), rel, mime, s.searchMaxText)
+	if err != nil {
+		return err
+	}
+	_, err = s.DB.Exec(`
+		INSERT INTO drive_content (node_id, file_hash, body, tsv, indexed_at)
+		VALUES ($1, $2, $3, to_tsvector('simple', $3), now())
+		ON CONFLICT (node_id) DO UPDATE SET file_hash=EXCLUDED.file_hash, body=EXCLUDED.body, tsv=EXCLUDED.tsv, indexed_at=now()
+	`, nodeID, hash, body)
+	return err
+}
+
+// likeEscape 转义 LIKE 模式中的通配符
+func likeEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// searchTerms 从查询串中取出用于匹配文件名和高亮的词（去掉引号、排除词和 or）
+func searchTerms(q string) []string {
+	var terms []string
+	for _, f := range strings.Fields(strings.ReplaceAll(q, `"`, " ")) {
+		if strings.HasPrefix(f, "-") || strings.EqualFold(f, "or") {
+			continue
+		}
+		terms = append(terms, f)
+	}
+	return terms
+}
+
+// hasCJK 中日韩文本没有空格分词，tsvector 无法按词匹配，需要退回子串匹配
+func hasCJK(s string) bool {
+	for _, r := range s {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchResult 一条搜索结果，Snippets 为 HTML 转义后用 <mark> 标出匹配词的正文片段
+type SearchResult struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	Capacity  int64     `json:"capacity"`
+	IsDir     bool      `json:"is_dir"`
+	CreatedAt time.Time `json:"created_at"`
+	NameMatch bool      `json:"name_match"`
+	Rank      float64   `json:"rank"`
+	Snippets  []string  `json:"snippets,omitempty"`
+	Metadata  *FileMeta `json:"metadata,omitempty"`
+}
+
+// searchSnippets 在正文中找出前几处匹配，截取前后文并高亮
+func searchSnippets(body string, re *regexp.Regexp) []string {
+	var out []string
+	runes := []rune(body)
+	// 以字符为单位定位，避免把多字节字符截断
+	locs := re.FindAllStringIndex(body, -1)
+	lastEnd := -1
+	for _, loc := range locs {
+		if len(out) >= searchMaxSnippets {
+			break
+		}
+		start := utf8RuneIndex(body, loc[0])
+		if start < lastEnd {
+			continue // 已包含在上一个片段中
+		}
+		from, to := max(0, start-searchSnippetRunes), min(len(runes), start+searchSnippetRunes)
+		fragment := string(runes[from:to])
+		var b strings.Builder
+		if from > 0 {
+			b.WriteString("…")
+		}
+		prev := 0
+		for _, m := range re.FindAllStringIndex(fragment, -1) {
+			b.WriteString(html.EscapeString(fragment[prev:m[0]]))
+			b.WriteString("<mark>" + html.EscapeString(fragment[m[0]:m[1]]) + "</mark>")
+			prev = m[1]
+		}
+		b.WriteString(html.EscapeString(fragment[prev:]))
+		if to < len(runes) {
+			b.WriteString("…")
+		}
+		out = append(out, strings.ReplaceAll(b.String(), "\n", " "))
+		lastEnd = to
+	}
+	return out
+}
+
+// utf8RuneIndex 把字节偏移换算为字符偏移
+func utf8RuneIndex(s string, byteOff int) int {
+	return len([]rune(s[:byteOff]))
+}
+
+// handleSearch 按文件名与正文搜索：GET /search?q=（兼容 keyword 参数）
+// q 支持 websearch 语法（"短语"、or、-排除），可叠加 /filter 的所有条件；结果按文件名命中、相关度排序
+func (s *Server) handleSearch(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		q = strings.TrimSpace(c.Query("keyword"))
+	}
+	terms := searchTerms(q)
+	if len(terms) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing 'q' query parameter"})
+		return
+	}
+	limit := 50
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > 200 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'limit' parameter"})
+			return
+		}
+		limit = n
+	}
+
+	d := s.driveFor(c)
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	conds, err := filterConds(c, d.OwnerID, currentUser(c).ID, arg)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	query := arg(q)
+	var nameConds, bodyConds []string
+	for _, t := range terms {
+		p := arg("%" + likeEscape(t) + "%")
+		nameConds = append(nameConds, "regexp_replace(d.name, '^.*/', '') ILIKE "+p)
+		bodyConds = append(bodyConds, "ci.body ILIKE "+p)
+	}
+	nameMatch := "(" + strings.Join(nameConds, " AND ") + ")"
+	matches := []string{"ci.tsv @@ websearch_to_tsquery('simple', " + query + ")", nameMatch}
+	if hasCJK(q) {
+		matches = append(matches, "("+strings.Join(bodyConds, " AND ")+")")
+	}
+	conds = append(conds, "("+strings.Join(matches, " OR ")+")")
+
+	rows, err := s.DB.Query(`
+		SELECT d.id, d.name, d.capacity, d.created_at, `+nameMatch+`,
+			COALESCE(ts_rank(ci.tsv, websearch_to_tsquery('simple', `+query+`)), 0), COALESCE(ci.body, ''), `+metaColumns+`
+		FROM drivelist d
+		LEFT JOIN drive_metadata m ON m.node_id = d.id
+		LEFT JOIN drive_content ci ON ci.node_id = d.id
+		WHERE `+strings.Join(conds, " AND ")+`
+		ORDER BY 5 DESC, 6 DESC, d.id DESC
+		LIMIT `+arg(limit), args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	quoted := make([]string, len(terms))
+	for i, t := range terms {
+		quoted[i] = regexp.QuoteMeta(t)
+	}
+	highlight := regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+
+	results := []SearchResult{}
+	for rows.Next() {
+		var r SearchResult
+		var body string
+		var m metaScan
+		if err := rows.Scan(append([]any{&r.ID, &r.Name, &r.Capacity, &r.CreatedAt, &r.NameMatch, &r.Rank, &body}, m.dest()...)...); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		r.Path = r.Name
+		r.IsDir = r.Capacity == 0 // 容量为0表示目录
+		r.Metadata = m.meta()
+		r.Snippets = searchSnippets(body, highlight)
+		results = append(results, r)
+	}
+	c.JSON(http.StatusOK, results)
+}
@@ -1,11 +1,12 @@
 package server
 
 import (
-	"archive/zip"
+	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -24,11 +25,25 @@ import (
 )
 
 type Server struct {
-	uploadDir string
-	host      string
-	DB        *sql.DB
-	Metalist  []shared.MetaData
-	Ge        *gin.Engine
+	uploadDir         string
+	host              string
+	trashRetention    time.Duration // 回收站保留期，0 表示不自动清理
+	changeRetention   time.Duration // 变更事件保留期，0 表示不自动清理
+	versionRetention  versionRetention
+	jwtSecret         []byte               // 会话 JWT 签名密钥
+	presignSecret     []byte               // 预签名 URL 的 HMAC 密钥
+	sessionTTL        time.Duration        // 登录会话有效期
+	allowRegistration bool                 // 是否允许自助注册（第一个用户总是允许）
+	defaultQuota      quotaLimit           // 未单独配置时的用户级配额
+	changes           *changeHub           // 变更事件订阅者
+	webhookWake       chan struct{}        // 唤醒 Webhook 调度器
+	thumbs            *thumbnailer         // 缩略图与预览生成器
+	metaQueue         chan fileJob         // 待提取元数据与建立全文索引的文件
+	searchMaxText     int                  // 全文索引每个文件最多保存的文本字节数
+	archiveLimits     shared.ExtractLimits // 归档上传的解压限制
+	DB                *sql.DB
+	Metalist          []shared.MetaData
+	Ge                *gin.Engine
 }
 
 // 上传会话（内存示例，生产建议用 Redis/DB 持久化）
@@ -42,10 +57,40 @@ type uploadSession struct {
 	TotalSize    int64
 	TargetPath   string // 相对存储路径
 	Status       string // uploading, merging, done, error
+	OnConflict   ConflictPolicy
+	ModTime      time.Time        // 客户端文件修改时间（keep-newer 使用）
+	Outcome      *conflictOutcome // 合并后的冲突处理结果
+	Actor        actor            // 上传者，写入版本记录与审计日志
+	PartETags    map[int]string   // S3 分段上传各分段的 ETag
+	OwnerID      int64            // 会话所属用户，只能由本人续传
+	DriveOwner   int64            // 写入的命名空间（上传到共享目录时为目录所有者）
 	CreatedAt    time.Time
 	mu           sync.Mutex
 }
 
+// checkUploadID 校验 uploadId：它会拼进临时目录路径，只能是单个路径段
+func checkUploadID(id string) error {
+	if id == "" || len(id) > 128 || filepath.Base(id) != id || strings.Contains(id, "..") || strings.ContainsAny(id, `/\`) {
+		return newAPIError(http.StatusBadRequest, "Invalid uploadId")
+	}
+	return nil
+}
+
+// newUploadID 生成上传会话 ID（时间戳加随机串，不含客户端输入）
+func newUploadID(prefix string) (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%d_%s", prefix, time.Now().UnixNano(), hex.EncodeToString(buf)), nil
+}
+
+func (sess *uploadSession) setStatus(status string) {
+	sess.mu.Lock()
+	sess.Status = status
+	sess.mu.Unlock()
+}
+
 var (
 	uploadSessions = map[string]*uploadSession{}
 	sessionsMu     sync.Mutex
@@ -104,6 +149,74 @@ func (s *Server) SetupDefaultSql() {
 	}
 
 	s.DB = db
+
+	// 各功能模块的附加表
+	if err := s.ensureTrashTables(); err != nil {
+		db.Close()
+		log.Fatalf("failed to create trash tables: %v", err)
+	}
+	log.Println("确保回收站表存在")
+	if err := s.ensureVersionTables(); err != nil {
+		db.Close()
+		log.Fatalf("failed to create version tables: %v", err)
+	}
+	log.Println("确保版本表存在")
+	if err := s.ensureUserTables(); err != nil {
+		db.Close()
+		log.Fatalf("failed to create user tables: %v", err)
+	}
+	log.Println("确保用户表存在")
+	if err := s.ensureQuotaTables(); err != nil {
+		db.Close()
+		log.Fatalf("failed to create quota tables: %v", err)
+	}
+	log.Println("确保配额表存在")
+	if err := s.ensureACLTables(); err != nil {
+		db.Close()
+		log.Fatalf("failed to create acl tables: %v", err)
+	}
+	log.Println("确保权限表存在")
+	if err := s.ensureShareTables(); err != nil {
+		db.Close()
+		log.Fatalf("failed to create share tables: %v", err)
+	}
+	log.Println("确保分享链接表存在")
+	if err := s.ensureS3Tables(); err != nil {
+		db.Close()
+		log.Fatalf("failed to create s3 tables: %v", err)
+	}
+	log.Println("确保 S3 访问密钥表存在")
+	if err := s.ensureChangeTables(); err != nil {
+		db.Close()
+		log.Fatalf("failed to create change tables: %v", err)
+	}
+	log.Println("确保变更事件表存在")
+	if err := s.ensureWebhookTables(); err != nil {
+		db.Close()
+		log.Fatalf("failed to create webhook tables: %v", err)
+	}
+	log.Println("确保 Webhook 表存在")
+	if err := s.ensureAuditTables(); err != nil {
+		db.Close()
+		log.Fatalf("failed to create audit tables: %v", err)
+	}
+	log.Println("确保审计日志表存在")
+	if err := s.ensureMetadataTables(); err != nil {
+		db.Close()
+		log.Fatalf("failed to create metadata tables: %v", err)
+	}
+	log.Println("确保文件元数据表存在")
+	if err := s.ensureSearchTables(); err != nil {
+		db.Close()
+		log.Fatalf("failed to create search tables: %v", err)
+	}
+	log.Println("确保全文索引表存在")
+	if err := s.ensureTagTables(); err != nil {
+		db.Close()
+		log.Fatalf("failed to create tag tables: %v", err)
+	}
+	log.Println("确保标签与收藏表存在")
+
 	s.Metalist = s.ReadItemsFromDB(db)
 }
 
@@ -150,109 +263,121 @@ func (s *Server) handleUpload(c *gin.Context) {
 		return
 	}
 
-	// 获取可选的路径字段（如 "test/data"）
-	userPath := c.PostForm("path")
-	// 基本安全检查：不允许绝对路径或上级引用
-	if userPath != "" {
-		if strings.Contains(userPath, "..") || strings.HasPrefix(userPath, "/") || strings.HasPrefix(userPath, "\\") {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid path"})
-			return
-		}
-		// 清理路径（去除多余分隔符）
-		userPath = filepath.Clean(userPath)
+	// 获取可选的路径字段（如 "test/data"），不允许绝对路径或上级引用
+	userPath, err := cleanRelPath(c.PostForm("path"))
+	if err != nil {
+		respondError(c, err)
+		return
 	}
 
-	// 定义服务器上的存储目录（uploads/<userPath>）
-	destDir := s.uploadDir
-	if userPath != "" && userPath != "." {
-		destDir = filepath.Join(s.uploadDir, userPath)
+	// 冲突策略：默认覆盖同路径文件（保持旧行为）
+	policy, err := parseConflictPolicy(c.PostForm("onConflict"), ConflictOverwrite)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	modTime, err := parseModTime(c.PostForm("modTime"))
+	if err != nil {
+		respondError(c, err)
+		return
 	}
-	// 确保目标目录存在
-	if err := os.MkdirAll(destDir, os.ModePerm); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create storage directory: " + err.Error()})
+	d := s.driveFor(c)
+	if err := s.authorize(c, d, joinRel(userPath, filepath.Base(file.Filename)), PermWrite); err != nil {
+		respondError(c, err)
 		return
 	}
 
-	// 将文件保存到服务器的目标路径
-	destPath := filepath.Join(destDir, file.Filename)
-	if err := c.SaveUploadedFile(file, destPath); err != nil {
+	// 先保存到临时目录，再按冲突策略放入命名空间
+	tmpDir := filepath.Join(s.uploadDir, "_tmp")
+	if err := os.MkdirAll(tmpDir, os.ModePerm); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create tmp dir: " + err.Error()})
+		return
+	}
+	tmp, err := os.CreateTemp(tmpDir, "upload-*")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create tmp file: " + err.Error()})
+		return
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err := c.SaveUploadedFile(file, tmp.Name()); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file: " + err.Error()})
 		return
 	}
 
-	// 将元数据存入数据库：存在则更新 capacity，否则插入新记录
-	var existingID int
-	err = s.DB.QueryRow("SELECT id FROM drivelist WHERE name=$1", meta.Name).Scan(&existingID)
+	outcome, version, err := s.storeFile(d, joinRel(userPath, filepath.Base(file.Filename)), tmp.Name(), policy, modTime, actorOf(c), "")
 	if err != nil {
-		if err == sql.ErrNoRows {
-			// 不存在，插入新记录
-			var newID int64
-			err = s.DB.QueryRow("INSERT INTO drivelist (name, capacity) VALUES ($1, $2) RETURNING id",
-				meta.Name, meta.Capacity).Scan(&newID)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert metadata: " + err.Error()})
-				return
-			}
-
-			// 插入闭包表记录：自己到自己 (depth=0)
-			_, err = s.DB.Exec("INSERT INTO drivelist_closure (ancestor, descendant, depth) VALUES ($1, $1, 0)", newID)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert closure for file: " + err.Error()})
-				return
-			}
-
-			// 如果文件在子目录中，建立与父目录的闭包关系
-			if userPath != "" && userPath != "." {
-				var parentID int64
-				err = s.DB.QueryRow("SELECT id FROM drivelist WHERE name=$1", userPath).Scan(&parentID)
-				if err == nil {
-					// 复制父节点的所有祖先关系
-					_, err = s.DB.Exec(`
-						INSERT INTO drivelist_closure (ancestor, descendant, depth)
-						SELECT ancestor, $1, depth + 1
-						FROM drivelist_closure
-						WHERE descendant = $2
-					`, newID, parentID)
-					if err != nil {
-						log.Printf("Warning: failed to link file to parent closure: %v", err)
-					}
-				}
-			}
-		} else {
-			// 查询出错
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check metadata: " + err.Error()})
-			return
-		}
-	} else {
-		// 记录已存在，更新容量（capacity）字段
-		_, err = s.DB.Exec("UPDATE drivelist SET capacity=$1 WHERE id=$2", meta.Capacity, existingID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update metadata: " + err.Error()})
-			return
-		}
+		respondError(c, err)
+		return
+	}
+	if !outcome.Proceed() {
+		c.JSON(http.StatusOK, gin.H{
+			"message":  "File skipped due to conflict policy",
+			"filename": file.Filename,
+			"conflict": outcome,
+		})
+		return
 	}
+	relName := outcome.Path
+	destPath := d.abs(relName)
 
 	// 打印日志并返回成功响应
 	fmt.Printf("File '%s' received and saved to '%s'. Meta: %+v\n", file.Filename, destPath, meta)
 	c.JSON(http.StatusOK, gin.H{
 		"message":  "File uploaded successfully",
-		"filename": file.Filename,
-		"path":     destPath,
+		"filename": filepath.Base(relName),
+		"path":     relName,
+		"version":  version,
+		"conflict": outcome,
 	})
 }
 
 func (s *Server) handleList(c *gin.Context) {
 	// 检查是否请求简单列表格式（用于向后兼容）
 	format := c.Query("format")
-	if format == "simple" || format == "flat" {
+	d := s.driveFor(c)
+	// 访问他人的命名空间时只返回共享给自己的节点
+	userID := currentUser(c).ID
+	visible, err := d.readableNodes(s.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	flat := format == "simple" || format == "flat"
+	// 按标签过滤：只保留带有全部标签的节点及其子树（树形结构额外保留上级目录）
+	if raw := c.Query("tag"); raw != "" {
+		tags, err := parseTags(raw)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		tagged, err := s.taggedNodes(d, tags, !flat)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if visible != nil {
+			for id := range tagged {
+				if !visible[id] {
+					delete(tagged, id)
+				}
+			}
+		}
+		visible = tagged
+	}
+	if flat {
 		// 返回简单的数组格式
-		items := s.ReadItemsFromDB(s.DB)
+		items, err := s.readDriveItems(d, visible)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusOK, items)
 		return
 	}
 
 	// 默认返回树形结构
-	tree, err := s.buildFileTree()
+	tree, err := s.buildFileTree(d, visible, userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -267,13 +392,44 @@ type TreeNode struct {
 	Capacity int64       `json:"capacity"`
 	IsDir    bool        `json:"is_dir"`
 	Path     string      `json:"path"`
+	Hash     string      `json:"hash,omitempty"` // 文件内容的 SHA-256，早期上传的文件可能为空
+	Tags     []string    `json:"tags,omitempty"`
+	Starred  bool        `json:"starred,omitempty"`
 	Children []*TreeNode `json:"children,omitempty"`
 }
 
-// buildFileTree 从数据库构建文件树
-func (s *Server) buildFileTree() (map[string]interface{}, error) {
+// readDriveItems 返回用户命名空间内节点的扁平列表，visible 为 nil 表示全部可见
+func (s *Server) readDriveItems(d *drive, visible map[int64]bool) ([]shared.MetaData, error) {
+	rows, err := s.DB.Query("SELECT id, name, capacity FROM drivelist WHERE owner_id=$1 ORDER BY id", d.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metalist := []shared.MetaData{}
+	for rows.Next() {
+		var id int64
+		var item shared.MetaData
+		if err := rows.Scan(&id, &item.Name, &item.Capacity); err != nil {
+			return nil, err
+		}
+		if visible != nil && !visible[id] {
+			continue
+		}
+		metalist = append(metalist, item)
+	}
+	return metalist, rows.Err()
+}
+
+// buildFileTree 从数据库构建用户命名空间的文件树，visible 为 nil 表示全部可见，userID 用于标记收藏
+func (s *Server) buildFileTree(d *drive, visible map[int64]bool, userID int64) (map[string]interface{}, error) {
+	tags, starred, err := s.loadTreeLabels(d.OwnerID, userID)
+	if err != nil {
+		return nil, err
+	}
+
 	// 1. 获取所有节点
-	rows, err := s.DB.Query("SELECT id, name, capacity FROM drivelist ORDER BY id")
+	rows, err := s.DB.Query("SELECT id, name, capacity, COALESCE(file_hash, '') FROM drivelist WHERE owner_id=$1 ORDER BY id", d.OwnerID)
 	if err != nil {
 		return nil, err
 	}
@@ -284,11 +440,14 @@ func (s *Server) buildFileTree() (map[string]interface{}, error) {
 
 	for rows.Next() {
 		var id int64
-		var name string
+		var name, hash string
 		var capacity int64
-		if err := rows.Scan(&id, &name, &capacity); err != nil {
+		if err := rows.Scan(&id, &name, &capacity, &hash); err != nil {
 			return nil, err
 		}
+		if visible != nil && !visible[id] {
+			continue
+		}
 
 		node := &TreeNode{
 			ID:       id,
@@ -296,6 +455,9 @@ func (s *Server) buildFileTree() (map[string]interface{}, error) {
 			Capacity: capacity,
 			IsDir:    capacity == 0, // 容量为0表示目录
 			Path:     name,
+			Hash:     hash,
+			Tags:     tags[id],
+			Starred:  starred[id],
 			Children: []*TreeNode{},
 		}
 		nodeMap[id] = node
@@ -304,11 +466,12 @@ func (s *Server) buildFileTree() (map[string]interface{}, error) {
 
 	// 2. 获取父子关系 (depth=1 表示直接父子关系)
 	rows, err = s.DB.Query(`
-		SELECT ancestor, descendant 
-		FROM drivelist_closure 
-		WHERE depth = 1
-		ORDER BY ancestor, descendant
-	`)
+		SELECT c.ancestor, c.descendant
+		FROM drivelist_closure c
+		JOIN drivelist d ON d.id = c.descendant
+		WHERE c.depth = 1 AND d.owner_id = $1
+		ORDER BY c.ancestor, c.descendant
+	`, d.OwnerID)
 	if err != nil {
 		return nil, err
 	}
@@ -320,6 +483,10 @@ func (s *Server) buildFileTree() (map[string]interface{}, error) {
 		if err := rows.Scan(&ancestor, &descendant); err != nil {
 			return nil, err
 		}
+		if _, ok := nodeMap[ancestor]; !ok {
+			// 父目录不可见时子节点作为根节点展示
+			continue
+		}
 		parentChildMap[ancestor] = append(parentChildMap[ancestor], descendant)
 	}
 
@@ -366,7 +533,7 @@ func (s *Server) buildFileTree() (map[string]interface{}, error) {
 }
 
 func (s *Server) handleDebugDrivelist(c *gin.Context) {
-	rows, err := s.DB.Query("SELECT id, name, capacity, created_at FROM drivelist ORDER BY id")
+	rows, err := s.DB.Query("SELECT id, name, capacity, created_at, COALESCE(owner_id, 0) FROM drivelist ORDER BY id")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -379,7 +546,8 @@ func (s *Server) handleDebugDrivelist(c *gin.Context) {
 		var name string
 		var capacity int64
 		var createdAt string
-		if err := rows.Scan(&id, &name, &capacity, &createdAt); err != nil {
+		var ownerID int64
+		if err := rows.Scan(&id, &name, &capacity, &createdAt, &ownerID); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -388,6 +556,7 @@ func (s *Server) handleDebugDrivelist(c *gin.Context) {
 			"name":       name,
 			"capacity":   capacity,
 			"created_at": createdAt,
+			"owner_id":   ownerID,
 		})
 	}
 	c.JSON(http.StatusOK, gin.H{"count": len(items), "items": items})
@@ -480,56 +649,33 @@ func (s *Server) handleDelete(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing 'name' query parameter"})
 		return
 	}
-
-	// 开始事务
-	tx, err := s.DB.Begin()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+	name, err := cleanRelPath(name)
+	if err != nil || name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid name"})
 		return
 	}
 
-	// 查询文件的 ID
-	var fileID int64
-	err = tx.QueryRow("SELECT id FROM drivelist WHERE name=$1", name).Scan(&fileID)
-	if err != nil {
-		tx.Rollback()
-		if err == sql.ErrNoRows {
-			c.JSON(http.StatusNotFound, gin.H{"error": "File not found in database"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query file: " + err.Error()})
+	// 默认移入回收站，permanent=true 时彻底删除
+	permanent := c.Query("permanent") == "true"
+	d := s.driveFor(c)
+	if err := s.authorize(c, d, name, PermDelete); err != nil {
+		respondError(c, err)
 		return
 	}
-
-	// 删除数据库中的记录（CASCADE 会自动删除 drivelist_closure 中的相关记录）
-	result, err := tx.Exec("DELETE FROM drivelist WHERE id=$1", fileID)
+	trashID, err := s.trashPath(d, name, permanent, actorOf(c))
 	if err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete record: " + err.Error()})
-		return
-	}
-
-	// 提交事务
-	if err := tx.Commit(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		respondError(c, err)
 		return
 	}
 
-	// 删除文件对象
-	filePath := filepath.Join(s.uploadDir, name)
-	if err := os.Remove(filePath); err != nil {
-		// 文件系统删除失败，但数据库已删除
-		c.JSON(http.StatusOK, gin.H{
-			"message": "Database record deleted, but file removal failed: " + err.Error(),
-			"warning": true,
-		})
+	if permanent {
+		c.JSON(http.StatusOK, gin.H{"message": "File and record deleted permanently", "path": name})
 		return
 	}
-
-	rowsAffected, _ := result.RowsAffected()
 	c.JSON(http.StatusOK, gin.H{
-		"message":       "File and record deleted successfully",
-		"rows_affected": rowsAffected,
+		"message":  "File moved to trash",
+		"path":     name,
+		"trash_id": trashID,
 	})
 }
 
@@ -541,179 +687,66 @@ func (s *Server) handleDeleteDir(c *gin.Context) {
 	}
 
 	// 安全检查：防止路径穿越
-	if strings.Contains(dirname, "..") || strings.HasPrefix(dirname, "/") || strings.HasPrefix(dirname, "\\") {
+	cleanName, err := cleanRelPath(dirname)
+	if err != nil || cleanName == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dirname"})
 		return
 	}
-	cleanName := filepath.Clean(dirname)
-
-	dirPath := filepath.Join(s.uploadDir, cleanName)
 
 	// 检查目录是否存在
-	if _, err := os.Stat(dirPath); os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Directory not found"})
+	d := s.driveFor(c)
+	if err := s.authorize(c, d, cleanName, PermDelete); err != nil {
+		respondError(c, err)
 		return
 	}
-
-	// 开始数据库事务
-	tx, err := s.DB.Begin()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+	dirPath := d.abs(cleanName)
+	if info, err := os.Stat(dirPath); os.IsNotExist(err) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Directory not found"})
 		return
-	}
-
-	// 首先获取该目录的 ID
-	var dirID int64
-	err = tx.QueryRow("SELECT id FROM drivelist WHERE name=$1", cleanName).Scan(&dirID)
-	if err != nil {
-		tx.Rollback()
-		if err == sql.ErrNoRows {
-			// 数据库中没有记录，但文件系统有目录，仍然删除文件系统
-			if err := os.RemoveAll(dirPath); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete directory: " + err.Error()})
-				return
-			}
-			c.JSON(http.StatusOK, gin.H{"message": "Directory deleted (no DB record found)"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query directory: " + err.Error()})
+	} else if err == nil && !info.IsDir() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Path is not a directory"})
 		return
 	}
 
-	// 删除该目录及其所有后代节点（利用闭包表）
-	// CASCADE 会自动删除 drivelist_closure 中的相关记录
-	_, err = tx.Exec(`
-        DELETE FROM drivelist
-        WHERE id IN (
-            SELECT descendant FROM drivelist_closure WHERE ancestor = $1
-        )
-    `, dirID)
-	// 删除
+	// 目录及其所有后代节点整体移入回收站（闭包结构一并快照）
+	permanent := c.Query("permanent") == "true"
+	trashID, err := s.trashPath(d, cleanName, permanent, actorOf(c))
 	if err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete DB records: " + err.Error()})
-		return
-	}
-
-	// 提交事务
-	if err := tx.Commit(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		respondError(c, err)
 		return
 	}
 
-	// 删除文件系统中的目录（在数据库操作成功后）
-	if err := os.RemoveAll(dirPath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB updated but failed to delete directory: " + err.Error()})
+	if permanent {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Directory and its contents deleted permanently",
+			"path":    cleanName,
+		})
 		return
 	}
-
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Directory and its contents deleted successfully",
-		"path":    cleanName,
+		"message":  "Directory and its contents moved to trash",
+		"path":     cleanName,
+		"trash_id": trashID,
 	})
 }
 
-func (s *Server) DownloadZip(c *gin.Context, dirPath string, zipName string) error {
-	// 创建临时 zip 文件
-	tmpZipPath := filepath.Join(os.TempDir(), fmt.Sprintf("download_%s.zip", zipName))
-
-	// 创建 zip 文件
-	zipFile, err := os.Create(tmpZipPath)
-	if err != nil {
-		return fmt.Errorf("failed to create zip file: %v", err)
-	}
-	defer zipFile.Close()
-	defer os.Remove(tmpZipPath) // 发送完后删除临时文件
-
-	zipWriter := zip.NewWriter(zipFile)
-
-	// 递归添加目录中的所有文件到 zip
-	err = s.addFilesToZip(zipWriter, dirPath, "")
-	if err != nil {
-		zipWriter.Close()
-		return fmt.Errorf("failed to add files to zip: %v", err)
-	}
-
-	// 关闭 zip writer
-	if err := zipWriter.Close(); err != nil {
-		return fmt.Errorf("failed to close zip: %v", err)
-	}
-
-	// 重新打开文件用于发送
-	zipFile.Close()
-
-	// 发送 zip 文件
-	c.FileAttachment(tmpZipPath, zipName+".zip")
-	return nil
-}
-
-// addFilesToZip 递归地将目录中的文件添加到 zip
-func (s *Server) addFilesToZip(zipWriter *zip.Writer, sourcePath string, baseInZip string) error {
-	// 读取目录内容
-	entries, err := os.ReadDir(sourcePath)
-	if err != nil {
-		return err
-	}
-
-	for _, entry := range entries {
-		fullPath := filepath.Join(sourcePath, entry.Name())
-		zipPath := filepath.Join(baseInZip, entry.Name())
-
-		// 将路径转换为正斜杠(zip 标准)
-		zipPath = filepath.ToSlash(zipPath)
-
-		if entry.IsDir() {
-			// 递归处理子目录
-			if err := s.addFilesToZip(zipWriter, fullPath, zipPath); err != nil {
-				return err
-			}
-		} else {
-			// 添加文件到 zip
-			if err := s.addFileToZip(zipWriter, fullPath, zipPath); err != nil {
-				return err
-			}
-		}
-	}
-
-	return nil
-}
-
-// addFileToZip 添加单个文件到 zip
-func (s *Server) addFileToZip(zipWriter *zip.Writer, filePath string, nameInZip string) error {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	fileInfo, err := file.Stat()
-	if err != nil {
-		return err
-	}
-
-	header, err := zip.FileInfoHeader(fileInfo)
-	if err != nil {
-		return err
-	}
-	header.Name = nameInZip
-	header.Method = zip.Deflate
-
-	writer, err := zipWriter.CreateHeader(header)
-	if err != nil {
-		return err
-	}
-
-	_, err = io.Copy(writer, file)
-	return err
-}
-
 func (s *Server) handleDownload(c *gin.Context) {
 	name := c.Query("name")
 	if name == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing 'name' query parameter"})
 		return
 	}
-	filePath := filepath.Join(s.uploadDir, name)
+	name, err := cleanRelPath(name)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	d := s.driveFor(c)
+	if err := s.authorize(c, d, name, PermRead); err != nil {
+		respondError(c, err)
+		return
+	}
+	filePath := d.abs(name)
 	// 使用 ReadFileTree 读取文件树结构并返回
 	fileTree, err := shared.ReadFileTree(filePath)
 	if err != nil {
@@ -721,15 +754,21 @@ func (s *Server) handleDownload(c *gin.Context) {
 		return
 	}
 	if fileTree.IsDir {
-		// 压缩文件夹，并返回下载
-		if err := s.DownloadZip(c, filePath, filepath.Base(name)); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to download zip: " + err.Error()})
+		// 打包文件夹，并返回下载
+		format, err := downloadFormat(c)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if err := s.DownloadArchive(c, filePath, filepath.Base(name), format); err != nil {
+			respondArchiveError(c, err)
 			return
 		}
 	} else {
 		// 返回文件内容
 		c.FileAttachment(filePath, filepath.Base(name))
 	}
+	s.recordDownload(c, d, name)
 }
 
 func (s *Server) handleDownloadDir(c *gin.Context) {
@@ -739,7 +778,22 @@ func (s *Server) handleDownloadDir(c *gin.Context) {
 		return
 	}
 
-	dirPath := filepath.Join(s.uploadDir, dirname)
+	dirname, err := cleanRelPath(dirname)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	d := s.driveFor(c)
+	if err := s.authorize(c, d, dirname, PermRead); err != nil {
+		respondError(c, err)
+		return
+	}
+	format, err := downloadFormat(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	dirPath := d.abs(dirname)
 
 	// 检查目录是否存在
 	fileInfo, err := os.Stat(dirPath)
@@ -757,11 +811,12 @@ func (s *Server) handleDownloadDir(c *gin.Context) {
 		return
 	}
 
-	// 压缩目录并返回
-	if err := s.DownloadZip(c, dirPath, dirname); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create zip: " + err.Error()})
+	// 打包目录并以流的形式返回
+	if err := s.DownloadArchive(c, dirPath, filepath.Base(dirname), format); err != nil {
+		respondArchiveError(c, err)
 		return
 	}
+	s.recordDownload(c, d, dirname)
 }
 
 func (s *Server) handleCreateDir(c *gin.Context) {
@@ -778,60 +833,23 @@ func (s *Server) handleCreateDir(c *gin.Context) {
 	}
 
 	// 清理路径
-	path = filepath.Clean(path)
-
-	// 在文件系统中创建实际目录
-	fullPath := filepath.Join(s.uploadDir, path)
-	if err := os.MkdirAll(fullPath, os.ModePerm); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create directory on filesystem: " + err.Error()})
-		return
-	}
-
-	// 数据库操作：使用完整路径作为名称
-	// 1. 先检查路径是否已存在
-	var existingID int64
-	err := s.DB.QueryRow("SELECT id FROM drivelist WHERE name=$1", path).Scan(&existingID)
-	if err == nil {
-		c.JSON(http.StatusOK, gin.H{"message": "Directory already exists", "id": existingID})
+	path = filepath.ToSlash(filepath.Clean(path))
+	d := s.driveFor(c)
+	if err := s.authorize(c, d, path, PermWrite); err != nil {
+		respondError(c, err)
 		return
 	}
 
-	// 2. 插入目录节点（容量为0表示目录）
-	var newID int64
-	err = s.DB.QueryRow("INSERT INTO drivelist (name, capacity) VALUES ($1, 0) RETURNING id",
-		path).Scan(&newID)
+	newID, created, err := s.makeDir(d, path, actorOf(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create directory in database: " + err.Error()})
+		respondError(c, err)
 		return
 	}
-
-	// 3. 维护闭包表关系
-	// 插入自己到自己 (depth=0)
-	_, err = s.DB.Exec("INSERT INTO drivelist_closure (ancestor, descendant, depth) VALUES ($1, $1, 0)", newID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert closure: " + err.Error()})
+	if !created {
+		c.JSON(http.StatusOK, gin.H{"message": "Directory already exists", "id": newID})
 		return
 	}
 
-	// 4. 如果有父路径，建立父子关系
-	parentPath := filepath.Dir(path)
-	if parentPath != "." && parentPath != "/" && parentPath != "\\" {
-		var parentID int64
-		err = s.DB.QueryRow("SELECT id FROM drivelist WHERE name=$1", parentPath).Scan(&parentID)
-		if err == nil {
-			// 复制父节点的所有祖先关系
-			_, err = s.DB.Exec(`
-				INSERT INTO drivelist_closure (ancestor, descendant, depth)
-				SELECT ancestor, $1, depth + 1
-				FROM drivelist_closure
-				WHERE descendant = $2
-			`, newID, parentID)
-			if err != nil {
-				log.Printf("Warning: failed to link parent closure: %v", err)
-			}
-		}
-	}
-
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Directory created successfully",
 		"id":      newID,
@@ -839,6 +857,36 @@ func (s *Server) handleCreateDir(c *gin.Context) {
 	})
 }
 
+// makeDir 创建目录（磁盘与数据库），缺失的父目录一并创建；已存在时 created 为 false
+func (s *Server) makeDir(d *drive, path string, act actor) (id int64, created bool, err error) {
+	// 在文件系统中创建实际目录
+	if err := os.MkdirAll(d.abs(path), os.ModePerm); err != nil {
+		return 0, false, fmt.Errorf("failed to create directory on filesystem: %v", err)
+	}
+	// 数据库操作：使用完整路径作为名称，先检查路径是否已存在
+	if id, err := d.lookupNode(s.DB, path); err == nil {
+		return id, false, nil
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	// 插入目录节点（容量为0表示目录）并维护闭包表关系
+	if id, err = d.ensureDirNode(tx, path); err != nil {
+		return 0, false, fmt.Errorf("failed to create directory in database: %v", err)
+	}
+	if err := d.recordChange(tx, changeCreated, "mkdir", id, path, "", act); err != nil {
+		return 0, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, false, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	s.notifyChange(d)
+	return id, true, nil
+}
+
 func (s *Server) handleRename(c *gin.Context) {
 	// 首先修改文件名字
 	oldName := c.Query("oldName")
@@ -847,28 +895,63 @@ func (s *Server) handleRename(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing 'oldName' or 'newName' query parameter"})
 		return
 	}
-	oldPath := filepath.Join(s.uploadDir, oldName)
-	newPath := filepath.Join(s.uploadDir, newName)
-	if err := os.Rename(oldPath, newPath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename file: " + err.Error()})
+	oldName, err := cleanRelPath(oldName)
+	if err != nil {
+		respondError(c, err)
 		return
 	}
-	// 然后更新数据库记录
-	_, err := s.DB.Exec("UPDATE drivelist SET name=$1 WHERE name=$2", newName, oldName)
+	newName, err = cleanRelPath(newName)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update database record:" + err.Error()})
+		respondError(c, err)
 		return
 	}
-	// 对Closure Table不需要额外操作，因为文件ID未变，只有名称变更
-	c.JSON(http.StatusOK, gin.H{
-		"message":  "File renamed successfully",
-		"old_name": oldName,
-		"new_name": newName,
-	})
-}
-
-func (s *Server) handleMove(c *gin.Context) {
-	// 把文件从一个目录移动到另一个目录
+	policy, err := parseConflictPolicy(c.Query("onConflict"), ConflictFail)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	d := s.driveFor(c)
+	if err := s.authorize(c, d, oldName, PermDelete); err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := s.authorize(c, d, newName, PermWrite); err != nil {
+		respondError(c, err)
+		return
+	}
+	// 覆盖已有目标相当于删除它
+	if policy == ConflictOverwrite || policy == ConflictKeepNewer {
+		if _, err := d.lookupNode(s.DB, newName); err == nil {
+			if err := s.authorize(c, d, newName, PermDelete); err != nil {
+				respondError(c, err)
+				return
+			}
+		}
+	}
+	// 重命名与移动共用同一实现：冲突处理、后代路径、闭包表与配额都由 movePath 负责
+	outcome, err := s.movePath(d, oldName, newName, policy, actorOf(c), "rename")
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if !outcome.Proceed() {
+		c.JSON(http.StatusOK, gin.H{
+			"message":  "Rename skipped due to conflict policy",
+			"old_name": oldName,
+			"conflict": outcome,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "File renamed successfully",
+		"old_name": oldName,
+		"new_name": outcome.Path,
+		"conflict": outcome,
+	})
+}
+
+func (s *Server) handleMove(c *gin.Context) {
+	// 把文件从一个目录移动到另一个目录
 	// oldpath: 原文件/文件夹路径（如 "folder1/file.txt"）
 	// newpath: 新的父目录路径（如 "folder2"）
 	oldPath := c.Query("oldpath")
@@ -886,83 +969,140 @@ func (s *Server) handleMove(c *gin.Context) {
 	}
 
 	// 清理路径
-	oldPath = filepath.Clean(oldPath)
+	oldPath = filepath.ToSlash(filepath.Clean(oldPath))
 	if newParentPath != "" {
-		newParentPath = filepath.Clean(newParentPath)
+		newParentPath = filepath.ToSlash(filepath.Clean(newParentPath))
+	}
+
+	policy, err := parseConflictPolicy(c.Query("onConflict"), ConflictFail)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	d := s.driveFor(c)
+	// 移动需要源上的 delete 权限与目标目录上的 write 权限
+	if err := s.authorize(c, d, oldPath, PermDelete); err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := s.authorize(c, d, joinRel(newParentPath, filepath.Base(oldPath)), PermWrite); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	fileName := filepath.Base(oldPath)
+	outcome, err := s.movePath(d, oldPath, joinRel(newParentPath, fileName), policy, actorOf(c), "move")
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if !outcome.Proceed() {
+		c.JSON(http.StatusOK, gin.H{
+			"message":  "Move skipped due to conflict policy",
+			"old_path": oldPath,
+			"conflict": outcome,
+		})
+		return
 	}
 
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "File/folder moved successfully",
+		"old_path": oldPath,
+		"new_path": outcome.Path,
+		"conflict": outcome,
+	})
+}
+
+// movePath 把节点（及其子树）移动到 newPath：更新磁盘、路径、闭包表与目录配额，
+// action 为写入审计记录的操作名（move / rename）。按策略跳过时 outcome.Proceed() 为 false
+func (s *Server) movePath(d *drive, oldPath, newPath string, policy ConflictPolicy, act actor, action string) (conflictOutcome, error) {
 	// 开始数据库事务
 	tx, err := s.DB.Begin()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
-		return
+		return conflictOutcome{}, fmt.Errorf("failed to begin transaction: %v", err)
 	}
 	defer tx.Rollback() // 如果没有 commit，则回滚
 
 	// 1. 获取要移动的节点 ID
-	var nodeID int64
-	err = tx.QueryRow("SELECT id FROM drivelist WHERE name=$1", oldPath).Scan(&nodeID)
+	nodeID, err := d.lookupNode(tx, oldPath)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Source file/folder not found in database"})
-			return
+			return conflictOutcome{}, newAPIError(http.StatusNotFound, "Source file/folder not found in database")
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query source: " + err.Error()})
-		return
+		return conflictOutcome{}, fmt.Errorf("failed to query source: %v", err)
 	}
 
-	// 2. 构建新路径（保留文件名）
-	fileName := filepath.Base(oldPath)
-	var newPath string
+	// 2. 获取新父目录的 ID（0 表示根目录）
+	newParentPath := parentRel(newPath)
 	var newParentID int64
-
-	if newParentPath == "" || newParentPath == "." {
-		// 移动到根目录
-		newPath = fileName
-		newParentID = 0 // 标记为根目录
-	} else {
-		// 移动到指定目录
-		newPath = filepath.Join(newParentPath, fileName)
-
-		// 获取新父目录的 ID
-		err = tx.QueryRow("SELECT id FROM drivelist WHERE name=$1", newParentPath).Scan(&newParentID)
+	if newParentPath != "" {
+		newParentID, err = d.lookupNode(tx, newParentPath)
 		if err != nil {
 			if err == sql.ErrNoRows {
-				c.JSON(http.StatusNotFound, gin.H{"error": "Target parent directory not found"})
-				return
+				return conflictOutcome{}, newAPIError(http.StatusNotFound, "Target parent directory not found")
 			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query target parent: " + err.Error()})
-			return
+			return conflictOutcome{}, fmt.Errorf("failed to query target parent: %v", err)
 		}
 	}
 
-	// 3. 检查新路径是否已存在
-	var existingID int64
-	err = tx.QueryRow("SELECT id FROM drivelist WHERE name=$1", newPath).Scan(&existingID)
-	if err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "Target path already exists"})
-		return
-	} else if err != sql.ErrNoRows {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check target path: " + err.Error()})
-		return
+	// 3. 检查新路径是否已存在，按冲突策略处理（默认返回 409）
+	if newPath == oldPath {
+		return conflictOutcome{}, newAPIError(http.StatusBadRequest, "Source and target are the same")
+	}
+	if strings.HasPrefix(newPath, oldPath+"/") {
+		return conflictOutcome{}, newAPIError(http.StatusBadRequest, "Cannot move a directory into itself")
+	}
+	// 目标是源的上级目录时，覆盖会先删掉源本身
+	if strings.HasPrefix(oldPath, newPath+"/") {
+		return conflictOutcome{}, newAPIError(http.StatusBadRequest, "Cannot replace an ancestor of the source")
+	}
+	oldFullPath := d.abs(oldPath)
+	var srcMod time.Time
+	if info, err := os.Stat(oldFullPath); err == nil {
+		srcMod = info.ModTime()
+	}
+	outcome, err := d.resolveConflict(tx, newPath, policy, srcMod)
+	if err != nil {
+		return conflictOutcome{}, err
+	}
+	if !outcome.Proceed() {
+		return outcome, nil
 	}
+	newPath = outcome.Path
+	// 移入带配额的目录时检查目录配额（用户级用量不变）；必须在删除目标之前检查，
+	// 否则超额失败时被覆盖的目标已经从磁盘上删掉了
+	moveBytes, moveFiles, err := subtreeUsage(tx, nodeID)
+	if err != nil {
+		return conflictOutcome{}, fmt.Errorf("failed to query source usage: %v", err)
+	}
+	if err := s.checkWriteQuota(tx, d, outcome, quotaDelta{Bytes: moveBytes, Files: moveFiles, From: oldPath}); err != nil {
+		return conflictOutcome{}, err
+	}
+	// 覆盖时先把目标移入回收站（移动总是整体替换目标节点），失败时在源移回之后再放回原处
+	_, restore, err := d.clearForOverwrite(tx, &outcome, true)
+	if err != nil {
+		return conflictOutcome{}, err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			restore()
+		}
+	}()
 
 	// 4. 移动文件系统中的文件/文件夹
-	oldFullPath := filepath.Join(s.uploadDir, oldPath)
-	newFullPath := filepath.Join(s.uploadDir, newPath)
+	newFullPath := d.abs(newPath)
 
 	// 确保新父目录存在
-	if newParentPath != "" && newParentPath != "." {
-		newParentFullPath := filepath.Join(s.uploadDir, newParentPath)
+	if newParentPath != "" {
+		newParentFullPath := d.abs(newParentPath)
 		if err := os.MkdirAll(newParentFullPath, os.ModePerm); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create target directory: " + err.Error()})
-			return
+			return conflictOutcome{}, fmt.Errorf("failed to create target directory: %v", err)
 		}
 	}
 
 	if err := os.Rename(oldFullPath, newFullPath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move file: " + err.Error()})
-		return
+		return conflictOutcome{}, fmt.Errorf("failed to move file: %v", err)
 	}
 
 	// 5. 更新数据库中的路径
@@ -970,8 +1110,7 @@ func (s *Server) handleMove(c *gin.Context) {
 	if err != nil {
 		// 回滚文件系统操作
 		os.Rename(newFullPath, oldFullPath)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update database path: " + err.Error()})
-		return
+		return conflictOutcome{}, fmt.Errorf("failed to update database path: %v", err)
 	}
 
 	// 6. 更新闭包表关系
@@ -989,8 +1128,7 @@ func (s *Server) handleMove(c *gin.Context) {
 	if err != nil {
 		// 回滚文件系统操作
 		os.Rename(newFullPath, oldFullPath)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete old closure relations: " + err.Error()})
-		return
+		return conflictOutcome{}, fmt.Errorf("failed to delete old closure relations: %v", err)
 	}
 
 	// 6.2 如果有新父节点，建立新的祖先关系
@@ -1007,13 +1145,16 @@ func (s *Server) handleMove(c *gin.Context) {
 		if err != nil {
 			// 回滚文件系统操作
 			os.Rename(newFullPath, oldFullPath)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create new closure relations: " + err.Error()})
-			return
+			return conflictOutcome{}, fmt.Errorf("failed to create new closure relations: %v", err)
 		}
 	}
 
 	// 7. 如果移动的是目录，需要更新其所有子节点的路径
-	// 获取所有后代节点
+	// 先读出所有后代节点（pq 不允许在同一事务中边遍历边写入）
+	type child struct {
+		id      int64
+		oldPath string
+	}
 	rows, err := tx.Query(`
 		SELECT d.id, d.name
 		FROM drivelist d
@@ -1023,66 +1164,296 @@ func (s *Server) handleMove(c *gin.Context) {
 	`, nodeID)
 	if err != nil {
 		os.Rename(newFullPath, oldFullPath)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query descendants: " + err.Error()})
-		return
+		return conflictOutcome{}, fmt.Errorf("failed to query descendants: %v", err)
 	}
-	defer rows.Close()
-
-	// 更新每个子节点的路径
+	var children []child
 	for rows.Next() {
-		var childID int64
-		var childOldPath string
-		if err := rows.Scan(&childID, &childOldPath); err != nil {
+		var ch child
+		if err := rows.Scan(&ch.id, &ch.oldPath); err != nil {
+			rows.Close()
 			os.Rename(newFullPath, oldFullPath)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan child: " + err.Error()})
-			return
+			return conflictOutcome{}, fmt.Errorf("failed to scan child: %v", err)
 		}
+		children = append(children, ch)
+	}
+	rows.Close()
 
-		// 计算新的子路径
-		relPath := strings.TrimPrefix(childOldPath, oldPath)
-		relPath = strings.TrimPrefix(relPath, string(filepath.Separator))
-		childNewPath := filepath.Join(newPath, relPath)
-
-		// 更新子节点路径
-		_, err = tx.Exec("UPDATE drivelist SET name=$1 WHERE id=$2", childNewPath, childID)
-		if err != nil {
+	// 更新每个子节点的路径
+	for _, ch := range children {
+		childNewPath := newPath + strings.TrimPrefix(ch.oldPath, oldPath)
+		if _, err := tx.Exec("UPDATE drivelist SET name=$1 WHERE id=$2", childNewPath, ch.id); err != nil {
 			os.Rename(newFullPath, oldFullPath)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update child path: " + err.Error()})
-			return
+			return conflictOutcome{}, fmt.Errorf("failed to update child path: %v", err)
 		}
 	}
 
+	// 目录配额跟随目录移动
+	if _, err := tx.Exec(`
+		UPDATE drive_quotas SET path = $1::text || substr(path, length($2::text) + 1)
+		WHERE owner_id = $3 AND (path = $2 OR left(path, length($2::text) + 1) = $2 || '/')
+	`, newPath, oldPath, d.OwnerID); err != nil {
+		os.Rename(newFullPath, oldFullPath)
+		return conflictOutcome{}, fmt.Errorf("failed to update folder quotas: %v", err)
+	}
+	if err := d.recordChange(tx, changeMoved, action, nodeID, newPath, oldPath, act); err != nil {
+		os.Rename(newFullPath, oldFullPath)
+		return conflictOutcome{}, err
+	}
+
 	// 8. 提交事务
 	if err := tx.Commit(); err != nil {
 		// 回滚文件系统操作
 		os.Rename(newFullPath, oldFullPath)
+		return conflictOutcome{}, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	committed = true
+	s.notifyChange(d)
+	return outcome, nil
+}
+
+func (s *Server) handleCopy(c *gin.Context) {
+	// 把文件/文件夹复制到另一个目录
+	// src: 原文件/文件夹路径（如 "folder1/file.txt"）
+	// newparent: 目标父目录路径（如 "folder2"），为空表示根目录
+	srcPath, err := cleanRelPath(c.Query("src"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if srcPath == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing 'src' query parameter"})
+		return
+	}
+	newParentPath, err := cleanRelPath(c.Query("newparent"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	policy, err := parseConflictPolicy(c.Query("onConflict"), ConflictFail)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	d := s.driveFor(c)
+
+	newPath := joinRel(newParentPath, filepath.Base(srcPath))
+	if err := s.authorize(c, d, srcPath, PermRead); err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := s.authorize(c, d, newPath, PermWrite); err != nil {
+		respondError(c, err)
+		return
+	}
+	if newPath == srcPath && (policy == ConflictOverwrite || policy == ConflictKeepNewer) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot overwrite the source with itself"})
+		return
+	}
+	if strings.HasPrefix(newPath, srcPath+"/") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot copy a directory into itself"})
+		return
+	}
+	// 目标是源的上级目录时，覆盖会先删掉源本身
+	if strings.HasPrefix(srcPath, newPath+"/") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot replace an ancestor of the source"})
+		return
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	srcID, err := d.lookupNode(tx, srcPath)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Source file/folder not found in database"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query source: " + err.Error()})
+		return
+	}
+	if newParentPath != "" {
+		if _, err := d.lookupNode(tx, newParentPath); err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Target parent directory not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query target parent: " + err.Error()})
+			return
+		}
+	}
+
+	srcFullPath := d.abs(srcPath)
+	srcInfo, err := os.Stat(srcFullPath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stat source: " + err.Error()})
+		return
+	}
+	outcome, err := d.resolveConflict(tx, newPath, policy, srcInfo.ModTime())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if !outcome.Proceed() {
+		c.JSON(http.StatusOK, gin.H{
+			"message":  "Copy skipped due to conflict policy",
+			"src":      srcPath,
+			"conflict": outcome,
+		})
+		return
+	}
+	newPath = outcome.Path
+
+	// 先读出源子树（pq 不允许在同一事务中边遍历边写入）
+	type copyItem struct {
+		name     string
+		capacity int64
+	}
+	rows, err := tx.Query(`
+		SELECT d.name, d.capacity
+		FROM drivelist d
+		JOIN drivelist_closure c ON d.id = c.descendant
+		WHERE c.ancestor = $1
+		ORDER BY c.depth, d.id
+	`, srcID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query source subtree: " + err.Error()})
+		return
+	}
+	var items []copyItem
+	for rows.Next() {
+		var it copyItem
+		if err := rows.Scan(&it.name, &it.capacity); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan source subtree: " + err.Error()})
+			return
+		}
+		items = append(items, it)
+	}
+	rows.Close()
+
+	var copyBytes, copyFiles int64
+	for _, it := range items {
+		copyBytes += it.capacity
+		if it.capacity > 0 {
+			copyFiles++
+		}
+	}
+	// 配额检查在删除被覆盖的目标之前进行，扣除目标原有的用量
+	if err := s.checkWriteQuota(tx, d, outcome, quotaDelta{Bytes: copyBytes, Files: copyFiles}); err != nil {
+		respondError(c, err)
+		return
+	}
+	// 被覆盖的目标移入回收站；失败时先删除副本再放回原处
+	_, restore, err := d.clearForOverwrite(tx, &outcome, true)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			restore()
+		}
+	}()
+
+	// 复制文件系统中的文件/文件夹
+	newFullPath := d.abs(newPath)
+	if err := copyPath(srcFullPath, newFullPath); err != nil {
+		os.RemoveAll(newFullPath)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to copy file: " + err.Error()})
+		return
+	}
+
+	// 按深度顺序插入副本节点，父目录总是先于子节点插入
+	for _, it := range items {
+		name := newPath + strings.TrimPrefix(it.name, srcPath)
+		if _, err := d.insertNode(tx, name, it.capacity); err != nil {
+			os.RemoveAll(newFullPath)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert copied record: " + err.Error()})
+			return
+		}
+	}
+
+	copyID, err := d.lookupNode(tx, newPath)
+	if err == nil {
+		err = d.recordChange(tx, outcomeChange(outcome), "copy", copyID, newPath, srcPath, actorOf(c))
+	}
+	if err != nil {
+		os.RemoveAll(newFullPath)
+		respondError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		os.RemoveAll(newFullPath)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
 		return
 	}
+	committed = true
+	s.notifyChange(d)
+	for _, it := range items {
+		if it.capacity > 0 {
+			s.enqueueFileJobs(d, newPath+strings.TrimPrefix(it.name, srcPath))
+		}
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message":  "File/folder moved successfully",
-		"old_path": oldPath,
+		"message":  "File/folder copied successfully",
+		"src":      srcPath,
 		"new_path": newPath,
+		"conflict": outcome,
 	})
 }
 
 func (s *Server) handleGetInfo(c *gin.Context) {
-	filename := c.Query("name")
-	filepath := filepath.Join(s.uploadDir, filename)
+	filename, err := cleanRelPath(c.Query("name"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	d := s.driveFor(c)
+	if err := s.authorize(c, d, filename, PermRead); err != nil {
+		respondError(c, err)
+		return
+	}
+	filepath := d.abs(filename)
 	info, err := os.Stat(filepath)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get file info: " + err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	resp := gin.H{
 		"name":         info.Name(),
 		"size":         info.Size(),
 		"mode":         info.Mode().String(),
 		"mod_time":     info.ModTime(),
 		"is_directory": info.IsDir(),
-	})
+	}
+	if nodeID, err := d.lookupNode(s.DB, filename); err == nil {
+		// 文件附带提取出的元数据；后台尚未处理时现场提取
+		if !info.IsDir() {
+			if meta, err := s.refreshMetadata(d, nodeID, filename); err == nil {
+				resp["metadata"] = meta
+			} else {
+				log.Printf("metadata %s: %v", filename, err)
+			}
+		}
+		if tags, err := s.nodeTags(nodeID); err == nil {
+			resp["tags"] = tags
+		}
+		if props, err := s.nodeProperties(nodeID); err == nil {
+			resp["properties"] = props
+		}
+		if starred, err := s.isFavorite(currentUser(c).ID, nodeID); err == nil {
+			resp["starred"] = starred
+		}
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 func (s *Server) handleBatchDelete(c *gin.Context) {
@@ -1093,22 +1464,6 @@ func (s *Server) handleBatchDownload(c *gin.Context) {
 	// TODO
 }
 
-func (s *Server) handleSearch(c *gin.Context) {
-	// TODO
-}
-
-func (s *Server) handleFilterByType(c *gin.Context) {
-	// TODO
-}
-
-func (s *Server) handleFilterByDate(c *gin.Context) {
-	// TODO
-}
-
-func (s *Server) handleFilterBySize(c *gin.Context) {
-	// TODO
-}
-
 func (s *Server) handleChunkUpload(c *gin.Context) {
 	// 接收分片上传参数
 	uploadId := c.PostForm("uploadId")
@@ -1117,17 +1472,33 @@ func (s *Server) handleChunkUpload(c *gin.Context) {
 	totalChunks, _ := strconv.Atoi(c.PostForm("totalChunks"))
 	chunkIndex, _ := strconv.Atoi(c.PostForm("chunkIndex"))
 	totalSize, _ := strconv.ParseInt(c.PostForm("totalSize"), 10, 64)
-	targetPath := c.PostForm("path") // 可选
-
-	if uploadId == "" || fileName == "" || totalChunks <= 0 || chunkIndex <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "missing upload metadata (uploadId,fileName,totalChunks,chunkIndex start from 1)"})
+	targetPath, err := cleanRelPath(c.PostForm("path")) // 可选
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	// 冲突策略：默认改名（保持旧行为，但使用 "name (1).ext" 编号）
+	policy, err := parseConflictPolicy(c.PostForm("onConflict"), ConflictRename)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	modTime, err := parseModTime(c.PostForm("modTime"))
+	if err != nil {
+		respondError(c, err)
 		return
 	}
 
-	// 保存分片到临时目录
-	tmpDir := filepath.Join(s.uploadDir, "_tmp", uploadId)
-	if err := os.MkdirAll(tmpDir, os.ModePerm); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create tmp dir: " + err.Error()})
+	if uploadId == "" || fileName == "" || totalChunks <= 0 || chunkIndex <= 0 || chunkIndex > totalChunks || totalSize <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing upload metadata (uploadId,fileName,totalSize,totalChunks,chunkIndex start from 1)"})
+		return
+	}
+	if err := checkUploadID(uploadId); err != nil {
+		respondError(c, err)
+		return
+	}
+	if fileName, err = cleanFileName(fileName); err != nil {
+		respondError(c, err)
 		return
 	}
 
@@ -1136,17 +1507,39 @@ func (s *Server) handleChunkUpload(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "chunk not provided: " + err.Error()})
 		return
 	}
-
-	dst := filepath.Join(tmpDir, fmt.Sprintf("%06d.part", chunkIndex))
-	if err := c.SaveUploadedFile(fileHeader, dst); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save chunk: " + err.Error()})
+	// 预签名上传：声明的总大小与单个分片都不能超过签名中的上限
+	scope := presignedScope(c)
+	if err := scope.checkSize(max(totalSize, fileHeader.Size)); err != nil {
+		respondError(c, err)
 		return
 	}
 
-	// 初始化/更新会话
+	// 先确认会话归属与写权限，再写磁盘
+	owner := currentUser(c).ID
 	sessionsMu.Lock()
 	sess, ok := uploadSessions[uploadId]
+	if ok && sess.OwnerID != owner {
+		sessionsMu.Unlock()
+		c.JSON(http.StatusForbidden, gin.H{"error": "upload session belongs to another user"})
+		return
+	}
+	if ok && scope != nil && (joinRel(sess.TargetPath, sess.FileName) != scope.Path || sess.DriveOwner != scope.Owner) {
+		sessionsMu.Unlock()
+		c.JSON(http.StatusForbidden, gin.H{"error": "upload session does not match the presigned path"})
+		return
+	}
 	if !ok {
+		// 新会话：检查目标目录的写权限，并按声明的 totalSize 提前检查配额
+		d := s.driveFor(c)
+		err := s.authorize(c, d, joinRel(targetPath, fileName), PermWrite)
+		if err == nil {
+			err = s.precheckUploadQuota(d, joinRel(targetPath, fileName), totalSize, policy)
+		}
+		if err != nil {
+			sessionsMu.Unlock()
+			respondError(c, err)
+			return
+		}
 		sess = &uploadSession{
 			UploadID:    uploadId,
 			FileName:    fileName,
@@ -1154,8 +1547,13 @@ func (s *Server) handleChunkUpload(c *gin.Context) {
 			TotalChunks: totalChunks,
 			Received:    map[int]bool{},
 			TotalSize:   totalSize,
-			TargetPath:  filepath.Clean(targetPath),
+			TargetPath:  targetPath,
 			Status:      "uploading",
+			OnConflict:  policy,
+			ModTime:     modTime,
+			Actor:       actorOf(c),
+			OwnerID:     owner,
+			DriveOwner:  d.OwnerID,
 			CreatedAt:   time.Now(),
 		}
 		uploadSessions[uploadId] = sess
@@ -1165,15 +1563,51 @@ func (s *Server) handleChunkUpload(c *gin.Context) {
 			sess.TotalChunks = totalChunks
 		}
 	}
+	sessChunks := sess.TotalChunks
 	sessionsMu.Unlock()
+	// 分片序号以会话创建时的 totalChunks 为准，超出的分片不会被合并
+	if chunkIndex > sessChunks {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("chunkIndex must be between 1 and %d", sessChunks)})
+		return
+	}
 
+	// 保存分片到临时目录；暂存的分片合并前不计入配额，累计大小不能超过声明的 totalSize
+	tmpDir := filepath.Join(s.uploadDir, "_tmp", uploadId)
+	if err := os.MkdirAll(tmpDir, os.ModePerm); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create tmp dir: " + err.Error()})
+		return
+	}
+	dst := filepath.Join(tmpDir, fmt.Sprintf("%06d.part", chunkIndex))
 	sess.mu.Lock()
-	if _, seen := sess.Received[chunkIndex]; !seen {
-		sess.Received[chunkIndex] = true
-		if fileHeader != nil && fileHeader.Size > 0 {
-			sess.ReceivedSize += fileHeader.Size
+	var oldSize int64
+	if sess.Received[chunkIndex] {
+		// 重传的分片替换原来的内容
+		if info, err := os.Stat(dst); err == nil {
+			oldSize = info.Size()
+		}
+	}
+	staged := sess.ReceivedSize - oldSize + fileHeader.Size
+	err = scope.checkSize(staged)
+	if err == nil && staged > sess.TotalSize {
+		err = newAPIError(http.StatusRequestEntityTooLarge, "Chunks exceed the declared totalSize of %d bytes", sess.TotalSize)
+	}
+	if err == nil {
+		err = c.SaveUploadedFile(fileHeader, dst)
+		if err != nil {
+			// 原来的分片可能已被部分覆盖，需要重传
+			os.Remove(dst)
+			delete(sess.Received, chunkIndex)
+			sess.ReceivedSize -= oldSize
+			err = fmt.Errorf("failed to save chunk: %w", err)
 		}
 	}
+	if err != nil {
+		sess.mu.Unlock()
+		respondError(c, err)
+		return
+	}
+	sess.Received[chunkIndex] = true
+	sess.ReceivedSize = staged
 	receivedCount := len(sess.Received)
 	total := sess.TotalChunks
 	sess.mu.Unlock()
@@ -1181,17 +1615,23 @@ func (s *Server) handleChunkUpload(c *gin.Context) {
 	// 若所有分片到齐，则合并
 	if receivedCount >= total {
 		if err := s.mergeChunks(uploadId, sess); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "merge failed: " + err.Error()})
+			respondError(c, fmt.Errorf("merge failed: %w", err))
 			return
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	sess.mu.Lock()
+	resp := gin.H{
 		"uploadId":      uploadId,
 		"receivedCount": receivedCount,
 		"totalChunks":   total,
 		"status":        sess.Status,
-	})
+	}
+	if sess.Outcome != nil {
+		resp["conflict"] = sess.Outcome
+	}
+	sess.mu.Unlock()
+	c.JSON(http.StatusOK, resp)
 }
 
 // mergeChunks 合并所有分片文件
@@ -1206,6 +1646,7 @@ func (s *Server) mergeChunks(uploadId string, sess *uploadSession) error {
 	sess.mu.Unlock()
 
 	tmpDir := filepath.Join(s.uploadDir, "_tmp", uploadId)
+	d := s.driveOf(sess.DriveOwner)
 	mergedTmp := filepath.Join(tmpDir, "merged.part")
 	out, err := os.Create(mergedTmp)
 	if err != nil {
@@ -1264,105 +1705,20 @@ func (s *Server) mergeChunks(uploadId string, sess *uploadSession) error {
 		}
 	}
 
-	// 移动到最终存储路径
-	finalDir := s.uploadDir
-	if sess.TargetPath != "" && sess.TargetPath != "." {
-		finalDir = filepath.Join(s.uploadDir, sess.TargetPath)
-	}
-	if err := os.MkdirAll(finalDir, os.ModePerm); err != nil {
-		sess.mu.Lock()
-		sess.Status = "error"
-		sess.mu.Unlock()
-		return fmt.Errorf("mkdir final dir failed: %v", err)
-	}
-	finalPath := filepath.Join(finalDir, sess.FileName)
-
-	// 如果目标文件已存在，添加时间戳后缀
-	if _, err := os.Stat(finalPath); err == nil {
-		finalPath = filepath.Join(finalDir, fmt.Sprintf("%d_%s", time.Now().Unix(), sess.FileName))
-	}
-
-	if err := os.Rename(mergedTmp, finalPath); err != nil {
-		sess.mu.Lock()
-		sess.Status = "error"
-		sess.mu.Unlock()
-		return fmt.Errorf("move merged to final failed: %v", err)
-	}
-
-	// 写数据库元数据
-	relName := sess.FileName
-	if sess.TargetPath != "" && sess.TargetPath != "." {
-		relName = filepath.ToSlash(filepath.Join(sess.TargetPath, sess.FileName))
-	}
-
-	// 确保父目录在数据库中存在（如果有父目录的话）
-	var parentID int64
-	hasParent := false
-	if sess.TargetPath != "" && sess.TargetPath != "." {
-		parentPath := filepath.ToSlash(sess.TargetPath)
-		err := s.DB.QueryRow("SELECT id FROM drivelist WHERE name=$1", parentPath).Scan(&parentID)
-		if err == sql.ErrNoRows {
-			// 父目录不存在，创建它（容量为0表示目录）
-			err = s.DB.QueryRow("INSERT INTO drivelist (name, capacity) VALUES ($1, 0) RETURNING id", parentPath).Scan(&parentID)
-			if err != nil {
-				log.Printf("warning: failed to create parent directory record: %v", err)
-			} else {
-				// 插入父目录的自引用闭包
-				if _, err := s.DB.Exec("INSERT INTO drivelist_closure (ancestor, descendant, depth) VALUES ($1, $1, 0)", parentID); err != nil {
-					log.Printf("warning: failed to insert parent closure self: %v", err)
-				}
-				hasParent = true
-			}
-		} else if err == nil {
-			hasParent = true
-		}
-	}
-
-	var existingID int64
-	err = s.DB.QueryRow("SELECT id FROM drivelist WHERE name=$1", relName).Scan(&existingID)
+	// 按冲突策略放入最终存储路径（默认改名为 "name (1).ext"）
+	outcome, _, err := s.storeFile(d, joinRel(sess.TargetPath, sess.FileName), mergedTmp, sess.OnConflict, sess.ModTime, sess.Actor, sess.FileHash)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			// 插入新记录
-			var newID int64
-			fi, _ := os.Stat(finalPath)
-			var cap int64
-			if fi != nil {
-				cap = fi.Size()
-			}
-			err = s.DB.QueryRow("INSERT INTO drivelist (name, capacity) VALUES ($1, $2) RETURNING id", relName, cap).Scan(&newID)
-			if err != nil {
-				return fmt.Errorf("insert drivelist failed: %v", err)
-			}
-			// 插入闭包表自己->自己
-			if _, err := s.DB.Exec("INSERT INTO drivelist_closure (ancestor, descendant, depth) VALUES ($1, $1, 0)", newID); err != nil {
-				log.Printf("warning: insert closure self failed: %v", err)
-			}
-			// 如果有父目录，建立闭包关系
-			if hasParent {
-				_, err = s.DB.Exec(`
-					INSERT INTO drivelist_closure (ancestor, descendant, depth)
-					SELECT ancestor, $1, depth + 1
-					FROM drivelist_closure
-					WHERE descendant = $2
-				`, newID, parentID)
-				if err != nil {
-					log.Printf("warning: failed to link file to parent closure: %v", err)
-				}
-			}
-		} else {
-			return fmt.Errorf("query existing drivelist failed: %v", err)
-		}
-	} else {
-		// 已存在则更新容量
-		fi, _ := os.Stat(finalPath)
-		var cap int64
-		if fi != nil {
-			cap = fi.Size()
-		}
-		if _, err := s.DB.Exec("UPDATE drivelist SET capacity=$1 WHERE id=$2", cap, existingID); err != nil {
-			log.Printf("warning: update capacity failed: %v", err)
+		// 冲突、配额等确定性失败重试也不会成功，直接清理分片
+		var apiErr *apiError
+		if errors.As(err, &apiErr) {
+			_ = os.RemoveAll(tmpDir)
 		}
+		sess.setStatus("error")
+		return err
 	}
+	sess.mu.Lock()
+	sess.Outcome = &outcome
+	sess.mu.Unlock()
 
 	// 删除临时分片目录
 	_ = os.RemoveAll(tmpDir)
@@ -1379,37 +1735,184 @@ func (s *Server) mergeChunks(uploadId string, sess *uploadSession) error {
 	return nil
 }
 
+// storeFile 把磁盘上已写好的文件 src 按冲突策略放入命名空间的 rel 处：
+// 检查配额、归档被覆盖的旧内容、移动文件、写入元数据并记录新版本。
+// 按策略跳过时 outcome.Proceed() 为 false，src 保持不动
+func (s *Server) storeFile(d *drive, rel, src string, policy ConflictPolicy, modTime time.Time, act actor, hash string) (conflictOutcome, int, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return conflictOutcome{}, 0, fmt.Errorf("begin transaction failed: %v", err)
+	}
+	defer tx.Rollback()
+
+	outcome, err := d.resolveConflict(tx, rel, policy, modTime)
+	if err != nil || !outcome.Proceed() {
+		return outcome, 0, err
+	}
+	relName := outcome.Path
+
+	// 按实际大小检查配额
+	var size int64
+	if fi, err := os.Stat(src); err == nil {
+		size = fi.Size()
+	}
+	if err := s.checkWriteQuota(tx, d, outcome, quotaDelta{Bytes: size, Files: 1}); err != nil {
+		return outcome, 0, err
+	}
+
+	// 移动到最终存储路径
+	finalPath := d.abs(relName)
+	if err := os.MkdirAll(filepath.Dir(finalPath), os.ModePerm); err != nil {
+		return outcome, 0, fmt.Errorf("mkdir final dir failed: %v", err)
+	}
+	reinsert, undo, err := d.clearForOverwrite(tx, &outcome, false)
+	if err != nil {
+		return outcome, 0, err
+	}
+	// 覆盖已有文件前先把旧内容归档为历史版本
+	nodeID := outcome.ExistingID
+	if nodeID != 0 && !reinsert {
+		if undo, err = d.archiveCurrent(tx, nodeID, relName); err != nil {
+			return outcome, 0, err
+		}
+	}
+	if err := os.Rename(src, finalPath); err != nil {
+		undo()
+		return outcome, 0, fmt.Errorf("move file to final path failed: %v", err)
+	}
+	if reinsert {
+		// 旧节点在回收站中，撤销时先移走新文件才能把它放回
+		restore := undo
+		undo = func() {
+			os.Remove(finalPath)
+			restore()
+		}
+	}
+	if !modTime.IsZero() {
+		_ = os.Chtimes(finalPath, modTime, modTime)
+	}
+
+	// 写数据库元数据：覆盖则更新容量，否则插入新记录（父目录不存在时一并创建）
+	if nodeID != 0 && !reinsert {
+		if _, err := tx.Exec("UPDATE drivelist SET capacity=$1 WHERE id=$2", size, nodeID); err != nil {
+			undo()
+			return outcome, 0, fmt.Errorf("update capacity failed: %v", err)
+		}
+	} else {
+		if _, err := d.ensureDirNode(tx, parentRel(relName)); err != nil {
+			undo()
+			return outcome, 0, fmt.Errorf("create parent directory record failed: %v", err)
+		}
+		if nodeID, err = d.insertNode(tx, relName, size); err != nil {
+			undo()
+			return outcome, 0, err
+		}
+	}
+	version, err := d.recordVersion(tx, nodeID, relName, act.Name, hash)
+	if err != nil {
+		undo()
+		return outcome, 0, err
+	}
+	if err := d.recordChange(tx, outcomeChange(outcome), "upload", nodeID, relName, "", act); err != nil {
+		undo()
+		return outcome, 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		undo()
+		return outcome, 0, fmt.Errorf("commit transaction failed: %v", err)
+	}
+	s.notifyChange(d)
+	s.enqueueFileJobs(d, relName)
+	return outcome, version, nil
+}
+
 func (s *Server) handleQuickUpload(c *gin.Context) {
 	// 秒传：检查文件哈希是否已存在
 	fileHash := c.PostForm("fileHash")
 	fileName := c.PostForm("fileName")
-	targetPath := c.PostForm("path")
 	totalSize, _ := strconv.ParseInt(c.PostForm("totalSize"), 10, 64)
 
 	if fileHash == "" || fileName == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "missing fileHash or fileName"})
 		return
 	}
+	fileName, err := cleanFileName(fileName)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	targetPath, err := cleanRelPath(c.PostForm("path"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	// 未显式指定 onConflict 时，同名且内容相同（或旧文件没有哈希）即视为秒传成功，否则按 rename 处理
+	rawPolicy := c.PostForm("onConflict")
+	policy, err := parseConflictPolicy(rawPolicy, ConflictRename)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	modTime, err := parseModTime(c.PostForm("modTime"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	d := s.driveFor(c)
+	if err := s.authorize(c, d, joinRel(targetPath, fileName), PermWrite); err != nil {
+		respondError(c, err)
+		return
+	}
 
-	// 注意：当前 drivelist 表没有 file_hash 字段
-	// 这里简化实现：通过文件名匹配（生产环境应添加 file_hash 字段）
+	// 目标路径已有文件时比较 file_hash：内容相同即秒传成功。
+	// 启用版本功能前写入的文件没有哈希，未指定 onConflict 时沿用旧行为按同名处理
 	var existingID int64
-	var existingName string
-	err := s.DB.QueryRow("SELECT id, name FROM drivelist WHERE name=$1", fileName).Scan(&existingID, &existingName)
-
+	var existingHash string
+	err = s.DB.QueryRow("SELECT id, COALESCE(file_hash, '') FROM drivelist WHERE owner_id=$1 AND name=$2",
+		d.OwnerID, joinRel(targetPath, fileName)).Scan(&existingID, &existingHash)
 	if err == nil {
-		// 找到相同文件名，返回秒传成功
-		c.JSON(http.StatusOK, gin.H{
-			"message":     "quick upload success (file exists)",
-			"existing_id": existingID,
-			"needUpload":  false,
-		})
+		if strings.EqualFold(existingHash, fileHash) || (existingHash == "" && rawPolicy == "") {
+			// 找到相同文件，返回秒传成功
+			c.JSON(http.StatusOK, gin.H{
+				"message":     "quick upload success (file exists)",
+				"existing_id": existingID,
+				"needUpload":  false,
+			})
+			return
+		}
+		// 提前按策略判断，避免上传完所有分片才发现冲突
+		outcome, err := d.resolveConflict(s.DB, joinRel(targetPath, fileName), policy, modTime)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if !outcome.Proceed() {
+			c.JSON(http.StatusOK, gin.H{
+				"message":     "upload skipped due to conflict policy",
+				"existing_id": existingID,
+				"needUpload":  false,
+				"conflict":    outcome,
+			})
+			return
+		}
+	}
+
+	// 文件不存在，需要上传；先按声明的大小检查配额，分块上传会话只接收声明大小以内的分片
+	if totalSize <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing totalSize"})
+		return
+	}
+	if err := s.precheckUploadQuota(d, joinRel(targetPath, fileName), totalSize, policy); err != nil {
+		respondError(c, err)
 		return
 	}
 
-	// 文件不存在，需要上传
 	// 生成 uploadId
-	uploadId := fmt.Sprintf("%d_%s", time.Now().UnixNano(), fileName)
+	uploadId, err := newUploadID("")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	// 创建临时目录
 	tmpDir := filepath.Join(s.uploadDir, "_tmp", uploadId)
@@ -1427,8 +1930,13 @@ func (s *Server) handleQuickUpload(c *gin.Context) {
 		TotalChunks: 0, // 将在第一个 chunk 请求时设置
 		Received:    map[int]bool{},
 		TotalSize:   totalSize,
-		TargetPath:  filepath.Clean(targetPath),
+		TargetPath:  targetPath,
 		Status:      "uploading",
+		OnConflict:  policy,
+		ModTime:     modTime,
+		Actor:       actorOf(c),
+		OwnerID:     currentUser(c).ID,
+		DriveOwner:  d.OwnerID,
 		CreatedAt:   time.Now(),
 	}
 	sessionsMu.Unlock()
@@ -1447,7 +1955,7 @@ func (s *Server) handleGetUploadProgress(c *gin.Context) {
 	sess, ok := uploadSessions[uploadId]
 	sessionsMu.Unlock()
 
-	if !ok {
+	if !ok || sess.OwnerID != currentUser(c).ID {
 		c.JSON(http.StatusNotFound, gin.H{"error": "uploadId not found"})
 		return
 	}
@@ -1483,47 +1991,136 @@ func (s *Server) handleGetUploadProgress(c *gin.Context) {
 func (s *Server) SetupDefaultRouter() {
 	r := gin.Default()
 
-	// 主要路由
+	// 公开路由
 	r.GET("/", s.handleIndex)
-	r.POST("/upload", s.handleUpload)
-	r.GET("/list", s.handleList)
-	r.DELETE("/delete", s.handleDelete)
-	r.DELETE("/deletedir", s.handleDeleteDir)
-	r.GET("/download", s.handleDownload)
-	r.GET("/downloaddir", s.handleDownloadDir)
-	r.POST("/createdir", s.handleCreateDir)
+	r.POST("/auth/register", s.handleRegister)
+	r.POST("/auth/login", s.handleLogin)
+	r.POST("/auth/logout", s.handleLogout)
+	// 公开分享链接（无需登录）
+	r.GET("/s/:token", s.handlePublicShare)
+	r.GET("/s/:token/download", s.handlePublicShareDownload)
+
+	// 以下路由需要登录，所有文件操作都限定在当前用户的命名空间内
+	api := r.Group("/", s.requireAuth(), s.resolveDrive())
+	api.GET("/auth/me", s.handleMe)
+	api.POST("/auth/tokens", s.handleCreateToken)
+	api.GET("/auth/tokens", s.handleListTokens)
+	api.DELETE("/auth/tokens/:id", s.handleDeleteToken)
+	api.POST("/auth/s3keys", s.handleCreateS3Key)
+	api.GET("/auth/s3keys", s.handleListS3Keys)
+	api.DELETE("/auth/s3keys/:key", s.handleDeleteS3Key)
+
+	// 主要路由
+	api.POST("/upload", s.handleUpload)
+	api.GET("/list", s.handleList)
+	api.DELETE("/delete", s.handleDelete)
+	api.DELETE("/deletedir", s.handleDeleteDir)
+	api.GET("/download", s.handleDownload)
+	api.GET("/downloaddir", s.handleDownloadDir)
+	api.POST("/createdir", s.handleCreateDir)
 
 	// 重命名文件/目录
-	r.PUT("/rename", s.handleRename)
+	api.PUT("/rename", s.handleRename)
 	// 移动文件/目录
-	r.PUT("/move", s.handleMove)
+	api.PUT("/move", s.handleMove)
+	// 复制文件/目录
+	api.POST("/copy", s.handleCopy)
 	// 获取文件/目录详细信息
-	r.GET("/info", s.handleGetInfo)
+	api.GET("/info", s.handleGetInfo)
+	// 缩略图与文本预览
+	api.GET("/thumbnail", s.handleThumbnail)
+	// 最近使用与目录动态
+	api.GET("/recent", s.handleRecent)
+	api.GET("/activity", s.handleActivity)
+	// 标签、收藏与自定义属性
+	api.GET("/tags", s.handleGetTags)
+	api.POST("/tags", s.handleAddTags)
+	api.PUT("/tags", s.handleRenameTag)
+	api.DELETE("/tags", s.handleRemoveTags)
+	api.GET("/favorites", s.handleListFavorites)
+	api.PUT("/favorites", s.handleAddFavorite)
+	api.DELETE("/favorites", s.handleRemoveFavorite)
+	api.GET("/properties", s.handleGetProperties)
+	api.PUT("/properties", s.handleSetProperties)
+	api.DELETE("/properties", s.handleDeleteProperty)
+	// 文件历史版本
+	api.GET("/versions", s.handleListVersions)
+	api.GET("/versions/download", s.handleDownloadVersion)
+	api.POST("/versions/restore", s.handleRestoreVersion)
+	// 回收站
+	api.GET("/trash", s.handleListTrash)
+	api.POST("/trash/restore", s.handleRestoreTrash)
+	api.DELETE("/trash", s.handleEmptyTrash)
+	// 访问控制（共享目录）
+	api.GET("/acl", s.handleGetACL)
+	api.POST("/acl", s.handleGrantACL)
+	api.DELETE("/acl", s.handleRevokeACL)
+	api.GET("/shared", s.handleSharedWithMe)
+	// 预签名 URL
+	api.POST("/presign", s.handlePresign)
+	// 分享链接管理
+	api.POST("/shares", s.handleCreateShare)
+	api.GET("/shares", s.handleListShares)
+	api.DELETE("/shares/:id", s.handleRevokeShare)
+	api.GET("/shares/:id/access", s.handleShareAccessLog)
+	// 配额与用量
+	api.GET("/quota", s.handleQuotaUsage)
+	api.PUT("/quota", s.handleSetQuota)
+	api.DELETE("/quota", s.handleDeleteQuota)
+	// 变更事件流（SSE / WebSocket，可按游标续传）
+	api.GET("/events", s.handleChangesSSE)
+	api.GET("/events/ws", s.handleChangesWS)
+	// 审计日志
+	api.GET("/audit", s.handleAuditLog)
+	api.GET("/audit/export", s.handleAuditExport)
+	// 出站 Webhook
+	api.POST("/webhooks", s.handleCreateWebhook)
+	api.GET("/webhooks", s.handleListWebhooks)
+	api.GET("/webhooks/dead", s.handleWebhookDeadLetters)
+	api.PUT("/webhooks/:id", s.handleUpdateWebhook)
+	api.DELETE("/webhooks/:id", s.handleDeleteWebhook)
+	api.GET("/webhooks/:id/deliveries", s.handleWebhookDeliveries)
+	api.POST("/webhooks/deliveries/:id/retry", s.handleRedeliver)
 	// 批量删除
-	r.DELETE("/batch-delete", s.handleBatchDelete)
+	api.DELETE("/batch-delete", s.handleBatchDelete)
 	// 批量下载（打包成zip）
-	r.POST("/batch-download", s.handleBatchDownload)
+	api.POST("/batch-download", s.handleBatchDownload)
 
 	// 搜索文件
-	r.GET("/search", s.handleSearch)
+	api.GET("/search", s.handleSearch)
 	// 按类型过滤（图片、视频、文档等）
-	r.GET("/filter/type", s.handleFilterByType)
+	api.GET("/filter/type", s.handleFilterByType)
 	// 按时间范围过滤
-	r.GET("/filter/date", s.handleFilterByDate)
+	api.GET("/filter/date", s.handleFilterByDate)
 	// 按大小过滤
-	r.GET("/filter/size", s.handleFilterBySize)
+	api.GET("/filter/size", s.handleFilterBySize)
 
 	// 断点续传
-	r.POST("/upload/chunk", s.handleChunkUpload)
+	api.POST("/upload/chunk", s.handleChunkUpload)
 	// 秒传（文件哈希检查）
-	r.POST("/upload/quick", s.handleQuickUpload)
+	api.POST("/upload/quick", s.handleQuickUpload)
 	// 获取上传进度
-	r.GET("/upload/progress/:uploadId", s.handleGetUploadProgress)
+	api.GET("/upload/progress/:uploadId", s.handleGetUploadProgress)
+	// 上传 zip 并在服务端解压导入（与 /upload/archive?format=zip 相同）
+	api.POST("/upload/zip", s.handleZipUpload)
+	// 上传 zip / tar / tar.gz / tar.zst 并在服务端批量解压导入
+	api.POST("/upload/archive", s.handleArchiveUpload)
+
+	// WebDAV（Basic 认证，挂载到文件管理器或办公软件）
+	dav := r.Group(davPrefix, davChallenge(), s.requireAuth())
+	for _, method := range davMethods {
+		dav.Handle(method, "/*path", s.handleWebDAV)
+	}
+
+	// S3 兼容网关（SigV4 认证）
+	s3 := r.Group("/s3", s.requireS3Auth())
+	s3.Any("/*path", s.handleS3)
 
-	// 调试路由
-	r.GET("/debug/drivelist", s.handleDebugDrivelist)
-	r.GET("/debug/closure", s.handleDebugClosure)
-	r.GET("/debug/subtree/:id", s.handleDebugSubtree)
+	// 调试路由（仅管理员）
+	debug := api.Group("/debug", s.requireAdmin())
+	debug.GET("/drivelist", s.handleDebugDrivelist)
+	debug.GET("/closure", s.handleDebugClosure)
+	debug.GET("/subtree/:id", s.handleDebugSubtree)
 
 	s.Ge = r
 }
@@ -1532,11 +2129,48 @@ func InitServer() *Server {
 	s := &Server{}
 	s.host = "localhost:8080"
 	s.uploadDir = "./uploads"
+	s.trashRetention = time.Duration(envInt("TRASH_RETENTION_DAYS", 30)) * 24 * time.Hour
+	s.changeRetention = time.Duration(envInt("CHANGE_RETENTION_DAYS", 7)) * 24 * time.Hour
+	s.changes = newChangeHub()
+	s.thumbs = newThumbnailer(s.uploadDir)
+	s.searchMaxText = envInt("SEARCH_MAX_TEXT_KB", 512) << 10
+	s.archiveLimits = shared.ExtractLimits{
+		MaxFiles: envInt("ARCHIVE_MAX_ENTRIES", 100000),
+		MaxBytes: int64(envInt("ARCHIVE_MAX_MB", 10240)) << 20,
+		MaxRatio: int64(envInt("ARCHIVE_MAX_RATIO", 200)),
+	}
+	s.versionRetention = versionRetention{
+		KeepLast: envInt("VERSION_KEEP_LAST", 10),
+		KeepDays: envInt("VERSION_KEEP_DAYS", 30),
+	}
+	s.jwtSecret = loadJWTSecret()
+	s.presignSecret = loadPresignSecret(s.jwtSecret)
+	s.sessionTTL = time.Duration(envInt("SESSION_TTL_HOURS", 24*7)) * time.Hour
+	s.allowRegistration = os.Getenv("ALLOW_REGISTRATION") != "false"
+	s.defaultQuota = quotaLimit{
+		MaxBytes: int64(envInt("USER_QUOTA_MB", 0)) << 20,
+		MaxFiles: int64(envInt("USER_QUOTA_FILES", 0)),
+	}
 	// 确保上传目录存在
 	if err := os.MkdirAll(s.uploadDir, os.ModePerm); err != nil {
 		log.Fatalf("Failed to create upload directory: %v", err)
 	}
 	s.SetupDefaultSql()
 	s.SetupDefaultRouter()
+	s.startTrashPurger(time.Hour)
+	s.startVersionPruner(time.Hour)
+	s.startLabelPruner(time.Hour)
+	s.startChangePruner(time.Hour)
+	s.startWebhookDispatcher()
+	s.startThumbnailWorkers(2)
+	s.startMetadataWorker(time.Hour)
 	return s
 }
+
+// envInt 读取整数环境变量，未设置或非法时返回默认值
+func envInt(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,435 @@
+package server
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 公开分享链接：不透明 token 指向一个节点（按 ID 关联，移动/重命名后依然有效），
+// 可设置密码、过期时间与最大下载次数；每次访问都会记录审计日志
+
+// ShareLink 分享链接
+type ShareLink struct {
+	ID            int64      `json:"id"`
+	Token         string     `json:"token"`
+	OwnerID       int64      `json:"owner_id"`
+	NodeID        int64      `json:"node_id"`
+	Path          string     `json:"path"`
+	IsDir         bool       `json:"is_dir"`
+	HasPassword   bool       `json:"has_password"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	MaxDownloads  *int       `json:"max_downloads,omitempty"`
+	DownloadCount int        `json:"download_count"`
+	CreatedBy     int64      `json:"created_by"`
+	CreatedAt     time.Time  `json:"created_at"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+
+	passwordHash string
+}
+
+func (s *Server) ensureShareTables() error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS share_links (
+			id SERIAL PRIMARY KEY,
+			token TEXT NOT NULL UNIQUE,
+			owner_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			node_id INTEGER NOT NULL REFERENCES drivelist(id) ON DELETE CASCADE,
+			password_hash TEXT,
+			expires_at TIMESTAMPTZ,
+			max_downloads INT,
+			download_count INT NOT NULL DEFAULT 0,
+			created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMPTZ DEFAULT now(),
+			revoked_at TIMESTAMPTZ
+		)`,
+		`CREATE TABLE IF NOT EXISTS share_link_access (
+			id SERIAL PRIMARY KEY,
+			link_id INTEGER NOT NULL REFERENCES share_links(id) ON DELETE CASCADE,
+			action TEXT NOT NULL,
+			path TEXT NOT NULL DEFAULT '',
+			client_ip TEXT NOT NULL DEFAULT '',
+			user_agent TEXT NOT NULL DEFAULT '',
+			accessed_at TIMESTAMPTZ DEFAULT now()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_share_access_link ON share_link_access(link_id)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := s.DB.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const shareLinkColumns = `
+	l.id, l.token, l.owner_id, l.node_id, n.name, n.capacity = 0, COALESCE(l.password_hash, ''),
+	l.expires_at, l.max_downloads, l.download_count, COALESCE(l.created_by, 0), l.created_at, l.revoked_at`
+
+func scanShareLink(row interface{ Scan(...any) error }) (*ShareLink, error) {
+	var l ShareLink
+	var expires, revoked sql.NullTime
+	var maxDownloads sql.NullInt64
+	if err := row.Scan(&l.ID, &l.Token, &l.OwnerID, &l.NodeID, &l.Path, &l.IsDir, &l.passwordHash,
+		&expires, &maxDownloads, &l.DownloadCount, &l.CreatedBy, &l.CreatedAt, &revoked); err != nil {
+		return nil, err
+	}
+	l.HasPassword = l.passwordHash != ""
+	if expires.Valid {
+		l.ExpiresAt = &expires.Time
+	}
+	if revoked.Valid {
+		l.RevokedAt = &revoked.Time
+	}
+	if maxDownloads.Valid {
+		n := int(maxDownloads.Int64)
+		l.MaxDownloads = &n
+	}
+	return &l, nil
+}
+
+// logShareAccess 记录一次分享链接访问
+func (s *Server) logShareAccess(c *gin.Context, linkID int64, action, path string) {
+	if _, err := s.DB.Exec("INSERT INTO share_link_access (link_id, action, path, client_ip, user_agent) VALUES ($1, $2, $3, $4, $5)",
+		linkID, action, path, c.ClientIP(), c.Request.UserAgent()); err != nil {
+		log.Printf("warning: failed to record share access: %v", err)
+	}
+}
+
+// handleCreateShare 创建分享链接：POST /shares，需要目标上的 share 权限
+func (s *Server) handleCreateShare(c *gin.Context) {
+	var req struct {
+		Path           string     `json:"path"`
+		Password       string     `json:"password"`
+		ExpiresAt      *time.Time `json:"expires_at"`
+		ExpiresInHours int        `json:"expires_in_hours"`
+		MaxDownloads   int        `json:"max_downloads"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	rel, err := cleanRelPath(req.Path)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if rel == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing 'path'"})
+		return
+	}
+	d := s.driveFor(c)
+	if err := s.authorize(c, d, rel, PermShare); err != nil {
+		respondError(c, err)
+		return
+	}
+	nodeID, err := d.lookupNode(s.DB, rel)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var expires sql.NullTime
+	switch {
+	case req.ExpiresAt != nil:
+		expires = sql.NullTime{Time: *req.ExpiresAt, Valid: true}
+	case req.ExpiresInHours > 0:
+		expires = sql.NullTime{Time: time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour), Valid: true}
+	}
+	if expires.Valid && !expires.Time.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expiry time must be in the future"})
+		return
+	}
+	var maxDownloads sql.NullInt64
+	if req.MaxDownloads > 0 {
+		maxDownloads = sql.NullInt64{Int64: int64(req.MaxDownloads), Valid: true}
+	}
+	var passwordHash sql.NullString
+	if req.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password: " + err.Error()})
+			return
+		}
+		passwordHash = sql.NullString{String: string(hash), Valid: true}
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	token := hex.EncodeToString(buf)
+
+	var id int64
+	err = s.withAudit(actorOf(c), d.OwnerID, "share_create", rel, gin.H{"has_password": passwordHash.Valid}, func(tx *sql.Tx) error {
+		return tx.QueryRow(`
+			INSERT INTO share_links (token, owner_id, node_id, password_hash, expires_at, max_downloads, created_by)
+			VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id
+		`, token, d.OwnerID, nodeID, passwordHash, expires, maxDownloads, currentUser(c).ID).Scan(&id)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create share link: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Share link created",
+		"id":      id,
+		"token":   token,
+		"url":     "/s/" + token,
+		"path":    rel,
+	})
+}
+
+// handleListShares 列出当前用户创建的、或指向自己命名空间的分享链接
+func (s *Server) handleListShares(c *gin.Context) {
+	uid := currentUser(c).ID
+	rows, err := s.DB.Query(`SELECT `+shareLinkColumns+`
+		FROM share_links l
+		JOIN drivelist n ON n.id = l.node_id
+		WHERE l.created_by = $1 OR l.owner_id = $1
+		ORDER BY l.created_at DESC
+	`, uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	links := []*ShareLink{}
+	for rows.Next() {
+		l, err := scanShareLink(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		links = append(links, l)
+	}
+	c.JSON(http.StatusOK, gin.H{"count": len(links), "items": links})
+}
+
+// ownedShare 读取当前用户可管理的分享链接（创建者或命名空间所有者）
+func (s *Server) ownedShare(c *gin.Context) (*ShareLink, error) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, newAPIError(http.StatusBadRequest, "Invalid share id")
+	}
+	uid := currentUser(c).ID
+	l, err := scanShareLink(s.DB.QueryRow(`SELECT `+shareLinkColumns+`
+		FROM share_links l
+		JOIN drivelist n ON n.id = l.node_id
+		WHERE l.id = $1 AND (l.created_by = $2 OR l.owner_id = $2)
+	`, id, uid))
+	if err == sql.ErrNoRows {
+		return nil, newAPIError(http.StatusNotFound, "Share link not found")
+	}
+	return l, err
+}
+
+// handleRevokeShare 撤销分享链接；记录保留用于审计
+func (s *Server) handleRevokeShare(c *gin.Context) {
+	l, err := s.ownedShare(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	err = s.withAudit(actorOf(c), l.OwnerID, "share_revoke", l.Path, gin.H{"share_id": l.ID}, func(tx *sql.Tx) error {
+		_, err := tx.Exec("UPDATE share_links SET revoked_at = now() WHERE id=$1 AND revoked_at IS NULL", l.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Share link revoked", "id": l.ID})
+}
+
+// handleShareAccessLog 查看分享链接的访问记录
+func (s *Server) handleShareAccessLog(c *gin.Context) {
+	l, err := s.ownedShare(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	rows, err := s.DB.Query(`
+		SELECT action, path, client_ip, user_agent, accessed_at
+		FROM share_link_access WHERE link_id = $1
+		ORDER BY accessed_at DESC, id DESC
+	`, l.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	items := []gin.H{}
+	for rows.Next() {
+		var action, path, ip, ua string
+		var at time.Time
+		if err := rows.Scan(&action, &path, &ip, &ua, &at); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		items = append(items, gin.H{"action": action, "path": path, "client_ip": ip, "user_agent": ua, "accessed_at": at})
+	}
+	c.JSON(http.StatusOK, gin.H{"link": l, "count": len(items), "items": items})
+}
+
+// openShare 校验公开访问的分享链接（撤销、过期、下载次数、密码），并解析子路径
+// 返回链接、命名空间以及目标在命名空间内的相对路径
+func (s *Server) openShare(c *gin.Context) (*ShareLink, *drive, string, error) {
+	l, err := scanShareLink(s.DB.QueryRow(`SELECT `+shareLinkColumns+`
+		FROM share_links l
+		JOIN drivelist n ON n.id = l.node_id
+		WHERE l.token = $1
+	`, c.Param("token")))
+	if err == sql.ErrNoRows {
+		return nil, nil, "", newAPIError(http.StatusNotFound, "Share link not found")
+	}
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if l.RevokedAt != nil {
+		s.logShareAccess(c, l.ID, "denied", "")
+		return nil, nil, "", newAPIError(http.StatusGone, "Share link has been revoked")
+	}
+	if l.ExpiresAt != nil && time.Now().After(*l.ExpiresAt) {
+		s.logShareAccess(c, l.ID, "denied", "")
+		return nil, nil, "", newAPIError(http.StatusGone, "Share link has expired")
+	}
+	if l.MaxDownloads != nil && l.DownloadCount >= *l.MaxDownloads {
+		s.logShareAccess(c, l.ID, "denied", "")
+		return nil, nil, "", newAPIError(http.StatusGone, "Share link download limit reached")
+	}
+	if l.HasPassword {
+		password := c.GetHeader("X-Share-Password")
+		if password == "" {
+			password = c.Query("password")
+		}
+		if bcrypt.CompareHashAndPassword([]byte(l.passwordHash), []byte(password)) != nil {
+			s.logShareAccess(c, l.ID, "denied", "")
+			return nil, nil, "", newAPIError(http.StatusUnauthorized, "Password required or incorrect")
+		}
+	}
+
+	// 目录分享允许通过 path 参数浏览/下载子项，但不能越出分享根
+	sub, err := cleanRelPath(c.Query("path"))
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if sub != "" && !l.IsDir {
+		return nil, nil, "", newAPIError(http.StatusBadRequest, "Shared item is a file")
+	}
+	return l, s.driveOf(l.OwnerID), joinRel(l.Path, sub), nil
+}
+
+// handlePublicShare 查看分享内容：文件返回元信息，目录返回指定层级的子项（只读）
+func (s *Server) handlePublicShare(c *gin.Context) {
+	l, d, rel, err := s.openShare(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	info, err := os.Stat(d.abs(rel))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	s.logShareAccess(c, l.ID, "view", rel)
+
+	shareRel := strings.TrimPrefix(strings.TrimPrefix(rel, l.Path), "/")
+	resp := gin.H{
+		"name":     filepath.Base(l.Path),
+		"path":     shareRel,
+		"is_dir":   info.IsDir(),
+		"size":     info.Size(),
+		"mod_time": info.ModTime(),
+	}
+	if l.ExpiresAt != nil {
+		resp["expires_at"] = l.ExpiresAt
+	}
+	if l.MaxDownloads != nil {
+		resp["downloads_left"] = *l.MaxDownloads - l.DownloadCount
+	}
+	if info.IsDir() {
+		entries, err := os.ReadDir(d.abs(rel))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read directory: " + err.Error()})
+			return
+		}
+		children := []gin.H{}
+		for _, entry := range entries {
+			fi, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			children = append(children, gin.H{
+				"name":     entry.Name(),
+				"path":     joinRel(shareRel, entry.Name()),
+				"is_dir":   entry.IsDir(),
+				"size":     fi.Size(),
+				"mod_time": fi.ModTime(),
+			})
+		}
+		resp["children"] = children
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// handlePublicShareDownload 通过分享链接下载文件或打包下载目录（format 同 /downloaddir），计入下载次数
+func (s *Server) handlePublicShareDownload(c *gin.Context) {
+	l, d, rel, err := s.openShare(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	format, err := downloadFormat(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	fullPath := d.abs(rel)
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	// 原子地占用一次下载额度，防止并发请求超出上限
+	res, err := s.DB.Exec(`
+		UPDATE share_links SET download_count = download_count + 1
+		WHERE id = $1 AND (max_downloads IS NULL OR download_count < max_downloads)
+	`, l.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		s.logShareAccess(c, l.ID, "denied", rel)
+		c.JSON(http.StatusGone, gin.H{"error": "Share link download limit reached"})
+		return
+	}
+	s.logShareAccess(c, l.ID, "download", rel)
+
+	if info.IsDir() {
+		if err := s.DownloadArchive(c, fullPath, filepath.Base(rel), format); err != nil {
+			respondArchiveError(c, err)
+		}
+		return
+	}
+	c.FileAttachment(fullPath, filepath.Base(rel))
+}
@@ -0,0 +1,624 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// 标签、收藏与自定义属性：都按节点 ID 存储，移动、重命名后依然有效。
+// 标签和属性属于命名空间，所有可读的人都能看到，修改需要写权限；收藏是每个用户自己的
+const (
+	maxTagLen           = 64
+	maxPropertyKeyLen   = 128
+	maxPropertyValueLen = 4096
+	maxPropertiesPerReq = 100
+)
+
+func (s *Server) ensureTagTables() error {
+	stmts := []string{
+		// node_id 不加外键：节点进入回收站后恢复时沿用原 ID，标签、收藏和属性需要保留；孤儿记录由清理任务回收
+		`CREATE TABLE IF NOT EXISTS drive_tags (
+			node_id INTEGER NOT NULL,
+			tag TEXT NOT NULL,
+			created_by TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (node_id, tag)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_tags_tag ON drive_tags(tag)`,
+		`CREATE TABLE IF NOT EXISTS drive_favorites (
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			node_id INTEGER NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (user_id, node_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS drive_properties (
+			node_id INTEGER NOT NULL,
+			key TEXT NOT NULL,
+			value TEXT NOT NULL,
+			updated_by TEXT NOT NULL DEFAULT '',
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (node_id, key)
+		)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := s.DB.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseTags 解析逗号分隔的标签列表：去掉首尾空白并转为小写，去重
+func parseTags(raw string) ([]string, error) {
+	seen := map[string]bool{}
+	var tags []string
+	for _, t := range strings.Split(raw, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		if utf8.RuneCountInString(t) > maxTagLen {
+			return nil, newAPIError(http.StatusBadRequest, "Tag too long (max %d characters): %s", maxTagLen, t)
+		}
+		if strings.IndexFunc(t, unicode.IsControl) >= 0 {
+			return nil, newAPIError(http.StatusBadRequest, "Invalid tag: %q", t)
+		}
+		seen[t] = true
+		tags = append(tags, t)
+	}
+	if len(tags) == 0 {
+		return nil, newAPIError(http.StatusBadRequest, "Missing 'tag' query parameter")
+	}
+	return tags, nil
+}
+
+// nodeTarget 解析标签、收藏、属性接口的 path 参数，目标必须是已存在的节点
+func (s *Server) nodeTarget(c *gin.Context) (*drive, string, int64, error) {
+	rel, err := cleanRelPath(c.Query("path"))
+	if err != nil {
+		return nil, "", 0, err
+	}
+	if rel == "" {
+		return nil, "", 0, newAPIError(http.StatusBadRequest, "Missing 'path' query parameter")
+	}
+	d := s.driveFor(c)
+	nodeID, err := d.lookupNode(s.DB, rel)
+	if err == sql.ErrNoRows {
+		return nil, "", 0, newAPIError(http.StatusNotFound, "File not found")
+	}
+	return d, rel, nodeID, err
+}
+
+// nodeTags 返回节点上的标签（按字母排序）
+func (s *Server) nodeTags(nodeID int64) ([]string, error) {
+	rows, err := s.DB.Query("SELECT tag FROM drive_tags WHERE node_id=$1 ORDER BY tag", nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags := []string{}
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// nodeProperties 返回节点上的自定义属性
+func (s *Server) nodeProperties(nodeID int64) (map[string]string, error) {
+	rows, err := s.DB.Query("SELECT key, value FROM drive_properties WHERE node_id=$1", nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	props := map[string]string{}
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return nil, err
+		}
+		props[k] = v
+	}
+	return props, rows.Err()
+}
+
+// isFavorite 节点是否被用户收藏
+func (s *Server) isFavorite(userID, nodeID int64) (bool, error) {
+	var starred bool
+	err := s.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM drive_favorites WHERE user_id=$1 AND node_id=$2)", userID, nodeID).Scan(&starred)
+	return starred, err
+}
+
+// loadTreeLabels 读取命名空间内所有节点的标签以及用户的收藏，用于文件树展示
+func (s *Server) loadTreeLabels(ownerID, userID int64) (map[int64][]string, map[int64]bool, error) {
+	rows, err := s.DB.Query(`
+		SELECT t.node_id, t.tag FROM drive_tags t JOIN drivelist d ON d.id = t.node_id
+		WHERE d.owner_id = $1 ORDER BY t.node_id, t.tag
+	`, ownerID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	tags := map[int64][]string{}
+	for rows.Next() {
+		var id int64
+		var t string
+		if err := rows.Scan(&id, &t); err != nil {
+			return nil, nil, err
+		}
+		tags[id] = append(tags[id], t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	rows, err = s.DB.Query(`
+		SELECT f.node_id FROM drive_favorites f JOIN drivelist d ON d.id = f.node_id
+		WHERE f.user_id = $1 AND d.owner_id = $2
+	`, userID, ownerID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	starred := map[int64]bool{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, nil, err
+		}
+		starred[id] = true
+	}
+	return tags, starred, rows.Err()
+}
+
+// taggedNodes 返回同时带有全部 tags 的节点及其子树；withAncestors 时还包含它们的上级目录，保证文件树连通
+func (s *Server) taggedNodes(d *drive, tags []string, withAncestors bool) (map[int64]bool, error) {
+	query := `
+		SELECT c.descendant FROM drivelist_closure c
+		WHERE c.ancestor IN (
+			SELECT t.node_id FROM drive_tags t JOIN drivelist n ON n.id = t.node_id
+			WHERE n.owner_id = $1 AND t.tag = ANY($2)
+			GROUP BY t.node_id HAVING count(*) = $3
+		)`
+	if withAncestors {
+		query += `
+		UNION
+		SELECT c.ancestor FROM drivelist_closure c
+		WHERE c.descendant IN (
+			SELECT t.node_id FROM drive_tags t JOIN drivelist n ON n.id = t.node_id
+			WHERE n.owner_id = $1 AND t.tag = ANY($2)
+			GROUP BY t.node_id HAVING count(*) = $3
+		)`
+	}
+	rows, err := s.DB.Query(query, d.OwnerID, pq.Array(tags), len(tags))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := map[int64]bool{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// TagCount 命名空间中的一个标签及使用它的节点数
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// handleGetTags 查看标签：GET /tags?path= 返回节点的标签；不带 path 时返回命名空间内（可读范围）所有标签及数量
+func (s *Server) handleGetTags(c *gin.Context) {
+	if c.Query("path") == "" {
+		s.listNamespaceTags(c)
+		return
+	}
+	d, rel, nodeID, err := s.nodeTarget(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := s.authorize(c, d, rel, PermRead); err != nil {
+		respondError(c, err)
+		return
+	}
+	tags, err := s.nodeTags(nodeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"path": rel, "tags": tags})
+}
+
+func (s *Server) listNamespaceTags(c *gin.Context) {
+	d := s.driveFor(c)
+	userID := currentUser(c).ID
+	query := `SELECT t.tag, count(*) FROM drive_tags t JOIN drivelist d ON d.id = t.node_id WHERE d.owner_id = $1`
+	args := []any{d.OwnerID}
+	if userID != d.OwnerID {
+		// 他人的命名空间只统计共享给自己的子树
+		query += ` AND d.id IN (
+			SELECT cl.descendant FROM drive_acl a JOIN drivelist_closure cl ON cl.ancestor = a.node_id
+			WHERE a.user_id = $2 AND a.perms & $3 <> 0)`
+		args = append(args, userID, PermRead|PermAdmin)
+	}
+	rows, err := s.DB.Query(query+" GROUP BY t.tag ORDER BY count(*) DESC, t.tag", args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+	counts := []TagCount{}
+	for rows.Next() {
+		var tc TagCount
+		if err := rows.Scan(&tc.Tag, &tc.Count); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		counts = append(counts, tc)
+	}
+	c.JSON(http.StatusOK, counts)
+}
+
+// handleAddTags 添加标签：POST /tags?path=&tag=a,b（需要写权限，已存在的标签忽略）
+func (s *Server) handleAddTags(c *gin.Context) {
+	d, rel, nodeID, err := s.nodeTarget(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	tags, err := parseTags(c.Query("tag"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := s.authorize(c, d, rel, PermWrite); err != nil {
+		respondError(c, err)
+		return
+	}
+	err = s.withAudit(actorOf(c), d.OwnerID, "tag_add", rel, gin.H{"tags": tags}, func(tx *sql.Tx) error {
+		for _, t := range tags {
+			if _, err := tx.Exec(`
+				INSERT INTO drive_tags (node_id, tag, created_by) VALUES ($1, $2, $3)
+				ON CONFLICT (node_id, tag) DO NOTHING
+			`, nodeID, t, actorName(c)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add tags: " + err.Error()})
+		return
+	}
+	all, err := s.nodeTags(nodeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Tags added", "path": rel, "tags": all})
+}
+
+// handleRemoveTags 移除标签：DELETE /tags?path=&tag=a,b（需要写权限）
+func (s *Server) handleRemoveTags(c *gin.Context) {
+	d, rel, nodeID, err := s.nodeTarget(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	tags, err := parseTags(c.Query("tag"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := s.authorize(c, d, rel, PermWrite); err != nil {
+		respondError(c, err)
+		return
+	}
+	var removed int64
+	err = s.withAudit(actorOf(c), d.OwnerID, "tag_remove", rel, gin.H{"tags": tags}, func(tx *sql.Tx) error {
+		res, err := tx.Exec("DELETE FROM drive_tags WHERE node_id=$1 AND tag = ANY($2)", nodeID, pq.Array(tags))
+		if err != nil {
+			return err
+		}
+		removed, _ = res.RowsAffected()
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove tags: " + err.Error()})
+		return
+	}
+	if removed == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found on this path"})
+		return
+	}
+	all, err := s.nodeTags(nodeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Tags removed", "path": rel, "tags": all})
+}
+
+// handleRenameTag 在整个命名空间内重命名标签：PUT /tags?from=&to=（需要根目录写权限），目标标签已存在时合并
+func (s *Server) handleRenameTag(c *gin.Context) {
+	from, err := parseTags(c.Query("from"))
+	if err != nil || len(from) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'from' parameter, expected a single tag"})
+		return
+	}
+	to, err := parseTags(c.Query("to"))
+	if err != nil || len(to) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'to' parameter, expected a single tag"})
+		return
+	}
+	d := s.driveFor(c)
+	if err := s.authorize(c, d, "", PermWrite); err != nil {
+		respondError(c, err)
+		return
+	}
+	var renamed int64
+	err = s.withAudit(actorOf(c), d.OwnerID, "tag_rename", "", gin.H{"from": from[0], "to": to[0]}, func(tx *sql.Tx) error {
+		res, err := tx.Exec(`
+			INSERT INTO drive_tags (node_id, tag, created_by)
+			SELECT t.node_id, $3, $4 FROM drive_tags t JOIN drivelist d ON d.id = t.node_id
+			WHERE d.owner_id = $1 AND t.tag = $2
+			ON CONFLICT (node_id, tag) DO NOTHING
+		`, d.OwnerID, from[0], to[0], actorName(c))
+		if err != nil {
+			return err
+		}
+		renamed, _ = res.RowsAffected()
+		_, err = tx.Exec(`
+			DELETE FROM drive_tags t USING drivelist d
+			WHERE d.id = t.node_id AND d.owner_id = $1 AND t.tag = $2 AND t.tag <> $3
+		`, d.OwnerID, from[0], to[0])
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename tag: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Tag renamed", "from": from[0], "to": to[0], "count": renamed})
+}
+
+// Favorite 当前用户收藏的一个节点，可能在他人的命名空间中
+type Favorite struct {
+	NodeID    int64     `json:"node_id"`
+	OwnerID   int64     `json:"owner"`
+	Path      string    `json:"path"`
+	Capacity  int64     `json:"capacity"`
+	IsDir     bool      `json:"is_dir"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// handleListFavorites 列出当前用户的收藏：GET /favorites（跳过已失去读权限的节点）
+func (s *Server) handleListFavorites(c *gin.Context) {
+	userID := currentUser(c).ID
+	rows, err := s.DB.Query(`
+		SELECT d.id, d.owner_id, d.name, d.capacity, f.created_at
+		FROM drive_favorites f JOIN drivelist d ON d.id = f.node_id
+		WHERE f.user_id = $1 AND (d.owner_id = $1 OR d.id IN (
+			SELECT cl.descendant FROM drive_acl a JOIN drivelist_closure cl ON cl.ancestor = a.node_id
+			WHERE a.user_id = $1 AND a.perms & $2 <> 0))
+		ORDER BY f.created_at DESC
+	`, userID, PermRead|PermAdmin)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+	favs := []Favorite{}
+	for rows.Next() {
+		var f Favorite
+		if err := rows.Scan(&f.NodeID, &f.OwnerID, &f.Path, &f.Capacity, &f.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		f.IsDir = f.Capacity == 0 // 容量为0表示目录
+		favs = append(favs, f)
+	}
+	c.JSON(http.StatusOK, favs)
+}
+
+// handleAddFavorite 收藏：PUT /favorites?path=（需要读权限，重复收藏无副作用）
+func (s *Server) handleAddFavorite(c *gin.Context) {
+	d, rel, nodeID, err := s.nodeTarget(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := s.authorize(c, d, rel, PermRead); err != nil {
+		respondError(c, err)
+		return
+	}
+	if _, err := s.DB.Exec(`
+		INSERT INTO drive_favorites (user_id, node_id) VALUES ($1, $2)
+		ON CONFLICT (user_id, node_id) DO NOTHING
+	`, currentUser(c).ID, nodeID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add favorite: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Added to favorites", "path": rel, "starred": true})
+}
+
+// handleRemoveFavorite 取消收藏：DELETE /favorites?path=
+func (s *Server) handleRemoveFavorite(c *gin.Context) {
+	_, rel, nodeID, err := s.nodeTarget(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	res, err := s.DB.Exec("DELETE FROM drive_favorites WHERE user_id=$1 AND node_id=$2", currentUser(c).ID, nodeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove favorite: " + err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Path is not in favorites"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Removed from favorites", "path": rel, "starred": false})
+}
+
+// handleGetProperties 查看自定义属性：GET /properties?path=
+func (s *Server) handleGetProperties(c *gin.Context) {
+	d, rel, nodeID, err := s.nodeTarget(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := s.authorize(c, d, rel, PermRead); err != nil {
+		respondError(c, err)
+		return
+	}
+	props, err := s.nodeProperties(nodeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"path": rel, "properties": props})
+}
+
+// handleSetProperties 设置自定义属性：PUT /properties?path=，请求体为 {"key": "value", ...}，值为 null 表示删除该键
+func (s *Server) handleSetProperties(c *gin.Context) {
+	d, rel, nodeID, err := s.nodeTarget(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	var body map[string]*string
+	if err := json.NewDecoder(c.Request.Body).Decode(&body); err != nil || len(body) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Request body must be a non-empty JSON object of properties"})
+		return
+	}
+	if len(body) > maxPropertiesPerReq {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many properties in one request"})
+		return
+	}
+	keys := make([]string, 0, len(body))
+	for k, v := range body {
+		if strings.TrimSpace(k) == "" || utf8.RuneCountInString(k) > maxPropertyKeyLen {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid property key: " + k})
+			return
+		}
+		if v != nil && len(*v) > maxPropertyValueLen {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Property value too long: " + k})
+			return
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if err := s.authorize(c, d, rel, PermWrite); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	err = s.withAudit(actorOf(c), d.OwnerID, "property_set", rel, gin.H{"keys": keys}, func(tx *sql.Tx) error {
+		for _, k := range keys {
+			var err error
+			if v := body[k]; v == nil {
+				_, err = tx.Exec("DELETE FROM drive_properties WHERE node_id=$1 AND key=$2", nodeID, k)
+			} else {
+				_, err = tx.Exec(`
+					INSERT INTO drive_properties (node_id, key, value, updated_by, updated_at) VALUES ($1, $2, $3, $4, now())
+					ON CONFLICT (node_id, key) DO UPDATE SET value=EXCLUDED.value, updated_by=EXCLUDED.updated_by, updated_at=now()
+				`, nodeID, k, *v, actorName(c))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set properties: " + err.Error()})
+		return
+	}
+	props, err := s.nodeProperties(nodeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Properties updated", "path": rel, "properties": props})
+}
+
+// handleDeleteProperty 删除一个自定义属性：DELETE /properties?path=&key=
+func (s *Server) handleDeleteProperty(c *gin.Context) {
+	d, rel, nodeID, err := s.nodeTarget(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	key := c.Query("key")
+	if key == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing 'key' query parameter"})
+		return
+	}
+	if err := s.authorize(c, d, rel, PermWrite); err != nil {
+		respondError(c, err)
+		return
+	}
+	var removed int64
+	err = s.withAudit(actorOf(c), d.OwnerID, "property_delete", rel, gin.H{"key": key}, func(tx *sql.Tx) error {
+		res, err := tx.Exec("DELETE FROM drive_properties WHERE node_id=$1 AND key=$2", nodeID, key)
+		if err != nil {
+			return err
+		}
+		removed, _ = res.RowsAffected()
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete property: " + err.Error()})
+		return
+	}
+	if removed == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Property not found: " + key})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Property deleted", "path": rel, "key": key})
+}
+
+// startLabelPruner 后台清理节点已被彻底删除的标签、收藏与属性
+func (s *Server) startLabelPruner(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			s.pruneLabels()
+			<-ticker.C
+		}
+	}()
+}
+
+func (s *Server) pruneLabels() {
+	// 节点既不在 drivelist 也不在回收站时才是孤儿
+	for _, table := range []string{"drive_tags", "drive_favorites", "drive_properties"} {
+		_, err := s.DB.Exec(`
+			DELETE FROM ` + table + ` x
+			WHERE NOT EXISTS (SELECT 1 FROM drivelist d WHERE d.id = x.node_id)
+			AND NOT EXISTS (SELECT 1 FROM drive_trash_nodes t WHERE t.node_id = x.node_id)
+		`)
+		if err != nil {
+			log.Printf("warning: prune orphan %s failed: %v", table, err)
+		}
+	}
+}
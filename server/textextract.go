@@ -0,0 +1,576 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// 全文索引的文本提取：纯文本/Markdown/源码、HTML、PDF 文本层、DOCX/XLSX/PPTX，全部用标准库实现
+
+// ooxmlParts Office Open XML 文档中承载正文的部件
+var ooxmlParts = map[string][]string{
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   {"word/document.xml"},
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         {"xl/sharedStrings.xml", "xl/worksheets/*.xml"},
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": {"ppt/slides/*.xml"},
+}
+
+// extractText 按类型提取文件中的文本，最多返回 limit 字节；不支持的类型返回空串
+func extractText(path, name, mime string, limit int) (string, error) {
+	var text string
+	var err error
+	switch {
+	case mime == "text/html" || strings.HasSuffix(strings.ToLower(name), ".html") || strings.HasSuffix(strings.ToLower(name), ".htm"):
+		text, err = htmlText(path, limit)
+	case strings.HasPrefix(mime, "text/") || previewKind(name) == previewText ||
+		mime == "application/json" || mime == "application/xml" || mime == "application/javascript":
+		text, err = plainText(path, limit)
+	case mime == "application/pdf":
+		text, err = pdfText(path, limit)
+	case ooxmlParts[mime] != nil:
+		text, err = ooxmlText(path, ooxmlParts[mime], limit)
+	}
+	if err != nil {
+		return "", err
+	}
+	return cleanIndexText(text, limit), nil
+}
+
+// cleanIndexText 去掉非法 UTF-8 与 NUL（PostgreSQL 的 TEXT 不接受），合并多余空白，并在字符边界截断
+func cleanIndexText(s string, limit int) string {
+	s = strings.ToValidUTF8(s, " ")
+	s = strings.ReplaceAll(s, "\x00", " ")
+	var b strings.Builder
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(line)
+		if b.Len() >= limit {
+			break
+		}
+	}
+	out := b.String()
+	if len(out) > limit {
+		out = out[:limit]
+		for len(out) > 0 && !utf8.ValidString(out) {
+			out = out[:len(out)-1]
+		}
+	}
+	return out
+}
+
+func plainText(path string, limit int) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	b, err := io.ReadAll(io.LimitReader(f, int64(limit)))
+	return string(b), err
+}
+
+// htmlText 提取 HTML 中的可见文本，跳过脚本和样式，块级元素之间换行
+func htmlText(path string, limit int) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	z := html.NewTokenizer(io.LimitReader(f, int64(limit)*4))
+	var b strings.Builder
+	skip := 0
+	for b.Len() < limit {
+		switch tt := z.Next(); tt {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return b.String(), nil
+			}
+			return b.String(), z.Err()
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			tag := string(name)
+			if tag == "script" || tag == "style" || tag == "noscript" {
+				if tt == html.StartTagToken {
+					skip++
+				} else if tt == html.EndTagToken && skip > 0 {
+					skip--
+				}
+				continue
+			}
+			switch tag {
+			case "p", "div", "br", "li", "tr", "h1", "h2", "h3", "h4", "h5", "h6", "section", "article", "pre", "blockquote":
+				b.WriteString("\n")
+			}
+		case html.TextToken:
+			if skip == 0 {
+				b.Write(z.Text())
+				b.WriteString(" ")
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+// ooxmlText 读取 zip 包中匹配 parts 的 XML 部件，收集 <t> 元素的文本，段落与单元格之间分隔
+func ooxmlText(path string, parts []string, limit int) (string, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+	var b strings.Builder
+	for _, pattern := range parts {
+		for _, f := range zr.File {
+			if ok, _ := pathMatch(pattern, f.Name); !ok || b.Len() >= limit {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return "", err
+			}
+			err = xmlText(io.LimitReader(rc, 64<<20), &b, limit)
+			rc.Close()
+			if err != nil {
+				return b.String(), nil // 损坏的部件只保留已提取的部分
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+func pathMatch(pattern, name string) (bool, error) {
+	if !strings.Contains(pattern, "*") {
+		return pattern == name, nil
+	}
+	return path.Match(pattern, name)
+}
+
+// xmlText 收集 t（Word/PowerPoint 的 w:t、a:t，Excel 的 t）与 v（Excel 单元格值）元素的文本；
+// Excel 中 t="s" 单元格的 v 是共享字符串的序号，正文已在 sharedStrings.xml 中收集
+func xmlText(r io.Reader, b *strings.Builder, limit int) error {
+	dec := xml.NewDecoder(r)
+	inText, sharedCell := false, false
+	for b.Len() < limit {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "c":
+				sharedCell = false
+				for _, a := range t.Attr {
+					if a.Name.Local == "t" && a.Value == "s" {
+						sharedCell = true
+					}
+				}
+			case "t":
+				inText = true
+			case "v":
+				inText = !sharedCell
+			case "tab":
+				b.WriteString("\t")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t", "v":
+				inText = false
+			case "p", "si", "row":
+				b.WriteString("\n")
+			case "c":
+				b.WriteString("\t")
+			}
+		case xml.CharData:
+			if inText {
+				b.Write(t)
+			}
+		}
+	}
+	return nil
+}
+
+// ---------- PDF 文本层 ----------
+
+var pdfStreamRe = regexp.MustCompile(`>>\s*stream\r?\n`)
+
+const (
+	pdfMaxStream  = 16 << 20  // 单个流最多解压的字节数
+	pdfMaxInflate = 128 << 20 // 每一遍扫描累计最多解压的字节数，防止大量高压缩比的小流耗尽内存
+)
+
+// pdfInflater 在总预算内解压 FlateDecode 流，预算用完后返回 nil
+type pdfInflater struct {
+	budget int64
+}
+
+func (z *pdfInflater) inflate(stream []byte) []byte {
+	n := min(z.budget, pdfMaxStream)
+	if n <= 0 {
+		return nil
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(stream))
+	if err != nil {
+		return nil
+	}
+	defer zr.Close()
+	out, _ := io.ReadAll(io.LimitReader(zr, n))
+	z.budget -= int64(len(out))
+	return out
+}
+
+// pdfStream 待提取文本的内容流（未解压的原始数据）
+type pdfStream struct {
+	data  []byte
+	flate bool
+}
+
+// pdfText 收集 Tj/TJ/'/" 显示的字符串。十六进制字符串按文件中 ToUnicode CMap 的合并表解码，
+// 没有 CMap 时按单字节处理；依赖字体内部编码且没有 ToUnicode 的字体无法还原。
+// CMap 可能位于内容流之后，因此第一遍只解析 CMap 并记下内容流的位置，第二遍再逐个解压提取，
+// 任何时候只保留一个解压后的流，文本达到 limit 即停止
+func pdfText(path string, limit int) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, pdfMaxScanSize))
+	if err != nil {
+		return "", err
+	}
+
+	var contents []pdfStream
+	cmap := pdfCMap{}
+	scan := &pdfInflater{budget: pdfMaxInflate}
+	for _, loc := range pdfStreamRe.FindAllIndex(data, -1) {
+		start := pdfDictStart(data, loc[0])
+		if start < 0 {
+			continue
+		}
+		dict := data[start : loc[0]+2]
+		if bytes.Contains(dict, []byte("/Image")) || bytes.Contains(dict, []byte("/ObjStm")) || bytes.Contains(dict, []byte("/XRef")) {
+			continue
+		}
+		raw := pdfStreamData(data, loc[0]+2)
+		if raw == nil {
+			continue
+		}
+		flate := bytes.Contains(dict, []byte("/FlateDecode"))
+		if !flate && bytes.Contains(dict, []byte("/Filter")) {
+			continue // 其他编码（图像压缩等）不含文本
+		}
+		stream := raw
+		if flate {
+			if stream = scan.inflate(raw); stream == nil {
+				continue
+			}
+		}
+		if bytes.Contains(stream, []byte("begincmap")) {
+			cmap.parse(stream)
+		} else if bytes.Contains(stream, []byte("BT")) {
+			contents = append(contents, pdfStream{data: raw, flate: flate})
+		}
+	}
+
+	var b strings.Builder
+	text := &pdfInflater{budget: pdfMaxInflate}
+	for _, content := range contents {
+		if b.Len() >= limit {
+			break
+		}
+		stream := content.data
+		if content.flate {
+			if stream = text.inflate(stream); stream == nil {
+				continue
+			}
+		}
+		pdfContentText(stream, cmap, &b)
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// pdfCMap ToUnicode 映射：字符码 → Unicode 文本
+type pdfCMap struct {
+	codes     map[uint32]string
+	codeBytes int
+}
+
+var (
+	pdfBfcharRe  = regexp.MustCompile(`(?s)beginbfchar(.*?)endbfchar`)
+	pdfBfrangeRe = regexp.MustCompile(`(?s)beginbfrange(.*?)endbfrange`)
+	pdfHexRe     = regexp.MustCompile(`<([0-9A-Fa-f\s]*)>|\[([^\]]*)\]`)
+)
+
+// pdfMaxCMapEntries 一个文件的 CMap 最多保存的映射数
+const pdfMaxCMapEntries = 1 << 18
+
+func (m *pdfCMap) parse(stream []byte) {
+	if m.codes == nil {
+		m.codes = map[uint32]string{}
+	}
+	full := func() bool { return len(m.codes) >= pdfMaxCMapEntries }
+	for _, block := range pdfBfcharRe.FindAllSubmatch(stream, -1) {
+		toks := pdfHexRe.FindAllSubmatch(block[1], -1)
+		for i := 0; i+1 < len(toks) && !full(); i += 2 {
+			src, n := pdfHexCode(toks[i][1])
+			m.setWidth(n)
+			m.codes[src] = pdfUTF16(toks[i+1][1])
+		}
+	}
+	for _, block := range pdfBfrangeRe.FindAllSubmatch(stream, -1) {
+		toks := pdfHexRe.FindAllSubmatch(block[1], -1)
+		for i := 0; i+2 < len(toks) && !full(); i += 3 {
+			lo, n := pdfHexCode(toks[i][1])
+			hi, _ := pdfHexCode(toks[i+1][1])
+			m.setWidth(n)
+			if hi < lo || hi-lo > 0xFFFF {
+				continue
+			}
+			if arr := toks[i+2][2]; arr != nil {
+				for j, dst := range pdfHexRe.FindAllSubmatch(arr, -1) {
+					if uint32(j) > hi-lo || full() {
+						break
+					}
+					m.codes[lo+uint32(j)] = pdfUTF16(dst[1])
+				}
+				continue
+			}
+			base := []rune(pdfUTF16(toks[i+2][1]))
+			if len(base) == 0 {
+				continue
+			}
+			// 按偏移循环：hi 为 0xFFFFFFFF 时 code++ 会回绕，循环永远不会结束
+			for k := uint32(0); k <= hi-lo && !full(); k++ {
+				r := append([]rune{}, base...)
+				r[len(r)-1] += rune(k)
+				m.codes[lo+k] = string(r)
+			}
+		}
+	}
+}
+
+func (m *pdfCMap) setWidth(n int) {
+	if n > m.codeBytes {
+		m.codeBytes = n
+	}
+}
+
+func pdfHexCode(h []byte) (uint32, int) {
+	b, _ := hex.DecodeString(string(bytes.Join(bytes.Fields(h), nil)))
+	var v uint32
+	for _, c := range b {
+		v = v<<8 | uint32(c)
+	}
+	return v, len(b)
+}
+
+func pdfUTF16(h []byte) string {
+	b, _ := hex.DecodeString(string(bytes.Join(bytes.Fields(h), nil)))
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		u = append(u, binary.BigEndian.Uint16(b[i:]))
+	}
+	return string(utf16.Decode(u))
+}
+
+// decode 把字符串按 CMap 解码；没有 CMap 或码不在表中时按 Latin-1 处理
+func (m pdfCMap) decode(s []byte, isHex bool) string {
+	if isHex && len(m.codes) > 0 {
+		n := max(m.codeBytes, 1)
+		var b strings.Builder
+		for i := 0; i+n <= len(s); i += n {
+			var code uint32
+			for _, c := range s[i : i+n] {
+				code = code<<8 | uint32(c)
+			}
+			b.WriteString(m.codes[code])
+		}
+		return b.String()
+	}
+	if bytes.HasPrefix(s, []byte{0xFE, 0xFF}) { // UTF-16BE 文本字符串
+		return pdfUTF16([]byte(hex.EncodeToString(s[2:])))
+	}
+	r := make([]rune, len(s))
+	for i, c := range s {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+// pdfContentText 扫描内容流中的文本操作符
+func pdfContentText(content []byte, cmap pdfCMap, b *strings.Builder) {
+	type pdfString struct {
+		data  []byte
+		isHex bool
+	}
+	var operands []pdfString
+	var kerning []float64
+	inArray := false
+	flush := func(sep string) {
+		for i, s := range operands {
+			if i > 0 && i-1 < len(kerning) && kerning[i-1] < -200 {
+				b.WriteString(" ") // TJ 中较大的负间距通常表示单词间隔
+			}
+			b.WriteString(cmap.decode(s.data, s.isHex))
+		}
+		b.WriteString(sep)
+	}
+	for i := 0; i < len(content); {
+		c := content[i]
+		switch {
+		case c == '(':
+			s, next := pdfLiteralString(content, i)
+			operands = append(operands, pdfString{data: s})
+			i = next
+		case c == '<' && i+1 < len(content) && content[i+1] == '<':
+			i += 2 // 标记内容的属性字典
+		case c == '/':
+			// 名字对象（字体名等）不是操作符，跳过时不能清空操作数
+			i++
+			for i < len(content) && !bytes.ContainsRune([]byte(" \t\r\n/[]()<>{}%"), rune(content[i])) {
+				i++
+			}
+		case c == '<':
+			end := bytes.IndexByte(content[i:], '>')
+			if end < 0 {
+				return
+			}
+			h := bytes.Join(bytes.Fields(content[i+1:i+end]), nil)
+			if len(h)%2 == 1 {
+				h = append(h, '0')
+			}
+			s, _ := hex.DecodeString(string(h))
+			operands = append(operands, pdfString{data: s, isHex: true})
+			i += end + 1
+		case c == '[':
+			inArray = true
+			kerning = kerning[:0]
+			i++
+		case c == ']':
+			inArray = false
+			i++
+		case c == '%':
+			for i < len(content) && content[i] != '\n' && content[i] != '\r' {
+				i++
+			}
+		case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < len(content) && (content[j] == '.' || (content[j] >= '0' && content[j] <= '9')) {
+				j++
+			}
+			if inArray {
+				// 记录紧跟在第 len(operands) 个字符串之后的间距
+				for len(kerning) < len(operands) {
+					kerning = append(kerning, 0)
+				}
+				if v, err := strconv.ParseFloat(string(content[i:j]), 64); err == nil && len(operands) > 0 {
+					kerning[len(operands)-1] += v
+				}
+			}
+			i = j
+		case (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '\'' || c == '"' || c == '*':
+			j := i + 1
+			for j < len(content) && ((content[j] >= 'a' && content[j] <= 'z') || (content[j] >= 'A' && content[j] <= 'Z') || content[j] == '*') {
+				j++
+			}
+			switch string(content[i:j]) {
+			case "ID":
+				// 内联图像的二进制数据，跳到 EI
+				if end := bytes.Index(content[j:], []byte("EI")); end >= 0 {
+					j += end + 2
+				} else {
+					j = len(content)
+				}
+			case "Tj", "TJ":
+				flush("")
+			case "'", "\"":
+				b.WriteString("\n")
+				flush("")
+			case "T*", "ET":
+				b.WriteString("\n")
+			case "Td", "TD", "Tm":
+				b.WriteString(" ")
+			}
+			operands, kerning = operands[:0], kerning[:0]
+			i = j
+		default:
+			i++
+		}
+	}
+}
+
+// pdfLiteralString 解析从 start（'('）开始的字面字符串，返回内容与结束后的位置
+func pdfLiteralString(data []byte, start int) ([]byte, int) {
+	var out []byte
+	depth := 0
+	for i := start; i < len(data); i++ {
+		c := data[i]
+		switch c {
+		case '(':
+			if depth > 0 {
+				out = append(out, c)
+			}
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return out, i + 1
+			}
+			out = append(out, c)
+		case '\\':
+			i++
+			if i >= len(data) {
+				return out, i
+			}
+			switch e := data[i]; e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b', 'f':
+			case '\r', '\n': // 续行
+			default:
+				if e >= '0' && e <= '7' {
+					v, n := 0, 0
+					for n < 3 && i < len(data) && data[i] >= '0' && data[i] <= '7' {
+						v = v*8 + int(data[i]-'0')
+						i++
+						n++
+					}
+					i--
+					out = append(out, byte(v))
+				} else {
+					out = append(out, e)
+				}
+			}
+		default:
+			out = append(out, c)
+		}
+	}
+	return out, len(data)
+}
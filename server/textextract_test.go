@@ -0,0 +1,61 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPdfCMapParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		want   map[uint32]string
+	}{
+		{"bfchar", "beginbfchar <01> <0041> <02> <0042> endbfchar", map[uint32]string{1: "A", 2: "B"}},
+		{"bfrange", "beginbfrange <0010> <0012> <0061> endbfrange", map[uint32]string{0x10: "a", 0x11: "b", 0x12: "c"}},
+		{"bfrange array", "beginbfrange <05> <06> [<0058> <0059> <005A>] endbfrange", map[uint32]string{5: "X", 6: "Y"}},
+		{"range at the top of the code space", "beginbfrange <FFFFFFFE> <FFFFFFFF> <0041> endbfrange",
+			map[uint32]string{0xFFFFFFFE: "A", 0xFFFFFFFF: "B"}},
+		{"array at the top of the code space", "beginbfrange <FFFFFFFF> <FFFFFFFF> [<0041> <0042>] endbfrange",
+			map[uint32]string{0xFFFFFFFF: "A"}},
+		{"reversed range", "beginbfrange <0012> <0010> <0061> endbfrange", map[uint32]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			done := make(chan pdfCMap, 1)
+			go func() {
+				var m pdfCMap
+				m.parse([]byte(tt.stream))
+				done <- m
+			}()
+			var m pdfCMap
+			select {
+			case m = <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("parse did not finish")
+			}
+			if len(m.codes) != len(tt.want) {
+				t.Fatalf("codes = %v, want %v", m.codes, tt.want)
+			}
+			for code, s := range tt.want {
+				if m.codes[code] != s {
+					t.Errorf("code %#x = %q, want %q", code, m.codes[code], s)
+				}
+			}
+		})
+	}
+}
+
+func FuzzPdfCMapParse(f *testing.F) {
+	f.Add([]byte("beginbfchar <01> <0041> endbfchar beginbfrange <0010> <0012> <0061> endbfrange"))
+	f.Add([]byte("beginbfrange <FFFF0000> <FFFFFFFF> <0041> endbfrange"))
+	f.Add([]byte("beginbfrange <00> <FF> [<0041> <0042>] <FFFFFFFF> <FFFFFFFF> [<0043>] endbfrange"))
+	f.Add([]byte("beginbfrange <> <> <> endbfrange beginbfchar <> <> endbfchar"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var m pdfCMap
+		m.parse(data)
+		if len(m.codes) > pdfMaxCMapEntries {
+			t.Fatalf("%d entries exceed the cap of %d", len(m.codes), pdfMaxCMapEntries)
+		}
+	})
+}
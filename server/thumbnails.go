@@ -0,0 +1,378 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// 缩略图与预览：图片按多个尺寸生成 JPEG 缩略图，文本/代码文件截取开头若干 KB 作为预览。
+// 结果按内容哈希缓存在 uploads/_thumbs/ 下，内容相同的文件（复制、秒传、其他用户）共用缓存；
+// 上传完成后在后台预生成，请求时缺失则现场生成
+
+const (
+	thumbsDirName    = "_thumbs"
+	thumbDefaultSize = 256
+	thumbQuality     = 82
+	thumbMaxPixels   = 64 << 20 // 超过该像素数的图片不生成缩略图，防止解码耗尽内存
+	thumbQueueSize   = 256
+)
+
+// thumbSizes 支持的缩略图边长（像素），一次解码生成全部尺寸
+var thumbSizes = []int{128, 256, 512}
+
+// 可生成预览的文件类型
+const (
+	previewNone = iota
+	previewImage
+	previewText
+)
+
+var imageExts = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true}
+
+var textExts = map[string]bool{
+	".txt": true, ".md": true, ".markdown": true, ".log": true, ".csv": true, ".tsv": true,
+	".json": true, ".yaml": true, ".yml": true, ".toml": true, ".ini": true, ".conf": true, ".cfg": true, ".env": true,
+	".xml": true, ".html": true, ".htm": true, ".css": true, ".scss": true, ".less": true, ".svg": true,
+	".go": true, ".mod": true, ".sum": true, ".py": true, ".js": true, ".jsx": true, ".ts": true, ".tsx": true, ".vue": true,
+	".java": true, ".kt": true, ".c": true, ".h": true, ".cc": true, ".cpp": true, ".hpp": true, ".cs": true,
+	".rs": true, ".rb": true, ".php": true, ".swift": true, ".lua": true, ".pl": true, ".r": true, ".scala": true,
+	".sh": true, ".bash": true, ".zsh": true, ".ps1": true, ".bat": true, ".sql": true, ".proto": true, ".dockerfile": true,
+}
+
+// previewKind 按扩展名判断预览类型
+func previewKind(name string) int {
+	ext := strings.ToLower(filepath.Ext(name))
+	switch {
+	case imageExts[ext]:
+		return previewImage
+	case textExts[ext]:
+		return previewText
+	}
+	return previewNone
+}
+
+// thumbnailer 缩略图生成器：后台队列 + 同一内容并发请求只生成一次
+type thumbnailer struct {
+	dir      string
+	textSize int // 文本预览的字节数
+	queue    chan fileJob
+	mu       sync.Mutex
+	inflight map[string]chan struct{}
+}
+
+// fileJob 文件写入后交给后台处理的任务
+type fileJob struct {
+	d   *drive
+	rel string
+}
+
+func newThumbnailer(uploadDir string) *thumbnailer {
+	return &thumbnailer{
+		dir:      filepath.Join(uploadDir, thumbsDirName),
+		textSize: envInt("PREVIEW_TEXT_KB", 4) << 10,
+		queue:    make(chan fileJob, thumbQueueSize),
+		inflight: map[string]chan struct{}{},
+	}
+}
+
+// imagePath 返回某个尺寸缩略图的缓存路径
+func (t *thumbnailer) imagePath(hash string, size int) string {
+	return filepath.Join(t.dir, hash[:2], fmt.Sprintf("%s_%d.jpg", hash, size))
+}
+
+// textPath 返回文本预览的缓存路径（预览长度变化后自动失效）
+func (t *thumbnailer) textPath(hash string) string {
+	return filepath.Join(t.dir, hash[:2], fmt.Sprintf("%s_%dk.txt", hash, t.textSize>>10))
+}
+
+// ensure 确保 hash 对应的预览已生成；同一内容的并发调用等待第一个调用完成
+func (t *thumbnailer) ensure(src, hash string, kind int) error {
+	cached := t.textPath(hash)
+	if kind == previewImage {
+		cached = t.imagePath(hash, thumbSizes[len(thumbSizes)-1])
+	}
+	for {
+		if _, err := os.Stat(cached); err == nil {
+			return nil
+		}
+		t.mu.Lock()
+		if wait, ok := t.inflight[hash]; ok {
+			t.mu.Unlock()
+			<-wait
+			continue
+		}
+		done := make(chan struct{})
+		t.inflight[hash] = done
+		t.mu.Unlock()
+
+		var err error
+		if kind == previewImage {
+			err = t.generateImage(src, hash)
+		} else {
+			err = t.generateText(src, hash)
+		}
+		t.mu.Lock()
+		delete(t.inflight, hash)
+		t.mu.Unlock()
+		close(done)
+		return err
+	}
+}
+
+// generateImage 解码一次，按所有尺寸等比缩放（不放大），透明部分铺白底后写为 JPEG
+func (t *thumbnailer) generateImage(src, hash string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return newAPIError(http.StatusUnsupportedMediaType, "Unsupported image: %v", err)
+	}
+	if cfg.Width*cfg.Height > thumbMaxPixels {
+		return newAPIError(http.StatusUnprocessableEntity, "Image too large for thumbnail: %dx%d", cfg.Width, cfg.Height)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return newAPIError(http.StatusUnsupportedMediaType, "Failed to decode image: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(t.dir, hash[:2]), os.ModePerm); err != nil {
+		return err
+	}
+	b := img.Bounds()
+	// 最大尺寸最后落盘，作为“已全部生成”的标志
+	for _, size := range thumbSizes {
+		w, h := b.Dx(), b.Dy()
+		if w > size || h > size {
+			if w >= h {
+				w, h = size, max(1, h*size/w)
+			} else {
+				w, h = max(1, w*size/h), size
+			}
+		}
+		dst := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+		if err := writeAtomic(t.imagePath(hash, size), func(w io.Writer) error {
+			return jpeg.Encode(w, dst, &jpeg.Options{Quality: thumbQuality})
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generateText 截取文件开头 textSize 字节作为预览，截断在完整的 UTF-8 字符处；非 UTF-8 内容不生成
+func (t *thumbnailer) generateText(src, hash string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	buf := make([]byte, t.textSize)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	buf = buf[:n]
+	if n == t.textSize {
+		// 去掉被截断的最后一个多字节字符
+		for i := 0; i < utf8.UTFMax && len(buf) > 0; i++ {
+			if r, size := utf8.DecodeLastRune(buf); r != utf8.RuneError || size != 1 {
+				break
+			}
+			buf = buf[:len(buf)-1]
+		}
+	}
+	if !utf8.Valid(buf) {
+		return newAPIError(http.StatusUnsupportedMediaType, "File is not UTF-8 text")
+	}
+	if err := os.MkdirAll(filepath.Join(t.dir, hash[:2]), os.ModePerm); err != nil {
+		return err
+	}
+	return writeAtomic(t.textPath(hash), func(w io.Writer) error {
+		_, err := w.Write(buf)
+		return err
+	})
+}
+
+// writeAtomic 先写临时文件再改名，避免并发读取到写了一半的缓存
+func writeAtomic(path string, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// contentHash 返回节点的内容哈希；旧数据没有记录时现场计算并回写
+func (s *Server) contentHash(d *drive, nodeID int64, rel string) (string, error) {
+	var hash string
+	if err := s.DB.QueryRow("SELECT COALESCE(file_hash, '') FROM drivelist WHERE id=$1", nodeID).Scan(&hash); err != nil {
+		return "", err
+	}
+	if hash != "" {
+		return hash, nil
+	}
+	hash, _, err := hashFile(d.abs(rel))
+	if err != nil {
+		return "", err
+	}
+	if _, err := s.DB.Exec("UPDATE drivelist SET file_hash=$1 WHERE id=$2", hash, nodeID); err != nil {
+		log.Printf("warning: failed to store file hash: %v", err)
+	}
+	return hash, nil
+}
+
+// enqueueThumbnail 文件写入后提交后台预生成任务；队列满时丢弃，请求时再生成
+func (s *Server) enqueueThumbnail(d *drive, rel string) {
+	if s.thumbs == nil || previewKind(rel) == previewNone {
+		return
+	}
+	select {
+	case s.thumbs.queue <- fileJob{d: d, rel: rel}:
+	default:
+	}
+}
+
+// startThumbnailWorkers 启动后台生成协程
+func (s *Server) startThumbnailWorkers(n int) {
+	for i := 0; i < n; i++ {
+		go func() {
+			for job := range s.thumbs.queue {
+				nodeID, err := job.d.lookupNode(s.DB, job.rel)
+				if err != nil {
+					continue
+				}
+				hash, err := s.contentHash(job.d, nodeID, job.rel)
+				if err != nil {
+					continue
+				}
+				if err := s.thumbs.ensure(job.d.abs(job.rel), hash, previewKind(job.rel)); err != nil {
+					log.Printf("thumbnail %s: %v", job.rel, err)
+				}
+			}
+		}()
+	}
+}
+
+// handleThumbnail 返回缩略图或文本预览：GET /thumbnail?name=&size=
+// 图片返回 JPEG，文本返回开头部分（X-Preview-Truncated 表示是否被截断）；ETag 由内容哈希决定
+func (s *Server) handleThumbnail(c *gin.Context) {
+	name := c.Query("name")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing 'name' query parameter"})
+		return
+	}
+	name, err := cleanRelPath(name)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	size := thumbDefaultSize
+	if raw := c.Query("size"); raw != "" {
+		size, err = strconv.Atoi(raw)
+		valid := false
+		for _, s := range thumbSizes {
+			valid = valid || s == size
+		}
+		if err != nil || !valid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid size, supported: %v", thumbSizes)})
+			return
+		}
+	}
+	d := s.driveFor(c)
+	if err := s.authorize(c, d, name, PermRead); err != nil {
+		respondError(c, err)
+		return
+	}
+	kind := previewKind(name)
+	if kind == previewNone {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "No preview available for this file type"})
+		return
+	}
+
+	nodeID, err := d.lookupNode(s.DB, name)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	info, err := os.Stat(d.abs(name))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	if info.IsDir() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot preview a directory"})
+		return
+	}
+	hash, err := s.contentHash(d, nodeID, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash content: " + err.Error()})
+		return
+	}
+	if err := s.thumbs.ensure(d.abs(name), hash, kind); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	path := s.thumbs.imagePath(hash, size)
+	etag := fmt.Sprintf(`"%s-%d"`, hash, size)
+	if kind == previewText {
+		path = s.thumbs.textPath(hash)
+		etag = fmt.Sprintf(`"%s-%dk"`, hash, s.thumbs.textSize>>10)
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+		c.Header("X-Preview-Truncated", strconv.FormatBool(info.Size() > int64(s.thumbs.textSize)))
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open preview: " + err.Error()})
+		return
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// 同一 URL 的内容会随文件更新而变化，缓存必须用 ETag 重新验证
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private, no-cache")
+	http.ServeContent(c.Writer, c.Request, "", stat.ModTime(), f)
+}
@@ -0,0 +1,495 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 回收站：删除操作把节点连同闭包关系快照移入回收站，文件移动到用户命名空间的 trash/<id>/ 下，
+// 恢复时按原 ID 重新插入，保证闭包结构与删除前一致
+
+// trashDirName 单用户时代 uploads/ 下的回收站目录，仅在迁移旧数据时使用
+const trashDirName = "_trash"
+
+// TrashItem 回收站条目
+type TrashItem struct {
+	ID           int64     `json:"id"`
+	OriginalPath string    `json:"original_path"`
+	IsDir        bool      `json:"is_dir"`
+	Capacity     int64     `json:"capacity"`
+	NodeCount    int       `json:"node_count"`
+	DeletedAt    time.Time `json:"deleted_at"`
+	ExpiresAt    time.Time `json:"expires_at,omitempty"`
+}
+
+func (s *Server) ensureTrashTables() error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS drive_trash (
+			id SERIAL PRIMARY KEY,
+			original_path TEXT NOT NULL,
+			is_dir BOOLEAN NOT NULL,
+			capacity BIGINT NOT NULL DEFAULT 0,
+			deleted_at TIMESTAMPTZ DEFAULT now()
+		)`,
+		// 被删除节点的快照（保留原 ID 与创建时间）
+		`CREATE TABLE IF NOT EXISTS drive_trash_nodes (
+			trash_id INTEGER NOT NULL REFERENCES drive_trash(id) ON DELETE CASCADE,
+			node_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			capacity BIGINT NOT NULL,
+			created_at TIMESTAMPTZ,
+			PRIMARY KEY (trash_id, node_id)
+		)`,
+		// 子树内部的闭包关系快照
+		`CREATE TABLE IF NOT EXISTS drive_trash_closure (
+			trash_id INTEGER NOT NULL REFERENCES drive_trash(id) ON DELETE CASCADE,
+			ancestor INTEGER NOT NULL,
+			descendant INTEGER NOT NULL,
+			depth INT NOT NULL,
+			PRIMARY KEY (trash_id, ancestor, descendant)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_trash_deleted_at ON drive_trash(deleted_at)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := s.DB.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trashStorage 返回回收站条目在磁盘上的存储目录
+func (d *drive) trashStorage(trashID int64) string {
+	return filepath.Join(d.TrashDir, strconv.FormatInt(trashID, 10))
+}
+
+// moveToTrash 把 rel 对应的节点（nodeID 为 0 表示库中无记录）及其子树移入回收站
+// 数据库操作在 tx 中完成；文件会立即移动，返回的 undo 用于事务提交失败时撤销
+func (d *drive) moveToTrash(tx dbQuerier, nodeID int64, rel string) (int64, func(), error) {
+	fullPath := d.abs(rel)
+	info, err := os.Stat(fullPath)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, nil, err
+	}
+	isDir := err == nil && info.IsDir()
+
+	var capacity int64
+	if nodeID != 0 {
+		if err := tx.QueryRow(`
+			SELECT COALESCE(SUM(d.capacity), 0)
+			FROM drivelist d
+			JOIN drivelist_closure c ON d.id = c.descendant
+			WHERE c.ancestor = $1
+		`, nodeID).Scan(&capacity); err != nil {
+			return 0, nil, fmt.Errorf("sum subtree capacity failed: %v", err)
+		}
+	} else if err == nil && !isDir {
+		capacity = info.Size()
+	}
+
+	var trashID int64
+	if err := tx.QueryRow("INSERT INTO drive_trash (original_path, is_dir, capacity, owner_id) VALUES ($1, $2, $3, $4) RETURNING id",
+		rel, isDir, capacity, d.OwnerID).Scan(&trashID); err != nil {
+		return 0, nil, fmt.Errorf("insert trash record failed: %v", err)
+	}
+
+	if nodeID != 0 {
+		// 快照节点与子树内部闭包关系，然后删除原记录（CASCADE 清理闭包表）
+		if _, err := tx.Exec(`
+			INSERT INTO drive_trash_nodes (trash_id, node_id, name, capacity, created_at)
+			SELECT $1, d.id, d.name, d.capacity, d.created_at
+			FROM drivelist d
+			JOIN drivelist_closure c ON d.id = c.descendant
+			WHERE c.ancestor = $2
+		`, trashID, nodeID); err != nil {
+			return 0, nil, fmt.Errorf("snapshot trash nodes failed: %v", err)
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO drive_trash_closure (trash_id, ancestor, descendant, depth)
+			SELECT $1, cl.ancestor, cl.descendant, cl.depth
+			FROM drivelist_closure cl
+			WHERE cl.ancestor IN (SELECT descendant FROM drivelist_closure WHERE ancestor = $2)
+		`, trashID, nodeID); err != nil {
+			return 0, nil, fmt.Errorf("snapshot trash closure failed: %v", err)
+		}
+		if err := deleteSubtree(tx, nodeID); err != nil {
+			return 0, nil, fmt.Errorf("delete records failed: %v", err)
+		}
+	}
+
+	undo := func() {}
+	if info != nil {
+		storage := d.trashStorage(trashID)
+		if err := os.MkdirAll(storage, os.ModePerm); err != nil {
+			return 0, nil, err
+		}
+		dst := filepath.Join(storage, filepath.Base(fullPath))
+		if err := os.Rename(fullPath, dst); err != nil {
+			os.RemoveAll(storage)
+			return 0, nil, fmt.Errorf("move to trash failed: %v", err)
+		}
+		undo = func() {
+			os.Rename(dst, fullPath)
+			os.RemoveAll(storage)
+		}
+	}
+	return trashID, undo, nil
+}
+
+// trashPath 处理单个删除请求：移入回收站，或在 permanent=true 时直接删除
+func (s *Server) trashPath(d *drive, rel string, permanent bool, act actor) (int64, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("Failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	nodeID, err := d.lookupNode(tx, rel)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("Failed to query file: %v", err)
+	}
+	fullPath := d.abs(rel)
+	if err == sql.ErrNoRows {
+		if _, statErr := os.Lstat(fullPath); statErr != nil {
+			return 0, newAPIError(http.StatusNotFound, "File not found")
+		}
+		nodeID = 0
+	}
+	action := "delete"
+	if permanent {
+		action = "delete_permanent"
+	}
+	if err := d.recordChange(tx, changeDeleted, action, nodeID, rel, "", act); err != nil {
+		return 0, err
+	}
+
+	if permanent {
+		if nodeID != 0 {
+			if err := deleteSubtree(tx, nodeID); err != nil {
+				return 0, fmt.Errorf("Failed to delete record: %v", err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, fmt.Errorf("Failed to commit transaction: %v", err)
+		}
+		s.notifyChange(d)
+		if err := os.RemoveAll(fullPath); err != nil {
+			return 0, fmt.Errorf("DB updated but failed to delete file: %v", err)
+		}
+		return 0, nil
+	}
+
+	trashID, undo, err := d.moveToTrash(tx, nodeID, rel)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		undo()
+		return 0, fmt.Errorf("Failed to commit transaction: %v", err)
+	}
+	s.notifyChange(d)
+	return trashID, nil
+}
+
+func (s *Server) handleListTrash(c *gin.Context) {
+	d := s.ownDrive(c)
+	rows, err := s.DB.Query(`
+		SELECT t.id, t.original_path, t.is_dir, t.capacity, t.deleted_at,
+			(SELECT COUNT(*) FROM drive_trash_nodes n WHERE n.trash_id = t.id)
+		FROM drive_trash t
+		WHERE t.owner_id = $1
+		ORDER BY t.deleted_at DESC, t.id DESC
+	`, d.OwnerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	items := []TrashItem{}
+	for rows.Next() {
+		var it TrashItem
+		if err := rows.Scan(&it.ID, &it.OriginalPath, &it.IsDir, &it.Capacity, &it.DeletedAt, &it.NodeCount); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if s.trashRetention > 0 {
+			it.ExpiresAt = it.DeletedAt.Add(s.trashRetention)
+		}
+		items = append(items, it)
+	}
+	c.JSON(http.StatusOK, gin.H{"count": len(items), "items": items})
+}
+
+func (s *Server) handleRestoreTrash(c *gin.Context) {
+	trashID, err := strconv.ParseInt(c.Query("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing or invalid 'id' query parameter"})
+		return
+	}
+	policy, err := parseConflictPolicy(c.Query("onConflict"), ConflictFail)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	d := s.ownDrive(c)
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var originalPath string
+	err = tx.QueryRow("SELECT original_path FROM drive_trash WHERE id=$1 AND owner_id=$2 FOR UPDATE", trashID, d.OwnerID).Scan(&originalPath)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Trash item not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query trash item: " + err.Error()})
+		return
+	}
+
+	storedPath := filepath.Join(d.trashStorage(trashID), filepath.Base(originalPath))
+	var storedMod time.Time
+	if info, err := os.Stat(storedPath); err == nil {
+		storedMod = info.ModTime()
+	}
+
+	outcome, err := d.resolveConflict(tx, originalPath, policy, storedMod)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if !outcome.Proceed() {
+		c.JSON(http.StatusOK, gin.H{"message": "Restore skipped due to conflict policy", "conflict": outcome})
+		return
+	}
+	target := outcome.Path
+
+	var restoreBytes, restoreFiles int64
+	if err := tx.QueryRow(`
+		SELECT COALESCE(SUM(capacity), 0), COUNT(*) FILTER (WHERE capacity > 0)
+		FROM drive_trash_nodes WHERE trash_id = $1
+	`, trashID).Scan(&restoreBytes, &restoreFiles); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query trash usage: " + err.Error()})
+		return
+	}
+	if err := s.checkWriteQuota(tx, d, outcome, quotaDelta{Bytes: restoreBytes, Files: restoreFiles}); err != nil {
+		respondError(c, err)
+		return
+	}
+	// 恢复总是按原 ID 重新插入，因此被覆盖的目标整体移入回收站（配额检查通过之后才移走）
+	_, restore, err := d.clearForOverwrite(tx, &outcome, true)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			restore()
+		}
+	}()
+
+	// 原父目录可能已被删除，按需重建
+	parentID, err := d.ensureDirNode(tx, parentRel(target))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to recreate parent directory: " + err.Error()})
+		return
+	}
+
+	// 按原 ID 恢复节点（序列不会复用已分配的 ID），路径前缀替换为最终目标路径
+	var rootID int64
+	err = tx.QueryRow("SELECT node_id FROM drive_trash_nodes WHERE trash_id=$1 AND name=$2", trashID, originalPath).Scan(&rootID)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query trash root: " + err.Error()})
+		return
+	}
+	if err == nil {
+		if _, err := tx.Exec(`
+			INSERT INTO drivelist (id, name, capacity, created_at, owner_id)
+			SELECT node_id, $2::text || substr(name, length($3::text) + 1), capacity, created_at, $4
+			FROM drive_trash_nodes
+			WHERE trash_id = $1
+		`, trashID, target, originalPath, d.OwnerID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore records: " + err.Error()})
+			return
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO drivelist_closure (ancestor, descendant, depth)
+			SELECT ancestor, descendant, depth FROM drive_trash_closure WHERE trash_id = $1
+		`, trashID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore closure: " + err.Error()})
+			return
+		}
+		if parentID != 0 {
+			// 与 move 相同：把恢复的子树挂到父目录的所有祖先下
+			if _, err := tx.Exec(`
+				INSERT INTO drivelist_closure (ancestor, descendant, depth)
+				SELECT p.ancestor, c.descendant, p.depth + c.depth + 1
+				FROM drivelist_closure p
+				CROSS JOIN drivelist_closure c
+				WHERE p.descendant = $1
+				AND c.ancestor = $2
+			`, parentID, rootID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link restored closure: " + err.Error()})
+				return
+			}
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM drive_trash WHERE id=$1", trashID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete trash record: " + err.Error()})
+		return
+	}
+	if err := d.recordChange(tx, changeCreated, "trash_restore", rootID, target, originalPath, actorOf(c)); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	fullTarget := d.abs(target)
+	if err := os.MkdirAll(filepath.Dir(fullTarget), os.ModePerm); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create parent directory: " + err.Error()})
+		return
+	}
+	if err := os.Rename(storedPath, fullTarget); err != nil && !os.IsNotExist(err) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore file: " + err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		os.Rename(fullTarget, storedPath)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
+		return
+	}
+	committed = true
+	s.notifyChange(d)
+	os.RemoveAll(d.trashStorage(trashID))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Restored successfully",
+		"id":       trashID,
+		"path":     target,
+		"conflict": outcome,
+	})
+}
+
+// handleEmptyTrash 清空回收站；带 id 参数时只彻底删除该条目
+func (s *Server) handleEmptyTrash(c *gin.Context) {
+	d := s.ownDrive(c)
+	var ids []int64
+	if raw := c.Query("id"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'id' query parameter"})
+			return
+		}
+		ids = append(ids, id)
+	} else {
+		rows, err := s.DB.Query("SELECT id FROM drive_trash WHERE owner_id=$1", d.OwnerID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err == nil {
+				ids = append(ids, id)
+			}
+		}
+		rows.Close()
+	}
+
+	purged, err := s.purgeTrash(d, ids, actorOf(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge trash: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Trash emptied", "purged": purged})
+}
+
+// purgeTrash 彻底删除回收站条目及其存储
+func (s *Server) purgeTrash(d *drive, ids []int64, act actor) (int, error) {
+	purged := 0
+	for _, id := range ids {
+		tx, err := s.DB.Begin()
+		if err != nil {
+			return purged, err
+		}
+		var originalPath string
+		err = tx.QueryRow("DELETE FROM drive_trash WHERE id=$1 AND owner_id=$2 RETURNING original_path", id, d.OwnerID).Scan(&originalPath)
+		if err == sql.ErrNoRows {
+			tx.Rollback()
+			continue
+		}
+		if err == nil {
+			err = recordAudit(tx, act, d.OwnerID, "trash_purge", 0, originalPath, "", gin.H{"trash_id": id})
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			tx.Rollback()
+			return purged, err
+		}
+		if err := os.RemoveAll(d.trashStorage(id)); err != nil {
+			log.Printf("warning: failed to remove trash storage %d: %v", id, err)
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// startTrashPurger 后台定期清理超过保留期的回收站条目
+func (s *Server) startTrashPurger(interval time.Duration) {
+	if s.trashRetention <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			s.purgeExpiredTrash()
+			<-ticker.C
+		}
+	}()
+}
+
+func (s *Server) purgeExpiredTrash() {
+	rows, err := s.DB.Query("SELECT id, owner_id FROM drive_trash WHERE deleted_at < $1 AND owner_id IS NOT NULL",
+		time.Now().Add(-s.trashRetention))
+	if err != nil {
+		log.Printf("warning: query expired trash failed: %v", err)
+		return
+	}
+	byOwner := map[int64][]int64{}
+	for rows.Next() {
+		var id, owner int64
+		if err := rows.Scan(&id, &owner); err == nil {
+			byOwner[owner] = append(byOwner[owner], id)
+		}
+	}
+	rows.Close()
+	if len(byOwner) == 0 {
+		return
+	}
+	total := 0
+	for owner, ids := range byOwner {
+		n, err := s.purgeTrash(s.driveOf(owner), ids, systemActor)
+		if err != nil {
+			log.Printf("warning: purge expired trash failed: %v", err)
+		}
+		total += n
+	}
+	log.Printf("回收站自动清理 %d 项", total)
+}
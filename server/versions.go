@@ -0,0 +1,452 @@
+package server
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// 文件版本：每次写入都会记录一条版本（哈希、大小、作者、时间），最新一条即当前内容；
+// 被覆盖的旧内容保存在用户命名空间的 versions/<node_id>/<version>
+
+// versionsDirName 单用户时代 uploads/ 下的版本存储目录，仅在迁移旧数据时使用
+const versionsDirName = "_versions"
+
+// FileVersion 文件的一个历史版本
+type FileVersion struct {
+	Version   int       `json:"version"`
+	Hash      string    `json:"hash"`
+	Size      int64     `json:"size"`
+	Author    string    `json:"author"`
+	CreatedAt time.Time `json:"created_at"`
+	Current   bool      `json:"current"`
+}
+
+// versionRetention 版本保留规则：总是保留最近 KeepLast 个，另外 KeepDays 天内每天保留最后一个
+type versionRetention struct {
+	KeepLast int
+	KeepDays int
+}
+
+func (s *Server) ensureVersionTables() error {
+	stmts := []string{
+		`ALTER TABLE drivelist ADD COLUMN IF NOT EXISTS file_hash TEXT`,
+		// node_id 不加外键：节点进入回收站后恢复时沿用原 ID，版本需要保留；孤儿版本由清理任务回收
+		`CREATE TABLE IF NOT EXISTS drivelist_versions (
+			id SERIAL PRIMARY KEY,
+			node_id INTEGER NOT NULL,
+			version INT NOT NULL,
+			file_hash TEXT NOT NULL,
+			size BIGINT NOT NULL,
+			author TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ DEFAULT now(),
+			UNIQUE (node_id, version)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_versions_node ON drivelist_versions(node_id)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := s.DB.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// actorName 返回执行操作的用户名，未认证的请求退回客户端 IP
+func actorName(c *gin.Context) string {
+	if u := currentUser(c); u != nil {
+		return u.Username
+	}
+	return c.ClientIP()
+}
+
+// versionBlob 返回历史版本内容的存储路径
+func (d *drive) versionBlob(nodeID int64, version int) string {
+	return filepath.Join(d.VersionsDir, strconv.FormatInt(nodeID, 10), strconv.Itoa(version))
+}
+
+// hashFile 计算文件的 SHA256 与大小
+func hashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// archiveCurrent 在覆盖 rel 之前把当前内容保存为历史版本
+// 旧文件会被移动到版本存储中，返回的 undo 用于写入新内容失败时恢复
+func (d *drive) archiveCurrent(q dbQuerier, nodeID int64, rel string) (func(), error) {
+	fullPath := d.abs(rel)
+	info, err := os.Stat(fullPath)
+	if err != nil || info.IsDir() {
+		return func() {}, nil
+	}
+
+	var current int
+	err = q.QueryRow("SELECT version FROM drivelist_versions WHERE node_id=$1 ORDER BY version DESC LIMIT 1", nodeID).Scan(&current)
+	if err == sql.ErrNoRows {
+		// 启用版本功能前上传的文件没有版本记录，补一条基线版本
+		hash, size, err := hashFile(fullPath)
+		if err != nil {
+			return nil, fmt.Errorf("hash current content failed: %v", err)
+		}
+		current = 1
+		if _, err := q.Exec(`INSERT INTO drivelist_versions (node_id, version, file_hash, size, author, created_at, owner_id)
+			VALUES ($1, $2, $3, $4, '', $5, $6)`, nodeID, current, hash, size, info.ModTime(), d.OwnerID); err != nil {
+			return nil, fmt.Errorf("insert baseline version failed: %v", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("query current version failed: %v", err)
+	}
+
+	blob := d.versionBlob(nodeID, current)
+	if err := os.MkdirAll(filepath.Dir(blob), os.ModePerm); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(fullPath, blob); err != nil {
+		return nil, fmt.Errorf("archive current content failed: %v", err)
+	}
+	return func() { os.Rename(blob, fullPath) }, nil
+}
+
+// recordVersion 在写入新内容后追加一条版本记录，hash 为空时现场计算
+func (d *drive) recordVersion(q dbQuerier, nodeID int64, rel, author, hash string) (int, error) {
+	fullPath := d.abs(rel)
+	var size int64
+	if hash == "" {
+		var err error
+		if hash, size, err = hashFile(fullPath); err != nil {
+			return 0, fmt.Errorf("hash content failed: %v", err)
+		}
+	} else if info, err := os.Stat(fullPath); err == nil {
+		size = info.Size()
+	}
+
+	var version int
+	if err := q.QueryRow(`
+		INSERT INTO drivelist_versions (node_id, version, file_hash, size, author, owner_id)
+		SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3, $4, $5
+		FROM drivelist_versions WHERE node_id = $1
+		RETURNING version
+	`, nodeID, hash, size, author, d.OwnerID).Scan(&version); err != nil {
+		return 0, fmt.Errorf("insert version failed: %v", err)
+	}
+	if _, err := q.Exec("UPDATE drivelist SET file_hash=$1 WHERE id=$2", hash, nodeID); err != nil {
+		return 0, fmt.Errorf("update file hash failed: %v", err)
+	}
+	return version, nil
+}
+
+// recordInitialVersions 批量为新插入的文件节点登记第一个版本并写入内容哈希
+func (d *drive) recordInitialVersions(q dbQuerier, nodeIDs []int64, hashes []string, sizes []int64, author string) error {
+	if len(nodeIDs) == 0 {
+		return nil
+	}
+	if _, err := q.Exec(`
+		INSERT INTO drivelist_versions (node_id, version, file_hash, size, author, owner_id)
+		SELECT n, 1, h, s, $4, $5 FROM unnest($1::int[], $2::text[], $3::bigint[]) AS t(n, h, s)
+	`, pq.Array(nodeIDs), pq.Array(hashes), pq.Array(sizes), author, d.OwnerID); err != nil {
+		return fmt.Errorf("insert versions failed: %v", err)
+	}
+	if _, err := q.Exec(`
+		UPDATE drivelist SET file_hash = t.h
+		FROM unnest($1::int[], $2::text[]) AS t(n, h)
+		WHERE drivelist.id = t.n
+	`, pq.Array(nodeIDs), pq.Array(hashes)); err != nil {
+		return fmt.Errorf("update file hash failed: %v", err)
+	}
+	return nil
+}
+
+// listVersions 按版本号倒序返回节点的所有版本
+func listVersions(q dbQuerier, nodeID int64) ([]FileVersion, error) {
+	rows, err := q.Query(`
+		SELECT version, file_hash, size, author, created_at
+		FROM drivelist_versions
+		WHERE node_id = $1
+		ORDER BY version DESC
+	`, nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []FileVersion{}
+	for rows.Next() {
+		var v FileVersion
+		if err := rows.Scan(&v.Version, &v.Hash, &v.Size, &v.Author, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		v.Current = len(versions) == 0
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// versionTarget 解析 name/version 参数、检查 perm 权限并定位版本内容
+func (s *Server) versionTarget(c *gin.Context, d *drive, perm int) (rel string, nodeID int64, v FileVersion, blob string, err error) {
+	rel, err = cleanRelPath(c.Query("name"))
+	if err != nil {
+		return
+	}
+	if rel == "" {
+		err = newAPIError(http.StatusBadRequest, "Missing 'name' query parameter")
+		return
+	}
+	if err = s.authorize(c, d, rel, perm); err != nil {
+		return
+	}
+	version, convErr := strconv.Atoi(c.Query("version"))
+	if convErr != nil {
+		err = newAPIError(http.StatusBadRequest, "Missing or invalid 'version' query parameter")
+		return
+	}
+	if nodeID, err = d.lookupNode(s.DB, rel); err == sql.ErrNoRows {
+		err = newAPIError(http.StatusNotFound, "File not found")
+		return
+	} else if err != nil {
+		return
+	}
+
+	versions, err := listVersions(s.DB, nodeID)
+	if err != nil {
+		return
+	}
+	for _, candidate := range versions {
+		if candidate.Version == version {
+			v = candidate
+			if v.Current {
+				blob = d.abs(rel)
+			} else {
+				blob = d.versionBlob(nodeID, version)
+			}
+			return
+		}
+	}
+	err = newAPIError(http.StatusNotFound, "Version not found")
+	return
+}
+
+func (s *Server) handleListVersions(c *gin.Context) {
+	rel, err := cleanRelPath(c.Query("name"))
+	if err != nil || rel == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing or invalid 'name' query parameter"})
+		return
+	}
+	d := s.driveFor(c)
+	if err := s.authorize(c, d, rel, PermRead); err != nil {
+		respondError(c, err)
+		return
+	}
+	nodeID, err := d.lookupNode(s.DB, rel)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	versions, err := listVersions(s.DB, nodeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list versions: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"name": rel, "count": len(versions), "versions": versions})
+}
+
+func (s *Server) handleDownloadVersion(c *gin.Context) {
+	rel, _, v, blob, err := s.versionTarget(c, s.driveFor(c), PermRead)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if _, err := os.Stat(blob); err != nil {
+		c.JSON(http.StatusGone, gin.H{"error": "Version content is no longer available"})
+		return
+	}
+	c.Header("ETag", `"`+v.Hash+`"`)
+	c.FileAttachment(blob, fmt.Sprintf("v%d_%s", v.Version, filepath.Base(rel)))
+}
+
+func (s *Server) handleRestoreVersion(c *gin.Context) {
+	d := s.driveFor(c)
+	rel, nodeID, v, blob, err := s.versionTarget(c, d, PermWrite)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if v.Current {
+		c.JSON(http.StatusOK, gin.H{"message": "Version is already current", "version": v.Version})
+		return
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var currentSize int64
+	if err := tx.QueryRow("SELECT capacity FROM drivelist WHERE id=$1", nodeID).Scan(&currentSize); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query current size: " + err.Error()})
+		return
+	}
+	if err := s.checkQuota(tx, d, rel, quotaDelta{Bytes: v.Size - currentSize}); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	// 恢复也是一次覆盖：当前内容先归档，再把旧版本复制回原路径
+	undo, err := d.archiveCurrent(tx, nodeID, rel)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	fullPath := d.abs(rel)
+	if err := copyPath(blob, fullPath); err != nil {
+		undo()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore content: " + err.Error()})
+		return
+	}
+	newVersion, err := d.recordVersion(tx, nodeID, rel, actorName(c), v.Hash)
+	if err == nil {
+		_, err = tx.Exec("UPDATE drivelist SET capacity=$1 WHERE id=$2", v.Size, nodeID)
+	}
+	if err == nil {
+		err = d.recordChange(tx, changeUpdated, "version_restore", nodeID, rel, "", actorOf(c))
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		os.Remove(fullPath)
+		undo()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record restored version: " + err.Error()})
+		return
+	}
+	s.notifyChange(d)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Version restored successfully",
+		"name":          rel,
+		"restored_from": v.Version,
+		"version":       newVersion,
+	})
+}
+
+// startVersionPruner 后台按保留规则清理历史版本
+func (s *Server) startVersionPruner(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			s.pruneVersions()
+			<-ticker.C
+		}
+	}()
+}
+
+func (s *Server) pruneVersions() {
+	// 1. 节点已被彻底删除（既不在 drivelist 也不在回收站）的孤儿版本
+	rows, err := s.DB.Query(`
+		DELETE FROM drivelist_versions v
+		WHERE NOT EXISTS (SELECT 1 FROM drivelist d WHERE d.id = v.node_id)
+		AND NOT EXISTS (SELECT 1 FROM drive_trash_nodes t WHERE t.node_id = v.node_id)
+		RETURNING node_id, version, owner_id
+	`)
+	if err != nil {
+		log.Printf("warning: prune orphan versions failed: %v", err)
+		return
+	}
+	removed := 0
+	for rows.Next() {
+		var nodeID int64
+		var version int
+		var owner sql.NullInt64
+		if err := rows.Scan(&nodeID, &version, &owner); err == nil {
+			if owner.Valid {
+				os.Remove(s.driveOf(owner.Int64).versionBlob(nodeID, version))
+			}
+			removed++
+		}
+	}
+	rows.Close()
+
+	// 2. 按保留规则清理
+	rows, err = s.DB.Query(`
+		SELECT node_id, version, owner_id, created_at
+		FROM drivelist_versions
+		WHERE owner_id IS NOT NULL
+		ORDER BY node_id, version DESC
+	`)
+	if err != nil {
+		log.Printf("warning: query versions failed: %v", err)
+		return
+	}
+	type versionRef struct {
+		nodeID  int64
+		version int
+		owner   int64
+	}
+	var expired []versionRef
+	var curNode int64 = -1
+	var kept int
+	seenDays := map[string]bool{}
+	cutoff := time.Now().AddDate(0, 0, -s.versionRetention.KeepDays)
+	for rows.Next() {
+		var ref versionRef
+		var createdAt time.Time
+		if err := rows.Scan(&ref.nodeID, &ref.version, &ref.owner, &createdAt); err != nil {
+			continue
+		}
+		if ref.nodeID != curNode {
+			curNode, kept = ref.nodeID, 0
+			seenDays = map[string]bool{}
+		}
+		day := createdAt.Format("2006-01-02")
+		switch {
+		case kept == 0 || kept < s.versionRetention.KeepLast:
+			// 当前版本与最近 N 个版本总是保留
+		case createdAt.After(cutoff) && !seenDays[day]:
+			// 保留期内每天保留最后一个版本
+		default:
+			expired = append(expired, ref)
+			continue
+		}
+		kept++
+		seenDays[day] = true
+	}
+	rows.Close()
+
+	for _, ref := range expired {
+		if _, err := s.DB.Exec("DELETE FROM drivelist_versions WHERE node_id=$1 AND version=$2", ref.nodeID, ref.version); err != nil {
+			log.Printf("warning: delete version failed: %v", err)
+			continue
+		}
+		os.Remove(s.driveOf(ref.owner).versionBlob(ref.nodeID, ref.version))
+		removed++
+	}
+	if removed > 0 {
+		log.Printf("版本清理：删除 %d 个历史版本", removed)
+	}
+}
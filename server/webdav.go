@@ -0,0 +1,455 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/webdav"
+)
+
+// WebDAV：把 /dav/ 下的请求映射到与 REST 接口相同的元数据和存储路径上，
+// 上传、建目录、移动、删除分别复用 storeFile、makeDir、movePath、trashPath
+
+const davPrefix = "/dav"
+
+// davMethods WebDAV 需要注册的请求方法
+var davMethods = []string{
+	"OPTIONS", "GET", "HEAD", "PUT", "DELETE", "MKCOL",
+	"COPY", "MOVE", "LOCK", "UNLOCK", "PROPFIND", "PROPPATCH",
+}
+
+// 锁按命名空间区分（内存示例，重启后失效）
+var (
+	davLocks   = map[int64]webdav.LockSystem{}
+	davLocksMu sync.Mutex
+)
+
+func davLockSystem(ownerID int64) webdav.LockSystem {
+	davLocksMu.Lock()
+	defer davLocksMu.Unlock()
+	ls, ok := davLocks[ownerID]
+	if !ok {
+		ls = webdav.NewMemLS()
+		davLocks[ownerID] = ls
+	}
+	return ls
+}
+
+// davErr 把接口错误转换为 webdav 包识别的 os 错误
+func davErr(err error) error {
+	var ae *apiError
+	if errors.As(err, &ae) {
+		switch ae.status {
+		case http.StatusNotFound:
+			return os.ErrNotExist
+		case http.StatusForbidden:
+			return os.ErrPermission
+		case http.StatusConflict:
+			return os.ErrExist
+		}
+	}
+	return err
+}
+
+// davFS 一次请求内某个用户看到的命名空间，实现 webdav.FileSystem
+type davFS struct {
+	s       *Server
+	d       *drive
+	userID  int64
+	act     actor
+	visible map[int64]bool // 非所有者可见的节点，nil 表示全部可见
+	loaded  bool
+}
+
+// rel 把 webdav 路径（以 / 开头）转换为命名空间内的相对路径
+func (fs *davFS) rel(name string) (string, error) {
+	rel, err := cleanRelPath(strings.Trim(name, "/"))
+	if err != nil {
+		return "", os.ErrNotExist
+	}
+	return rel, nil
+}
+
+// canSee 判断节点是否可见：可读节点，以及共享目录的祖先（用于逐级浏览）
+func (fs *davFS) canSee(id int64) (bool, error) {
+	if !fs.loaded {
+		visible, err := fs.d.readableNodes(fs.s.DB, fs.userID)
+		if err != nil {
+			return false, err
+		}
+		if visible != nil {
+			rows, err := fs.s.DB.Query(`
+				SELECT DISTINCT c.ancestor
+				FROM drive_acl a
+				JOIN drivelist_closure c ON c.descendant = a.node_id
+				JOIN drivelist d ON d.id = a.node_id
+				WHERE a.user_id = $1 AND d.owner_id = $2 AND a.perms & $3 <> 0
+			`, fs.userID, fs.d.OwnerID, PermRead|PermAdmin)
+			if err != nil {
+				return false, err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var anc int64
+				if err := rows.Scan(&anc); err != nil {
+					return false, err
+				}
+				visible[anc] = true
+			}
+			if err := rows.Err(); err != nil {
+				return false, err
+			}
+		}
+		fs.visible, fs.loaded = visible, true
+	}
+	return fs.visible == nil || fs.visible[id], nil
+}
+
+// stat 返回相对路径对应的磁盘信息，不存在或不可见时返回错误
+func (fs *davFS) stat(rel string) (os.FileInfo, error) {
+	if rel == "" {
+		if err := os.MkdirAll(fs.d.Root, os.ModePerm); err != nil {
+			return nil, err
+		}
+		return os.Stat(fs.d.Root)
+	}
+	id, err := fs.d.lookupNode(fs.s.DB, rel)
+	if err == sql.ErrNoRows {
+		return nil, os.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	ok, err := fs.canSee(id)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, os.ErrPermission
+	}
+	return os.Stat(fs.d.abs(rel))
+}
+
+// readDir 按数据库中的直接子节点列出目录，过滤掉不可见的节点
+func (fs *davFS) readDir(rel string) ([]os.FileInfo, error) {
+	prefix := ""
+	if rel != "" {
+		prefix = rel + "/"
+	}
+	rows, err := fs.s.DB.Query(`
+		SELECT id, name FROM drivelist
+		WHERE owner_id = $1 AND left(name, length($2::text)) = $2
+		AND name <> $2 AND strpos(substr(name, length($2::text) + 1), '/') = 0
+		ORDER BY name
+	`, fs.d.OwnerID, prefix)
+	if err != nil {
+		return nil, err
+	}
+	type child struct {
+		id   int64
+		name string
+	}
+	var children []child
+	for rows.Next() {
+		var ch child
+		if err := rows.Scan(&ch.id, &ch.name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		children = append(children, ch)
+	}
+	rows.Close()
+
+	infos := []os.FileInfo{}
+	for _, ch := range children {
+		if ok, err := fs.canSee(ch.id); err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+		info, err := os.Stat(fs.d.abs(ch.name))
+		if err != nil {
+			continue // 记录存在但文件缺失时跳过
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// requireParent 确认父目录存在（WebDAV 不会自动创建中间目录）
+func (fs *davFS) requireParent(rel string) error {
+	info, err := fs.stat(parentRel(rel))
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return os.ErrNotExist
+	}
+	return nil
+}
+
+func (fs *davFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	rel, err := fs.rel(name)
+	if err != nil {
+		return err
+	}
+	if rel == "" {
+		return os.ErrExist
+	}
+	if err := fs.s.authorizeUser(fs.userID, fs.d, rel, PermWrite); err != nil {
+		return davErr(err)
+	}
+	if err := fs.requireParent(rel); err != nil {
+		return err
+	}
+	_, created, err := fs.s.makeDir(fs.d, rel, fs.act)
+	if err != nil {
+		return err
+	}
+	if !created {
+		return os.ErrExist
+	}
+	return nil
+}
+
+func (fs *davFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	rel, err := fs.rel(name)
+	if err != nil {
+		return nil, err
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		info, err := fs.stat(rel)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			if err := fs.s.authorizeUser(fs.userID, fs.d, rel, PermRead); err != nil {
+				return nil, davErr(err)
+			}
+		}
+		f, err := os.Open(fs.d.abs(rel))
+		if err != nil {
+			return nil, err
+		}
+		return &davFile{File: f, fs: fs, rel: rel, dir: info.IsDir()}, nil
+	}
+
+	// 写入：内容先落到临时文件，Close 时再按覆盖策略放入命名空间
+	if rel == "" {
+		return nil, os.ErrPermission
+	}
+	if err := fs.s.authorizeUser(fs.userID, fs.d, rel, PermWrite); err != nil {
+		return nil, davErr(err)
+	}
+	if err := fs.requireParent(rel); err != nil {
+		return nil, err
+	}
+	if info, err := fs.stat(rel); err == nil && info.IsDir() {
+		return nil, os.ErrExist
+	}
+	tmpDir := filepath.Join(fs.s.uploadDir, "_tmp")
+	if err := os.MkdirAll(tmpDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(tmpDir, "dav-*")
+	if err != nil {
+		return nil, err
+	}
+	return &davUpload{File: tmp, fs: fs, rel: rel}, nil
+}
+
+func (fs *davFS) RemoveAll(ctx context.Context, name string) error {
+	rel, err := fs.rel(name)
+	if err != nil {
+		return err
+	}
+	if rel == "" {
+		return os.ErrPermission
+	}
+	if err := fs.s.authorizeUser(fs.userID, fs.d, rel, PermDelete); err != nil {
+		return davErr(err)
+	}
+	if _, err := fs.d.lookupNode(fs.s.DB, rel); err == sql.ErrNoRows {
+		return nil
+	}
+	// 与 REST 删除一致：移入回收站
+	_, err = fs.s.trashPath(fs.d, rel, false, fs.act)
+	return davErr(err)
+}
+
+func (fs *davFS) Rename(ctx context.Context, oldName, newName string) error {
+	oldRel, err := fs.rel(oldName)
+	if err != nil {
+		return err
+	}
+	newRel, err := fs.rel(newName)
+	if err != nil {
+		return err
+	}
+	if oldRel == "" || newRel == "" {
+		return os.ErrPermission
+	}
+	if err := fs.s.authorizeUser(fs.userID, fs.d, oldRel, PermDelete); err != nil {
+		return davErr(err)
+	}
+	if err := fs.s.authorizeUser(fs.userID, fs.d, newRel, PermWrite); err != nil {
+		return davErr(err)
+	}
+	// 覆盖目标时 webdav 包会先调用 RemoveAll，这里按失败策略处理冲突
+	_, err = fs.s.movePath(fs.d, oldRel, newRel, ConflictFail, fs.act, "move")
+	return davErr(err)
+}
+
+func (fs *davFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	rel, err := fs.rel(name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.stat(rel)
+}
+
+// davFile 只读打开的文件或目录，目录列表来自数据库
+type davFile struct {
+	*os.File
+	fs  *davFS
+	rel string
+	dir bool
+	off int
+}
+
+func (f *davFile) Readdir(count int) ([]os.FileInfo, error) {
+	if !f.dir {
+		return f.File.Readdir(count)
+	}
+	infos, err := f.fs.readDir(f.rel)
+	if err != nil {
+		return nil, err
+	}
+	if count <= 0 {
+		return infos, nil
+	}
+	if f.off >= len(infos) {
+		return nil, io.EOF
+	}
+	end := min(f.off+count, len(infos))
+	page := infos[f.off:end]
+	f.off = end
+	return page, nil
+}
+
+// davUpload 写入中的文件，关闭时提交到命名空间（冲突、配额、历史版本与 REST 上传一致）
+type davUpload struct {
+	*os.File
+	fs  *davFS
+	rel string
+}
+
+func (f *davUpload) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
+
+func (f *davUpload) Close() error {
+	defer os.Remove(f.Name())
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	_, _, err := f.fs.s.storeFile(f.fs.d, f.rel, f.Name(), ConflictOverwrite, time.Time{}, f.fs.act, "")
+	if err != nil {
+		log.Printf("webdav: store %s failed: %v", f.rel, err)
+	}
+	return davErr(err)
+}
+
+// davChallenge 未携带凭据时提示客户端使用 Basic 认证
+func davChallenge() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			c.Header("WWW-Authenticate", `Basic realm="single-drive"`)
+		}
+		c.Next()
+	}
+}
+
+// davPrecheck 在交给 webdav 包之前检查权限与配额，以便返回准确的状态码
+// （webdav 包只能把文件系统错误映射为 404/405/409 等少数状态）
+func (s *Server) davPrecheck(c *gin.Context, d *drive) error {
+	rel, err := cleanRelPath(strings.Trim(c.Param("path"), "/"))
+	if err != nil {
+		return err
+	}
+	dest := ""
+	if raw := c.GetHeader("Destination"); raw != "" {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return newAPIError(http.StatusBadRequest, "Invalid Destination header")
+		}
+		if dest, err = cleanRelPath(strings.Trim(strings.TrimPrefix(u.Path, davPrefix), "/")); err != nil {
+			return err
+		}
+	}
+	switch c.Request.Method {
+	case "PUT":
+		if err := s.authorize(c, d, rel, PermWrite); err != nil {
+			return err
+		}
+		if c.Request.ContentLength > 0 {
+			return s.precheckUploadQuota(d, rel, c.Request.ContentLength, ConflictOverwrite)
+		}
+	case "MKCOL":
+		return s.authorize(c, d, rel, PermWrite)
+	case "DELETE":
+		return s.authorize(c, d, rel, PermDelete)
+	case "MOVE", "COPY":
+		perm := PermDelete
+		if c.Request.Method == "COPY" {
+			perm = PermRead
+		}
+		if err := s.authorize(c, d, rel, perm); err != nil {
+			return err
+		}
+		return s.authorize(c, d, dest, PermWrite)
+	}
+	return nil
+}
+
+// handleWebDAV WebDAV 入口：/dav/<path>，可通过 ?owner= 访问共享给自己的命名空间
+func (s *Server) handleWebDAV(c *gin.Context) {
+	u := currentUser(c)
+	d := s.driveOf(u.ID)
+	if raw := c.Query("owner"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'owner' parameter"})
+			return
+		}
+		d = s.driveOf(id)
+	}
+	if err := s.davPrecheck(c, d); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	h := &webdav.Handler{
+		Prefix:     davPrefix,
+		FileSystem: &davFS{s: s, d: d, userID: u.ID, act: actorOf(c)},
+		LockSystem: davLockSystem(d.OwnerID),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				log.Printf("webdav %s %s: %v", r.Method, r.URL.Path, err)
+			}
+		},
+	}
+	h.ServeHTTP(c.Writer, c.Request)
+}
@@ -0,0 +1,668 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 出站 Webhook：调度器按游标读取 drive_changes（与事件流共用同一批变更记录），
+// 按路径前缀与事件类型匹配后生成投递记录；投递失败按指数退避重试，
+// 超过最大次数进入死信列表，可手动重新投递
+
+const (
+	deliveryPending   = "pending"
+	deliveryDelivered = "delivered"
+	deliveryDead      = "dead"
+)
+
+const (
+	webhookPollInterval = 5 * time.Second
+	webhookTimeout      = 10 * time.Second
+	webhookBaseBackoff  = 30 * time.Second
+	webhookMaxBackoff   = 6 * time.Hour
+	webhookBatchSize    = 100
+)
+
+// webhookEventTypes 可订阅的事件类型
+var webhookEventTypes = []string{changeCreated, changeUpdated, changeMoved, changeDeleted}
+
+// Webhook 一个出站 Webhook 配置
+type Webhook struct {
+	ID         int64     `json:"id"`
+	URL        string    `json:"url"`
+	PathPrefix string    `json:"path_prefix"`
+	Events     []string  `json:"events"` // 为空表示全部类型
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	ownerID int64
+	secret  string
+	cursor  int64
+}
+
+// WebhookDelivery 一次投递（含重试状态）
+type WebhookDelivery struct {
+	ID            int64      `json:"id"`
+	WebhookID     int64      `json:"webhook_id"`
+	ChangeID      int64      `json:"change_id"`
+	EventType     string     `json:"event_type"`
+	Path          string     `json:"path"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	LastStatus    int        `json:"last_status,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+}
+
+func (s *Server) ensureWebhookTables() error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS webhooks (
+			id SERIAL PRIMARY KEY,
+			owner_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			path_prefix TEXT NOT NULL DEFAULT '',
+			events TEXT NOT NULL DEFAULT '',
+			active BOOLEAN NOT NULL DEFAULT true,
+			last_change_id BIGINT NOT NULL DEFAULT 0,
+			created_at TIMESTAMPTZ DEFAULT now()
+		)`,
+		`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id SERIAL PRIMARY KEY,
+			webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+			change_id BIGINT NOT NULL,
+			event_type TEXT NOT NULL,
+			path TEXT NOT NULL DEFAULT '',
+			payload TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'pending',
+			attempts INT NOT NULL DEFAULT 0,
+			next_attempt_at TIMESTAMPTZ DEFAULT now(),
+			last_status INT NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ DEFAULT now(),
+			delivered_at TIMESTAMPTZ,
+			UNIQUE (webhook_id, change_id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := s.DB.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseWebhookEvents 校验事件类型列表，返回逗号分隔的存储形式
+func parseWebhookEvents(events []string) (string, error) {
+	seen := map[string]bool{}
+	var out []string
+	for _, ev := range events {
+		ev = strings.ToLower(strings.TrimSpace(ev))
+		if ev == "" || seen[ev] {
+			continue
+		}
+		valid := false
+		for _, t := range webhookEventTypes {
+			if ev == t {
+				valid = true
+			}
+		}
+		if !valid {
+			return "", newAPIError(http.StatusBadRequest, "Unknown event type: %s", ev)
+		}
+		seen[ev] = true
+		out = append(out, ev)
+	}
+	return strings.Join(out, ","), nil
+}
+
+// matches 判断事件是否命中 Webhook 的路径前缀与类型；移动事件的新旧路径任一命中即可
+func (w *Webhook) matches(ev ChangeEvent) bool {
+	if len(w.Events) > 0 {
+		found := false
+		for _, t := range w.Events {
+			if t == ev.Type {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	under := func(p string) bool {
+		return w.PathPrefix == "" || p == w.PathPrefix || strings.HasPrefix(p, w.PathPrefix+"/")
+	}
+	return under(ev.Path) || (ev.OldPath != "" && under(ev.OldPath))
+}
+
+const webhookColumns = `id, owner_id, url, secret, path_prefix, events, active, last_change_id, created_at`
+
+func scanWebhook(row interface{ Scan(...any) error }) (*Webhook, error) {
+	var w Webhook
+	var events string
+	if err := row.Scan(&w.ID, &w.ownerID, &w.URL, &w.secret, &w.PathPrefix, &events, &w.Active, &w.cursor, &w.CreatedAt); err != nil {
+		return nil, err
+	}
+	w.Events = []string{}
+	if events != "" {
+		w.Events = strings.Split(events, ",")
+	}
+	return &w, nil
+}
+
+// validateWebhookURL 只允许 http/https 地址；内网地址在投递时由拨号器拦截
+func validateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return newAPIError(http.StatusBadRequest, "Invalid webhook url: must be an absolute http(s) URL")
+	}
+	return nil
+}
+
+// handleCreateWebhook 创建 Webhook：POST /webhooks，签名密钥只在创建时返回一次
+func (s *Server) handleCreateWebhook(c *gin.Context) {
+	var req struct {
+		URL        string   `json:"url"`
+		PathPrefix string   `json:"path_prefix"`
+		Events     []string `json:"events"`
+		Secret     string   `json:"secret"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if err := validateWebhookURL(req.URL); err != nil {
+		respondError(c, err)
+		return
+	}
+	prefix, err := cleanRelPath(req.PathPrefix)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	events, err := parseWebhookEvents(req.Events)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	secret := req.Secret
+	if secret == "" {
+		buf := make([]byte, 24)
+		if _, err := rand.Read(buf); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		secret = hex.EncodeToString(buf)
+	}
+
+	// 只投递创建之后的事件：游标从当前最新的变更开始
+	d := s.ownDrive(c)
+	var id int64
+	err = s.withAudit(actorOf(c), d.OwnerID, "webhook_create", prefix, gin.H{"url": req.URL, "events": events}, func(tx *sql.Tx) error {
+		return tx.QueryRow(`
+			INSERT INTO webhooks (owner_id, url, secret, path_prefix, events, last_change_id)
+			VALUES ($1, $2, $3, $4, $5, (SELECT COALESCE(MAX(id), 0) FROM drive_changes WHERE owner_id = $1))
+			RETURNING id
+		`, d.OwnerID, req.URL, secret, prefix, events).Scan(&id)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Webhook created",
+		"id":      id,
+		"secret":  secret,
+	})
+}
+
+// handleListWebhooks 列出当前用户的 Webhook
+func (s *Server) handleListWebhooks(c *gin.Context) {
+	rows, err := s.DB.Query(`SELECT `+webhookColumns+` FROM webhooks WHERE owner_id = $1 ORDER BY id`, currentUser(c).ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+	hooks := []*Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		hooks = append(hooks, w)
+	}
+	c.JSON(http.StatusOK, gin.H{"count": len(hooks), "items": hooks})
+}
+
+// ownedWebhook 读取当前用户的 Webhook
+func (s *Server) ownedWebhook(c *gin.Context) (*Webhook, error) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, newAPIError(http.StatusBadRequest, "Invalid webhook id")
+	}
+	w, err := scanWebhook(s.DB.QueryRow(`SELECT `+webhookColumns+` FROM webhooks WHERE id = $1 AND owner_id = $2`, id, currentUser(c).ID))
+	if err == sql.ErrNoRows {
+		return nil, newAPIError(http.StatusNotFound, "Webhook not found")
+	}
+	return w, err
+}
+
+// handleUpdateWebhook 修改 Webhook：PUT /webhooks/:id，只更新请求中出现的字段
+func (s *Server) handleUpdateWebhook(c *gin.Context) {
+	w, err := s.ownedWebhook(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	var req struct {
+		URL        *string   `json:"url"`
+		PathPrefix *string   `json:"path_prefix"`
+		Events     *[]string `json:"events"`
+		Active     *bool     `json:"active"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if req.URL != nil {
+		if err := validateWebhookURL(*req.URL); err != nil {
+			respondError(c, err)
+			return
+		}
+		w.URL = *req.URL
+	}
+	if req.PathPrefix != nil {
+		if w.PathPrefix, err = cleanRelPath(*req.PathPrefix); err != nil {
+			respondError(c, err)
+			return
+		}
+	}
+	events := strings.Join(w.Events, ",")
+	if req.Events != nil {
+		if events, err = parseWebhookEvents(*req.Events); err != nil {
+			respondError(c, err)
+			return
+		}
+	}
+	if req.Active != nil {
+		w.Active = *req.Active
+	}
+	// 重新启用时跳过停用期间的事件
+	detail := gin.H{"id": w.ID, "url": w.URL, "events": events, "active": w.Active}
+	err = s.withAudit(actorOf(c), w.ownerID, "webhook_update", w.PathPrefix, detail, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			UPDATE webhooks SET url = $1, path_prefix = $2, events = $3, active = $4,
+				last_change_id = CASE WHEN active THEN last_change_id ELSE (SELECT COALESCE(MAX(id), 0) FROM drive_changes WHERE owner_id = webhooks.owner_id) END
+			WHERE id = $5
+		`, w.URL, w.PathPrefix, events, w.Active, w.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook updated", "id": w.ID})
+}
+
+// handleDeleteWebhook 删除 Webhook 及其投递记录
+func (s *Server) handleDeleteWebhook(c *gin.Context) {
+	w, err := s.ownedWebhook(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	err = s.withAudit(actorOf(c), w.ownerID, "webhook_delete", w.PathPrefix, gin.H{"id": w.ID, "url": w.URL}, func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM webhooks WHERE id = $1", w.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted", "id": w.ID})
+}
+
+const deliveryColumns = `d.id, d.webhook_id, d.change_id, d.event_type, d.path, d.status, d.attempts,
+	d.next_attempt_at, d.last_status, d.last_error, d.created_at, d.delivered_at`
+
+func scanDelivery(row interface{ Scan(...any) error }) (*WebhookDelivery, error) {
+	var dl WebhookDelivery
+	var next, delivered sql.NullTime
+	if err := row.Scan(&dl.ID, &dl.WebhookID, &dl.ChangeID, &dl.EventType, &dl.Path, &dl.Status, &dl.Attempts,
+		&next, &dl.LastStatus, &dl.LastError, &dl.CreatedAt, &delivered); err != nil {
+		return nil, err
+	}
+	if next.Valid && dl.Status == deliveryPending {
+		dl.NextAttemptAt = &next.Time
+	}
+	if delivered.Valid {
+		dl.DeliveredAt = &delivered.Time
+	}
+	return &dl, nil
+}
+
+// listDeliveries 按条件查询当前用户 Webhook 的投递记录
+func (s *Server) listDeliveries(c *gin.Context, webhookID int64, status string) {
+	limit := 100
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > 1000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'limit' parameter"})
+			return
+		}
+		limit = n
+	}
+	rows, err := s.DB.Query(`SELECT `+deliveryColumns+`
+		FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+		WHERE w.owner_id = $1 AND ($2 = 0 OR d.webhook_id = $2) AND ($3 = '' OR d.status = $3)
+		ORDER BY d.id DESC
+		LIMIT $4
+	`, currentUser(c).ID, webhookID, status, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+	items := []*WebhookDelivery{}
+	for rows.Next() {
+		dl, err := scanDelivery(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		items = append(items, dl)
+	}
+	c.JSON(http.StatusOK, gin.H{"count": len(items), "items": items})
+}
+
+// handleWebhookDeliveries 投递日志：GET /webhooks/:id/deliveries[?status=]
+func (s *Server) handleWebhookDeliveries(c *gin.Context) {
+	w, err := s.ownedWebhook(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	status := c.Query("status")
+	if status != "" && status != deliveryPending && status != deliveryDelivered && status != deliveryDead {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'status' parameter"})
+		return
+	}
+	s.listDeliveries(c, w.ID, status)
+}
+
+// handleWebhookDeadLetters 死信列表：GET /webhooks/dead，所有 Webhook 中放弃重试的投递
+func (s *Server) handleWebhookDeadLetters(c *gin.Context) {
+	s.listDeliveries(c, 0, deliveryDead)
+}
+
+// handleRedeliver 重新投递：POST /webhooks/deliveries/:id/retry，重置重试次数并立即排队
+func (s *Server) handleRedeliver(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery id"})
+		return
+	}
+	res, err := s.DB.Exec(`
+		UPDATE webhook_deliveries d SET status = 'pending', attempts = 0, next_attempt_at = now(), last_error = ''
+		FROM webhooks w
+		WHERE d.id = $1 AND w.id = d.webhook_id AND w.owner_id = $2
+	`, id, currentUser(c).ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		return
+	}
+	s.wakeWebhooks()
+	c.JSON(http.StatusOK, gin.H{"message": "Delivery queued", "id": id})
+}
+
+// webhookSignature 计算签名：HMAC-SHA256(secret, timestamp + "." + body)
+func webhookSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff 第 attempts 次失败后的等待时间：30s、1m、2m……最长 6 小时
+func webhookBackoff(attempts int) time.Duration {
+	d := webhookBaseBackoff
+	for i := 1; i < attempts && d < webhookMaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, webhookMaxBackoff)
+}
+
+// newWebhookClient 投递用的 HTTP 客户端；除非 WEBHOOK_ALLOW_PRIVATE=true，拒绝连接回环与内网地址
+func newWebhookClient() *http.Client {
+	allowPrivate := os.Getenv("WEBHOOK_ALLOW_PRIVATE") == "true"
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if allowPrivate {
+				return nil
+			}
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() || ip.IsMulticast() {
+				return fmt.Errorf("webhook target %s is not allowed", host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	return &http.Client{
+		Timeout:   webhookTimeout,
+		Transport: transport,
+		// 不跟随重定向，避免绕过地址限制
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+}
+
+// wakeWebhooks 唤醒调度器（有新的变更或手动重新投递时）
+func (s *Server) wakeWebhooks() {
+	select {
+	case s.webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// startWebhookDispatcher 后台调度：先把新变更展开为投递记录，再投递到期的记录
+func (s *Server) startWebhookDispatcher() {
+	s.webhookWake = make(chan struct{}, 1)
+	client := newWebhookClient()
+	maxAttempts := envInt("WEBHOOK_MAX_ATTEMPTS", 8)
+	go func() {
+		ticker := time.NewTicker(webhookPollInterval)
+		defer ticker.Stop()
+		for {
+			if err := s.enqueueWebhookDeliveries(); err != nil {
+				log.Printf("warning: enqueue webhook deliveries failed: %v", err)
+			}
+			s.sendDueDeliveries(client, maxAttempts)
+			select {
+			case <-s.webhookWake:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// enqueueWebhookDeliveries 为每个启用的 Webhook 读取其游标之后的变更，命中的生成投递记录
+func (s *Server) enqueueWebhookDeliveries() error {
+	rows, err := s.DB.Query(`SELECT ` + webhookColumns + ` FROM webhooks WHERE active`)
+	if err != nil {
+		return err
+	}
+	var hooks []*Webhook
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		hooks = append(hooks, w)
+	}
+	rows.Close()
+
+	for _, w := range hooks {
+		d := s.driveOf(w.ownerID)
+		for {
+			events, err := d.changesSince(s.DB, w.cursor, changeBatchSize)
+			if err != nil {
+				return err
+			}
+			if len(events) == 0 {
+				break
+			}
+			tx, err := s.DB.Begin()
+			if err != nil {
+				return err
+			}
+			for _, ev := range events {
+				if !w.matches(ev) {
+					continue
+				}
+				payload, _ := json.Marshal(gin.H{"webhook_id": w.ID, "event": ev})
+				if _, err := tx.Exec(`
+					INSERT INTO webhook_deliveries (webhook_id, change_id, event_type, path, payload)
+					VALUES ($1, $2, $3, $4, $5)
+					ON CONFLICT (webhook_id, change_id) DO NOTHING
+				`, w.ID, ev.Cursor, ev.Type, ev.Path, string(payload)); err != nil {
+					tx.Rollback()
+					return err
+				}
+			}
+			w.cursor = events[len(events)-1].Cursor
+			if _, err := tx.Exec("UPDATE webhooks SET last_change_id = $1 WHERE id = $2", w.cursor, w.ID); err != nil {
+				tx.Rollback()
+				return err
+			}
+			if err := tx.Commit(); err != nil {
+				return err
+			}
+			if len(events) < changeBatchSize {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// sendDueDeliveries 投递所有到期的记录
+func (s *Server) sendDueDeliveries(client *http.Client, maxAttempts int) {
+	type due struct {
+		id      int64
+		payload string
+		event   string
+		url     string
+		secret  string
+		attempt int
+	}
+	rows, err := s.DB.Query(`
+		SELECT d.id, d.payload, d.event_type, w.url, w.secret, d.attempts
+		FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.status = 'pending' AND d.next_attempt_at <= now() AND w.active
+		ORDER BY d.id
+		LIMIT $1
+	`, webhookBatchSize)
+	if err != nil {
+		log.Printf("warning: query webhook deliveries failed: %v", err)
+		return
+	}
+	var items []due
+	for rows.Next() {
+		var it due
+		if err := rows.Scan(&it.id, &it.payload, &it.event, &it.url, &it.secret, &it.attempt); err == nil {
+			items = append(items, it)
+		}
+	}
+	rows.Close()
+
+	for _, it := range items {
+		status, err := postWebhook(client, it.url, it.secret, it.event, it.id, []byte(it.payload))
+		attempts := it.attempt + 1
+		if err == nil {
+			if _, err := s.DB.Exec(`
+				UPDATE webhook_deliveries SET status = 'delivered', attempts = $2, last_status = $3, last_error = '', delivered_at = now()
+				WHERE id = $1
+			`, it.id, attempts, status); err != nil {
+				log.Printf("warning: update webhook delivery failed: %v", err)
+			}
+			continue
+		}
+		next := deliveryPending
+		if attempts >= maxAttempts {
+			next = deliveryDead
+		}
+		if _, err := s.DB.Exec(`
+			UPDATE webhook_deliveries SET status = $2, attempts = $3, last_status = $4, last_error = $5, next_attempt_at = $6
+			WHERE id = $1
+		`, it.id, next, attempts, status, err.Error(), time.Now().Add(webhookBackoff(attempts))); err != nil {
+			log.Printf("warning: update webhook delivery failed: %v", err)
+		}
+	}
+}
+
+// postWebhook 发送一次投递，2xx 视为成功；返回响应状态码（连接失败时为 0）
+func postWebhook(client *http.Client, target, secret, event string, deliveryID int64, body []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "single-drive-webhook")
+	req.Header.Set("X-Drive-Event", event)
+	req.Header.Set("X-Drive-Delivery", strconv.FormatInt(deliveryID, 10))
+	req.Header.Set("X-Drive-Timestamp", timestamp)
+	req.Header.Set("X-Drive-Webhook-Signature", webhookSignature(secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,467 @@
+package shared
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// 安全解压：zip 与 tar（可带 gzip / zstd 压缩）共用同一套限制与策略，
+// 防止路径穿越、压缩炸弹、经由符号链接写到解压目录之外，以及带 setuid 等特殊权限位的文件
+
+var (
+	// ErrArchiveLimit 归档超出 ExtractLimits 中的某项限制
+	ErrArchiveLimit = errors.New("archive exceeds extraction limits")
+	// ErrIllegalPath 条目路径或链接目标越出解压目录
+	ErrIllegalPath = errors.New("illegal path in archive")
+	// ErrExists OverwriteFail 策略下目标文件已存在
+	ErrExists = errors.New("file already exists")
+)
+
+// SymlinkPolicy 符号链接与硬链接条目的处理方式
+type SymlinkPolicy int
+
+const (
+	SymlinkSkip   SymlinkPolicy = iota // 跳过（默认）
+	SymlinkReject                      // 遇到链接即报错
+	SymlinkInside                      // 只创建目标在解压目录之内的链接，其余报错
+)
+
+// OverwritePolicy 目标文件已存在时的处理方式；目录总是合并
+type OverwritePolicy int
+
+const (
+	OverwriteReplace OverwritePolicy = iota // 覆盖（默认）
+	OverwriteSkip                           // 保留已有文件
+	OverwriteFail                           // 报错
+)
+
+// ExtractLimits 解压限制，0 表示不限制
+type ExtractLimits struct {
+	MaxFiles int   // 条目数上限
+	MaxBytes int64 // 展开后的总字节数上限
+	MaxRatio int64 // 展开后大小与归档大小之比的上限
+}
+
+// ExtractOptions 解压选项
+type ExtractOptions struct {
+	ExtractLimits
+	Symlinks  SymlinkPolicy
+	PermMask  os.FileMode // 与条目的权限位相与，0 表示 DefaultPermMask；setuid、setgid、sticky 位总是去掉
+	Overwrite OverwritePolicy
+}
+
+// DefaultPermMask 默认去掉组和其他用户的写权限
+const DefaultPermMask os.FileMode = 0755
+
+// DefaultExtractOptions 默认选项：最多 10 万个条目、展开 10GB、压缩比 200:1，跳过链接，覆盖已有文件
+var DefaultExtractOptions = ExtractOptions{
+	ExtractLimits: ExtractLimits{MaxFiles: 100000, MaxBytes: 10 << 30, MaxRatio: 200},
+}
+
+// ratioMinBytes 展开后不足该大小时不检查压缩比，避免小文件误判
+const ratioMinBytes = 1 << 20
+
+// ExtractGuard 在解压过程中累计条目数与展开后的字节数，超出限制时返回包装了 ErrArchiveLimit 的错误。
+// 作为 io.Writer 与解压输出并联使用；input 返回已读取的归档字节数，用于计算压缩比
+type ExtractGuard struct {
+	limits ExtractLimits
+	input  func() int64
+	files  int
+	total  int64
+}
+
+// NewExtractGuard 创建解压限制检查器，input 为 nil 时不检查压缩比
+func NewExtractGuard(limits ExtractLimits, input func() int64) *ExtractGuard {
+	return &ExtractGuard{limits: limits, input: input}
+}
+
+// Entry 计入一个条目
+func (g *ExtractGuard) Entry() error {
+	g.files++
+	if g.limits.MaxFiles > 0 && g.files > g.limits.MaxFiles {
+		return fmt.Errorf("%w: more than %d entries", ErrArchiveLimit, g.limits.MaxFiles)
+	}
+	return nil
+}
+
+// Reserve 条目声明的大小已经超出剩余额度时提前报错，不必解压（zip 在目录中声明了每个条目的大小）
+func (g *ExtractGuard) Reserve(size uint64) error {
+	if max := g.limits.MaxBytes; max > 0 && size > uint64(max-g.total) {
+		return fmt.Errorf("%w: expands to more than %d bytes", ErrArchiveLimit, max)
+	}
+	return nil
+}
+
+// Total 已展开的字节数
+func (g *ExtractGuard) Total() int64 { return g.total }
+
+func (g *ExtractGuard) Write(p []byte) (int, error) {
+	g.total += int64(len(p))
+	if g.limits.MaxBytes > 0 && g.total > g.limits.MaxBytes {
+		return 0, fmt.Errorf("%w: expands to more than %d bytes", ErrArchiveLimit, g.limits.MaxBytes)
+	}
+	if g.limits.MaxRatio > 0 && g.input != nil && g.total > ratioMinBytes {
+		if in := g.input(); in > 0 && g.total/in > g.limits.MaxRatio {
+			return 0, fmt.Errorf("%w: compression ratio exceeds %d:1", ErrArchiveLimit, g.limits.MaxRatio)
+		}
+	}
+	return len(p), nil
+}
+
+// extractor 把条目写入 dest，所有路径都经过 target 检查
+type extractor struct {
+	dest  string
+	real  string // dest 解析符号链接后的真实路径
+	opts  ExtractOptions
+	guard *ExtractGuard
+}
+
+func newExtractor(destDir string, opts ExtractOptions, input func() int64) (*extractor, error) {
+	if err := os.MkdirAll(destDir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create destination directory: %v", err)
+	}
+	real, err := filepath.EvalSymlinks(destDir)
+	if err != nil {
+		return nil, err
+	}
+	return &extractor{dest: filepath.Clean(destDir), real: real, opts: opts, guard: NewExtractGuard(opts.ExtractLimits, input)}, nil
+}
+
+// within 判断 p 是否位于 base 之内（含 base 本身）
+func within(base, p string) bool {
+	rel, err := filepath.Rel(base, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator))
+}
+
+// innerDotDot 判断链接目标是否在普通路径段之后出现 ..。系统解析时先跟随中间的符号链接再处理其后的 ..，
+// 像 sub/up/.. 这样的目标字面上在解压目录之内，经由先前解压的 sub/up -> .. 实际却指向外部
+func innerDotDot(target string) bool {
+	named := false
+	for _, part := range strings.Split(filepath.ToSlash(target), "/") {
+		switch part {
+		case "", ".":
+		case "..":
+			if named {
+				return true
+			}
+		default:
+			named = true
+		}
+	}
+	return false
+}
+
+// target 清理条目名并拼接到解压目录：拒绝绝对路径与 ..，归档根目录返回空串
+func (x *extractor) target(name string) (string, error) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	clean := path.Clean(name)
+	if path.IsAbs(clean) || filepath.VolumeName(name) != "" || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("%w: %s", ErrIllegalPath, name)
+	}
+	if clean == "." {
+		return "", nil
+	}
+	return filepath.Join(x.dest, filepath.FromSlash(clean)), nil
+}
+
+// checkParents 确认 dst 的各级上级目录都不是符号链接，防止先放一个指向外部的链接再经由它写文件
+func (x *extractor) checkParents(dst string) error {
+	rel, err := filepath.Rel(x.dest, filepath.Dir(dst))
+	if err != nil || rel == "." {
+		return err
+	}
+	p := x.dest
+	for _, part := range strings.Split(rel, string(os.PathSeparator)) {
+		p = filepath.Join(p, part)
+		info, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%w: %s is a symbolic link", ErrIllegalPath, p)
+		}
+	}
+	return nil
+}
+
+// prepare 检查条目并为写入做准备；返回 false 表示按 OverwriteSkip 跳过
+func (x *extractor) prepare(name string) (string, bool, error) {
+	dst, err := x.target(name)
+	if err != nil || dst == "" {
+		return "", false, err
+	}
+	if err := x.guard.Entry(); err != nil {
+		return "", false, err
+	}
+	if err := x.checkParents(dst); err != nil {
+		return "", false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return "", false, fmt.Errorf("failed to create parent directory for %s: %v", dst, err)
+	}
+	info, err := os.Lstat(dst)
+	if os.IsNotExist(err) {
+		return dst, true, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if info.IsDir() {
+		return "", false, fmt.Errorf("%w: a folder exists at %s", ErrExists, name)
+	}
+	switch x.opts.Overwrite {
+	case OverwriteSkip:
+		return "", false, nil
+	case OverwriteFail:
+		return "", false, fmt.Errorf("%w: %s", ErrExists, name)
+	}
+	// 覆盖前删除旧条目，避免经由已有的符号链接写到别处
+	return dst, true, os.Remove(dst)
+}
+
+func (x *extractor) perm(mode os.FileMode) os.FileMode {
+	mask := x.opts.PermMask
+	if mask == 0 {
+		mask = DefaultPermMask
+	}
+	return mode.Perm() & mask
+}
+
+func (x *extractor) dir(name string, mode os.FileMode) error {
+	dst, err := x.target(name)
+	if err != nil || dst == "" {
+		return err
+	}
+	if err := x.guard.Entry(); err != nil {
+		return err
+	}
+	if err := x.checkParents(dst); err != nil {
+		return err
+	}
+	if info, err := os.Lstat(dst); err == nil && !info.IsDir() {
+		return fmt.Errorf("%w: a file exists at %s", ErrExists, name)
+	}
+	if err := os.MkdirAll(dst, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create directory %s: %v", dst, err)
+	}
+	// 保留目录自身的写和执行权限，否则无法继续解压其中的条目
+	return os.Chmod(dst, x.perm(mode)|0700)
+}
+
+func (x *extractor) file(name string, mode os.FileMode, modTime time.Time, r io.Reader) error {
+	dst, ok, err := x.prepare(name)
+	if err != nil || !ok {
+		return err
+	}
+	perm := x.perm(mode)
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_EXCL, perm|0200)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(io.MultiWriter(out, x.guard), r)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(dst, perm); err != nil {
+		return err
+	}
+	if !modTime.IsZero() {
+		return os.Chtimes(dst, modTime, modTime)
+	}
+	return nil
+}
+
+// link 创建符号链接（target 相对于链接所在目录）或硬链接（target 为归档内的路径）
+func (x *extractor) link(name, target string, hard bool) error {
+	switch x.opts.Symlinks {
+	case SymlinkSkip:
+		return nil
+	case SymlinkReject:
+		return fmt.Errorf("%w: link %s -> %s", ErrIllegalPath, name, target)
+	}
+	dst, err := x.target(name)
+	if err != nil || dst == "" {
+		return err
+	}
+	var resolved string
+	if hard {
+		resolved, err = x.target(target)
+	} else if path.IsAbs(filepath.ToSlash(target)) || filepath.VolumeName(target) != "" || innerDotDot(target) {
+		err = fmt.Errorf("%w: link %s -> %s", ErrIllegalPath, name, target)
+	} else {
+		resolved = filepath.Join(filepath.Dir(dst), target)
+	}
+	if err != nil {
+		return err
+	}
+	if !within(x.dest, resolved) {
+		return fmt.Errorf("%w: link %s -> %s", ErrIllegalPath, name, target)
+	}
+	if hard {
+		// 硬链接目标可能经由先前解压的符号链接，按真实路径检查并链接到真实文件
+		real, err := filepath.EvalSymlinks(resolved)
+		if err != nil || !within(x.real, real) {
+			return fmt.Errorf("%w: hard link %s -> %s does not point to an extracted file", ErrIllegalPath, name, target)
+		}
+		if info, err := os.Lstat(real); err != nil || !info.Mode().IsRegular() {
+			return fmt.Errorf("%w: hard link %s -> %s does not point to an extracted file", ErrIllegalPath, name, target)
+		}
+		resolved = real
+	}
+
+	dst, ok, err := x.prepare(name)
+	if err != nil || !ok {
+		return err
+	}
+	if hard {
+		return os.Link(resolved, dst)
+	}
+	return os.Symlink(target, dst)
+}
+
+// Unzip 以默认选项解压 zip 文件
+func Unzip(zipPath string, destDir string) error {
+	f, err := os.Open(zipPath)
+	if err != nil {
+		return fmt.Errorf("failed to open zip file: %v", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return UnzipReader(f, info.Size(), destDir, DefaultExtractOptions)
+}
+
+// UnzipReader 从随机访问的 r 解压 zip 到 destDir
+func UnzipReader(r io.ReaderAt, size int64, destDir string, opts ExtractOptions) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("failed to open zip file: %v", err)
+	}
+	x, err := newExtractor(destDir, opts, func() int64 { return size })
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		if err := x.zipEntry(f); err != nil {
+			return fmt.Errorf("failed to extract %s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+func (x *extractor) zipEntry(f *zip.File) error {
+	mode := f.Mode()
+	switch {
+	case mode&os.ModeSymlink != 0:
+		// zip 中符号链接的内容即链接目标
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		target, err := io.ReadAll(io.LimitReader(rc, 4096))
+		if err != nil {
+			return err
+		}
+		return x.link(f.Name, string(target), false)
+	case mode.IsDir():
+		return x.dir(f.Name, mode)
+	case mode.IsRegular():
+		if err := x.guard.Reserve(f.UncompressedSize64); err != nil {
+			return err
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		return x.file(f.Name, mode, f.Modified, rc)
+	}
+	return nil // 设备文件、命名管道等跳过
+}
+
+// countingReader 统计读取的字节数（解压前的输入）
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Untar 从 r 流式解压 tar 到 destDir，按文件头识别 gzip、zstd 压缩；保留权限位（经 PermMask 过滤）与修改时间
+func Untar(r io.Reader, destDir string, opts ExtractOptions) error {
+	counter := &countingReader{r: r}
+	br := bufio.NewReader(counter)
+	x, err := newExtractor(destDir, opts, func() int64 { return counter.n })
+	if err != nil {
+		return err
+	}
+
+	var src io.Reader = br
+	head, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("failed to read gzip: %v", err)
+		}
+		defer gz.Close()
+		src = gz
+	case bytes.HasPrefix(head, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		zr, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return fmt.Errorf("failed to read zstd: %v", err)
+		}
+		defer zr.Close()
+		src = zr
+	}
+
+	tr := tar.NewReader(src)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar: %v", err)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = x.dir(hdr.Name, hdr.FileInfo().Mode())
+		case tar.TypeReg:
+			err = x.file(hdr.Name, hdr.FileInfo().Mode(), hdr.ModTime, tr)
+		case tar.TypeSymlink:
+			err = x.link(hdr.Name, hdr.Linkname, false)
+		case tar.TypeLink:
+			err = x.link(hdr.Name, hdr.Linkname, true)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to extract %s: %w", hdr.Name, err)
+		}
+	}
+}
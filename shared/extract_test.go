@@ -0,0 +1,265 @@
+package shared
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// entry 测试归档中的一个条目
+type entry struct {
+	name string
+	body string
+	link string // 符号链接或硬链接的目标
+	typ  byte   // tar 类型，0 表示普通文件
+	mode int64
+}
+
+func tarball(t *testing.T, entries ...entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Linkname: e.link, Typeflag: e.typ, Mode: e.mode}
+		if hdr.Typeflag == 0 {
+			hdr.Typeflag = tar.TypeReg
+			hdr.Size = int64(len(e.body))
+		}
+		if hdr.Mode == 0 {
+			hdr.Mode = 0644
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zipball(t *testing.T, entries ...entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		mode := os.FileMode(0644)
+		if e.link != "" {
+			mode = os.ModeSymlink | 0777
+		}
+		hdr.SetMode(mode)
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := e.body
+		if e.link != "" {
+			body = e.link
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// dests 返回解压目录与其上级目录，上级目录用于检查是否有内容写到解压目录之外
+func dests(t *testing.T) (string, string) {
+	t.Helper()
+	parent := t.TempDir()
+	return filepath.Join(parent, "out"), parent
+}
+
+func untar(t *testing.T, dest string, opts ExtractOptions, entries ...entry) error {
+	t.Helper()
+	return Untar(bytes.NewReader(tarball(t, entries...)), dest, opts)
+}
+
+func assertOnlyDest(t *testing.T, parent string) {
+	t.Helper()
+	items, err := os.ReadDir(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range items {
+		if item.Name() != "out" {
+			t.Errorf("unexpected %s outside the destination", item.Name())
+		}
+	}
+}
+
+func TestExtractRejectsPathTraversal(t *testing.T) {
+	for _, name := range []string{"../evil.txt", "/evil.txt", "a/../../evil.txt", `..\evil.txt`} {
+		dest, parent := dests(t)
+		if err := untar(t, dest, DefaultExtractOptions, entry{name: name, body: "x"}); !errors.Is(err, ErrIllegalPath) {
+			t.Errorf("tar %q: err = %v, want ErrIllegalPath", name, err)
+		}
+		assertOnlyDest(t, parent)
+
+		dest, parent = dests(t)
+		data := zipball(t, entry{name: name, body: "x"})
+		if err := UnzipReader(bytes.NewReader(data), int64(len(data)), dest, DefaultExtractOptions); !errors.Is(err, ErrIllegalPath) {
+			t.Errorf("zip %q: err = %v, want ErrIllegalPath", name, err)
+		}
+		assertOnlyDest(t, parent)
+	}
+}
+
+func TestExtractSymlinks(t *testing.T) {
+	inside := DefaultExtractOptions
+	inside.Symlinks = SymlinkInside
+	sub := entry{name: "sub/", typ: tar.TypeDir, mode: 0755}
+	file := entry{name: "sub/file.txt", body: "data"}
+	up := entry{name: "sub/up", typ: tar.TypeSymlink, link: ".."}
+
+	tests := []struct {
+		name    string
+		opts    ExtractOptions
+		entries []entry
+		wantErr error
+	}{
+		{"skip by default", DefaultExtractOptions, []entry{{name: "l", typ: tar.TypeSymlink, link: "/etc/passwd"}}, nil},
+		{"reject", ExtractOptions{Symlinks: SymlinkReject}, []entry{{name: "l", typ: tar.TypeSymlink, link: "x"}}, ErrIllegalPath},
+		{"inside", inside, []entry{sub, file, {name: "l", typ: tar.TypeSymlink, link: "sub/file.txt"}}, nil},
+		{"absolute", inside, []entry{{name: "l", typ: tar.TypeSymlink, link: "/etc/passwd"}}, ErrIllegalPath},
+		{"parent", inside, []entry{{name: "l", typ: tar.TypeSymlink, link: "../x"}}, ErrIllegalPath},
+		{"chain through earlier link", inside, []entry{sub, up, {name: "esc", typ: tar.TypeSymlink, link: "sub/up/.."}}, ErrIllegalPath},
+		{"dot-dot after a name", inside, []entry{{name: "l", typ: tar.TypeSymlink, link: "x/.."}}, ErrIllegalPath},
+		{"write through link", inside, []entry{sub, {name: "l", typ: tar.TypeSymlink, link: "sub"}, {name: "l/x.txt", body: "x"}}, ErrIllegalPath},
+		{"hard link outside", inside, []entry{{name: "h", typ: tar.TypeLink, link: "../outside.txt"}}, ErrIllegalPath},
+		{"hard link through link", inside, []entry{sub, file, up, {name: "h", typ: tar.TypeLink, link: "sub/up/sub/file.txt"}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest, parent := dests(t)
+			if err := os.WriteFile(filepath.Join(parent, "outside.txt"), []byte("secret"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			err := untar(t, dest, tt.opts, tt.entries...)
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			// 无论成功与否，解压目录中的任何路径都不应解析到外部
+			root, err := filepath.EvalSymlinks(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			filepath.Walk(dest, func(p string, _ os.FileInfo, err error) error {
+				if err != nil {
+					return nil
+				}
+				if real, err := filepath.EvalSymlinks(p); err == nil && !within(root, real) {
+					t.Errorf("%s resolves outside the destination: %s", p, real)
+				}
+				return nil
+			})
+		})
+	}
+}
+
+func TestExtractHardLinkSharesExtractedFile(t *testing.T) {
+	inside := DefaultExtractOptions
+	inside.Symlinks = SymlinkInside
+	dest, _ := dests(t)
+	err := untar(t, dest, inside,
+		entry{name: "sub/file.txt", body: "data"},
+		entry{name: "sub/up", typ: tar.TypeSymlink, link: ".."},
+		entry{name: "h", typ: tar.TypeLink, link: "sub/up/sub/file.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Lstat(filepath.Join(dest, "h"))
+	if err != nil || !info.Mode().IsRegular() {
+		t.Fatalf("hard link not created: %v", err)
+	}
+	orig, _ := os.Stat(filepath.Join(dest, "sub", "file.txt"))
+	if !os.SameFile(info, orig) {
+		t.Error("hard link does not point to the extracted file")
+	}
+}
+
+func TestExtractMasksPermissions(t *testing.T) {
+	dest, _ := dests(t)
+	err := untar(t, dest, DefaultExtractOptions,
+		entry{name: "d/", typ: tar.TypeDir, mode: 0o2777},
+		entry{name: "d/suid", body: "x", mode: 0o4777},
+		entry{name: "sticky", body: "x", mode: 0o1666})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]os.FileMode{"d": 0755, "d/suid": 0755, "sticky": 0644} {
+		info, err := os.Stat(filepath.Join(dest, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky); got != want {
+			t.Errorf("%s: mode = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestExtractLimits(t *testing.T) {
+	big := string(make([]byte, 4<<20))
+	gzipped := func(data []byte) []byte {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(data)
+		gz.Close()
+		return buf.Bytes()
+	}
+
+	t.Run("entries", func(t *testing.T) {
+		dest, _ := dests(t)
+		opts := ExtractOptions{ExtractLimits: ExtractLimits{MaxFiles: 2}}
+		err := untar(t, dest, opts, entry{name: "a", body: "1"}, entry{name: "b", body: "2"}, entry{name: "c", body: "3"})
+		if !errors.Is(err, ErrArchiveLimit) {
+			t.Errorf("err = %v, want ErrArchiveLimit", err)
+		}
+	})
+	t.Run("bytes tar", func(t *testing.T) {
+		dest, _ := dests(t)
+		opts := ExtractOptions{ExtractLimits: ExtractLimits{MaxBytes: 50}}
+		err := untar(t, dest, opts, entry{name: "a", body: string(make([]byte, 40))}, entry{name: "b", body: string(make([]byte, 40))})
+		if !errors.Is(err, ErrArchiveLimit) {
+			t.Errorf("err = %v, want ErrArchiveLimit", err)
+		}
+	})
+	t.Run("bytes zip declared size", func(t *testing.T) {
+		dest, _ := dests(t)
+		data := zipball(t, entry{name: "a", body: string(make([]byte, 100))})
+		opts := ExtractOptions{ExtractLimits: ExtractLimits{MaxBytes: 50}}
+		if err := UnzipReader(bytes.NewReader(data), int64(len(data)), dest, opts); !errors.Is(err, ErrArchiveLimit) {
+			t.Errorf("err = %v, want ErrArchiveLimit", err)
+		}
+		if _, err := os.Stat(filepath.Join(dest, "a")); !os.IsNotExist(err) {
+			t.Error("entry over the declared limit was written")
+		}
+	})
+	t.Run("ratio", func(t *testing.T) {
+		dest, _ := dests(t)
+		data := gzipped(tarball(t, entry{name: "zeros", body: big}))
+		opts := ExtractOptions{ExtractLimits: ExtractLimits{MaxRatio: 10}}
+		if err := Untar(bytes.NewReader(data), dest, opts); !errors.Is(err, ErrArchiveLimit) {
+			t.Errorf("err = %v, want ErrArchiveLimit", err)
+		}
+	})
+	t.Run("no ratio limit", func(t *testing.T) {
+		dest, _ := dests(t)
+		data := gzipped(tarball(t, entry{name: "zeros", body: big}))
+		if err := Untar(bytes.NewReader(data), dest, ExtractOptions{}); err != nil {
+			t.Errorf("err = %v", err)
+		}
+	})
+}
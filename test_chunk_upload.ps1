@@ -43,10 +43,8 @@ Write-Host ""
 
 # 3. First upload (chunk upload)
 Write-Host "3. First upload (chunk upload)..." -ForegroundColor Yellow
-Set-Location client
-go run chunk_upload.go ../$testFile
+go run ./cmd/chunkupload $testFile
 $exitCode1 = $LASTEXITCODE
-Set-Location ..
 
 if ($exitCode1 -ne 0) {
     Write-Host "  [ERROR] First upload failed" -ForegroundColor Red
@@ -61,10 +59,8 @@ Write-Host ""
 
 # 4. Second upload of same file (test quick upload)
 Write-Host "4. Second upload of same file (test quick upload)..." -ForegroundColor Yellow
-Set-Location client
-go run chunk_upload.go ../$testFile
+go run ./cmd/chunkupload $testFile
 $exitCode2 = $LASTEXITCODE
-Set-Location ..
 
 if ($exitCode2 -ne 0) {
     Write-Host "  [WARNING] Second upload failed (expected to succeed via quick upload)" -ForegroundColor Yellow
@@ -73,10 +69,8 @@ Write-Host ""
 
 # 5. Test upload to subdirectory
 Write-Host "5. Test upload to subdirectory..." -ForegroundColor Yellow
-Set-Location client
-go run chunk_upload.go ../$testFile "test/chunks"
+go run ./cmd/chunkupload $testFile "test/chunks"
 $exitCode3 = $LASTEXITCODE
-Set-Location ..
 
 if ($exitCode3 -ne 0) {
     Write-Host "  [WARNING] Subdirectory upload failed" -ForegroundColor Yellow